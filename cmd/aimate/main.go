@@ -7,6 +7,8 @@ import (
 	"github.com/hession/aimate/internal/cli"
 	"github.com/hession/aimate/internal/config"
 	"github.com/hession/aimate/internal/logger"
+	v2 "github.com/hession/aimate/internal/memory/v2"
+	"github.com/hession/aimate/internal/redact"
 	"github.com/spf13/cobra"
 )
 
@@ -44,6 +46,8 @@ It can:
 			}); err != nil {
 				return fmt.Errorf("failed to initialize logger: %w", err)
 			}
+			// Keep secrets out of logs; the memory system replaces this with its configured redactor
+			logger.SetRedactor(redact.Default())
 
 			return nil
 		},
@@ -101,8 +105,38 @@ It can:
 		},
 	}
 
+	// memory subcommand
+	memoryCmd := &cobra.Command{
+		Use:   "memory",
+		Short: "Manage the memory store",
+	}
+	memoryCmd.AddCommand(&cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt memory files and session transcripts at rest",
+		Long: `Encrypts all memory files, session transcripts and indexed message content in the
+global memory directory and the current project, then enables encryption in the memory config.
+
+The key is stored in the configured key file (default ~/.aimate/memory.key). If the
+passphrase environment variable (default AIMATE_MEMORY_PASSPHRASE) is set when the key
+file is created, the key is derived from the passphrase instead and the variable must be
+set whenever AIMate runs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateMemoryEncryption(true)
+		},
+	})
+	memoryCmd.AddCommand(&cobra.Command{
+		Use:   "decrypt",
+		Short: "Decrypt the memory store back to plaintext",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateMemoryEncryption(false)
+		},
+	})
+
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(memoryCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -113,6 +147,38 @@ It can:
 	logger.Close()
 }
 
+// migrateMemoryEncryption encrypts or decrypts the global and current project memory stores
+func migrateMemoryEncryption(encrypt bool) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	result, err := v2.EncryptMemoryStorage(cwd, encrypt)
+	if err != nil {
+		return err
+	}
+
+	action := "Encrypted"
+	if !encrypt {
+		action = "Decrypted"
+	}
+	fmt.Printf("%s %d files and %d database records (%d files already done)\n",
+		action, result.Files, result.Records, result.Unchanged)
+	if result.Renamed > 0 {
+		fmt.Printf("Renamed %d memory files from title-based to ID-based names\n", result.Renamed)
+	}
+	if encrypt {
+		for _, root := range result.HistoryRoots {
+			fmt.Printf("Warning: git history in %s still contains earlier plaintext versions and file names\n", root)
+		}
+		for _, clone := range result.SyncClones {
+			fmt.Printf("Warning: team sync clone %s and its remote stay in plaintext; team sync now requires team_sync.allow_plaintext\n", clone)
+		}
+	}
+	return nil
+}
+
 // logConfigInfo logs configuration information to log file
 func logConfigInfo(cfg *config.Config) {
 	apiKeyDisplay := "(not configured)"
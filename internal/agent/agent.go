@@ -27,6 +27,18 @@ type Agent struct {
 	maxContextMsgs  int
 	streamHandler   func(content string)
 	toolCallHandler func(name string, args map[string]any, result string, err error)
+	noticeHandler   func(notice string)
+	lastTurn        *turnInput // original text of the last user turn, for Retry
+}
+
+// turnInput is a user turn as typed and as sent to the LLM.
+// The session stores the message redacted, so Retry replays this copy instead.
+type turnInput struct {
+	sessionID    string
+	sequence     int
+	userMessage  string
+	prompt       string
+	allowedTools []string
 }
 
 // Option agent configuration option
@@ -46,6 +58,13 @@ func WithToolCallHandler(handler func(name string, args map[string]any, result s
 	}
 }
 
+// WithMemoryNoticeHandler sets the handler for memory changes the user should know about
+func WithMemoryNoticeHandler(handler func(notice string)) Option {
+	return func(a *Agent) {
+		a.noticeHandler = handler
+	}
+}
+
 // New creates a new Agent instance
 func New(cfg *config.Config, llmClient *llm.Client, memV2 *MemoryV2Integration, reg *tools.Registry, opts ...Option) (*Agent, error) {
 	// Load prompt configuration
@@ -68,6 +87,11 @@ func New(cfg *config.Config, llmClient *llm.Client, memV2 *MemoryV2Integration,
 		opt(agent)
 	}
 
+	// Let the memory system use the LLM for reranking
+	if llmClient != nil {
+		agent.memoryV2.UseLLM(llmClient)
+	}
+
 	// Load or create session (v2 handles this internally)
 	if err := agent.memoryV2.GetMemorySystem().Session().LoadLatestSession(); err != nil {
 		// If loading fails, create a new session
@@ -97,32 +121,139 @@ func (a *Agent) ClearSession() error {
 	return nil
 }
 
+// AddSessionNote records a system note in the session history
+func (a *Agent) AddSessionNote(note string) error {
+	return a.memoryV2.AddConversation("system", note, EstimateTokens(note))
+}
+
 // Chat processes user message and returns response
 func (a *Agent) Chat(ctx context.Context, userMessage string) (string, error) {
+	return a.ChatExpanded(ctx, userMessage, userMessage)
+}
+
+// ChatExpanded processes a user message whose @attachments were expanded into expanded.
+// The expanded text is saved in the session and sent to the LLM;
+// memory search and extraction only see the message as typed.
+func (a *Agent) ChatExpanded(ctx context.Context, userMessage, expanded string) (string, error) {
 	// Save user message to v2 session
+	tokenCount := EstimateTokens(expanded)
+	if err := a.memoryV2.AddConversation("user", expanded, tokenCount); err != nil {
+		return "", fmt.Errorf("failed to save user message: %w", err)
+	}
+	a.rememberTurn(userMessage, expanded, nil)
+
+	return a.respond(ctx, userMessage, expanded, true, nil)
+}
+
+// ChatWithTools processes a user message with only the given tools available.
+// An empty allowedTools list means all registered tools are available.
+func (a *Agent) ChatWithTools(ctx context.Context, userMessage string, allowedTools []string) (string, error) {
 	tokenCount := EstimateTokens(userMessage)
 	if err := a.memoryV2.AddConversation("user", userMessage, tokenCount); err != nil {
 		return "", fmt.Errorf("failed to save user message: %w", err)
 	}
+	a.rememberTurn(userMessage, userMessage, allowedTools)
+
+	return a.respond(ctx, userMessage, userMessage, true, allowedTools)
+}
+
+// Retry regenerates the response to the last user message.
+// The previous assistant reply and its tool messages are dropped from the session.
+// A turn sent in this run is replayed as originally typed; a turn loaded from an
+// earlier run only exists in the session, so it is replayed with secrets redacted.
+func (a *Agent) Retry(ctx context.Context) (string, error) {
+	session := a.memoryV2.GetMemorySystem().Session()
+	last := session.LastUserMessage()
+	if last == nil {
+		return "", fmt.Errorf("no user message to retry")
+	}
+	turn := a.retryTurn(session.GetCurrentSession().ID, last)
+
+	if err := session.TruncateMessages(last.Sequence + 1); err != nil {
+		return "", fmt.Errorf("failed to drop last response: %w", err)
+	}
+
+	// Memory extraction already ran for this message
+	return a.respond(ctx, turn.userMessage, turn.prompt, false, turn.allowedTools)
+}
+
+// rememberTurn keeps the original text of the user message just saved to the session
+func (a *Agent) rememberTurn(userMessage, prompt string, allowedTools []string) {
+	session := a.memoryV2.GetMemorySystem().Session()
+	last := session.LastUserMessage()
+	if last == nil {
+		a.lastTurn = nil
+		return
+	}
+	a.lastTurn = &turnInput{
+		sessionID:    session.GetCurrentSession().ID,
+		sequence:     last.Sequence,
+		userMessage:  userMessage,
+		prompt:       prompt,
+		allowedTools: allowedTools,
+	}
+}
+
+// retryTurn returns the input to replay for the last user message:
+// the remembered original when it is the same message, else the stored copy
+func (a *Agent) retryTurn(sessionID string, last *v2.SessionMessage) turnInput {
+	if t := a.lastTurn; t != nil && t.sessionID == sessionID && t.sequence == last.Sequence {
+		return *t
+	}
+	return turnInput{sessionID: sessionID, sequence: last.Sequence, userMessage: last.Content, prompt: last.Content}
+}
+
+// Edit replaces the last user message and everything after it, then reruns the turn.
+func (a *Agent) Edit(ctx context.Context, newMessage string) (string, error) {
+	session := a.memoryV2.GetMemorySystem().Session()
+	last := session.LastUserMessage()
+	if last == nil {
+		return "", fmt.Errorf("no user message to edit")
+	}
+
+	if err := session.TruncateMessages(last.Sequence); err != nil {
+		return "", fmt.Errorf("failed to drop last turn: %w", err)
+	}
+
+	return a.Chat(ctx, newMessage)
+}
+
+// LastUserMessage returns the content of the last user message in the session,
+// unredacted when it was sent in this run (see Retry)
+func (a *Agent) LastUserMessage() (string, bool) {
+	session := a.memoryV2.GetMemorySystem().Session()
+	last := session.LastUserMessage()
+	if last == nil {
+		return "", false
+	}
+	return a.retryTurn(session.GetCurrentSession().ID, last).prompt, true
+}
 
+// respond runs the LLM/tool loop for a user message that is already saved in the session.
+// userMessage drives memory search and extraction; prompt is what the LLM receives.
+func (a *Agent) respond(ctx context.Context, userMessage, prompt string, processMemory bool, allowedTools []string) (string, error) {
 	// Build message list
-	messages, err := a.buildMessages(userMessage)
+	messages, err := a.buildMessages(userMessage, prompt)
 	if err != nil {
 		return "", fmt.Errorf("failed to build messages: %w", err)
 	}
 
 	// Get tool schemas
+	allowed := toolFilter(allowedTools)
 	toolSchemas := a.registry.GetSchemas()
-	llmTools := make([]llm.Tool, len(toolSchemas))
-	for i, schema := range toolSchemas {
-		llmTools[i] = llm.Tool{
+	llmTools := make([]llm.Tool, 0, len(toolSchemas))
+	for _, schema := range toolSchemas {
+		if !allowed(schema.Function.Name) {
+			continue
+		}
+		llmTools = append(llmTools, llm.Tool{
 			Type: schema.Type,
 			Function: llm.ToolFunction{
 				Name:        schema.Function.Name,
 				Description: schema.Function.Description,
 				Parameters:  schema.Function.Parameters,
 			},
-		}
+		})
 	}
 
 	// Agent loop
@@ -168,7 +299,13 @@ func (a *Agent) Chat(ctx context.Context, userMessage string) (string, error) {
 
 		// Execute each tool call
 		for _, toolCall := range resp.ToolCalls {
-			result, toolErr := a.executeTool(toolCall)
+			var result string
+			var toolErr error
+			if allowed(toolCall.Function.Name) {
+				result, toolErr = a.executeTool(toolCall)
+			} else {
+				toolErr = fmt.Errorf("tool not allowed: %s", toolCall.Function.Name)
+			}
 
 			// Notify tool call status
 			if a.toolCallHandler != nil {
@@ -201,7 +338,9 @@ func (a *Agent) Chat(ctx context.Context, userMessage string) (string, error) {
 	}
 
 	// Check if we need to save long-term memory
-	a.checkAndSaveMemory(ctx, userMessage, finalResponse)
+	if processMemory {
+		a.checkAndSaveMemory(ctx, userMessage, finalResponse)
+	}
 
 	// Save assistant response (only if it's not empty)
 	if finalResponse != "" {
@@ -214,8 +353,8 @@ func (a *Agent) Chat(ctx context.Context, userMessage string) (string, error) {
 	return finalResponse, nil
 }
 
-// buildMessages builds the message list
-func (a *Agent) buildMessages(userMessage string) ([]llm.Message, error) {
+// buildMessages builds the message list, searching memories with userMessage and ending with prompt
+func (a *Agent) buildMessages(userMessage, prompt string) ([]llm.Message, error) {
 	// Get system prompt from config
 	systemPrompt := a.promptConfig.GetSystemPrompt()
 
@@ -229,7 +368,7 @@ func (a *Agent) buildMessages(userMessage string) ([]llm.Message, error) {
 		var memoryContent strings.Builder
 		memoryContent.WriteString(a.promptConfig.GetMemoryContext() + "\n")
 		for _, mem := range memories {
-			memoryContent.WriteString(fmt.Sprintf("- %s\n", mem.Content))
+			memoryContent.WriteString(fmt.Sprintf("- [%s] %s\n", mem.ID, mem.Content))
 		}
 		messages = append(messages, llm.Message{
 			Role:    "system",
@@ -249,8 +388,8 @@ func (a *Agent) buildMessages(userMessage string) ([]llm.Message, error) {
 	expectedToolCalls := map[string]bool{}
 	for i := 0; i < len(historyMsgs); i++ {
 		msg := historyMsgs[i]
-		// Skip the just-saved user message
-		if msg.Role == "user" && msg.Content == userMessage {
+		// Skip the just-saved user message (stored redacted, so it may differ from prompt)
+		if msg.Role == "user" && (msg.Content == prompt || i == len(historyMsgs)-1) {
 			continue
 		}
 
@@ -348,12 +487,25 @@ func (a *Agent) buildMessages(userMessage string) ([]llm.Message, error) {
 	// Add current user message
 	messages = append(messages, llm.Message{
 		Role:    "user",
-		Content: userMessage,
+		Content: prompt,
 	})
 
 	return messages, nil
 }
 
+// toolFilter returns a predicate reporting whether a tool may be used.
+// An empty list allows every tool.
+func toolFilter(allowedTools []string) func(name string) bool {
+	if len(allowedTools) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(allowedTools))
+	for _, name := range allowedTools {
+		set[name] = true
+	}
+	return func(name string) bool { return set[name] }
+}
+
 // executeTool executes a tool
 func (a *Agent) executeTool(toolCall llm.ToolCall) (string, error) {
 	var args map[string]any
@@ -377,7 +529,15 @@ func (a *Agent) searchRelevantMemories(ctx context.Context, userMessage string)
 // checkAndSaveMemory checks if we need to save long-term memory using v2
 func (a *Agent) checkAndSaveMemory(ctx context.Context, userMessage, response string) {
 	// Use v2 automatic classification and storage
-	_, _ = a.memoryV2.ProcessUserMessage(ctx, userMessage)
+	result, err := a.memoryV2.ProcessUserMessage(ctx, userMessage)
+	if err != nil || result == nil || a.noticeHandler == nil {
+		return
+	}
+
+	// Surface superseded or contradicting memories
+	if summary := result.Supersession.Summary(); summary != "" {
+		a.noticeHandler(summary)
+	}
 }
 
 // SessionID returns the current session ID
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"testing"
+
+	v2 "github.com/hession/aimate/internal/memory/v2"
 )
 
 func TestEstimateTokens(t *testing.T) {
@@ -94,3 +96,47 @@ func TestMaxToolIterations(t *testing.T) {
 		t.Errorf("MaxToolIterations should be 10, got %d", MaxToolIterations)
 	}
 }
+
+func TestToolFilter(t *testing.T) {
+	all := toolFilter(nil)
+	if !all("read_file") || !all("run_command") {
+		t.Error("Empty filter should allow every tool")
+	}
+
+	limited := toolFilter([]string{"read_file", "list_dir"})
+	if !limited("read_file") || !limited("list_dir") {
+		t.Error("Listed tools should be allowed")
+	}
+	if limited("run_command") {
+		t.Error("Unlisted tools should not be allowed")
+	}
+}
+
+func TestRetryTurn(t *testing.T) {
+	a := &Agent{lastTurn: &turnInput{
+		sessionID:    "sess-1",
+		sequence:     3,
+		userMessage:  "deploy with TOKEN=abcdefgh",
+		prompt:       "deploy with TOKEN=abcdefgh\n\n[attached file]",
+		allowedTools: []string{"run_command"},
+	}}
+	stored := &v2.SessionMessage{Sequence: 3, Role: "user", Content: "deploy with TOKEN=[REDACTED_SECRET_1]"}
+
+	// The remembered turn is replayed as originally typed
+	turn := a.retryTurn("sess-1", stored)
+	if turn.userMessage != "deploy with TOKEN=abcdefgh" || turn.prompt != a.lastTurn.prompt || len(turn.allowedTools) != 1 {
+		t.Errorf("Expected the original turn, got %+v", turn)
+	}
+
+	// Other messages fall back to the stored copy
+	for _, tc := range []struct {
+		sessionID string
+		sequence  int
+	}{{"sess-2", 3}, {"sess-1", 5}} {
+		msg := &v2.SessionMessage{Sequence: tc.sequence, Role: "user", Content: stored.Content}
+		turn := a.retryTurn(tc.sessionID, msg)
+		if turn.userMessage != stored.Content || turn.prompt != stored.Content || turn.allowedTools != nil {
+			t.Errorf("Expected the stored copy for %s/%d, got %+v", tc.sessionID, tc.sequence, turn)
+		}
+	}
+}
@@ -4,6 +4,7 @@ package agent
 import (
 	"context"
 
+	"github.com/hession/aimate/internal/llm"
 	v2 "github.com/hession/aimate/internal/memory/v2"
 )
 
@@ -35,6 +36,17 @@ func (m *MemoryV2Integration) SetProject(projectPath string) error {
 	return m.memSys.SetProject(projectPath)
 }
 
+// UseLLM 让记忆系统使用 LLM 完成重排序等任务
+func (m *MemoryV2Integration) UseLLM(client *llm.Client) {
+	m.memSys.SetCompleteFunc(func(ctx context.Context, prompt string) (string, error) {
+		resp, err := client.Chat(ctx, []llm.Message{{Role: "user", Content: prompt}}, nil)
+		if err != nil {
+			return "", err
+		}
+		return resp.Content, nil
+	})
+}
+
 // GetMemorySystem 获取记忆系统
 func (m *MemoryV2Integration) GetMemorySystem() *v2.MemorySystem {
 	return m.memSys
@@ -84,6 +96,31 @@ func (m *MemoryV2Integration) SearchMemories(ctx context.Context, query string,
 	return m.memSys.Search(ctx, query, topK)
 }
 
+// SaveMemory 由模型主动保存记忆
+func (m *MemoryV2Integration) SaveMemory(ctx context.Context, memType v2.MemoryType, category v2.MemoryCategory, scope v2.MemoryScope, title, content string, tags []string) (*v2.Memory, error) {
+	return m.memSys.SaveMemory(ctx, memType, category, scope, title, content, tags, "agent")
+}
+
+// SearchMemoriesDetailed 搜索记忆并返回分数
+func (m *MemoryV2Integration) SearchMemoriesDetailed(ctx context.Context, query string, topK int) ([]*v2.MemorySearchResult, error) {
+	return m.memSys.SearchDetailed(ctx, query, topK)
+}
+
+// GetMemory 按 ID 获取记忆
+func (m *MemoryV2Integration) GetMemory(id string) (*v2.Memory, error) {
+	return m.memSys.GetMemory(id)
+}
+
+// UpdateMemory 更新记忆内容
+func (m *MemoryV2Integration) UpdateMemory(ctx context.Context, id, content string, tags []string) (*v2.Memory, error) {
+	return m.memSys.UpdateMemory(ctx, id, content, tags)
+}
+
+// ForgetMemory 删除记忆
+func (m *MemoryV2Integration) ForgetMemory(id string) (*v2.Memory, error) {
+	return m.memSys.DeleteMemory(id)
+}
+
 // GetStats 获取记忆系统统计
 func (m *MemoryV2Integration) GetStats() *v2.MemorySystemStats {
 	return m.memSys.GetStats()
@@ -0,0 +1,344 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/hession/aimate/internal/config"
+	"github.com/hession/aimate/internal/tools"
+)
+
+const (
+	// maxAttachmentBytes limits the content included from a single file or URL
+	maxAttachmentBytes = 64 * 1024
+	// maxAttachmentTotalBytes limits the content included from all attachments in one message
+	maxAttachmentTotalBytes = 256 * 1024
+	// maxAttachmentDirFiles limits the number of files included from an @dir/ reference
+	maxAttachmentDirFiles = 20
+)
+
+// errBinaryAttachment is returned when an attached file is not text
+var errBinaryAttachment = errors.New("binary files cannot be attached")
+
+// attachmentRef matches @references at the start of input or after whitespace
+var attachmentRef = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// Attachment describes one @reference included in a message
+type Attachment struct {
+	Ref       string // reference as typed, without the @
+	Kind      string // "file", "dir" or "url"
+	Bytes     int    // bytes of content included
+	Files     int    // files included (dir only)
+	Truncated bool   // content was cut to fit size limits
+}
+
+// Attacher expands @file, @dir/ and @https:// references in user input
+type Attacher struct {
+	baseDir    string
+	fetch      func(url string, maxBytes int) (string, error)
+	maxBytes   int
+	totalBytes int
+}
+
+// NewAttacher creates an attacher resolving paths relative to baseDir
+func NewAttacher(baseDir string, cfg *config.Config) *Attacher {
+	fetchTool := tools.NewFetchURLTool(cfg)
+	return &Attacher{
+		baseDir:    baseDir,
+		fetch:      fetchURLContent(fetchTool),
+		maxBytes:   maxAttachmentBytes,
+		totalBytes: maxAttachmentTotalBytes,
+	}
+}
+
+// fetchURLContent adapts the fetch_url tool to return only the page content
+func fetchURLContent(tool *tools.FetchURLTool) func(string, int) (string, error) {
+	return func(rawURL string, maxBytes int) (string, error) {
+		result, err := tool.Execute(map[string]any{
+			"url":       rawURL,
+			"max_bytes": float64(maxBytes),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		var payload struct {
+			Status  int    `json:"status"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(result), &payload); err != nil {
+			return "", fmt.Errorf("failed to decode fetch result: %w", err)
+		}
+		if payload.Status >= 400 {
+			return "", fmt.Errorf("HTTP status %d", payload.Status)
+		}
+		return payload.Content, nil
+	}
+}
+
+// Expand returns the input with attachment contents appended.
+// References that do not resolve to an existing file, directory or URL are left as plain text.
+func (a *Attacher) Expand(input string) (string, []Attachment, error) {
+	matches := attachmentRef.FindAllStringSubmatch(input, -1)
+	if len(matches) == 0 {
+		return input, nil, nil
+	}
+
+	var blocks strings.Builder
+	var attachments []Attachment
+	remaining := a.totalBytes
+	seen := make(map[string]bool)
+
+	for _, m := range matches {
+		ref := strings.TrimRight(m[2], ".,;:!?)")
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		var att *Attachment
+		var err error
+		switch {
+		case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://"):
+			att, err = a.attachURL(&blocks, ref, &remaining)
+		default:
+			att, err = a.attachPath(&blocks, ref, &remaining)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to attach @%s: %w", ref, err)
+		}
+		if att != nil {
+			attachments = append(attachments, *att)
+		}
+	}
+
+	if len(attachments) == 0 {
+		return input, nil, nil
+	}
+
+	return input + "\n\n" + strings.TrimRight(blocks.String(), "\n"), attachments, nil
+}
+
+// attachURL fetches a URL and writes its content block
+func (a *Attacher) attachURL(blocks *strings.Builder, ref string, remaining *int) (*Attachment, error) {
+	limit := min(a.maxBytes, *remaining)
+	if limit <= 0 {
+		return &Attachment{Ref: ref, Kind: "url", Truncated: true}, nil
+	}
+
+	content, err := a.fetch(ref, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	content, truncated := truncateUTF8(content, limit)
+	writeAttachmentBlock(blocks, ref, content, truncated)
+	*remaining -= len(content)
+
+	return &Attachment{Ref: ref, Kind: "url", Bytes: len(content), Truncated: truncated}, nil
+}
+
+// attachPath attaches a file or the text files of a directory
+func (a *Attacher) attachPath(blocks *strings.Builder, ref string, remaining *int) (*Attachment, error) {
+	path := a.resolve(ref)
+	info, err := os.Stat(path)
+	if err != nil {
+		// Not a path (e.g. an @mention): leave as plain text
+		return nil, nil
+	}
+
+	if !info.IsDir() {
+		content, truncated, err := readAttachmentFile(path, min(a.maxBytes, *remaining))
+		if err != nil {
+			return nil, err
+		}
+		writeAttachmentBlock(blocks, ref, content, truncated)
+		*remaining -= len(content)
+		return &Attachment{Ref: ref, Kind: "file", Bytes: len(content), Truncated: truncated}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	att := &Attachment{Ref: ref, Kind: "dir"}
+	var listing []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			listing = append(listing, name+"/")
+			continue
+		}
+		listing = append(listing, name)
+
+		if att.Files >= maxAttachmentDirFiles || *remaining <= 0 {
+			att.Truncated = true
+			continue
+		}
+
+		filePath := filepath.Join(path, name)
+		content, truncated, err := readAttachmentFile(filePath, min(a.maxBytes, *remaining))
+		if err != nil {
+			// Skip unreadable or binary files
+			continue
+		}
+		writeAttachmentBlock(blocks, filepath.Join(ref, name), content, truncated)
+		*remaining -= len(content)
+		att.Bytes += len(content)
+		att.Files++
+		att.Truncated = att.Truncated || truncated
+	}
+
+	sort.Strings(listing)
+	writeAttachmentBlock(blocks, ref, strings.Join(listing, "\n"), false)
+
+	return att, nil
+}
+
+// resolve makes a reference path absolute relative to the base directory
+func (a *Attacher) resolve(ref string) string {
+	if strings.HasPrefix(ref, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ref[2:])
+		}
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(a.baseDir, ref)
+}
+
+// readAttachmentFile reads up to limit bytes of a text file
+func readAttachmentFile(path string, limit int) (string, bool, error) {
+	if limit <= 0 {
+		return "", true, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, limit+1)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", false, err
+	}
+	buf = buf[:n]
+
+	if bytes.IndexByte(buf, 0) >= 0 {
+		return "", false, errBinaryAttachment
+	}
+
+	content, truncated := truncateUTF8(string(buf), limit)
+	return content, truncated, nil
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a rune
+func truncateUTF8(s string, limit int) (string, bool) {
+	if len(s) <= limit {
+		return s, false
+	}
+	s = s[:limit]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s, true
+}
+
+// writeAttachmentBlock writes one attachment as a fenced block
+func writeAttachmentBlock(blocks *strings.Builder, ref, content string, truncated bool) {
+	fence := codeFence(content)
+	blocks.WriteString(fmt.Sprintf("### Attachment: %s\n%s\n%s\n%s\n", ref, fence, strings.TrimRight(content, "\n"), fence))
+	if truncated {
+		blocks.WriteString("(truncated to fit size limit)\n")
+	}
+	blocks.WriteString("\n")
+}
+
+// codeFence returns a backtick fence longer than any backtick run in content,
+// so attached Markdown cannot close the block early
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// FormatAttachmentNote describes included attachments for the session history
+func FormatAttachmentNote(attachments []Attachment) string {
+	parts := make([]string, 0, len(attachments))
+	for _, att := range attachments {
+		desc := fmt.Sprintf("%s (%s, %d bytes", att.Ref, att.Kind, att.Bytes)
+		if att.Kind == "dir" {
+			desc += fmt.Sprintf(", %d files", att.Files)
+		}
+		if att.Truncated {
+			desc += ", truncated"
+		}
+		parts = append(parts, desc+")")
+	}
+	return "Attachments included: " + strings.Join(parts, "; ")
+}
+
+// attachmentCompleter suggests file paths for a word starting with @
+func attachmentCompleter(word, baseDir string) []prompt.Suggest {
+	ref := strings.TrimPrefix(word, "@")
+	if strings.HasPrefix(ref, "http") {
+		return nil
+	}
+
+	dirPart, prefix := filepath.Split(ref)
+	dir := dirPart
+	if dir == "" {
+		dir = "."
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(baseDir, dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var suggestions []prompt.Suggest
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		desc := "file"
+		if entry.IsDir() {
+			name += "/"
+			desc = "directory"
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: "@" + dirPart + name, Description: desc})
+	}
+
+	return suggestions
+}
@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -79,10 +82,10 @@ func TestGetMemoryTypeIcon(t *testing.T) {
 		memType  v2.MemoryType
 		expected string
 	}{
-		{v2.MemoryTypeCore, "\xf0\x9f\x93\x8c"},      // pushpin emoji
-		{v2.MemoryTypeSession, "\xf0\x9f\x92\xac"},   // speech balloon emoji
-		{v2.MemoryTypeShortTerm, "\xf0\x9f\x93\x9d"}, // memo emoji
-		{v2.MemoryTypeLongTerm, "\xf0\x9f\x93\x9a"},  // books emoji
+		{v2.MemoryTypeCore, "\xf0\x9f\x93\x8c"},        // pushpin emoji
+		{v2.MemoryTypeSession, "\xf0\x9f\x92\xac"},     // speech balloon emoji
+		{v2.MemoryTypeShortTerm, "\xf0\x9f\x93\x9d"},   // memo emoji
+		{v2.MemoryTypeLongTerm, "\xf0\x9f\x93\x9a"},    // books emoji
 		{v2.MemoryType("unknown"), "\xf0\x9f\x93\x84"}, // page emoji for unknown
 	}
 
@@ -192,3 +195,252 @@ func TestNewMemoryV2Commands(t *testing.T) {
 		t.Error("memSys should be nil when initialized with nil")
 	}
 }
+
+func TestParseMemoryDraft(t *testing.T) {
+	tests := []struct {
+		draft   string
+		title   string
+		content string
+	}{
+		{"# Deploy steps\n\nRun make release\n", "Deploy steps", "Run make release"},
+		{"Use tabs\n", "Use tabs", "Use tabs"},
+		{"# \n\nPrefer short answers\n", "Prefer short answers", "Prefer short answers"},
+		{"# \n\n", "", ""},
+	}
+
+	for _, tt := range tests {
+		title, content := parseMemoryDraft(tt.draft)
+		if title != tt.title || content != tt.content {
+			t.Errorf("parseMemoryDraft(%q) = (%q, %q), want (%q, %q)", tt.draft, title, content, tt.title, tt.content)
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if got := editorCommand(); len(got) != 1 || got[0] != "vi" {
+		t.Errorf("Expected default editor vi, got %v", got)
+	}
+
+	t.Setenv("EDITOR", "code --wait")
+	if got := editorCommand(); len(got) != 2 || got[0] != "code" || got[1] != "--wait" {
+		t.Errorf("Expected EDITOR to be split into args, got %v", got)
+	}
+
+	t.Setenv("VISUAL", "nano")
+	if got := editorCommand(); got[0] != "nano" {
+		t.Errorf("Expected VISUAL to take priority, got %v", got)
+	}
+}
+
+func TestEditInEditor(t *testing.T) {
+	// "true" leaves the file untouched, so the original content comes back
+	t.Setenv("VISUAL", "true")
+	got, err := editInEditor("", "hello", "aimate-test-*.md")
+	if err != nil {
+		t.Fatalf("editInEditor failed: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("Expected unchanged content, got %q", got)
+	}
+
+	// Drafts go to the given directory and are removed afterwards
+	dir := t.TempDir()
+	if _, err := editInEditor(dir, "secret", "aimate-test-*.md"); err != nil {
+		t.Fatalf("editInEditor failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected draft to be removed, found %d files", len(entries))
+	}
+}
+
+func TestLoadCustomCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	globalDir := filepath.Join(tmpDir, "config", "commands")
+	projectDir := filepath.Join(tmpDir, "project", ".aimate", "commands")
+	for _, dir := range []string{globalDir, projectDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(globalDir, "review.md"):  "---\ndescription: Review a file\narguments: <file>\nallowed_tools: [read_file]\n---\nReview $ARGUMENTS carefully.\n",
+		filepath.Join(globalDir, "standup.md"): "Summarize what I did yesterday.",
+		filepath.Join(globalDir, "help.md"):    "Should be ignored because /help is built in.",
+		filepath.Join(globalDir, "broken.md"):  "---\ndescription: never closed\n",
+		filepath.Join(projectDir, "review.md"): "---\ndescription: Project review\n---\nReview $ARGUMENTS against our style guide.\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	dirs := customCommandDirs(filepath.Join(tmpDir, "config"), filepath.Join(tmpDir, "project"))
+	cmds, err := LoadCustomCommands(dirs...)
+	if err != nil {
+		t.Fatalf("LoadCustomCommands failed: %v", err)
+	}
+
+	if len(cmds) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(cmds))
+	}
+
+	review := findCustomCommand(cmds, "/review")
+	if review == nil {
+		t.Fatal("Expected /review to be loaded")
+	}
+	if review.Description != "Project review" {
+		t.Errorf("Project command should override global one, got %q", review.Description)
+	}
+	if got := review.Expand("main.go"); got != "Review main.go against our style guide." {
+		t.Errorf("Unexpected expansion: %q", got)
+	}
+
+	standup := findCustomCommand(cmds, "/standup")
+	if standup == nil {
+		t.Fatal("Expected /standup to be loaded")
+	}
+	if standup.Description != "Custom command" {
+		t.Errorf("Expected default description, got %q", standup.Description)
+	}
+	if got := standup.Expand("focus on memory work"); got != "Summarize what I did yesterday.\n\nfocus on memory work" {
+		t.Errorf("Arguments should be appended without placeholder, got %q", got)
+	}
+
+	if findCustomCommand(cmds, "/help") != nil {
+		t.Error("Built-in command names should not be overridden")
+	}
+}
+
+func TestParseCustomCommandFrontmatter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fix.md")
+	content := "---\ndescription: Fix a bug\narguments: <issue>\nallowed_tools:\n  - read_file\n  - write_file\n---\nFix $ARGUMENTS\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd, err := parseCustomCommand(path)
+	if err != nil {
+		t.Fatalf("parseCustomCommand failed: %v", err)
+	}
+	if cmd.Name != "fix" || cmd.Usage() != "/fix <issue>" {
+		t.Errorf("Unexpected name/usage: %s / %s", cmd.Name, cmd.Usage())
+	}
+	if len(cmd.AllowedTools) != 2 || cmd.AllowedTools[1] != "write_file" {
+		t.Errorf("Unexpected allowed tools: %v", cmd.AllowedTools)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.md")
+	_ = os.WriteFile(bad, []byte("---\ndescription: x\n"), 0644)
+	if _, err := parseCustomCommand(bad); err == nil {
+		t.Error("Unclosed frontmatter should return error")
+	}
+}
+
+func TestAttacherExpand(t *testing.T) {
+	baseDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(baseDir, "main.go"), []byte("package main\n"), 0644)
+	_ = os.MkdirAll(filepath.Join(baseDir, "pkg", "sub"), 0755)
+	_ = os.WriteFile(filepath.Join(baseDir, "pkg", "a.txt"), []byte("alpha"), 0644)
+	_ = os.WriteFile(filepath.Join(baseDir, "pkg", "bin.dat"), []byte{0x00, 0x01}, 0644)
+
+	a := NewAttacher(baseDir, nil)
+	var fetched string
+	a.fetch = func(url string, maxBytes int) (string, error) {
+		fetched = url
+		return "page content", nil
+	}
+
+	input := "explain @main.go and @pkg/ and @https://example.com/doc, thanks @nobody"
+	message, atts, err := a.Expand(input)
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+
+	if len(atts) != 3 {
+		t.Fatalf("Expected 3 attachments, got %d: %+v", len(atts), atts)
+	}
+	if atts[0].Kind != "file" || atts[1].Kind != "dir" || atts[2].Kind != "url" {
+		t.Errorf("Unexpected attachment kinds: %+v", atts)
+	}
+	if atts[1].Files != 1 {
+		t.Errorf("Directory should include 1 text file, got %d", atts[1].Files)
+	}
+	if fetched != "https://example.com/doc" {
+		t.Errorf("Trailing punctuation should be stripped from URL, got %s", fetched)
+	}
+
+	for _, want := range []string{input, "package main", "alpha", "sub/", "page content"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expanded message should contain %q", want)
+		}
+	}
+
+	note := FormatAttachmentNote(atts)
+	if !strings.Contains(note, "main.go (file") || !strings.Contains(note, "1 files") {
+		t.Errorf("Unexpected note: %s", note)
+	}
+
+	// Markdown fences inside an attachment must not close the block
+	_ = os.WriteFile(filepath.Join(baseDir, "README.md"), []byte("# Usage\n```go\nrun()\n```\n"), 0644)
+	message, _, _ = a.Expand("@README.md")
+	if !strings.Contains(message, "````\n# Usage\n```go\nrun()\n```\n````") {
+		t.Errorf("Attachment fence should be longer than fences in the content: %q", message)
+	}
+
+	// Plain input is returned unchanged
+	message, atts, _ = a.Expand("email me at a@b.com")
+	if message != "email me at a@b.com" || len(atts) != 0 {
+		t.Errorf("Input without attachments should be unchanged")
+	}
+}
+
+func TestAttacherLimits(t *testing.T) {
+	baseDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(baseDir, "big.txt"), []byte(strings.Repeat("x", 100)), 0644)
+	_ = os.WriteFile(filepath.Join(baseDir, "bin.dat"), []byte{0x00, 0x01}, 0644)
+
+	a := NewAttacher(baseDir, nil)
+	a.maxBytes = 40
+	a.totalBytes = 60
+
+	_, atts, err := a.Expand("@big.txt")
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if len(atts) != 1 || !atts[0].Truncated || atts[0].Bytes != 40 {
+		t.Errorf("Large file should be truncated to 40 bytes, got %+v", atts)
+	}
+
+	if _, _, err := a.Expand("@bin.dat"); err == nil {
+		t.Error("Binary file should return error")
+	}
+
+	if got, truncated := truncateUTF8("你好", 4); got != "你" || !truncated {
+		t.Errorf("truncateUTF8 should not split runes, got %q", got)
+	}
+}
+
+func TestAttachmentCompleter(t *testing.T) {
+	baseDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(baseDir, "readme.md"), []byte("x"), 0644)
+	_ = os.MkdirAll(filepath.Join(baseDir, "reports"), 0755)
+	_ = os.WriteFile(filepath.Join(baseDir, "reports", "q1.txt"), []byte("x"), 0644)
+
+	got := attachmentCompleter("@re", baseDir)
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %d", len(got))
+	}
+
+	got = attachmentCompleter("@reports/q", baseDir)
+	if len(got) != 1 || got[0].Text != "@reports/q1.txt" {
+		t.Errorf("Unexpected nested suggestion: %+v", got)
+	}
+
+	if got := attachmentCompleter("@https://", baseDir); len(got) != 0 {
+		t.Error("URLs should not be completed")
+	}
+}
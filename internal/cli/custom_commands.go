@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// argumentsPlaceholder is replaced with the text typed after a custom command
+const argumentsPlaceholder = "$ARGUMENTS"
+
+// builtinCommands are command names that custom commands cannot override
+var builtinCommands = map[string]bool{
+	"help": true, "clear": true, "retry": true, "edit": true, "new": true,
+	"config": true, "history": true, "session": true, "memory": true,
+	"exit": true, "quit": true, "q": true,
+}
+
+// CustomCommand is a user-defined slash command backed by a Markdown prompt template
+type CustomCommand struct {
+	Name         string   `yaml:"-"`
+	Description  string   `yaml:"description"`
+	Arguments    string   `yaml:"arguments"`
+	AllowedTools []string `yaml:"allowed_tools"`
+	Template     string   `yaml:"-"`
+	Path         string   `yaml:"-"`
+}
+
+// Expand substitutes $ARGUMENTS in the template.
+// If the template has no placeholder, arguments are appended after a blank line.
+func (c *CustomCommand) Expand(args string) string {
+	args = strings.TrimSpace(args)
+	if strings.Contains(c.Template, argumentsPlaceholder) {
+		return strings.ReplaceAll(c.Template, argumentsPlaceholder, args)
+	}
+	if args == "" {
+		return c.Template
+	}
+	return c.Template + "\n\n" + args
+}
+
+// Usage returns the command usage line, e.g. "/review <file>"
+func (c *CustomCommand) Usage() string {
+	if c.Arguments == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Arguments
+}
+
+// customCommandDirs returns the command directories in load order.
+// Project commands come last so they override global ones with the same name.
+func customCommandDirs(configDir, projectDir string) []string {
+	var dirs []string
+	if configDir != "" {
+		dirs = append(dirs, filepath.Join(configDir, "commands"))
+	}
+	if projectDir != "" {
+		dirs = append(dirs, filepath.Join(projectDir, ".aimate", "commands"))
+	}
+	return dirs
+}
+
+// LoadCustomCommands loads custom commands from the given directories.
+// Missing directories are skipped; later directories override earlier ones.
+// Malformed command files are skipped with a warning so one bad file does not hide the rest.
+func LoadCustomCommands(dirs ...string) ([]*CustomCommand, error) {
+	byName := make(map[string]*CustomCommand)
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read commands directory %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			cmd, err := parseCustomCommand(path)
+			if err != nil {
+				fmt.Printf("Warning: skipping custom command: %v\n", err)
+				continue
+			}
+			if builtinCommands[cmd.Name] {
+				continue
+			}
+			byName[cmd.Name] = cmd
+		}
+	}
+
+	commands := make([]*CustomCommand, 0, len(byName))
+	for _, cmd := range byName {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	return commands, nil
+}
+
+// parseCustomCommand parses a command file with optional YAML frontmatter
+func parseCustomCommand(path string) (*CustomCommand, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command file %s: %w", path, err)
+	}
+
+	cmd := &CustomCommand{
+		Name: strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".md")),
+		Path: path,
+	}
+
+	body := data
+	if bytes.HasPrefix(data, []byte("---")) {
+		rest := data[3:]
+		end := bytes.Index(rest, []byte("\n---"))
+		if end < 0 {
+			return nil, fmt.Errorf("invalid frontmatter in command file %s: missing closing ---", path)
+		}
+		if err := yaml.Unmarshal(rest[:end], cmd); err != nil {
+			return nil, fmt.Errorf("failed to parse frontmatter in command file %s: %w", path, err)
+		}
+		body = rest[end+len("\n---"):]
+	}
+
+	cmd.Template = strings.TrimSpace(string(body))
+	if cmd.Template == "" {
+		return nil, fmt.Errorf("command file %s has an empty prompt template", path)
+	}
+	if cmd.Description == "" {
+		cmd.Description = "Custom command"
+	}
+
+	return cmd, nil
+}
+
+// findCustomCommand looks up a loaded custom command by its slash name
+func findCustomCommand(commands []*CustomCommand, slashName string) *CustomCommand {
+	name := strings.TrimPrefix(strings.ToLower(slashName), "/")
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
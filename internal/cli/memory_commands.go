@@ -4,6 +4,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -75,6 +76,18 @@ func (c *MemoryV2Commands) handleSessionCommand(args []string) string {
 			return "❌ 请指定会话 ID: /session restore <session_id>"
 		}
 		return c.sessionRestore(args[1])
+	case "fork":
+		if len(args) < 2 {
+			return "❌ 请指定消息序号: /session fork <seq>"
+		}
+		return c.sessionFork(args[1])
+	case "tree":
+		return c.sessionTree()
+	case "search":
+		if len(args) < 2 {
+			return "❌ 请指定搜索内容: /session search <query>"
+		}
+		return c.sessionSearch(strings.Join(args[1:], " "))
 	default:
 		return c.sessionHelp()
 	}
@@ -153,6 +166,106 @@ func (c *MemoryV2Commands) sessionRestore(sessionID string) string {
 	return fmt.Sprintf("✅ 会话已恢复: %s", sessionID)
 }
 
+// sessionFork 从指定消息处分支当前会话
+func (c *MemoryV2Commands) sessionFork(seqArg string) string {
+	seq, err := strconv.Atoi(seqArg)
+	if err != nil || seq <= 0 {
+		return fmt.Sprintf("❌ 无效的消息序号: %s", seqArg)
+	}
+
+	parentID := ""
+	if cur := c.memSys.Session().GetCurrentSession(); cur != nil {
+		parentID = cur.ID
+	}
+
+	sess, err := c.memSys.Session().ForkSession(seq)
+	if err != nil {
+		return fmt.Sprintf("❌ 分支会话失败: %v", err)
+	}
+
+	return fmt.Sprintf("✅ 已从消息 #%d 创建分支会话\n   会话 ID: %s\n   父会话: %s\n   消息数: %d",
+		seq, sess.ID[:8], shortID(parentID), sess.MessageCount)
+}
+
+// sessionTree 以树形显示会话分支关系
+func (c *MemoryV2Commands) sessionTree() string {
+	roots, err := c.memSys.Session().BuildSessionTree()
+	if err != nil {
+		return fmt.Sprintf("❌ 获取会话树失败: %v", err)
+	}
+
+	if len(roots) == 0 {
+		return "📋 暂无会话记录"
+	}
+
+	currentID := ""
+	if cur := c.memSys.Session().GetCurrentSession(); cur != nil {
+		currentID = cur.ID
+	}
+
+	var builder strings.Builder
+	builder.WriteString("🌳 会话树\n\n")
+	for _, root := range roots {
+		writeSessionTreeNode(&builder, root, "", "", currentID)
+	}
+	builder.WriteString("\n使用 /session fork <seq> 从当前会话分支")
+
+	return builder.String()
+}
+
+// writeSessionTreeNode 递归输出会话树节点
+func writeSessionTreeNode(builder *strings.Builder, node *v2.SessionTreeNode, prefix, childPrefix, currentID string) {
+	sess := node.Session
+
+	title := sess.Title
+	if title == "" {
+		title = "(无标题)"
+	}
+
+	line := fmt.Sprintf("%s%s - %s (消息: %d, 创建: %s)",
+		prefix, sess.ID[:8], title, sess.MessageCount, sess.CreatedAt.Format("01-02 15:04"))
+	if sess.ParentID != "" {
+		line += fmt.Sprintf(" ⑂#%d", sess.ForkSequence)
+	}
+	if sess.ID == currentID {
+		line += " ← 当前"
+	}
+	builder.WriteString(line + "\n")
+
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			writeSessionTreeNode(builder, child, childPrefix+"└── ", childPrefix+"    ", currentID)
+		} else {
+			writeSessionTreeNode(builder, child, childPrefix+"├── ", childPrefix+"│   ", currentID)
+		}
+	}
+}
+
+// sessionSearch 全文搜索历史会话消息
+func (c *MemoryV2Commands) sessionSearch(query string) string {
+	hits, err := c.memSys.SearchHistory(query, 20)
+	if err != nil {
+		return fmt.Sprintf("❌ 搜索失败: %v", err)
+	}
+
+	if len(hits) == 0 {
+		return fmt.Sprintf("🔍 未找到与 \"%s\" 相关的历史消息", query)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("🔍 历史消息搜索结果 (关键词: %s)\n\n", query))
+
+	for i, hit := range hits {
+		builder.WriteString(fmt.Sprintf("%d. %s #%d %s %s\n",
+			i+1, shortID(hit.SessionID), hit.Sequence,
+			formatRoleIcon(hit.Role), hit.Timestamp.Format("2006-01-02 15:04")))
+		builder.WriteString(fmt.Sprintf("   %s\n\n", hit.Snippet))
+	}
+
+	builder.WriteString("使用 /session restore <id> 恢复会话")
+	return builder.String()
+}
+
 // sessionHelp 显示会话命令帮助
 func (c *MemoryV2Commands) sessionHelp() string {
 	return `📖 会话命令帮助
@@ -161,7 +274,10 @@ func (c *MemoryV2Commands) sessionHelp() string {
 /session                  - 显示当前会话状态
 /session status           - 显示当前会话状态
 /session list             - 列出最近会话
-/session restore <id>     - 恢复指定会话`
+/session restore <id>     - 恢复指定会话
+/session fork <seq>       - 从指定消息处分支当前会话
+/session tree             - 显示会话分支树
+/session search <query>   - 全文搜索历史会话消息`
 }
 
 // ========== 记忆管理命令 ==========
@@ -177,22 +293,100 @@ func (c *MemoryV2Commands) handleMemoryCommand(args []string) string {
 	case "stats":
 		return c.memoryStats()
 	case "search":
+		explain := len(args) > 1 && args[1] == "--explain"
+		if explain {
+			args = append(args[:1], args[2:]...)
+		}
 		if len(args) < 2 {
-			return "❌ 请指定搜索关键词: /memory search <keyword>"
+			return "❌ 请指定搜索关键词: /memory search [--explain] <keyword>"
 		}
-		return c.memorySearch(strings.Join(args[1:], " "))
+		return c.memorySearch(strings.Join(args[1:], " "), explain)
 	case "diagnose":
 		return c.memoryDiagnose()
 	case "reindex":
 		return c.memoryReindex()
+	case "reembed":
+		return c.memoryReembed()
 	case "sync":
 		return c.memorySync()
 	case "maintenance":
 		return c.memoryMaintenance()
+	case "reflect":
+		return c.memoryReflect()
+	case "review":
+		return c.memoryReview(args[1:])
 	case "core":
+		if len(args) > 1 && strings.ToLower(args[1]) == "refine" {
+			return c.memoryCoreRefine(args[2:])
+		}
 		return c.memoryCoreList()
 	case "recent":
 		return c.memoryRecent()
+	case "project":
+		return c.memoryProject(strings.Join(args[1:], " "))
+	case "add":
+		return c.memoryAdd(args[1:])
+	case "show", "edit", "pin", "unpin", "archive", "delete":
+		if len(args) < 2 {
+			return fmt.Sprintf("❌ 请指定记忆 ID: /memory %s <id>", subCmd)
+		}
+		id, err := c.memSys.ResolveMemoryID(args[1])
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+		switch subCmd {
+		case "show":
+			return c.memoryShow(id)
+		case "edit":
+			return c.memoryEdit(id)
+		case "pin", "unpin":
+			return c.memoryPin(id, subCmd == "pin")
+		case "archive":
+			return c.memoryArchive(id)
+		default:
+			return c.memoryDelete(id)
+		}
+	case "tag":
+		if len(args) < 2 {
+			return "❌ 用法: /memory tag <id> [tag ...] [-tag ...]"
+		}
+		id, err := c.memSys.ResolveMemoryID(args[1])
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+		return c.memoryTag(id, args[2:])
+	case "history":
+		if len(args) < 2 {
+			return "❌ 用法: /memory history <id>"
+		}
+		id, err := c.memSys.ResolveMemoryID(args[1])
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+		return c.memoryHistory(id)
+	case "revert":
+		if len(args) < 3 {
+			return "❌ 用法: /memory revert <id> <rev>"
+		}
+		id, err := c.memSys.ResolveMemoryID(args[1])
+		if err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
+		return c.memoryRevert(id, args[2])
+	case "team":
+		if len(args) > 1 && args[1] == "sync" {
+			return c.memoryTeamSync()
+		}
+		return c.memoryTeamStatus()
+	case "graph":
+		return c.memoryGraph(args[1:])
+	case "link":
+		return c.memoryLink(args[1:])
+	case "unlink":
+		if len(args) < 3 {
+			return "❌ 用法: /memory unlink <id> <target>"
+		}
+		return c.memoryUnlink(args[1], args[2])
 	default:
 		return c.memoryHelp()
 	}
@@ -207,6 +401,12 @@ func (c *MemoryV2Commands) memoryStats() string {
 
 	builder.WriteString("📌 核心记忆:\n")
 	builder.WriteString(fmt.Sprintf("   Token 使用: %d\n", stats.CoreTokens))
+	if stats.PendingReviews > 0 {
+		builder.WriteString(fmt.Sprintf("   待审核变更: %d（/memory review 查看）\n", stats.PendingReviews))
+	}
+	if stats.CoreNeedsRefine {
+		builder.WriteString("   接近上限，建议精炼（/memory core refine）\n")
+	}
 
 	builder.WriteString("\n💬 会话记忆:\n")
 	builder.WriteString(fmt.Sprintf("   当前消息: %d\n", stats.SessionMessages))
@@ -223,30 +423,40 @@ func (c *MemoryV2Commands) memoryStats() string {
 	builder.WriteString("\n🔍 索引统计:\n")
 	builder.WriteString(fmt.Sprintf("   索引条目: %d\n", stats.IndexedCount))
 	builder.WriteString(fmt.Sprintf("   向量条目: %d\n", stats.VectorCount))
+	if stats.VectorModel != "" {
+		builder.WriteString(fmt.Sprintf("   向量模型: %s\n", stats.VectorModel))
+	}
+	if stats.VectorNeedsReembed {
+		builder.WriteString("   ⚠️ 向量模型与当前配置不一致，请运行 /memory reembed\n")
+	}
 
 	return builder.String()
 }
 
 // memorySearch 搜索记忆
-func (c *MemoryV2Commands) memorySearch(keyword string) string {
+func (c *MemoryV2Commands) memorySearch(keyword string, explain bool) string {
 	ctx := context.Background()
-	memories, err := c.memSys.Search(ctx, keyword, 10)
+	results, err := c.memSys.SearchDetailed(ctx, keyword, 10)
 	if err != nil {
 		return fmt.Sprintf("❌ 搜索失败: %v", err)
 	}
 
-	if len(memories) == 0 {
+	if len(results) == 0 {
 		return fmt.Sprintf("🔍 未找到与 \"%s\" 相关的记忆", keyword)
 	}
 
 	var builder strings.Builder
 	builder.WriteString(fmt.Sprintf("🔍 搜索结果 (关键词: %s)\n\n", keyword))
 
-	for i, mem := range memories {
+	for i, result := range results {
+		mem := result.Memory
 		typeIcon := getMemoryTypeIcon(mem.Type)
 		builder.WriteString(fmt.Sprintf("%d. %s [%s] %s\n",
 			i+1, typeIcon, mem.Category, mem.Title))
 		builder.WriteString(fmt.Sprintf("   %s\n", truncateForDisplay(mem.Content, 100)))
+		if explain && result.Explanation != nil {
+			builder.WriteString(fmt.Sprintf("   📐 %s (%s)\n", result.Explanation, result.MatchType))
+		}
 		builder.WriteString("\n")
 	}
 
@@ -282,6 +492,19 @@ func (c *MemoryV2Commands) memoryDiagnose() string {
 	builder.WriteString(fmt.Sprintf("   短期记忆: %d (过期: %d)\n",
 		stats.ShortTermCount, stats.ShortTermExpired))
 	builder.WriteString(fmt.Sprintf("   长期记忆: %d\n", stats.LongTermCount))
+	if stats.VectorNeedsReembed {
+		builder.WriteString(fmt.Sprintf("\n🚨 向量库模型 (%s) 与当前嵌入配置不一致，向量检索已暂停，请运行 /memory reembed\n",
+			stats.VectorModel))
+	}
+
+	// 脱敏审计（本次运行）
+	if redactor := c.memSys.Redactor(); redactor == nil {
+		builder.WriteString("\n🔓 敏感信息脱敏: 未启用\n")
+	} else if total := redactor.Total(); total > 0 {
+		builder.WriteString(fmt.Sprintf("\n🔒 敏感信息脱敏: 本次运行共替换 %d 处 (%s)\n", total, redactor.Summary()))
+	} else {
+		builder.WriteString("\n🔒 敏感信息脱敏: 本次运行尚未替换内容\n")
+	}
 
 	return builder.String()
 }
@@ -301,6 +524,25 @@ func (c *MemoryV2Commands) memoryReindex() string {
 		result.Created, result.Updated, result.Errors, result.DurationMs)
 }
 
+// memoryReembed 使用当前嵌入模型重建全部向量
+func (c *MemoryV2Commands) memoryReembed() string {
+	fmt.Println("🔄 正在重建向量（完成前仍使用旧向量）...")
+	result, err := c.memSys.Reembed(context.Background(), func(done, total int) {
+		fmt.Printf("\r   进度: %d/%d", done, total)
+	})
+	fmt.Println()
+	if err != nil {
+		return fmt.Sprintf("❌ 重建向量失败，旧向量保持不变: %v", err)
+	}
+
+	return fmt.Sprintf("✅ 向量重建完成\n"+
+		"   模型: %s (%d 维)\n"+
+		"   重建: %d\n"+
+		"   跳过: %d\n"+
+		"   耗时: %dms",
+		result.Space.Model, result.Space.Dimension, result.Embedded, result.Skipped, result.DurationMs)
+}
+
 // memorySync 同步索引
 func (c *MemoryV2Commands) memorySync() string {
 	result, err := c.memSys.SyncIndex()
@@ -317,15 +559,413 @@ func (c *MemoryV2Commands) memorySync() string {
 		result.Created, result.Updated, result.Deleted, result.Skipped, result.DurationMs)
 }
 
+// memoryProject 显示或切换当前项目
+func (c *MemoryV2Commands) memoryProject(path string) string {
+	if path != "" {
+		if err := c.memSys.SetProject(path); err != nil {
+			return fmt.Sprintf("❌ 切换项目失败: %v", err)
+		}
+	}
+
+	project, root := c.memSys.GetProject()
+	if project == "" {
+		return "📁 当前未打开项目，仅使用全局记忆"
+	}
+	prefix := "📁 当前项目"
+	if path != "" {
+		prefix = "✅ 已切换到项目"
+	}
+	return fmt.Sprintf("%s: %s\n   记忆目录: %s", prefix, project, root)
+}
+
+// memoryAdd 添加记忆，未提供内容时打开编辑器
+func (c *MemoryV2Commands) memoryAdd(args []string) string {
+	if len(args) < 2 {
+		return "❌ 用法: /memory add <core|short_term|long_term> <category> [--global|--project] [内容]"
+	}
+
+	memType := parseMemoryType(args[0])
+	category := v2.MemoryCategory(strings.ToLower(args[1]))
+
+	var scope v2.MemoryScope
+	var words []string
+	for _, arg := range args[2:] {
+		switch arg {
+		case "--global":
+			scope = v2.ScopeGlobal
+		case "--project":
+			scope = v2.ScopeProject
+		default:
+			words = append(words, arg)
+		}
+	}
+
+	var title, content string
+	if len(words) > 0 {
+		content = strings.Join(words, " ")
+		title = v2.ExtractTitle(content)
+	} else {
+		dir, err := c.draftDir()
+		if err != nil {
+			return fmt.Sprintf("❌ 打开编辑器失败: %v", err)
+		}
+		draft, err := editInEditor(dir, memoryDraftTemplate, "aimate-memory-*.md")
+		if err != nil {
+			return fmt.Sprintf("❌ 打开编辑器失败: %v", err)
+		}
+		title, content = parseMemoryDraft(draft)
+		if content == "" {
+			return "🚫 内容为空，已取消"
+		}
+	}
+
+	mem, err := c.memSys.SaveMemory(context.Background(), memType, category, scope, title, content, nil, "user")
+	if err != nil {
+		return fmt.Sprintf("❌ 添加记忆失败: %v", err)
+	}
+	return fmt.Sprintf("✅ 记忆已添加\n   ID: %s\n   类型: %s/%s\n   标题: %s",
+		shortID(mem.ID), mem.Type, mem.Category, mem.Title)
+}
+
+// memoryShow 显示记忆详情
+func (c *MemoryV2Commands) memoryShow(id string) string {
+	mem, err := c.memSys.GetMemory(id)
+	if err != nil {
+		return fmt.Sprintf("❌ 读取记忆失败: %v", err)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s %s\n\n", getMemoryTypeIcon(mem.Type), mem.Title))
+	builder.WriteString(fmt.Sprintf("   ID: %s\n", mem.ID))
+	builder.WriteString(fmt.Sprintf("   类型: %s/%s (%s)\n", mem.Type, mem.Category, mem.Scope))
+	if len(mem.Tags) > 0 {
+		builder.WriteString(fmt.Sprintf("   标签: %s\n", strings.Join(mem.Tags, ", ")))
+	}
+	if mem.Pinned {
+		builder.WriteString("   📍 已固定\n")
+	}
+	builder.WriteString(fmt.Sprintf("   重要性: %d  访问次数: %d\n", mem.Importance, mem.AccessCount))
+	builder.WriteString(fmt.Sprintf("   创建: %s  更新: %s\n",
+		mem.CreatedAt.Format("2006-01-02 15:04"), mem.UpdatedAt.Format("2006-01-02 15:04")))
+	if mem.ExpiresAt != nil {
+		builder.WriteString(fmt.Sprintf("   过期: %s\n", mem.ExpiresAt.Format("2006-01-02 15:04")))
+	}
+	if mem.Source != "" {
+		builder.WriteString(fmt.Sprintf("   来源: %s\n", mem.Source))
+	}
+	for _, relatedID := range mem.Related {
+		title := "(已删除)"
+		if related, err := c.memSys.GetMemory(relatedID); err == nil {
+			title = related.Title
+		}
+		builder.WriteString(fmt.Sprintf("   关联: %s → %s %s\n", mem.RelationTo(relatedID), shortID(relatedID), title))
+	}
+	builder.WriteString(fmt.Sprintf("   文件: %s\n\n", mem.FilePath))
+	builder.WriteString(strings.TrimSpace(mem.Content))
+
+	return builder.String()
+}
+
+// draftDir 返回编辑器草稿的存放目录：启用加密时为记忆目录下的私有目录，避免明文写入共享的临时目录；否则为系统临时目录
+func (c *MemoryV2Commands) draftDir() (string, error) {
+	if !c.memSys.Encrypted() {
+		return "", nil
+	}
+	return c.memSys.EditDir()
+}
+
+// memoryEdit 在编辑器中打开记忆文件，保存后同步索引
+func (c *MemoryV2Commands) memoryEdit(id string) string {
+	mem, err := c.memSys.GetMemory(id)
+	if err != nil {
+		return fmt.Sprintf("❌ 读取记忆失败: %v", err)
+	}
+
+	// 加密的文件需解密到私有目录中的临时文件编辑，保存后重新加密写回
+	if c.memSys.Encrypted() {
+		content, err := c.memSys.ReadMemoryFile(mem.FilePath)
+		if err != nil {
+			return fmt.Sprintf("❌ 读取记忆失败: %v", err)
+		}
+		dir, err := c.draftDir()
+		if err != nil {
+			return fmt.Sprintf("❌ 打开编辑器失败: %v", err)
+		}
+		edited, err := editInEditor(dir, string(content), "aimate-memory-*.md")
+		if err != nil {
+			return fmt.Sprintf("❌ 打开编辑器失败: %v", err)
+		}
+		updated, err := c.memSys.WriteMemoryFile(context.Background(), mem.FilePath, []byte(edited))
+		if err != nil {
+			return fmt.Sprintf("❌ 保存记忆失败: %v", err)
+		}
+		return fmt.Sprintf("✅ 记忆已更新: %s", updated.Title)
+	}
+
+	if err := runEditor(mem.FilePath); err != nil {
+		return fmt.Sprintf("❌ 打开编辑器失败: %v", err)
+	}
+
+	updated, err := c.memSys.SyncMemoryFile(context.Background(), mem.FilePath)
+	if err != nil {
+		return fmt.Sprintf("❌ 同步记忆失败: %v", err)
+	}
+	return fmt.Sprintf("✅ 记忆已更新: %s", updated.Title)
+}
+
+// memoryTag 添加或移除标签（以 - 开头表示移除），不带标签时显示当前标签
+func (c *MemoryV2Commands) memoryTag(id string, args []string) string {
+	mem, err := c.memSys.GetMemory(id)
+	if err != nil {
+		return fmt.Sprintf("❌ 读取记忆失败: %v", err)
+	}
+
+	if len(args) > 0 {
+		tags := append([]string{}, mem.Tags...)
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				tags = removeTag(tags, strings.TrimPrefix(arg, "-"))
+			} else if !containsTag(tags, arg) {
+				tags = append(tags, arg)
+			}
+		}
+
+		mem, err = c.memSys.SetMemoryTags(context.Background(), id, tags)
+		if err != nil {
+			return fmt.Sprintf("❌ 更新标签失败: %v", err)
+		}
+	}
+
+	if len(mem.Tags) == 0 {
+		return fmt.Sprintf("🏷️  %s: 无标签", mem.Title)
+	}
+	return fmt.Sprintf("🏷️  %s: %s", mem.Title, strings.Join(mem.Tags, ", "))
+}
+
+// memoryPin 固定或取消固定记忆
+func (c *MemoryV2Commands) memoryPin(id string, pinned bool) string {
+	mem, err := c.memSys.PinMemory(id, pinned)
+	if err != nil {
+		return fmt.Sprintf("❌ 更新记忆失败: %v", err)
+	}
+	if pinned {
+		return fmt.Sprintf("📍 已固定: %s（不会过期、归档或被合并）", mem.Title)
+	}
+	return fmt.Sprintf("✅ 已取消固定: %s", mem.Title)
+}
+
+// memoryArchive 归档记忆
+func (c *MemoryV2Commands) memoryArchive(id string) string {
+	mem, err := c.memSys.ArchiveMemory(id)
+	if err != nil {
+		return fmt.Sprintf("❌ 归档记忆失败: %v", err)
+	}
+	return fmt.Sprintf("📦 已归档: %s", mem.Title)
+}
+
+// memoryDelete 删除记忆
+func (c *MemoryV2Commands) memoryDelete(id string) string {
+	mem, err := c.memSys.DeleteMemory(id)
+	if err != nil {
+		return fmt.Sprintf("❌ 删除记忆失败: %v", err)
+	}
+	return fmt.Sprintf("🗑️  已删除: %s", mem.Title)
+}
+
+// memoryHistory 显示记忆的版本历史
+func (c *MemoryV2Commands) memoryHistory(id string) string {
+	entries, err := c.memSys.MemoryHistory(id, 20)
+	if err != nil {
+		return fmt.Sprintf("❌ 读取记忆历史失败: %v", err)
+	}
+	if len(entries) == 0 {
+		return "📭 暂无历史版本"
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("📜 记忆历史（%d 个版本）:\n\n", len(entries)))
+	for _, entry := range entries {
+		builder.WriteString(fmt.Sprintf("   %s  %s  %s\n",
+			entry.ShortRev, entry.Date.Format("2006-01-02 15:04"), entry.Message))
+	}
+	builder.WriteString(fmt.Sprintf("\n使用 /memory revert %s <rev> 恢复到指定版本", shortID(id)))
+	return builder.String()
+}
+
+// memoryRevert 将记忆恢复到指定版本
+func (c *MemoryV2Commands) memoryRevert(id, rev string) string {
+	mem, err := c.memSys.RevertMemory(context.Background(), id, rev)
+	if err != nil {
+		return fmt.Sprintf("❌ 恢复记忆失败: %v", err)
+	}
+	return fmt.Sprintf("⏪ 已恢复到版本 %s: %s", rev, mem.Title)
+}
+
+// memoryTeamStatus 显示团队同步配置与上次同步时间
+func (c *MemoryV2Commands) memoryTeamStatus() string {
+	status, err := c.memSys.TeamSyncStatus()
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	categories := make([]string, len(status.Categories))
+	for i, category := range status.Categories {
+		categories[i] = string(category)
+	}
+	lastSync := "从未同步"
+	if !status.LastSync.IsZero() {
+		lastSync = status.LastSync.Format("2006-01-02 15:04")
+	}
+
+	var builder strings.Builder
+	builder.WriteString("👥 团队记忆同步:\n\n")
+	builder.WriteString(fmt.Sprintf("   远端: %s\n", status.Remote))
+	builder.WriteString(fmt.Sprintf("   分支: %s\n", status.Branch))
+	builder.WriteString(fmt.Sprintf("   共享分类: %s\n", strings.Join(categories, ", ")))
+	builder.WriteString(fmt.Sprintf("   上次同步: %s（共享 %d 条）\n", lastSync, status.Shared))
+	if status.Plaintext {
+		builder.WriteString(fmt.Sprintf("\n⚠️ 本地记忆已加密，但同步克隆 %s 与远端中的共享记忆为明文\n", status.Dir))
+	}
+	builder.WriteString("\n使用 /memory team sync 立即同步")
+	return builder.String()
+}
+
+// memoryTeamSync 与团队远端同步共享记忆
+func (c *MemoryV2Commands) memoryTeamSync() string {
+	result, err := c.memSys.SyncTeam(context.Background())
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	msg := fmt.Sprintf("🔄 团队同步完成: 拉取 %d，推送 %d，冲突 %d",
+		result.Imported, result.Exported, result.Conflicts)
+	if result.ArchivedLocal > 0 || result.DeletedRemote > 0 {
+		msg += fmt.Sprintf("，本地归档 %d，远端删除 %d", result.ArchivedLocal, result.DeletedRemote)
+	}
+	return msg
+}
+
+// memoryGraph 导出以某条记忆为起点的关联图（默认 Mermaid）
+func (c *MemoryV2Commands) memoryGraph(args []string) string {
+	const usage = "❌ 用法: /memory graph <id> [--dot|--mermaid] [--depth N]"
+
+	format, depth := "mermaid", 1
+	var idArg string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dot":
+			format = "dot"
+		case "--mermaid":
+			format = "mermaid"
+		case "--depth":
+			if i+1 >= len(args) {
+				return usage
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return "❌ --depth 必须为正整数"
+			}
+			depth = n
+			i++
+		default:
+			if idArg != "" {
+				return usage
+			}
+			idArg = args[i]
+		}
+	}
+	if idArg == "" {
+		return usage
+	}
+
+	id, err := c.memSys.ResolveMemoryID(idArg)
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	graph, err := c.memSys.BuildMemoryGraph(id, depth)
+	if err != nil {
+		return fmt.Sprintf("❌ 构建关联图失败: %v", err)
+	}
+
+	if format == "dot" {
+		return strings.TrimRight(graph.DOT(), "\n")
+	}
+	return strings.TrimRight(graph.Mermaid(), "\n")
+}
+
+// memoryLink 添加带类型的关联；只指定 ID 时按向量相似度给出建议
+func (c *MemoryV2Commands) memoryLink(args []string) string {
+	const usage = "❌ 用法: /memory link <id> <related|supersedes|depends-on|contradicts|example-of> <target>"
+	if len(args) != 1 && len(args) != 3 {
+		return usage
+	}
+
+	id, err := c.memSys.ResolveMemoryID(args[0])
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	if len(args) == 1 {
+		suggestions, err := c.memSys.SuggestRelations(id, 5)
+		if err != nil {
+			return fmt.Sprintf("❌ 查找相似记忆失败: %v", err)
+		}
+		if len(suggestions) == 0 {
+			return "📭 没有可建议的关联"
+		}
+		var builder strings.Builder
+		builder.WriteString("🔗 建议关联:\n\n")
+		for _, s := range suggestions {
+			builder.WriteString(fmt.Sprintf("   %s %.2f %s\n", shortID(s.Memory.ID), s.Score, s.Memory.Title))
+		}
+		builder.WriteString(fmt.Sprintf("\n使用 /memory link %s <type> <target> 添加关联", shortID(id)))
+		return builder.String()
+	}
+
+	relType, err := v2.ParseRelationType(args[1])
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	targetID, err := c.memSys.ResolveMemoryID(args[2])
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	if err := c.memSys.LinkMemories(id, targetID, relType); err != nil {
+		return fmt.Sprintf("❌ 添加关联失败: %v", err)
+	}
+	return fmt.Sprintf("🔗 已关联: %s -%s-> %s", shortID(id), relType, shortID(targetID))
+}
+
+// memoryUnlink 移除关联
+func (c *MemoryV2Commands) memoryUnlink(idArg, targetArg string) string {
+	id, err := c.memSys.ResolveMemoryID(idArg)
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	targetID, err := c.memSys.ResolveMemoryID(targetArg)
+	if err != nil {
+		// 目标已删除时仍允许按完整 ID 移除残留关联
+		targetID = targetArg
+	}
+	if err := c.memSys.UnlinkMemories(id, targetID); err != nil {
+		return fmt.Sprintf("❌ 移除关联失败: %v", err)
+	}
+	return fmt.Sprintf("✅ 已移除关联: %s → %s", shortID(id), shortID(targetID))
+}
+
 // memoryMaintenance 运行维护任务
 func (c *MemoryV2Commands) memoryMaintenance() string {
 	ctx := context.Background()
 	result := c.memSys.RunMaintenance(ctx)
+	if result.Skipped && len(result.Errors) == 0 {
+		return "⏭️  其他 AIMate 进程正在执行维护，本次已跳过"
+	}
 
 	var builder strings.Builder
 	builder.WriteString("🔧 维护任务完成\n\n")
 	builder.WriteString(fmt.Sprintf("   清理过期: %d\n", result.ExpiredCleaned))
 	builder.WriteString(fmt.Sprintf("   归档不活跃: %d\n", result.InactiveArchived))
+	builder.WriteString(fmt.Sprintf("   合并相似: %d → %d\n", result.MemoriesCompressed, result.CompressionClusters))
 	builder.WriteString(fmt.Sprintf("   提升记忆: %d\n", result.Promoted))
 	builder.WriteString(fmt.Sprintf("   同步索引: %d\n", result.IndexSynced))
 	builder.WriteString(fmt.Sprintf("   清理孤立: %d\n", result.OrphanedCleaned))
@@ -341,6 +981,101 @@ func (c *MemoryV2Commands) memoryMaintenance() string {
 	return builder.String()
 }
 
+// memoryReflect 立即执行会话反思
+func (c *MemoryV2Commands) memoryReflect() string {
+	result, err := c.memSys.Reflect(context.Background())
+	if err != nil {
+		return fmt.Sprintf("❌ 反思失败: %v", err)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("🪞 会话反思完成\n\n")
+	builder.WriteString(fmt.Sprintf("   处理会话: %d\n", result.Sessions))
+	builder.WriteString(fmt.Sprintf("   新增长期记忆: %d\n", result.LongTermAdded))
+	builder.WriteString(fmt.Sprintf("   待审核核心记忆: %d\n", result.CoreQueued))
+	builder.WriteString(fmt.Sprintf("   已存在跳过: %d", result.Skipped))
+	if result.CoreQueued > 0 {
+		builder.WriteString("\n\n使用 /memory review 审核核心记忆变更")
+	}
+	return builder.String()
+}
+
+// memoryReview 审核核心记忆变更
+func (c *MemoryV2Commands) memoryReview(args []string) string {
+	queue := c.memSys.ReviewQueue()
+
+	if len(args) == 0 {
+		items, err := queue.List()
+		if err != nil {
+			return fmt.Sprintf("❌ 读取审核队列失败: %v", err)
+		}
+		if len(items) == 0 {
+			return "✅ 没有待审核的核心记忆变更"
+		}
+
+		var builder strings.Builder
+		builder.WriteString(fmt.Sprintf("📋 待审核的核心记忆变更 (%d)\n\n", len(items)))
+		for _, item := range items {
+			action := "新增"
+			if item.Action == v2.ReviewUpdate {
+				action = "更新"
+			}
+			builder.WriteString(fmt.Sprintf("%s [%s] %s · %s\n", shortID(item.ID), action, item.Category, item.Title))
+			builder.WriteString(fmt.Sprintf("   %s\n", truncateForDisplay(item.Content, 200)))
+			if item.Source != "" {
+				builder.WriteString(fmt.Sprintf("   来源: %s\n", item.Source))
+			}
+			builder.WriteString("\n")
+		}
+		builder.WriteString("使用 /memory review approve <id|all> 或 /memory review reject <id|all>")
+		return builder.String()
+	}
+
+	if len(args) < 2 {
+		return "❌ 用法: /memory review [approve|reject] <id|all>"
+	}
+
+	ids := []string{args[1]}
+	if args[1] == "all" {
+		items, err := queue.List()
+		if err != nil {
+			return fmt.Sprintf("❌ 读取审核队列失败: %v", err)
+		}
+		ids = ids[:0]
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	var builder strings.Builder
+	switch strings.ToLower(args[0]) {
+	case "approve":
+		for _, id := range ids {
+			mem, err := queue.Approve(id)
+			if err != nil {
+				builder.WriteString(fmt.Sprintf("❌ %s: %v\n", shortID(id), err))
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("✅ 已写入核心记忆: %s\n", mem.Title))
+		}
+	case "reject":
+		for _, id := range ids {
+			if err := queue.Reject(id); err != nil {
+				builder.WriteString(fmt.Sprintf("❌ %s: %v\n", shortID(id), err))
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("🗑️ 已拒绝: %s\n", shortID(id)))
+		}
+	default:
+		return "❌ 用法: /memory review [approve|reject] <id|all>"
+	}
+
+	if builder.Len() == 0 {
+		return "✅ 没有待审核的核心记忆变更"
+	}
+	return strings.TrimRight(builder.String(), "\n")
+}
+
 // memoryCoreList 列出核心记忆
 func (c *MemoryV2Commands) memoryCoreList() string {
 	memories, err := c.memSys.Core().LoadAll()
@@ -362,9 +1097,51 @@ func (c *MemoryV2Commands) memoryCoreList() string {
 			truncateForDisplay(mem.Content, 80)))
 	}
 
+	if needsRefine, _ := c.memSys.Core().NeedsRefine(); needsRefine {
+		builder.WriteString("⚠️  核心记忆接近上限，可运行 /memory core refine 精炼")
+	}
+
 	return builder.String()
 }
 
+// memoryCoreRefine 生成、应用或放弃核心记忆精炼方案
+func (c *MemoryV2Commands) memoryCoreRefine(args []string) string {
+	if len(args) == 0 {
+		plan, err := c.memSys.ProposeCoreRefine(context.Background())
+		if err != nil {
+			return fmt.Sprintf("❌ 精炼核心记忆失败: %v", err)
+		}
+		return fmt.Sprintf("🧹 %s\n\n使用 /memory core refine apply 应用，或 /memory core refine discard 放弃", plan.Diff())
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "show":
+		plan := c.memSys.PendingCoreRefine()
+		if plan == nil {
+			return "✅ 没有待确认的精炼方案"
+		}
+		return fmt.Sprintf("🧹 %s\n\n使用 /memory core refine apply 应用，或 /memory core refine discard 放弃", plan.Diff())
+	case "apply":
+		result, err := c.memSys.ApplyCoreRefine()
+		if err != nil {
+			return fmt.Sprintf("❌ 应用精炼方案失败: %v", err)
+		}
+		msg := fmt.Sprintf("✅ 核心记忆已精炼\n   新建: %d\n   归档: %d\n   未变化: %d",
+			result.Created, result.Archived, result.Unchanged)
+		if result.ArchiveDir != "" {
+			msg += fmt.Sprintf("\n   旧版本: %s", result.ArchiveDir)
+		}
+		return msg
+	case "discard":
+		if !c.memSys.DiscardCoreRefine() {
+			return "✅ 没有待确认的精炼方案"
+		}
+		return "🗑️  已放弃精炼方案"
+	default:
+		return "❌ 用法: /memory core refine [show|apply|discard]"
+	}
+}
+
 // memoryRecent 显示最近记忆
 func (c *MemoryV2Commands) memoryRecent() string {
 	memories, err := c.memSys.ShortTerm().LoadRecent(7)
@@ -406,16 +1183,90 @@ func (c *MemoryV2Commands) memoryHelp() string {
 /memory                   - 显示记忆系统统计
 /memory stats             - 显示记忆系统统计
 /memory search <keyword>  - 搜索记忆
+/memory search --explain <keyword> - 搜索并显示每条结果的得分说明
 /memory core              - 列出核心记忆
+/memory add <type> <category> [--global|--project] [内容] - 添加记忆（未提供内容时打开编辑器）
+/memory show <id>         - 显示记忆详情（ID 支持前缀）
+/memory edit <id>         - 在 $EDITOR 中编辑记忆文件并同步索引
+/memory tag <id> [tag ...] [-tag ...] - 添加或移除标签
+/memory pin|unpin <id>    - 固定记忆（不会过期、归档或被合并）或取消固定
+/memory archive <id>      - 归档记忆
+/memory delete <id>       - 删除记忆
+/memory history <id>      - 显示记忆的版本历史（需启用 storage.git_history）
+/memory revert <id> <rev> - 将记忆恢复到指定版本
+/memory team              - 显示团队同步状态（需在项目配置中设置 team_sync.remote）
+/memory team sync         - 与团队远端同步共享的项目与决策记忆
+/memory link <id>         - 按相似度列出建议关联
+/memory link <id> <type> <target> - 添加关联（related/supersedes/depends-on/contradicts/example-of）
+/memory unlink <id> <target> - 移除关联
+/memory graph <id> [--dot|--mermaid] [--depth N] - 导出关联图（默认 Mermaid）
+/memory core refine       - 由 LLM 精炼核心记忆并显示差异
+/memory core refine apply|discard - 应用或放弃精炼方案（旧版本保存在归档目录）
 /memory recent            - 显示最近短期记忆
+/memory project [path]    - 显示或切换当前项目（切换后使用该项目的索引）
 /memory diagnose          - 诊断记忆系统
 /memory sync              - 同步索引
 /memory reindex           - 重建索引
-/memory maintenance       - 运行维护任务`
+/memory reembed           - 使用当前嵌入模型重建全部向量
+/memory maintenance       - 运行维护任务
+/memory reflect           - 立即从近期会话中提炼长期记忆
+/memory review            - 查看待审核的核心记忆变更
+/memory review approve <id|all> - 批准变更并写入核心记忆
+/memory review reject <id|all>  - 拒绝变更`
 }
 
 // ========== 工具函数 ==========
 
+// memoryDraftTemplate 新建记忆时编辑器中的模板
+const memoryDraftTemplate = "# \n\n"
+
+// parseMemoryDraft 解析编辑器中填写的记忆：第一行非空行为标题，其余为内容（只有一行时同时作为内容）
+func parseMemoryDraft(draft string) (string, string) {
+	lines := strings.Split(strings.TrimSpace(draft), "\n")
+	title := strings.TrimSpace(strings.TrimLeft(lines[0], "# "))
+	content := strings.TrimSpace(strings.Join(lines[1:], "\n"))
+	if content == "" {
+		content = title
+	}
+	if title == "" && content != "" {
+		title = v2.ExtractTitle(content)
+	}
+	return title, content
+}
+
+// parseMemoryType 解析记忆类型（支持 short / long 简写）
+func parseMemoryType(name string) v2.MemoryType {
+	switch strings.ToLower(name) {
+	case "short", "short-term":
+		return v2.MemoryTypeShortTerm
+	case "long", "long-term":
+		return v2.MemoryTypeLongTerm
+	default:
+		return v2.MemoryType(strings.ToLower(name))
+	}
+}
+
+// containsTag 判断标签是否已存在
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTag 移除标签
+func removeTag(tags []string, tag string) []string {
+	result := tags[:0]
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
 // getMemoryTypeIcon 获取记忆类型图标
 func getMemoryTypeIcon(memType v2.MemoryType) string {
 	switch memType {
@@ -445,6 +1296,30 @@ func truncateForDisplay(text string, maxLen int) string {
 	return text[:maxLen] + "..."
 }
 
+// formatRoleIcon 获取消息角色图标
+func formatRoleIcon(role string) string {
+	switch role {
+	case "user":
+		return "👤"
+	case "assistant":
+		return "🤖"
+	case "system":
+		return "⚙️"
+	case "tool":
+		return "🔧"
+	default:
+		return role
+	}
+}
+
+// shortID 截取 ID 前 8 位用于显示
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
 // GetCommandSuggestions 获取命令建议（用于自动补全）
 func GetMemoryV2CommandSuggestions() []CommandSuggestion {
 	return []CommandSuggestion{
@@ -452,15 +1327,35 @@ func GetMemoryV2CommandSuggestions() []CommandSuggestion {
 		{Text: "/session", Description: "显示会话状态"},
 		{Text: "/session list", Description: "列出最近会话"},
 		{Text: "/session restore", Description: "恢复指定会话"},
+		{Text: "/session fork", Description: "从指定消息处分支会话"},
+		{Text: "/session tree", Description: "显示会话分支树"},
+		{Text: "/session search", Description: "搜索历史会话消息"},
 		{Text: "/memory", Description: "显示记忆统计"},
 		{Text: "/memory stats", Description: "显示记忆统计"},
 		{Text: "/memory search", Description: "搜索记忆"},
 		{Text: "/memory core", Description: "列出核心记忆"},
 		{Text: "/memory recent", Description: "显示最近记忆"},
+		{Text: "/memory add", Description: "添加记忆"},
+		{Text: "/memory show", Description: "显示记忆详情"},
+		{Text: "/memory edit", Description: "在编辑器中编辑记忆"},
+		{Text: "/memory tag", Description: "添加或移除标签"},
+		{Text: "/memory pin", Description: "固定记忆"},
+		{Text: "/memory unpin", Description: "取消固定记忆"},
+		{Text: "/memory archive", Description: "归档记忆"},
+		{Text: "/memory delete", Description: "删除记忆"},
+		{Text: "/memory history", Description: "显示记忆版本历史"},
+		{Text: "/memory revert", Description: "恢复记忆到指定版本"},
+		{Text: "/memory team", Description: "显示团队同步状态"},
+		{Text: "/memory team sync", Description: "同步团队共享记忆"},
+		{Text: "/memory link", Description: "添加记忆关联"},
+		{Text: "/memory unlink", Description: "移除记忆关联"},
+		{Text: "/memory graph", Description: "导出记忆关联图"},
 		{Text: "/memory diagnose", Description: "诊断记忆系统"},
 		{Text: "/memory sync", Description: "同步索引"},
 		{Text: "/memory reindex", Description: "重建索引"},
 		{Text: "/memory maintenance", Description: "运行维护任务"},
+		{Text: "/memory reflect", Description: "从近期会话中提炼记忆"},
+		{Text: "/memory review", Description: "审核核心记忆变更"},
 	}
 }
 
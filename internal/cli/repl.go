@@ -20,6 +20,13 @@ const (
 	Version = "0.1.0"
 )
 
+var (
+	// customCommands holds user-defined slash commands loaded at startup
+	customCommands []*CustomCommand
+	// attacher expands @file, @dir/ and @url references in user input
+	attacher *Attacher
+)
+
 // Run starts the CLI interactive interface
 func Run(cfg *config.Config) error {
 	// Display welcome message
@@ -53,14 +60,27 @@ func Run(cfg *config.Config) error {
 		fmt.Printf("Warning: failed to set project path: %v\n", err)
 	}
 
+	// Load user-defined slash commands
+	cmds, err := LoadCustomCommands(customCommandDirs(config.GetConfigDir(), cwd)...)
+	if err != nil {
+		fmt.Printf("Warning: failed to load custom commands: %v\n", err)
+	}
+	customCommands = cmds
+	attacher = NewAttacher(cwd, cfg)
+
 	// Create tool registry
 	registry := tools.NewDefaultRegistry(confirmDangerousOp, cfg)
+	_ = registry.Register(tools.NewSearchHistoryTool(memV2.GetMemorySystem()))
+	for _, tool := range tools.NewMemoryTools(memV2, confirmDangerousOp) {
+		_ = registry.Register(tool)
+	}
 
 	// Create Agent
 	ag, err := agent.New(
 		cfg, llmClient, memV2, registry,
 		agent.WithStreamHandler(streamOutput),
 		agent.WithToolCallHandler(toolCallOutput),
+		agent.WithMemoryNoticeHandler(memoryNoticeOutput),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to initialize Agent: %w", err)
@@ -102,6 +122,12 @@ func RunPrompt(cfg *config.Config, promptText string) error {
 	registry := tools.NewDefaultRegistry(func(string) bool {
 		return false
 	}, cfg)
+	_ = registry.Register(tools.NewSearchHistoryTool(memV2.GetMemorySystem()))
+	for _, tool := range tools.NewMemoryTools(memV2, func(string) bool {
+		return false
+	}) {
+		_ = registry.Register(tool)
+	}
 
 	// Create Agent
 	ag, err := agent.New(
@@ -112,7 +138,14 @@ func RunPrompt(cfg *config.Config, promptText string) error {
 		return fmt.Errorf("failed to initialize Agent: %w", err)
 	}
 
-	if _, err := ag.Chat(context.Background(), promptText); err != nil {
+	cwd, _ := os.Getwd()
+	attacher = NewAttacher(cwd, cfg)
+	message, err := expandInput(ag, promptText)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ag.ChatExpanded(context.Background(), promptText, message); err != nil {
 		return err
 	}
 
@@ -171,24 +204,58 @@ func emptyCompleter(d prompt.Document) []prompt.Suggest {
 
 // commandCompleter provides auto-completion for built-in commands
 func commandCompleter(d prompt.Document) []prompt.Suggest {
+	word := d.GetWordBeforeCursor()
+	if strings.HasPrefix(word, "@") {
+		baseDir := "."
+		if attacher != nil {
+			baseDir = attacher.baseDir
+		}
+		return attachmentCompleter(word, baseDir)
+	}
+
 	s := []prompt.Suggest{
 		{Text: "/help", Description: "Show help message"},
 		{Text: "/clear", Description: "Clear current session history"},
+		{Text: "/retry", Description: "Regenerate the last response"},
+		{Text: "/edit", Description: "Edit the last message in $EDITOR and rerun"},
 		{Text: "/new", Description: "Create new session"},
 		{Text: "/config", Description: "Show current configuration"},
 		{Text: "/history", Description: "Show history usage tips"},
 		{Text: "/session", Description: "Show session status"},
 		{Text: "/session list", Description: "List recent sessions"},
 		{Text: "/session restore", Description: "Restore a session"},
+		{Text: "/session fork", Description: "Fork session at a message"},
+		{Text: "/session tree", Description: "Show session fork tree"},
+		{Text: "/session search", Description: "Search past session messages"},
 		{Text: "/memory", Description: "Show memory statistics"},
 		{Text: "/memory search", Description: "Search memories"},
 		{Text: "/memory core", Description: "List core memories"},
+		{Text: "/memory core refine", Description: "Consolidate core memories"},
 		{Text: "/memory recent", Description: "Show recent memories"},
+		{Text: "/memory project", Description: "Show or switch the current project"},
+		{Text: "/memory add", Description: "Add a memory"},
+		{Text: "/memory show", Description: "Show a memory"},
+		{Text: "/memory edit", Description: "Edit a memory in $EDITOR"},
+		{Text: "/memory tag", Description: "Add or remove memory tags"},
+		{Text: "/memory pin", Description: "Pin a memory"},
+		{Text: "/memory archive", Description: "Archive a memory"},
+		{Text: "/memory delete", Description: "Delete a memory"},
+		{Text: "/memory history", Description: "Show a memory's version history"},
+		{Text: "/memory revert", Description: "Revert a memory to an earlier version"},
+		{Text: "/memory team", Description: "Show team sync status"},
+		{Text: "/memory team sync", Description: "Sync shared memories with the team remote"},
+		{Text: "/memory link", Description: "Link two memories"},
+		{Text: "/memory unlink", Description: "Remove a memory link"},
+		{Text: "/memory graph", Description: "Export a memory's relation graph"},
 		{Text: "/memory diagnose", Description: "Diagnose memory system"},
+		{Text: "/memory review", Description: "Review pending core memory changes"},
 		{Text: "/exit", Description: "Exit program"},
 		{Text: "/quit", Description: "Exit program (alias)"},
 	}
-	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
+	for _, cmd := range customCommands {
+		s = append(s, prompt.Suggest{Text: "/" + cmd.Name, Description: cmd.Description})
+	}
+	return prompt.FilterHasPrefix(s, word, true)
 }
 
 // runREPL runs the interactive REPL with go-prompt support
@@ -277,7 +344,7 @@ func runREPL(ag *agent.Agent, cfg *config.Config) error {
 
 		// Handle built-in commands
 		if strings.HasPrefix(input, "/") {
-			if handleCommand(input, ag) {
+			if handleCommand(ctx, input, ag) {
 				continue
 			}
 			return nil // /exit command
@@ -292,10 +359,16 @@ func runREPL(ag *agent.Agent, cfg *config.Config) error {
 
 // processInput processes user input and calls agent
 func processInput(ctx context.Context, ag *agent.Agent, input string) error {
+	message, err := expandInput(ag, input)
+	if err != nil {
+		fmt.Printf("❌ %v\n\n", err)
+		return nil
+	}
+
 	// Call Agent to process
 	fmt.Printf("\nAIMate: ")
 
-	_, err := ag.Chat(ctx, input)
+	_, err = ag.ChatExpanded(ctx, input, message)
 	if err != nil {
 		fmt.Printf("\n❌ Error: %v\n", err)
 	}
@@ -305,8 +378,32 @@ func processInput(ctx context.Context, ag *agent.Agent, input string) error {
 	return nil
 }
 
+// expandInput expands @attachments and records which ones were included.
+// The expanded text is meant for the LLM only; memory processing should see the input as typed.
+func expandInput(ag *agent.Agent, input string) (string, error) {
+	if attacher == nil {
+		return input, nil
+	}
+
+	message, attachments, err := attacher.Expand(input)
+	if err != nil {
+		return "", err
+	}
+	if len(attachments) == 0 {
+		return input, nil
+	}
+
+	note := FormatAttachmentNote(attachments)
+	fmt.Printf("📎 %s\n", note)
+	if err := ag.AddSessionNote(note); err != nil {
+		return "", fmt.Errorf("failed to record attachments: %w", err)
+	}
+
+	return message, nil
+}
+
 // handleCommand handles built-in commands, returns true to continue loop, false to exit
-func handleCommand(cmd string, ag *agent.Agent) bool {
+func handleCommand(ctx context.Context, cmd string, ag *agent.Agent) bool {
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
 		return true
@@ -338,6 +435,39 @@ func handleCommand(cmd string, ag *agent.Agent) bool {
 		}
 		return true
 
+	case "/retry":
+		fmt.Printf("\nAIMate: ")
+		if _, err := ag.Retry(ctx); err != nil {
+			fmt.Printf("\n❌ Failed to retry: %v\n", err)
+		}
+		fmt.Println()
+		fmt.Println()
+		return true
+
+	case "/edit":
+		last, ok := ag.LastUserMessage()
+		if !ok {
+			fmt.Printf("❌ No user message to edit\n")
+			return true
+		}
+		edited, err := editInEditor("", last, "aimate-edit-*.md")
+		if err != nil {
+			fmt.Printf("❌ Failed to edit message: %v\n", err)
+			return true
+		}
+		edited = strings.TrimSpace(edited)
+		if edited == "" {
+			fmt.Printf("Edit cancelled: message is empty\n")
+			return true
+		}
+		fmt.Printf("\nAIMate: ")
+		if _, err := ag.Edit(ctx, edited); err != nil {
+			fmt.Printf("\n❌ Error: %v\n", err)
+		}
+		fmt.Println()
+		fmt.Println()
+		return true
+
 	case "/exit", "/quit", "/q":
 		fmt.Printf("Goodbye! 👋\n")
 		return false
@@ -369,6 +499,16 @@ func handleCommand(cmd string, ag *agent.Agent) bool {
 		return true
 
 	default:
+		if custom := findCustomCommand(customCommands, command); custom != nil {
+			args := strings.TrimSpace(strings.TrimPrefix(cmd, parts[0]))
+			fmt.Printf("\nAIMate: ")
+			if _, err := ag.ChatWithTools(ctx, custom.Expand(args), custom.AllowedTools); err != nil {
+				fmt.Printf("\n❌ Error: %v\n", err)
+			}
+			fmt.Println()
+			fmt.Println()
+			return true
+		}
 		fmt.Printf("❓ Unknown command: %s\n", cmd)
 		fmt.Println("Type /help for available commands")
 		return true
@@ -383,6 +523,8 @@ func printHelp() {
 Built-in Commands:
   /help           - Show this help message
   /clear          - Clear current session history
+  /retry          - Regenerate the last response
+  /edit           - Edit the last message in $EDITOR and rerun
   /new            - Create new session
   /config         - Show current configuration
   /history        - Show history usage tips
@@ -393,16 +535,39 @@ Session Commands:
   /session        - Show current session status
   /session list   - List recent sessions
   /session restore <id> - Restore a session
+  /session fork <seq> - Fork current session at message <seq>
+  /session tree   - Show session fork tree
+  /session search <query> - Search past session messages
 
 Memory Commands:
   /memory         - Show memory statistics
-  /memory search <keyword> - Search memories
+  /memory search [--explain] <keyword> - Search memories (--explain shows score breakdown)
   /memory core    - List core memories
+  /memory core refine [apply|discard] - Consolidate core memories with the LLM and review the diff
   /memory recent  - Show recent short-term memories
+  /memory project [path] - Show or switch the current project
+  /memory add <type> <category> [--global|--project] [text] - Add a memory (opens $EDITOR without text)
+  /memory show <id> - Show a memory (IDs may be abbreviated)
+  /memory edit <id> - Edit a memory file in $EDITOR and re-index it
+  /memory tag <id> [tag ...] [-tag ...] - Add or remove tags
+  /memory pin|unpin <id> - Exempt a memory from expiry, archiving and merging
+  /memory archive <id> - Move a memory to the archive
+  /memory delete <id> - Delete a memory
+  /memory history <id> - Show version history (requires storage.git_history)
+  /memory revert <id> <rev> - Revert a memory to an earlier version
+  /memory team - Show team sync status (requires team_sync.remote)
+  /memory team sync - Sync shared project/decision memories with the team remote
+  /memory link <id> [<type> <target>] - Suggest links, or link with related/supersedes/depends-on/contradicts/example-of
+  /memory unlink <id> <target> - Remove a link
+  /memory graph <id> [--dot|--mermaid] [--depth N] - Export the relation graph
   /memory diagnose - Diagnose memory system
   /memory sync    - Sync index
   /memory reindex - Rebuild index
+  /memory reembed - Re-embed all memories with the configured model
   /memory maintenance - Run maintenance tasks
+  /memory reflect - Distill recent sessions into long-term memories
+  /memory review  - List pending core memory changes
+  /memory review approve|reject <id|all> - Apply or discard pending changes
 
 Input Tips:
   • Use Backspace to delete characters
@@ -416,6 +581,7 @@ Input Tips:
   • End line with \\ for multi-line input
   • Press Enter twice to submit in multi-line mode
   • Press Ctrl+C to cancel current input
+  • Use @path/to/file, @dir/ or @https://... to attach content (Tab completes paths)
 
 Available Tools:
   • read_file    - Read file content
@@ -425,6 +591,11 @@ Available Tools:
   • search_files - Search file content
   • search_web   - Search the web for fresh information
   • fetch_url    - Fetch a URL for readable content
+  • search_history - Search messages from past sessions
+  • memory_save  - Save a memory (type/category/scope/tags)
+  • memory_search - Search memories and cite their IDs
+  • memory_update - Update an outdated memory (requires confirmation)
+  • memory_forget - Delete a memory (requires confirmation)
 
 Examples:
   "Show me the files in current directory"
@@ -433,6 +604,14 @@ Examples:
   "Create a file hello.txt with content Hello World"
 
 `)
+
+	if len(customCommands) > 0 {
+		fmt.Println("Custom Commands:")
+		for _, cmd := range customCommands {
+			fmt.Printf("  %-15s - %s\n", cmd.Usage(), cmd.Description)
+		}
+		fmt.Println()
+	}
 }
 
 // streamOutput handles stream output
@@ -440,6 +619,11 @@ func streamOutput(content string) {
 	fmt.Print(content)
 }
 
+// memoryNoticeOutput shows memory changes made while storing the user's message
+func memoryNoticeOutput(notice string) {
+	fmt.Printf("\n%s\n", notice)
+}
+
 // toolCallOutput handles tool call output
 func toolCallOutput(name string, args map[string]any, result string, err error) {
 	fmt.Printf("\n\n🔧 Calling tool: %s\n", name)
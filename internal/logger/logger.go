@@ -44,7 +44,13 @@ type Logger struct {
 	maxDays     int
 	currentFile *os.File
 	currentDate string
-	consoleOut  bool // Whether to output to console
+	consoleOut  bool     // Whether to output to console
+	redactor    Redactor // Optional filter applied to every message
+}
+
+// Redactor removes secrets from log messages before they are written
+type Redactor interface {
+	Redact(text string) string
 }
 
 var (
@@ -160,6 +166,9 @@ func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	message := fmt.Sprintf(format, args...)
+	if l.redactor != nil {
+		message = l.redactor.Redact(message)
+	}
 	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level.String(), message)
 
 	// Write to file
@@ -193,6 +202,13 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	l.log(ERROR, format, args...)
 }
 
+// SetRedactor sets the filter applied to every message (nil disables it)
+func (l *Logger) SetRedactor(r Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
 // Close closes the logger
 func (l *Logger) Close() error {
 	l.mu.Lock()
@@ -252,6 +268,13 @@ func Error(format string, args ...interface{}) {
 	}
 }
 
+// SetRedactor sets the message filter of the default logger
+func SetRedactor(r Redactor) {
+	if defaultLogger != nil {
+		defaultLogger.SetRedactor(r)
+	}
+}
+
 // Close closes the default logger
 func Close() error {
 	if defaultLogger != nil {
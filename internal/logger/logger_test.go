@@ -162,6 +162,45 @@ func TestLogger_LogLevels(t *testing.T) {
 	}
 }
 
+// replaceRedactor replaces a fixed secret for testing
+type replaceRedactor struct{ secret string }
+
+func (r replaceRedactor) Redact(text string) string {
+	return strings.ReplaceAll(text, r.secret, "[REDACTED]")
+}
+
+func TestLogger_SetRedactor(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "aimate-logger-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logger, err := NewLogger(Config{LogDir: tmpDir, Level: INFO})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.SetRedactor(replaceRedactor{secret: "sk-secret"})
+	logger.Info("calling API with key %s", "sk-secret")
+	logger.GetWriter(WARN).Write([]byte("writer sk-secret\n"))
+	logger.Close()
+
+	today := time.Now().Format("2006-01-02")
+	content, err := os.ReadFile(filepath.Join(tmpDir, "aimate-"+today+".log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	logContent := string(content)
+	if strings.Contains(logContent, "sk-secret") {
+		t.Errorf("Log should not contain the secret: %s", logContent)
+	}
+	if !strings.Contains(logContent, "calling API with key [REDACTED]") {
+		t.Error("Log should contain the redacted message")
+	}
+}
+
 func TestLogger_LevelFiltering(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "aimate-logger-test")
 	if err != nil {
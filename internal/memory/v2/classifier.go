@@ -48,8 +48,14 @@ type ClassificationResult struct {
 	// 提取的标签
 	Tags []string `json:"tags,omitempty"`
 
+	// 推荐的重要性 (1-5)
+	Importance int `json:"importance,omitempty"`
+
 	// 分类原因
 	Reason string `json:"reason"`
+
+	// 存储后检测到的取代与矛盾（仅长期记忆）
+	Supersession *SupersessionResult `json:"supersession,omitempty"`
 }
 
 // NewMemoryClassifier 创建记忆分类器
@@ -0,0 +1,196 @@
+// Package v2 提供可插拔的记忆分类器：正则分类器、LLM 分类器与影子对比模式
+package v2
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hession/aimate/internal/logger"
+)
+
+// 分类器模式
+const (
+	ClassifierRegex = "regex" // 基于正则规则
+	ClassifierLLM   = "llm"   // 基于 LLM 的结构化分类
+)
+
+// Classifier 记忆分类器接口
+type Classifier interface {
+	// ClassifyText 判断文本是否应存储为记忆并给出分类
+	ClassifyText(ctx context.Context, text string) (*ClassificationResult, error)
+}
+
+// ClassifyText 实现 Classifier 接口
+func (c *MemoryClassifier) ClassifyText(ctx context.Context, text string) (*ClassificationResult, error) {
+	result := c.Classify(text)
+	if result.ShouldStore && result.Importance == 0 {
+		result.Importance = c.ExtractImportance(text)
+	}
+	return result, nil
+}
+
+// ========== LLM 分类器 ==========
+
+// LLMClassifier 基于 LLM 的记忆分类器
+type LLMClassifier struct {
+	complete CompleteFunc
+}
+
+// NewLLMClassifier 创建 LLM 分类器
+func NewLLMClassifier(complete CompleteFunc) *LLMClassifier {
+	return &LLMClassifier{complete: complete}
+}
+
+// llmClassification LLM 返回的分类结果
+type llmClassification struct {
+	ShouldStore bool     `json:"should_store"`
+	Type        string   `json:"type"`
+	Category    string   `json:"category"`
+	Scope       string   `json:"scope"`
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags"`
+	Importance  int      `json:"importance"`
+	Confidence  float64  `json:"confidence"`
+	TTLDays     int      `json:"ttl_days"`
+	Reason      string   `json:"reason"`
+}
+
+// ClassifyText 实现 Classifier 接口
+func (c *LLMClassifier) ClassifyText(ctx context.Context, text string) (*ClassificationResult, error) {
+	reply, err := c.complete(ctx, buildClassifierPrompt(text))
+	if err != nil {
+		return nil, fmt.Errorf("LLM 分类失败: %w", err)
+	}
+	return parseClassification(reply)
+}
+
+// buildClassifierPrompt 生成分类提示词
+func buildClassifierPrompt(text string) string {
+	var prompt strings.Builder
+	prompt.WriteString("判断下面这条用户消息是否包含值得记住的信息，并进行分类。\n")
+	prompt.WriteString("大多数消息（提问、闲聊、一次性指令）不需要记住，此时 should_store 为 false。\n\n")
+	prompt.WriteString("记忆类型与分类：\n")
+	prompt.WriteString("- core（长期有效的用户偏好与规则）: preference / rule / persona\n")
+	prompt.WriteString("- short_term（几天内有效的临时信息）: task / note / context，需给出 ttl_days\n")
+	prompt.WriteString("- long_term（持久的知识与决策）: project / knowledge / decision\n")
+	prompt.WriteString("scope: global（跨项目通用）或 project（仅当前项目）\n")
+	prompt.WriteString("importance: 1-5；confidence: 0-1，表示你对分类结果的把握\n\n")
+	prompt.WriteString("只输出 JSON：{\"should_store\": true, \"type\": \"core\", \"category\": \"preference\", \"scope\": \"global\", ")
+	prompt.WriteString("\"title\": \"简短标题\", \"tags\": [], \"importance\": 3, \"confidence\": 0.9, \"ttl_days\": 0, \"reason\": \"简要原因\"}\n\n")
+	prompt.WriteString("用户消息：\n")
+	prompt.WriteString(text)
+	return prompt.String()
+}
+
+// parseClassification 解析并校验 LLM 返回的分类结果
+func parseClassification(reply string) (*ClassificationResult, error) {
+	var raw llmClassification
+	if err := decodeLLMJSON(reply, &raw, "分类结果"); err != nil {
+		return nil, err
+	}
+
+	result := &ClassificationResult{
+		ShouldStore: raw.ShouldStore,
+		Confidence:  math.Max(0, math.Min(1, raw.Confidence)),
+		Reason:      raw.Reason,
+	}
+	if !raw.ShouldStore {
+		if result.Reason == "" {
+			result.Reason = "LLM 判断无需存储"
+		}
+		return result, nil
+	}
+
+	memType := MemoryType(raw.Type)
+	category := MemoryCategory(raw.Category)
+	if err := validateMemoryCategory(memType, category); err != nil {
+		return nil, err
+	}
+
+	scope := MemoryScope(raw.Scope)
+	if scope != ScopeProject || memType == MemoryTypeCore {
+		scope = ScopeGlobal
+	}
+
+	result.MemoryType = memType
+	result.Category = category
+	result.Scope = scope
+	result.Title = strings.TrimSpace(raw.Title)
+	result.Tags = raw.Tags
+	result.Importance = raw.Importance
+	if result.Importance < 1 || result.Importance > 5 {
+		result.Importance = 3
+	}
+	if memType == MemoryTypeShortTerm {
+		result.TTLDays = raw.TTLDays
+		if result.TTLDays <= 0 {
+			result.TTLDays = 7
+		}
+	}
+	if result.Reason == "" {
+		result.Reason = "LLM 分类"
+	}
+
+	return result, nil
+}
+
+// ========== 影子模式 ==========
+
+// ShadowClassifier 影子分类器
+// 以主分类器的结果为准，同时运行影子分类器并记录两者不一致的情况，用于评估切换分类器的效果
+type ShadowClassifier struct {
+	primary Classifier
+	shadow  Classifier
+	logf    func(format string, args ...interface{})
+}
+
+// NewShadowClassifier 创建影子分类器（logf 为 nil 时写入日志文件）
+func NewShadowClassifier(primary, shadow Classifier, logf func(format string, args ...interface{})) *ShadowClassifier {
+	if logf == nil {
+		logf = logger.Info
+	}
+	return &ShadowClassifier{
+		primary: primary,
+		shadow:  shadow,
+		logf:    logf,
+	}
+}
+
+// ClassifyText 实现 Classifier 接口
+func (c *ShadowClassifier) ClassifyText(ctx context.Context, text string) (*ClassificationResult, error) {
+	result, err := c.primary.ClassifyText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	shadow, err := c.shadow.ClassifyText(ctx, text)
+	if err != nil {
+		c.logf("[memory-classifier] 影子分类失败: %v", err)
+		return result, nil
+	}
+
+	if classificationsDiffer(result, shadow) {
+		c.logf("[memory-classifier] 分类不一致: 主=%s 影子=%s 文本=%q",
+			describeClassification(result), describeClassification(shadow), truncateContent(text, 200))
+	}
+
+	return result, nil
+}
+
+// classificationsDiffer 判断两个分类结果是否不一致
+func classificationsDiffer(a, b *ClassificationResult) bool {
+	if a.ShouldStore != b.ShouldStore {
+		return true
+	}
+	return a.ShouldStore && (a.MemoryType != b.MemoryType || a.Category != b.Category)
+}
+
+// describeClassification 返回分类结果的简短描述
+func describeClassification(r *ClassificationResult) string {
+	if !r.ShouldStore {
+		return fmt.Sprintf("不存储(%s)", r.Reason)
+	}
+	return fmt.Sprintf("%s/%s(%.2f)", r.MemoryType, r.Category, r.Confidence)
+}
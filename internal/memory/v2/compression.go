@@ -0,0 +1,239 @@
+// Package v2 提供长期记忆的压缩去重功能
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 单个合并簇的最大记忆数，避免一次性合并过多内容
+const maxCompressionClusterSize = 8
+
+// MergeFunc 合并函数：将一组相似记忆合并为一条，返回合并后的标题与内容
+type MergeFunc func(ctx context.Context, memories []*Memory) (title, content string, err error)
+
+// CompressionResult 压缩结果
+type CompressionResult struct {
+	Clusters int `json:"clusters"` // 合并的簇数（即新建的记忆数）
+	Merged   int `json:"merged"`   // 被合并并归档的原记忆数
+}
+
+// MemoryCompressor 记忆压缩器
+// 将相似度超过阈值的长期记忆聚成簇，每簇合并为一条新记忆并归档原记忆
+type MemoryCompressor struct {
+	longTermMgr *LongTermMemoryManager
+	vector      VectorStore
+	embedding   *EmbeddingManager
+	config      *MemoryConfig
+
+	mergeFunc MergeFunc
+	mu        sync.RWMutex
+}
+
+// NewMemoryCompressor 创建记忆压缩器（mergeFunc 为 nil 时不执行压缩）
+func NewMemoryCompressor(
+	longTermMgr *LongTermMemoryManager,
+	vector VectorStore,
+	embedding *EmbeddingManager,
+	config *MemoryConfig,
+	mergeFunc MergeFunc,
+) *MemoryCompressor {
+	return &MemoryCompressor{
+		longTermMgr: longTermMgr,
+		vector:      vector,
+		embedding:   embedding,
+		config:      config,
+		mergeFunc:   mergeFunc,
+	}
+}
+
+// SetMergeFunc 设置合并函数
+func (c *MemoryCompressor) SetMergeFunc(mergeFunc MergeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mergeFunc = mergeFunc
+}
+
+// Compress 执行一次压缩
+func (c *MemoryCompressor) Compress(ctx context.Context) (*CompressionResult, error) {
+	result := &CompressionResult{}
+
+	c.mu.RLock()
+	mergeFunc := c.mergeFunc
+	c.mu.RUnlock()
+	if mergeFunc == nil {
+		return result, nil
+	}
+
+	active, err := c.longTermMgr.LoadActive()
+	if err != nil {
+		return result, fmt.Errorf("加载长期记忆失败: %w", err)
+	}
+
+	// 固定的记忆不参与合并
+	var memories []*Memory
+	for _, mem := range active {
+		if !mem.Pinned {
+			memories = append(memories, mem)
+		}
+	}
+
+	var errs []string
+	for _, cluster := range c.findClusters(memories) {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		title, content, err := mergeFunc(ctx, cluster)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		merged, err := c.longTermMgr.Merge(cluster, title, content)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		// 为新记忆生成向量，失败时已进入离线队列
+		if c.embedding != nil {
+			_ = c.embedding.EmbedAndStore(ctx, merged.ID, memoryEmbeddingText(merged))
+		}
+
+		result.Clusters++
+		result.Merged += len(cluster)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("合并记忆失败: %s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// findClusters 查找相似记忆簇
+// 只在相同作用域和项目内聚类；簇内任意两条记忆的相似度都需达到阈值
+func (c *MemoryCompressor) findClusters(memories []*Memory) [][]*Memory {
+	threshold := c.config.LongTerm.CompressionSimilarity
+	if threshold <= 0 || threshold > 1 || len(memories) < 2 {
+		return nil
+	}
+
+	sim := c.newSimilarity(memories)
+
+	groups := make(map[string][]int)
+	var keys []string
+	for i, mem := range memories {
+		key := string(mem.Scope) + "\x00" + mem.ProjectPath
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var clusters [][]*Memory
+	for _, key := range keys {
+		members := groups[key]
+		used := make(map[int]bool)
+
+		// 按 LoadActive 的顺序（重要性优先）依次作为簇的起点
+		for a, seed := range members {
+			if used[seed] {
+				continue
+			}
+
+			cluster := []int{seed}
+			for _, candidate := range members[a+1:] {
+				if used[candidate] || len(cluster) >= maxCompressionClusterSize {
+					continue
+				}
+
+				similar := true
+				for _, member := range cluster {
+					if sim(member, candidate) < threshold {
+						similar = false
+						break
+					}
+				}
+				if similar {
+					cluster = append(cluster, candidate)
+				}
+			}
+
+			if len(cluster) < 2 {
+				continue
+			}
+
+			group := make([]*Memory, len(cluster))
+			for i, idx := range cluster {
+				used[idx] = true
+				group[i] = memories[idx]
+			}
+			clusters = append(clusters, group)
+		}
+	}
+
+	return clusters
+}
+
+// newSimilarity 创建相似度函数
+// 两条记忆都已有向量时使用向量库中的向量，否则使用本地 n-gram 向量
+func (c *MemoryCompressor) newSimilarity(memories []*Memory) func(i, j int) float64 {
+	stored := make([][]float32, len(memories))
+	local := localMemoryVectors(memories)
+
+	if c.vector != nil {
+		for i, mem := range memories {
+			if vec, err := c.vector.GetVector(mem.ID); err == nil {
+				stored[i] = vec
+			}
+		}
+	}
+
+	return func(i, j int) float64 {
+		if stored[i] != nil && len(stored[i]) == len(stored[j]) {
+			return CosineSimilarity(stored[i], stored[j])
+		}
+		return CosineSimilarity(local[i], local[j])
+	}
+}
+
+// NewLLMMergeFunc 创建基于 LLM 的合并函数
+func NewLLMMergeFunc(complete CompleteFunc) MergeFunc {
+	return func(ctx context.Context, memories []*Memory) (string, string, error) {
+		var prompt strings.Builder
+		prompt.WriteString("以下几条记忆内容高度相似，请将它们合并为一条记忆。\n")
+		prompt.WriteString("保留所有不重复的事实，较新的信息优先，去掉重复表述，保持 Markdown 格式。\n")
+		prompt.WriteString("只输出 JSON：{\"title\": \"合并后的标题\", \"content\": \"合并后的内容\"}\n\n")
+		for i, mem := range memories {
+			prompt.WriteString(fmt.Sprintf("[%d] %s（更新于 %s）\n%s\n\n",
+				i+1, mem.Title, mem.UpdatedAt.Format("2006-01-02"), mem.Content))
+		}
+
+		reply, err := complete(ctx, prompt.String())
+		if err != nil {
+			return "", "", fmt.Errorf("LLM 合并失败: %w", err)
+		}
+		return parseMergeReply(reply)
+	}
+}
+
+// parseMergeReply 解析 LLM 返回的合并结果
+func parseMergeReply(reply string) (string, string, error) {
+	var merged struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	if err := decodeLLMJSON(reply, &merged, "合并结果"); err != nil {
+		return "", "", err
+	}
+
+	merged.Title = strings.TrimSpace(merged.Title)
+	merged.Content = strings.TrimSpace(merged.Content)
+	if merged.Title == "" || merged.Content == "" {
+		return "", "", fmt.Errorf("合并结果缺少标题或内容")
+	}
+	return merged.Title, merged.Content, nil
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/hession/aimate/internal/redact"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,6 +36,18 @@ type MemoryConfig struct {
 
 	// 上下文构建配置
 	Context ContextConfig `yaml:"context"`
+
+	// 记忆分类配置
+	Classifier ClassifierConfig `yaml:"classifier"`
+
+	// 团队同步配置
+	TeamSync TeamSyncConfig `yaml:"team_sync"`
+
+	// 静态加密配置
+	Encryption EncryptionConfig `yaml:"encryption"`
+
+	// 敏感信息脱敏配置
+	Redaction RedactionConfig `yaml:"redaction"`
 }
 
 // StorageConfig 存储配置
@@ -50,6 +63,9 @@ type StorageConfig struct {
 
 	// 项目根目录标记文件
 	ProjectMarkers []string `yaml:"project_markers"`
+
+	// 是否将记忆根目录作为 git 仓库记录每次变更（需要本地 git）
+	GitHistory bool `yaml:"git_history"`
 }
 
 // CoreMemoryConfig 核心记忆配置
@@ -113,6 +129,15 @@ type LongTermMemoryConfig struct {
 
 	// 最大文件数
 	MaxFiles int `yaml:"max_files"`
+
+	// 新记忆自动关联的相似度阈值（0 表示不自动关联）
+	RelationSimilarity float64 `yaml:"relation_similarity"`
+
+	// 新记忆最多自动关联的记忆数
+	MaxAutoRelations int `yaml:"max_auto_relations"`
+
+	// 新记忆与旧记忆相似度达到该值时由 LLM 判断是否取代或矛盾（0 表示不检测）
+	SupersedeSimilarity float64 `yaml:"supersede_similarity"`
 }
 
 // RetrievalConfig 检索配置
@@ -134,6 +159,27 @@ type RetrievalConfig struct {
 
 	// 检索超时（毫秒）
 	TimeoutMs int `yaml:"timeout_ms"`
+
+	// 融合策略：rrf（倒数排名融合）/weighted（归一化加权）/max（取最高分）
+	FusionStrategy string `yaml:"fusion_strategy"`
+
+	// RRF 平滑常数
+	RRFK int `yaml:"rrf_k"`
+
+	// weighted 策略下向量分数的权重（关键词为 1 减该值）
+	VectorWeight float64 `yaml:"vector_weight"`
+
+	// LLM 重排序的候选数量（0 表示不启用）
+	RerankTopN int `yaml:"rerank_top_n"`
+
+	// MMR 多样化参数，越小越偏向多样性（0 或 1 表示不启用）
+	MMRLambda float64 `yaml:"mmr_lambda"`
+
+	// 当前项目记忆相对全局记忆的分数权重（1 表示不区分）
+	ProjectWeight float64 `yaml:"project_weight"`
+
+	// 沿关联扩展的一跳邻居相对来源记忆的分数衰减（0 表示不扩展）
+	GraphDecay float64 `yaml:"graph_decay"`
 }
 
 // EmbeddingConfig 嵌入模型配置
@@ -141,7 +187,7 @@ type EmbeddingConfig struct {
 	// 是否启用向量检索
 	Enabled bool `yaml:"enabled"`
 
-	// API 提供商：deepseek/openai
+	// API 提供商：deepseek/openai/local（local 为本地离线实现，无需 API Key）
 	Provider string `yaml:"provider"`
 
 	// API Base URL
@@ -185,6 +231,12 @@ type MaintenanceConfig struct {
 
 	// 反思间隔（小时）
 	ReflectionIntervalHours int `yaml:"reflection_interval_hours"`
+
+	// 是否监听记忆文件变化（外部编辑后自动同步索引）
+	WatchFiles bool `yaml:"watch_files"`
+
+	// 文件变化的防抖时间（毫秒）
+	WatchDebounceMs int `yaml:"watch_debounce_ms"`
 }
 
 // ContextConfig 上下文构建配置
@@ -203,6 +255,70 @@ type ContextConfig struct {
 	CrossProjectSearch bool `yaml:"cross_project_search"`
 }
 
+// ClassifierConfig 记忆分类配置
+type ClassifierConfig struct {
+	// 分类器模式: regex, llm（未配置 LLM 时回退到 regex）
+	Mode string `yaml:"mode"`
+
+	// 最低置信度，低于该值的分类结果不存储
+	MinConfidence float64 `yaml:"min_confidence"`
+
+	// 影子模式：同时运行另一种分类器，只记录分歧而不影响存储
+	Shadow bool `yaml:"shadow"`
+}
+
+// TeamSyncConfig 团队同步配置（通常写在项目配置中）
+type TeamSyncConfig struct {
+	// 共享记忆的 git 远端地址（为空时不启用）
+	Remote string `yaml:"remote"`
+
+	// 同步分支
+	Branch string `yaml:"branch"`
+
+	// 共享的长期记忆分类（只同步项目作用域）
+	Categories []MemoryCategory `yaml:"categories"`
+
+	// 启用静态加密时仍允许同步（同步克隆与远端中的记忆为明文）
+	AllowPlaintext bool `yaml:"allow_plaintext"`
+}
+
+// EncryptionConfig 静态加密配置（通过 aimate memory encrypt|decrypt 切换）
+type EncryptionConfig struct {
+	// 是否加密记忆文件、会话记录与索引中的内容
+	Enabled bool `yaml:"enabled"`
+
+	// 密钥文件路径（权限 0600，保存随机密钥或口令派生参数）
+	KeyFile string `yaml:"key_file"`
+
+	// 口令所在的环境变量（创建密钥时设置该变量则由口令派生密钥）
+	PassphraseEnv string `yaml:"passphrase_env"`
+}
+
+// RedactionConfig 敏感信息脱敏配置
+// 启用时 API 密钥、令牌、私钥与密码赋值总会被替换，邮箱与电话号码可单独关闭
+type RedactionConfig struct {
+	// 是否在内容写入会话、记忆、embedding 请求与日志前脱敏
+	Enabled bool `yaml:"enabled"`
+
+	// 是否脱敏邮箱地址
+	Emails bool `yaml:"emails"`
+
+	// 是否脱敏电话号码
+	Phones bool `yaml:"phones"`
+
+	// 自定义规则（正则中名为 secret 的分组存在时只替换该分组）
+	Patterns []redact.Pattern `yaml:"patterns"`
+}
+
+// Options 转换为脱敏器选项
+func (c RedactionConfig) Options() redact.Options {
+	return redact.Options{
+		Emails: c.Emails,
+		Phones: c.Phones,
+		Custom: c.Patterns,
+	}
+}
+
 // DefaultMemoryConfig 返回默认配置
 func DefaultMemoryConfig() *MemoryConfig {
 	homeDir, _ := os.UserHomeDir()
@@ -239,6 +355,9 @@ func DefaultMemoryConfig() *MemoryConfig {
 			CompressionSimilarity: 0.85,
 			InactiveArchiveDays:   90,
 			MaxFiles:              500,
+			RelationSimilarity:    0.75,
+			MaxAutoRelations:      3,
+			SupersedeSimilarity:   0.75,
 		},
 		Retrieval: RetrievalConfig{
 			VectorTopK:      20,
@@ -247,6 +366,13 @@ func DefaultMemoryConfig() *MemoryConfig {
 			MinSimilarity:   0.6,
 			TimeDecayFactor: 0.95,
 			TimeoutMs:       500,
+			FusionStrategy:  FusionRRF,
+			RRFK:            60,
+			VectorWeight:    0.7,
+			RerankTopN:      0,
+			MMRLambda:       0.7,
+			ProjectWeight:   1.2,
+			GraphDecay:      0.5,
 		},
 		Embedding: EmbeddingConfig{
 			Enabled:    true,
@@ -266,6 +392,8 @@ func DefaultMemoryConfig() *MemoryConfig {
 			CompressMemories:        true,
 			ReflectionEnabled:       true,
 			ReflectionIntervalHours: 24,
+			WatchFiles:              true,
+			WatchDebounceMs:         500,
 		},
 		Context: ContextConfig{
 			TotalBudget:        128000,
@@ -276,6 +404,25 @@ func DefaultMemoryConfig() *MemoryConfig {
 			ReservedRatio:      0.10,
 			CrossProjectSearch: false,
 		},
+		Classifier: ClassifierConfig{
+			Mode:          ClassifierRegex,
+			MinConfidence: 0.6,
+			Shadow:        false,
+		},
+		TeamSync: TeamSyncConfig{
+			Branch:     "main",
+			Categories: []MemoryCategory{CategoryProject, CategoryDecision},
+		},
+		Encryption: EncryptionConfig{
+			Enabled:       false,
+			KeyFile:       filepath.Join(homeDir, ".aimate", "memory.key"),
+			PassphraseEnv: "AIMATE_MEMORY_PASSPHRASE",
+		},
+		Redaction: RedactionConfig{
+			Enabled: true,
+			Emails:  true,
+			Phones:  true,
+		},
 	}
 }
 
@@ -363,6 +510,13 @@ func (cm *ConfigManager) saveGlobalConfig() error {
 	return nil
 }
 
+// SetEncryptionEnabled 切换静态加密并保存全局配置
+func (cm *ConfigManager) SetEncryptionEnabled(enabled bool) error {
+	cm.globalConfig.Encryption.Enabled = enabled
+	cm.projectConfigs = make(map[string]*MemoryConfig)
+	return cm.saveGlobalConfig()
+}
+
 // GetGlobalConfig 获取全局配置
 func (cm *ConfigManager) GetGlobalConfig() *MemoryConfig {
 	return cm.globalConfig
@@ -483,6 +637,71 @@ func ValidateConfig(cfg *MemoryConfig) error {
 	if cfg.Retrieval.MinSimilarity < 0 || cfg.Retrieval.MinSimilarity > 1 {
 		return fmt.Errorf("配置错误: retrieval.min_similarity 必须在 0-1 之间")
 	}
+	switch cfg.Retrieval.FusionStrategy {
+	case "", FusionRRF, FusionWeighted, FusionMax:
+	default:
+		return fmt.Errorf("配置错误: retrieval.fusion_strategy 必须是 rrf/weighted/max 之一")
+	}
+	if cfg.Retrieval.VectorWeight < 0 || cfg.Retrieval.VectorWeight > 1 {
+		return fmt.Errorf("配置错误: retrieval.vector_weight 必须在 0-1 之间")
+	}
+	if cfg.Retrieval.MMRLambda < 0 || cfg.Retrieval.MMRLambda > 1 {
+		return fmt.Errorf("配置错误: retrieval.mmr_lambda 必须在 0-1 之间")
+	}
+	if cfg.Retrieval.RerankTopN < 0 {
+		return fmt.Errorf("配置错误: retrieval.rerank_top_n 不能为负数")
+	}
+	if cfg.Retrieval.ProjectWeight <= 0 {
+		return fmt.Errorf("配置错误: retrieval.project_weight 必须大于 0")
+	}
+	if cfg.Retrieval.GraphDecay < 0 || cfg.Retrieval.GraphDecay > 1 {
+		return fmt.Errorf("配置错误: retrieval.graph_decay 必须在 0-1 之间")
+	}
+	if cfg.LongTerm.RelationSimilarity < 0 || cfg.LongTerm.RelationSimilarity > 1 {
+		return fmt.Errorf("配置错误: long_term.relation_similarity 必须在 0-1 之间")
+	}
+	if cfg.LongTerm.SupersedeSimilarity < 0 || cfg.LongTerm.SupersedeSimilarity > 1 {
+		return fmt.Errorf("配置错误: long_term.supersede_similarity 必须在 0-1 之间")
+	}
+	if cfg.LongTerm.MaxAutoRelations < 0 {
+		return fmt.Errorf("配置错误: long_term.max_auto_relations 不能为负数")
+	}
+
+	if cfg.Maintenance.WatchDebounceMs < 0 {
+		return fmt.Errorf("配置错误: maintenance.watch_debounce_ms 不能为负数")
+	}
+
+	// 验证分类配置
+	switch cfg.Classifier.Mode {
+	case "", ClassifierRegex, ClassifierLLM:
+	default:
+		return fmt.Errorf("配置错误: classifier.mode 必须是 regex/llm 之一")
+	}
+	if cfg.Classifier.MinConfidence < 0 || cfg.Classifier.MinConfidence > 1 {
+		return fmt.Errorf("配置错误: classifier.min_confidence 必须在 0-1 之间")
+	}
+
+	// 验证团队同步配置
+	if cfg.TeamSync.Remote != "" && cfg.TeamSync.Branch == "" {
+		return fmt.Errorf("配置错误: team_sync.branch 不能为空")
+	}
+	for _, category := range cfg.TeamSync.Categories {
+		if err := validateMemoryCategory(MemoryTypeLongTerm, category); err != nil {
+			return fmt.Errorf("配置错误: team_sync.categories 只能包含长期记忆分类: %s", category)
+		}
+	}
+
+	// 验证加密配置
+	if cfg.Encryption.Enabled && cfg.Encryption.KeyFile == "" {
+		return fmt.Errorf("配置错误: encryption.key_file 不能为空")
+	}
+
+	// 验证脱敏规则
+	if cfg.Redaction.Enabled {
+		if _, err := redact.New(cfg.Redaction.Options()); err != nil {
+			return fmt.Errorf("配置错误: redaction.patterns: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -82,6 +82,11 @@ func (m *CoreMemoryManager) GetPersonas() ([]*Memory, error) {
 
 // Add 添加核心记忆
 func (m *CoreMemoryManager) Add(category MemoryCategory, title, content string) (*Memory, error) {
+	return m.AddWithSource(category, title, content, "")
+}
+
+// AddWithSource 添加核心记忆并记录来源（如 session:<id>）
+func (m *CoreMemoryManager) AddWithSource(category MemoryCategory, title, content, source string) (*Memory, error) {
 	// 检查是否已存在相同标题的记忆
 	existing, _ := m.FindByTitle(title)
 	if existing != nil {
@@ -96,6 +101,7 @@ func (m *CoreMemoryManager) Add(category MemoryCategory, title, content string)
 		Category:   category,
 		Title:      title,
 		Content:    content,
+		Source:     source,
 		Status:     StatusActive,
 		Importance: 5, // 核心记忆默认最高重要度
 		CreatedAt:  time.Now(),
@@ -182,6 +188,38 @@ func (m *CoreMemoryManager) Delete(id string) error {
 	return m.index.DeleteIndex(id)
 }
 
+// ArchiveTo 将核心记忆移入指定归档目录并删除索引，返回归档后的文件路径
+func (m *CoreMemoryManager) ArchiveTo(id, archiveDir string) (string, error) {
+	mem, err := m.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	dstPath := filepath.Join(archiveDir, filepath.Base(mem.FilePath))
+	mem.Status = StatusArchived
+	if err := m.fileStore.UpdateMemory(mem); err != nil {
+		return "", err
+	}
+	if err := m.fileStore.MoveMemory(mem.FilePath, dstPath); err != nil {
+		return "", err
+	}
+
+	return dstPath, m.index.DeleteIndex(id)
+}
+
+// Restore 将已归档的核心记忆恢复到原位置
+func (m *CoreMemoryManager) Restore(mem *Memory, archivedPath string) error {
+	if err := m.fileStore.MoveMemory(archivedPath, mem.FilePath); err != nil {
+		return err
+	}
+
+	mem.Status = StatusActive
+	if err := m.fileStore.UpdateMemory(mem); err != nil {
+		return err
+	}
+	return m.index.CreateIndex(MemoryToIndex(mem))
+}
+
 // FindByTitle 按标题查找核心记忆
 func (m *CoreMemoryManager) FindByTitle(title string) (*Memory, error) {
 	allMemories, err := m.LoadAll()
@@ -217,13 +255,17 @@ func (m *CoreMemoryManager) GetTotalTokens() (int, error) {
 
 	totalTokens := 0
 	for _, mem := range allMemories {
-		// 简单估算：每 4 个字符约 1 个 token
-		totalTokens += len(mem.Content) / 4
+		totalTokens += estimateCoreTokens(mem.Content)
 	}
 
 	return totalTokens, nil
 }
 
+// estimateCoreTokens 估算核心记忆内容的 Token 数（简单估算：每 4 个字符约 1 个 token）
+func estimateCoreTokens(content string) int {
+	return len(content) / 4
+}
+
 // IsOverLimit 检查是否超出 Token 限制
 func (m *CoreMemoryManager) IsOverLimit() (bool, error) {
 	tokens, err := m.GetTotalTokens()
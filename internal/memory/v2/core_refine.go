@@ -0,0 +1,330 @@
+// Package v2 提供核心记忆精炼：核心记忆超过阈值时由 LLM 整合为更精简的一组记忆
+package v2
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RefinedMemory 精炼后的一条核心记忆
+type RefinedMemory struct {
+	Category MemoryCategory `json:"category"`
+	Title    string         `json:"title"`
+	Content  string         `json:"content"`
+}
+
+// CoreRefinePlan 核心记忆精炼方案，需用户确认后才会应用
+type CoreRefinePlan struct {
+	Before       []*Memory        // 精炼前的核心记忆
+	After        []*RefinedMemory // 精炼后的核心记忆
+	TokensBefore int
+	TokensAfter  int
+	MaxTokens    int
+	CreatedAt    time.Time
+}
+
+// CoreRefineResult 精炼结果
+type CoreRefineResult struct {
+	Archived   int    // 归档的旧记忆数
+	Created    int    // 新建的记忆数
+	Unchanged  int    // 未变化的记忆数
+	ArchiveDir string // 旧版本所在的归档目录
+}
+
+// CoreRefiner 核心记忆精炼器
+// Propose 生成方案并暂存，Apply 将变化的旧记忆移入归档目录并写入新记忆
+type CoreRefiner struct {
+	storage   *StorageManager
+	fileStore *MarkdownFileStore
+	coreMgr   *CoreMemoryManager
+	config    *MemoryConfig
+
+	complete CompleteFunc
+	pending  *CoreRefinePlan
+	mu       sync.Mutex
+}
+
+// NewCoreRefiner 创建核心记忆精炼器（complete 为 nil 时无法生成方案）
+func NewCoreRefiner(
+	storage *StorageManager,
+	fileStore *MarkdownFileStore,
+	coreMgr *CoreMemoryManager,
+	config *MemoryConfig,
+	complete CompleteFunc,
+) *CoreRefiner {
+	return &CoreRefiner{
+		storage:   storage,
+		fileStore: fileStore,
+		coreMgr:   coreMgr,
+		config:    config,
+		complete:  complete,
+	}
+}
+
+// SetCompleteFunc 设置 LLM 补全函数
+func (r *CoreRefiner) SetCompleteFunc(complete CompleteFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.complete = complete
+}
+
+// Pending 返回待确认的精炼方案
+func (r *CoreRefiner) Pending() *CoreRefinePlan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending
+}
+
+// Discard 放弃待确认的精炼方案
+func (r *CoreRefiner) Discard() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	discarded := r.pending != nil
+	r.pending = nil
+	return discarded
+}
+
+// Propose 由 LLM 生成精炼方案并暂存，等待确认
+func (r *CoreRefiner) Propose(ctx context.Context) (*CoreRefinePlan, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.complete == nil {
+		return nil, fmt.Errorf("未配置 LLM，无法精炼核心记忆")
+	}
+
+	memories, err := r.coreMgr.LoadAll()
+	if err != nil {
+		return nil, fmt.Errorf("加载核心记忆失败: %w", err)
+	}
+	if len(memories) == 0 {
+		return nil, fmt.Errorf("没有可精炼的核心记忆")
+	}
+
+	target := int(float64(r.config.Core.MaxTokens) * r.config.Core.RefineThreshold)
+	reply, err := r.complete(ctx, buildCoreRefinePrompt(memories, target))
+	if err != nil {
+		return nil, fmt.Errorf("LLM 精炼失败: %w", err)
+	}
+
+	refined, err := parseCoreRefineReply(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CoreRefinePlan{
+		Before:    memories,
+		After:     refined,
+		MaxTokens: r.config.Core.MaxTokens,
+		CreatedAt: time.Now(),
+	}
+	for _, mem := range memories {
+		plan.TokensBefore += estimateCoreTokens(mem.Content)
+	}
+	for _, mem := range refined {
+		plan.TokensAfter += estimateCoreTokens(mem.Content)
+	}
+	if plan.TokensAfter > plan.MaxTokens {
+		return nil, fmt.Errorf("精炼结果约 %d tokens，仍超出上限 %d", plan.TokensAfter, plan.MaxTokens)
+	}
+
+	r.pending = plan
+	return plan, nil
+}
+
+// Apply 应用待确认的精炼方案
+// 未变化的记忆保持原样，其余旧记忆移入本次精炼的归档目录，再写入新记忆；写入失败时恢复旧记忆
+func (r *CoreRefiner) Apply() (*CoreRefineResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plan := r.pending
+	if plan == nil {
+		return nil, fmt.Errorf("没有待确认的精炼方案，请先运行 /memory core refine")
+	}
+
+	current, err := r.coreMgr.LoadAll()
+	if err != nil {
+		return nil, fmt.Errorf("加载核心记忆失败: %w", err)
+	}
+	if !sameCoreMemories(plan.Before, current) {
+		r.pending = nil
+		return nil, fmt.Errorf("生成方案后核心记忆已变化，请重新运行 /memory core refine")
+	}
+
+	kept := make(map[string]bool)
+	var added []*RefinedMemory
+	for _, after := range plan.After {
+		if mem := findUnchangedCore(plan.Before, after); mem != nil {
+			kept[mem.ID] = true
+			continue
+		}
+		added = append(added, after)
+	}
+
+	result := &CoreRefineResult{Unchanged: len(kept)}
+	runDir := "refine_" + plan.CreatedAt.Format("20060102_150405")
+
+	var archived []*Memory
+	var archivedPaths []string
+	restore := func() {
+		for i, mem := range archived {
+			_ = r.coreMgr.Restore(mem, archivedPaths[i])
+		}
+	}
+
+	for _, mem := range plan.Before {
+		if kept[mem.ID] {
+			continue
+		}
+		dir := filepath.Join(r.storage.GetArchivePath(mem), runDir)
+		path, err := r.coreMgr.ArchiveTo(mem.ID, dir)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("归档核心记忆 %s 失败: %w", mem.Title, err)
+		}
+		archived = append(archived, mem)
+		archivedPaths = append(archivedPaths, path)
+		result.ArchiveDir = dir
+	}
+
+	var created []*Memory
+	for _, after := range added {
+		mem, err := r.coreMgr.AddWithSource(after.Category, after.Title, after.Content, "refine")
+		if err != nil {
+			for _, c := range created {
+				_ = r.coreMgr.Delete(c.ID)
+			}
+			restore()
+			return nil, fmt.Errorf("写入精炼后的核心记忆 %s 失败: %w", after.Title, err)
+		}
+		created = append(created, mem)
+	}
+
+	result.Archived = len(archived)
+	result.Created = len(created)
+	r.pending = nil
+	return result, nil
+}
+
+// Diff 返回精炼前后的差异（- 为移除的旧记忆，+ 为新记忆）
+func (p *CoreRefinePlan) Diff() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("核心记忆精炼：%d 条 → %d 条，约 %d → %d tokens（上限 %d）\n\n",
+		len(p.Before), len(p.After), p.TokensBefore, p.TokensAfter, p.MaxTokens))
+
+	unchanged := make(map[string]bool)
+	for _, after := range p.After {
+		if mem := findUnchangedCore(p.Before, after); mem != nil {
+			unchanged[mem.ID] = true
+		}
+	}
+
+	for _, mem := range p.Before {
+		if unchanged[mem.ID] {
+			builder.WriteString(fmt.Sprintf("  [%s] %s（未变化）\n", mem.Category, mem.Title))
+		}
+	}
+	for _, mem := range p.Before {
+		if !unchanged[mem.ID] {
+			writeDiffEntry(&builder, "-", mem.Category, mem.Title, mem.Content)
+		}
+	}
+	for _, after := range p.After {
+		if findUnchangedCore(p.Before, after) == nil {
+			writeDiffEntry(&builder, "+", after.Category, after.Title, after.Content)
+		}
+	}
+
+	return strings.TrimRight(builder.String(), "\n")
+}
+
+// writeDiffEntry 写入一条差异，多行内容逐行加前缀
+func writeDiffEntry(builder *strings.Builder, sign string, category MemoryCategory, title, content string) {
+	builder.WriteString(fmt.Sprintf("%s [%s] %s\n", sign, category, title))
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		builder.WriteString(fmt.Sprintf("%s     %s\n", sign, line))
+	}
+}
+
+// findUnchangedCore 查找与精炼结果完全相同的旧记忆
+func findUnchangedCore(before []*Memory, after *RefinedMemory) *Memory {
+	for _, mem := range before {
+		if mem.Category == after.Category && mem.Title == after.Title &&
+			strings.TrimSpace(mem.Content) == strings.TrimSpace(after.Content) {
+			return mem
+		}
+	}
+	return nil
+}
+
+// sameCoreMemories 判断核心记忆自生成方案后是否未被修改
+func sameCoreMemories(before, current []*Memory) bool {
+	if len(before) != len(current) {
+		return false
+	}
+	contents := make(map[string]string, len(before))
+	for _, mem := range before {
+		contents[mem.ID] = mem.Content
+	}
+	for _, mem := range current {
+		content, ok := contents[mem.ID]
+		if !ok || content != mem.Content {
+			return false
+		}
+	}
+	return true
+}
+
+// buildCoreRefinePrompt 生成精炼提示词
+func buildCoreRefinePrompt(memories []*Memory, targetTokens int) string {
+	var prompt strings.Builder
+	prompt.WriteString("以下是用户的核心记忆（偏好、规则与角色设定），总量已接近上限，请整合为更精简的一组记忆。\n")
+	prompt.WriteString("要求：\n")
+	prompt.WriteString("- 保留所有不重复的偏好与规则，合并重复或相近的条目，较新的信息优先，删除已被取代的内容\n")
+	prompt.WriteString("- 每条记忆保持单一主题，标题简短且互不相同\n")
+	prompt.WriteString("- category 只能是 preference / rule / persona\n")
+	prompt.WriteString(fmt.Sprintf("- 全部内容合计不超过约 %d tokens（约 %d 个英文字符，中文按每字 3 字符计）\n\n", targetTokens, targetTokens*4))
+	prompt.WriteString("只输出 JSON：{\"memories\": [{\"category\": \"preference\", \"title\": \"标题\", \"content\": \"内容\"}]}\n\n")
+	prompt.WriteString("当前核心记忆：\n")
+	for i, mem := range memories {
+		prompt.WriteString(fmt.Sprintf("[%d] (%s) %s（更新于 %s）\n%s\n\n",
+			i+1, mem.Category, mem.Title, mem.UpdatedAt.Format("2006-01-02"), mem.Content))
+	}
+	return prompt.String()
+}
+
+// parseCoreRefineReply 解析并校验 LLM 返回的精炼结果
+func parseCoreRefineReply(reply string) ([]*RefinedMemory, error) {
+	var raw struct {
+		Memories []*RefinedMemory `json:"memories"`
+	}
+	if err := decodeLLMJSON(reply, &raw, "精炼结果"); err != nil {
+		return nil, err
+	}
+	if len(raw.Memories) == 0 {
+		return nil, fmt.Errorf("精炼结果为空")
+	}
+
+	titles := make(map[string]bool)
+	for _, mem := range raw.Memories {
+		mem.Title = strings.TrimSpace(mem.Title)
+		mem.Content = strings.TrimSpace(mem.Content)
+		if mem.Title == "" || mem.Content == "" {
+			return nil, fmt.Errorf("精炼结果缺少标题或内容")
+		}
+		if err := validateMemoryCategory(MemoryTypeCore, mem.Category); err != nil {
+			return nil, err
+		}
+		if titles[mem.Title] {
+			return nil, fmt.Errorf("精炼结果包含重复标题: %s", mem.Title)
+		}
+		titles[mem.Title] = true
+	}
+
+	return raw.Memories, nil
+}
@@ -3,6 +3,7 @@ package v2
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,9 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/hession/aimate/internal/logger"
+	"github.com/hession/aimate/internal/redact"
 )
 
 // EmbeddingClient Embedding API 客户端接口
@@ -277,53 +281,62 @@ func (c *OpenAIEmbeddingClient) GetDimension() int {
 
 // EmbeddingManager Embedding 管理器
 // 负责管理 embedding 的生成、缓存和队列
+// 配置了 store 时离线队列与缓存持久化到 SQLite，否则仅保存在内存中
 type EmbeddingManager struct {
 	client      EmbeddingClient
 	vectorStore VectorStore
+	store       *SQLiteEmbeddingStore
 	config      *EmbeddingConfig
+	redactor    *redact.Redactor // 非 nil 时文本发送到 API 前脱敏
 
-	// 离线队列
+	// 离线队列（未配置 store 时使用）
 	offlineQueue     []EmbeddingTask
 	offlineQueueLock sync.Mutex
 
-	// 缓存（内存缓存）
-	cache     map[string][]float32
-	cacheLock sync.RWMutex
+	// 缓存（内存缓存，按内容哈希索引）
+	cache *vectorCache
 }
 
 // EmbeddingTask 离线 embedding 任务
 type EmbeddingTask struct {
-	ID        string    `json:"id"`
-	Text      string    `json:"text"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	Text          string    `json:"text"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
-// NewEmbeddingManager 创建 Embedding 管理器
-func NewEmbeddingManager(client EmbeddingClient, vectorStore VectorStore, config *EmbeddingConfig) *EmbeddingManager {
+// 每轮处理的离线任务上限
+const offlineQueueBatchLimit = 100
+
+// 内存向量缓存的条目上限
+const embeddingMemoryCacheLimit = 1000
+
+// NewEmbeddingManager 创建 Embedding 管理器（store 可为 nil）
+func NewEmbeddingManager(client EmbeddingClient, vectorStore VectorStore, store *SQLiteEmbeddingStore, config *EmbeddingConfig) *EmbeddingManager {
 	return &EmbeddingManager{
 		client:       client,
 		vectorStore:  vectorStore,
+		store:        store,
 		config:       config,
 		offlineQueue: []EmbeddingTask{},
-		cache:        make(map[string][]float32),
+		cache:        newVectorCache(embeddingMemoryCacheLimit),
 	}
 }
 
+// SetRedactor 设置文本脱敏器（nil 表示不脱敏）
+func (m *EmbeddingManager) SetRedactor(redactor *redact.Redactor) {
+	m.redactor = redactor
+}
+
 // EmbedAndStore 生成 embedding 并存储
 func (m *EmbeddingManager) EmbedAndStore(ctx context.Context, id, text string) error {
-	// 检查缓存
-	m.cacheLock.RLock()
-	if vec, ok := m.cache[id]; ok {
-		m.cacheLock.RUnlock()
-		return m.vectorStore.StoreVector(id, vec)
-	}
-	m.cacheLock.RUnlock()
-
-	// 生成 embedding
-	vec, err := m.client.Embed(ctx, text)
+	text = m.redactor.Redact(text)
+	vec, err := m.embedCached(ctx, text)
 	if err != nil {
 		// 加入离线队列
-		m.addToOfflineQueue(id, text)
+		m.addToOfflineQueue(id, text, err)
 		return fmt.Errorf("生成 embedding 失败，已加入离线队列: %w", err)
 	}
 
@@ -332,11 +345,8 @@ func (m *EmbeddingManager) EmbedAndStore(ctx context.Context, id, text string) e
 		return fmt.Errorf("存储向量失败: %w", err)
 	}
 
-	// 更新缓存
-	m.cacheLock.Lock()
-	m.cache[id] = vec
-	m.cacheLock.Unlock()
-
+	// 已有最新向量，旧的离线任务不再需要
+	m.removeFromOfflineQueue(id)
 	return nil
 }
 
@@ -346,16 +356,34 @@ func (m *EmbeddingManager) EmbedBatchAndStore(ctx context.Context, items map[str
 		return nil
 	}
 
-	// 准备批量数据
+	// 命中缓存的直接存储，其余批量请求
+	cached := make(map[string][]float32)
 	ids := make([]string, 0, len(items))
 	texts := make([]string, 0, len(items))
 	for id, text := range items {
+		text = m.redactor.Redact(text)
+		if vec, ok := m.getCached(text); ok {
+			cached[id] = vec
+			continue
+		}
 		ids = append(ids, id)
 		texts = append(texts, text)
 	}
 
+	if len(cached) > 0 {
+		if err := m.vectorStore.BatchStoreVectors(cached); err != nil {
+			return fmt.Errorf("批量存储向量失败: %w", err)
+		}
+		for id := range cached {
+			m.removeFromOfflineQueue(id)
+		}
+	}
+
 	// 分批处理
 	batchSize := m.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(texts)
+	}
 	for i := 0; i < len(texts); i += batchSize {
 		end := i + batchSize
 		if end > len(texts) {
@@ -370,7 +398,7 @@ func (m *EmbeddingManager) EmbedBatchAndStore(ctx context.Context, items map[str
 		if err != nil {
 			// 将失败的加入离线队列
 			for j, id := range batchIDs {
-				m.addToOfflineQueue(id, batchTexts[j])
+				m.addToOfflineQueue(id, batchTexts[j], err)
 			}
 			continue
 		}
@@ -380,28 +408,59 @@ func (m *EmbeddingManager) EmbedBatchAndStore(ctx context.Context, items map[str
 		for j, id := range batchIDs {
 			if j < len(vectors) && vectors[j] != nil {
 				batchVectors[id] = vectors[j]
+				m.putCached(batchTexts[j], vectors[j])
 			}
 		}
 
 		if err := m.vectorStore.BatchStoreVectors(batchVectors); err != nil {
 			return fmt.Errorf("批量存储向量失败: %w", err)
 		}
-
-		// 更新缓存
-		m.cacheLock.Lock()
-		for id, vec := range batchVectors {
-			m.cache[id] = vec
+		for id := range batchVectors {
+			m.removeFromOfflineQueue(id)
 		}
-		m.cacheLock.Unlock()
 	}
 
 	return nil
 }
 
+// EmbedTexts 批量生成 embedding（不存储），命中缓存的文本不请求 API
+func (m *EmbeddingManager) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	var missIdx []int
+	var missTexts []string
+	for i, text := range texts {
+		text = m.redactor.Redact(text)
+		if vec, ok := m.getCached(text); ok {
+			vectors[i] = vec
+			continue
+		}
+		missIdx = append(missIdx, i)
+		missTexts = append(missTexts, text)
+	}
+
+	if len(missTexts) == 0 {
+		return vectors, nil
+	}
+
+	generated, err := m.client.EmbedBatch(ctx, missTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(generated) != len(missTexts) {
+		return nil, fmt.Errorf("embedding 数量不匹配: 期望 %d, 实际 %d", len(missTexts), len(generated))
+	}
+
+	for j, i := range missIdx {
+		vectors[i] = generated[j]
+		m.putCached(missTexts[j], generated[j])
+	}
+	return vectors, nil
+}
+
 // SearchSimilar 搜索相似向量
 func (m *EmbeddingManager) SearchSimilar(ctx context.Context, text string, topK int) ([]*VectorSearchResult, error) {
 	// 生成查询向量
-	queryVec, err := m.client.Embed(ctx, text)
+	queryVec, err := m.client.Embed(ctx, m.redactor.Redact(text))
 	if err != nil {
 		return nil, fmt.Errorf("生成查询向量失败: %w", err)
 	}
@@ -415,59 +474,205 @@ func (c *EmbeddingConfig) MinSimilarity() float64 {
 	return 0.6 // 默认值，可以从配置中读取
 }
 
-// addToOfflineQueue 添加到离线队列
-func (m *EmbeddingManager) addToOfflineQueue(id, text string) {
+// ModelID 返回标识向量空间的模型名（提供商/模型）
+// 本地提供商不使用 Model 字段，仅以提供商标识
+func (c *EmbeddingConfig) ModelID() string {
+	if c.Provider == "local" {
+		return c.Provider
+	}
+	return c.Provider + "/" + c.Model
+}
+
+// ========== 缓存 ==========
+
+// cacheKey 计算缓存键：同一模型下内容不变则键不变
+func (m *EmbeddingManager) cacheKey(text string) string {
+	return CalculateContentHash([]byte(m.config.ModelID() + "\x00" + text))
+}
+
+// getCached 按内容读取缓存向量（先内存后持久化存储）
+func (m *EmbeddingManager) getCached(text string) ([]float32, bool) {
+	key := m.cacheKey(text)
+
+	if vec, ok := m.cache.get(key); ok {
+		return vec, true
+	}
+
+	if m.store == nil {
+		return nil, false
+	}
+	vec, ok := m.store.GetCached(key)
+	if !ok || len(vec) != m.client.GetDimension() {
+		return nil, false
+	}
+
+	m.cache.put(key, vec)
+	return vec, true
+}
+
+// putCached 写入缓存
+func (m *EmbeddingManager) putCached(text string, vec []float32) {
+	key := m.cacheKey(text)
+
+	m.cache.put(key, vec)
+
+	if m.store != nil {
+		if err := m.store.PutCached(key, vec); err != nil {
+			logger.Warn("[embedding] %v", err)
+		}
+	}
+}
+
+// embedCached 生成 embedding，内容未变化时直接使用缓存
+func (m *EmbeddingManager) embedCached(ctx context.Context, text string) ([]float32, error) {
+	if vec, ok := m.getCached(text); ok {
+		return vec, nil
+	}
+
+	vec, err := m.client.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	m.putCached(text, vec)
+	return vec, nil
+}
+
+// ========== 离线队列 ==========
+
+// addToOfflineQueue 添加到离线队列，同一 ID 只保留最新文本
+func (m *EmbeddingManager) addToOfflineQueue(id, text string, cause error) {
+	now := time.Now()
+	task := EmbeddingTask{
+		ID:            id,
+		Text:          text,
+		Attempts:      1,
+		NextAttemptAt: now.Add(embeddingRetryDelay(1)),
+		CreatedAt:     now,
+	}
+	if cause != nil {
+		task.LastError = cause.Error()
+	}
+
+	if m.store != nil {
+		if err := m.store.Enqueue(task); err != nil {
+			logger.Warn("[embedding] 记忆 %s 未能加入离线队列: %v", id, err)
+		}
+		return
+	}
+
+	m.offlineQueueLock.Lock()
+	defer m.offlineQueueLock.Unlock()
+
+	for i := range m.offlineQueue {
+		if m.offlineQueue[i].ID == id {
+			m.offlineQueue[i] = task
+			return
+		}
+	}
+	m.offlineQueue = append(m.offlineQueue, task)
+}
+
+// removeFromOfflineQueue 从离线队列移除任务
+func (m *EmbeddingManager) removeFromOfflineQueue(id string) {
+	if m.store != nil {
+		if err := m.store.Dequeue(id); err != nil {
+			logger.Warn("[embedding] %v", err)
+		}
+		return
+	}
+
 	m.offlineQueueLock.Lock()
 	defer m.offlineQueueLock.Unlock()
 
-	m.offlineQueue = append(m.offlineQueue, EmbeddingTask{
-		ID:        id,
-		Text:      text,
-		CreatedAt: time.Now(),
-	})
+	for i := range m.offlineQueue {
+		if m.offlineQueue[i].ID == id {
+			m.offlineQueue = append(m.offlineQueue[:i], m.offlineQueue[i+1:]...)
+			return
+		}
+	}
 }
 
-// ProcessOfflineQueue 处理离线队列
-func (m *EmbeddingManager) ProcessOfflineQueue(ctx context.Context) (int, error) {
+// dueOfflineTasks 获取到期可重试的任务
+func (m *EmbeddingManager) dueOfflineTasks(now time.Time) ([]EmbeddingTask, error) {
+	if m.store != nil {
+		return m.store.DueTasks(now, offlineQueueBatchLimit)
+	}
+
 	m.offlineQueueLock.Lock()
-	queue := m.offlineQueue
-	m.offlineQueue = []EmbeddingTask{}
-	m.offlineQueueLock.Unlock()
+	defer m.offlineQueueLock.Unlock()
 
-	if len(queue) == 0 {
-		return 0, nil
+	var due []EmbeddingTask
+	for _, task := range m.offlineQueue {
+		if !task.NextAttemptAt.After(now) && len(due) < offlineQueueBatchLimit {
+			due = append(due, task)
+		}
+	}
+	return due, nil
+}
+
+// markOfflineTaskFailed 记录失败并推迟下次重试
+func (m *EmbeddingManager) markOfflineTaskFailed(task EmbeddingTask, cause error, now time.Time) {
+	if m.store != nil {
+		if err := m.store.MarkFailed(task, cause, now); err != nil {
+			logger.Warn("[embedding] %v", err)
+		}
+		return
+	}
+
+	m.offlineQueueLock.Lock()
+	defer m.offlineQueueLock.Unlock()
+
+	for i := range m.offlineQueue {
+		// 任务已被更新的文本覆盖时不再修改
+		if m.offlineQueue[i].ID == task.ID && m.offlineQueue[i].Text == task.Text {
+			m.offlineQueue[i].Attempts++
+			m.offlineQueue[i].LastError = cause.Error()
+			m.offlineQueue[i].NextAttemptAt = now.Add(embeddingRetryDelay(m.offlineQueue[i].Attempts))
+			return
+		}
+	}
+}
+
+// ProcessOfflineQueue 处理离线队列中到期的任务，失败的任务按指数退避推迟
+func (m *EmbeddingManager) ProcessOfflineQueue(ctx context.Context) (int, error) {
+	now := time.Now()
+	tasks, err := m.dueOfflineTasks(now)
+	if err != nil {
+		return 0, err
 	}
 
 	processed := 0
-	var failedTasks []EmbeddingTask
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
 
-	for _, task := range queue {
-		vec, err := m.client.Embed(ctx, task.Text)
+		vec, err := m.embedCached(ctx, task.Text)
 		if err != nil {
-			failedTasks = append(failedTasks, task)
+			m.markOfflineTaskFailed(task, err, now)
 			continue
 		}
 
 		if err := m.vectorStore.StoreVector(task.ID, vec); err != nil {
-			failedTasks = append(failedTasks, task)
+			m.markOfflineTaskFailed(task, err, now)
 			continue
 		}
 
+		m.removeFromOfflineQueue(task.ID)
 		processed++
 	}
 
-	// 将失败的任务重新加入队列
-	if len(failedTasks) > 0 {
-		m.offlineQueueLock.Lock()
-		m.offlineQueue = append(m.offlineQueue, failedTasks...)
-		m.offlineQueueLock.Unlock()
-	}
-
 	return processed, nil
 }
 
 // GetOfflineQueueSize 获取离线队列大小
 func (m *EmbeddingManager) GetOfflineQueueSize() int {
+	if m.store != nil {
+		size, _ := m.store.QueueSize()
+		return size
+	}
+
 	m.offlineQueueLock.Lock()
 	defer m.offlineQueueLock.Unlock()
 	return len(m.offlineQueue)
@@ -475,16 +680,93 @@ func (m *EmbeddingManager) GetOfflineQueueSize() int {
 
 // ClearCache 清除缓存
 func (m *EmbeddingManager) ClearCache() {
-	m.cacheLock.Lock()
-	m.cache = make(map[string][]float32)
-	m.cacheLock.Unlock()
+	m.cache.clear()
+
+	if m.store != nil {
+		if err := m.store.ClearCache(); err != nil {
+			logger.Warn("[embedding] %v", err)
+		}
+	}
 }
 
 // GetCacheSize 获取缓存大小
 func (m *EmbeddingManager) GetCacheSize() int {
-	m.cacheLock.RLock()
-	defer m.cacheLock.RUnlock()
-	return len(m.cache)
+	if m.store != nil {
+		size, _ := m.store.CacheSize()
+		return size
+	}
+
+	return m.cache.len()
+}
+
+// vectorCache 有条目上限的内存向量缓存，超出上限时淘汰最久未使用的条目
+type vectorCache struct {
+	limit int
+	order *list.List // 最近使用的在前
+	items map[string]*list.Element
+	mu    sync.Mutex
+}
+
+// vectorCacheEntry 缓存条目
+type vectorCacheEntry struct {
+	key    string
+	vector []float32
+}
+
+// newVectorCache 创建内存向量缓存
+func newVectorCache(limit int) *vectorCache {
+	return &vectorCache{
+		limit: limit,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get 读取缓存并标记为最近使用
+func (c *vectorCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*vectorCacheEntry).vector, true
+}
+
+// put 写入缓存，超出上限时淘汰最久未使用的条目
+func (c *vectorCache) put(key string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*vectorCacheEntry).vector = vector
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&vectorCacheEntry{key: key, vector: vector})
+	for c.limit > 0 && c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*vectorCacheEntry).key)
+	}
+}
+
+// clear 清空缓存
+func (c *vectorCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// len 返回缓存条目数
+func (c *vectorCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
 }
 
 // NewEmbeddingClient 根据配置创建 Embedding 客户端
@@ -492,6 +774,8 @@ func NewEmbeddingClient(config *EmbeddingConfig, apiKey string) EmbeddingClient
 	switch config.Provider {
 	case "openai":
 		return NewOpenAIEmbeddingClient(config, apiKey)
+	case "local":
+		return NewLocalEmbeddingClient(config.Dimension)
 	case "deepseek":
 		fallthrough
 	default:
@@ -0,0 +1,218 @@
+// Package v2 提供本地离线 Embedding 实现
+package v2
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// 本地 Embedding 默认维度
+const defaultLocalEmbeddingDimension = 512
+
+// 记忆之间相似度计算（MMR 去重、压缩聚类）所用的本地向量维度
+const localSimilarityDimension = 256
+
+// 各类特征的权重
+const (
+	localWeightWord       = 1.0 // 单词
+	localWeightWordBigram = 0.5 // 相邻单词
+	localWeightCharGram   = 0.3 // 单词内字符 3-gram（容忍词形变化）
+	localWeightCJKChar    = 0.5 // 中日韩单字
+	localWeightCJKBigram  = 1.0 // 中日韩相邻两字（近似词）
+)
+
+// LocalEmbeddingClient 纯 Go 本地 Embedding 客户端
+// 使用特征哈希（hashed n-gram + 符号随机投影）生成向量，无需网络和 API Key，
+// 结果确定且可复现，适用于离线环境和测试
+type LocalEmbeddingClient struct {
+	dimension int
+}
+
+// NewLocalEmbeddingClient 创建本地 Embedding 客户端
+func NewLocalEmbeddingClient(dimension int) *LocalEmbeddingClient {
+	if dimension <= 0 {
+		dimension = defaultLocalEmbeddingDimension
+	}
+	return &LocalEmbeddingClient{dimension: dimension}
+}
+
+// Embed 生成单个文本的向量
+func (c *LocalEmbeddingClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 统计特征频次
+	features := make(map[string]float64)
+	for _, seg := range segmentText(text) {
+		if seg.cjk {
+			addCJKFeatures(features, seg.tokens)
+		} else {
+			addWordFeatures(features, seg.tokens)
+		}
+	}
+
+	vec := make([]float32, c.dimension)
+	for feature, weight := range features {
+		h := hashFeature(feature)
+		bucket := int(h % uint64(c.dimension))
+		// 使用哈希最高位作为符号，相当于稀疏随机投影
+		sign := float32(1)
+		if h>>63 == 1 {
+			sign = -1
+		}
+		vec[bucket] += sign * float32(weight)
+	}
+
+	return NormalizeVector(vec), nil
+}
+
+// EmbedBatch 批量生成向量
+func (c *LocalEmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec, err := c.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+// GetDimension 获取向量维度
+func (c *LocalEmbeddingClient) GetDimension() int {
+	return c.dimension
+}
+
+// textSegment 连续的同类文本片段
+type textSegment struct {
+	cjk    bool
+	tokens []string
+}
+
+// segmentText 将文本切分为拉丁词片段和中日韩字片段
+// 标点和空白会打断片段，避免跨句组合 n-gram
+func segmentText(text string) []textSegment {
+	var segments []textSegment
+	var current *textSegment
+	var word strings.Builder
+
+	flushWord := func() {
+		if word.Len() > 0 && current != nil {
+			current.tokens = append(current.tokens, word.String())
+		}
+		word.Reset()
+	}
+	flushSegment := func() {
+		flushWord()
+		if current != nil && len(current.tokens) > 0 {
+			segments = append(segments, *current)
+		}
+		current = nil
+	}
+	ensure := func(cjk bool) {
+		if current == nil || current.cjk != cjk {
+			flushSegment()
+			current = &textSegment{cjk: cjk}
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			ensure(true)
+			current.tokens = append(current.tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			ensure(false)
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			// 空白只结束当前单词，不打断拉丁词片段
+			flushWord()
+		default:
+			flushSegment()
+		}
+	}
+	flushSegment()
+
+	return segments
+}
+
+// addWordFeatures 添加拉丁词特征：单词、相邻词和字符 3-gram
+func addWordFeatures(features map[string]float64, words []string) {
+	counts := make(map[string]int)
+	for i, w := range words {
+		counts["w:"+w]++
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+w]++
+		}
+		padded := []rune("#" + w + "#")
+		for j := 0; j+3 <= len(padded); j++ {
+			counts["c:"+string(padded[j:j+3])]++
+		}
+	}
+	addWeighted(features, counts)
+}
+
+// addCJKFeatures 添加中日韩特征：单字和相邻两字
+func addCJKFeatures(features map[string]float64, chars []string) {
+	counts := make(map[string]int)
+	for i, ch := range chars {
+		counts["h:"+ch]++
+		if i > 0 {
+			counts["hb:"+chars[i-1]+ch]++
+		}
+	}
+	addWeighted(features, counts)
+}
+
+// addWeighted 按次线性词频（1+log tf）和特征类型权重累加特征
+func addWeighted(features map[string]float64, counts map[string]int) {
+	for feature, tf := range counts {
+		features[feature] += (1 + math.Log(float64(tf))) * featureWeight(feature)
+	}
+}
+
+// featureWeight 根据特征前缀返回权重
+func featureWeight(feature string) float64 {
+	switch {
+	case strings.HasPrefix(feature, "w:"):
+		return localWeightWord
+	case strings.HasPrefix(feature, "b:"):
+		return localWeightWordBigram
+	case strings.HasPrefix(feature, "c:"):
+		return localWeightCharGram
+	case strings.HasPrefix(feature, "hb:"):
+		return localWeightCJKBigram
+	default:
+		return localWeightCJKChar
+	}
+}
+
+// hashFeature 计算特征哈希
+func hashFeature(feature string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(feature))
+	return h.Sum64()
+}
+
+// isCJK 判断是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// localMemoryVectors 使用本地 n-gram 向量表示一组记忆，用于比较记忆之间的相似度
+func localMemoryVectors(memories []*Memory) [][]float32 {
+	embedder := NewLocalEmbeddingClient(localSimilarityDimension)
+	vectors := make([][]float32, len(memories))
+	for i, mem := range memories {
+		vectors[i], _ = embedder.Embed(context.Background(), memoryEmbeddingText(mem))
+	}
+	return vectors
+}
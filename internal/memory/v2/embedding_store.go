@@ -0,0 +1,335 @@
+// Package v2 提供 embedding 离线队列与缓存的持久化
+package v2
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 离线队列重试退避参数
+const (
+	embeddingRetryBaseDelay = time.Minute
+	embeddingRetryMaxDelay  = 6 * time.Hour
+)
+
+// 持久化向量缓存的默认上限：超过条目数时淘汰最久未使用的条目，超过 TTL 未使用的条目过期
+const (
+	defaultEmbeddingCacheLimit = 50000
+	defaultEmbeddingCacheTTL   = 90 * 24 * time.Hour
+)
+
+// SQLiteEmbeddingStore 基于 SQLite 的 embedding 状态存储
+// 保存失败待重试的离线任务，以及按内容哈希索引的向量缓存
+type SQLiteEmbeddingStore struct {
+	db         *sql.DB
+	dbPath     string
+	cipher     *MemoryCipher // 非 nil 时离线队列文本加密存储
+	cacheLimit int           // 缓存条目上限（<= 0 表示不限）
+	cacheTTL   time.Duration // 缓存条目未使用的最长时间（<= 0 表示不过期）
+}
+
+// NewSQLiteEmbeddingStore 创建 embedding 状态存储
+func NewSQLiteEmbeddingStore(dbPath string) (*SQLiteEmbeddingStore, error) {
+	dir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建 embedding 存储目录失败: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("打开 embedding 数据库失败: %w", err)
+	}
+
+	store := &SQLiteEmbeddingStore{
+		db:         db,
+		dbPath:     dbPath,
+		cacheLimit: defaultEmbeddingCacheLimit,
+		cacheTTL:   defaultEmbeddingCacheTTL,
+	}
+
+	if err := store.initTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// initTables 初始化数据库表
+func (s *SQLiteEmbeddingStore) initTables() error {
+	queries := []string{
+		// 离线队列（同一 ID 只保留最新文本）
+		`CREATE TABLE IF NOT EXISTS embedding_queue (
+			id TEXT PRIMARY KEY,
+			text TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_queue_next_attempt ON embedding_queue(next_attempt_at)`,
+
+		// 向量缓存（按模型与内容哈希索引）
+		`CREATE TABLE IF NOT EXISTS embedding_cache (
+			content_hash TEXT PRIMARY KEY,
+			vector BLOB NOT NULL,
+			created_at DATETIME NOT NULL,
+			used_at DATETIME
+		)`,
+	}
+
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("初始化 embedding 表失败: %w", err)
+		}
+	}
+
+	if err := s.ensureUsedAtColumn(); err != nil {
+		return fmt.Errorf("初始化 embedding 表失败: %w", err)
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_cache_used_at ON embedding_cache(used_at)`); err != nil {
+		return fmt.Errorf("初始化 embedding 表失败: %w", err)
+	}
+
+	return nil
+}
+
+// ensureUsedAtColumn 为旧版本缓存表补充 used_at 列，已有条目以写入时间作为最近使用时间
+func (s *SQLiteEmbeddingStore) ensureUsedAtColumn() error {
+	rows, err := s.db.Query("PRAGMA table_info(embedding_cache)")
+	if err != nil {
+		return err
+	}
+
+	hasUsedAt := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == "used_at" {
+			hasUsedAt = true
+		}
+	}
+	rows.Close()
+
+	if hasUsedAt {
+		return nil
+	}
+	if _, err := s.db.Exec("ALTER TABLE embedding_cache ADD COLUMN used_at DATETIME"); err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE embedding_cache SET used_at = created_at")
+	return err
+}
+
+// SetCacheLimits 设置缓存条目上限与过期时间（<= 0 表示不限）
+func (s *SQLiteEmbeddingStore) SetCacheLimits(limit int, ttl time.Duration) {
+	s.cacheLimit = limit
+	s.cacheTTL = ttl
+}
+
+// SetCipher 设置离线队列文本的加密器（nil 表示明文存储）
+func (s *SQLiteEmbeddingStore) SetCipher(cipher *MemoryCipher) {
+	s.cipher = cipher
+}
+
+// ========== 离线队列 ==========
+
+// Enqueue 加入离线队列，已存在的同 ID 任务会被覆盖并重置重试计数
+func (s *SQLiteEmbeddingStore) Enqueue(task EmbeddingTask) error {
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+	if task.NextAttemptAt.IsZero() {
+		task.NextAttemptAt = task.CreatedAt
+	}
+
+	text, err := s.cipher.SealString(task.Text)
+	if err != nil {
+		return fmt.Errorf("写入离线队列失败: %w", err)
+	}
+
+	_, err = s.db.Exec(
+		`INSERT OR REPLACE INTO embedding_queue (id, text, attempts, last_error, next_attempt_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		task.ID, text, task.Attempts, task.LastError, task.NextAttemptAt, task.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("写入离线队列失败: %w", err)
+	}
+	return nil
+}
+
+// DueTasks 获取到期可重试的任务
+func (s *SQLiteEmbeddingStore) DueTasks(now time.Time, limit int) ([]EmbeddingTask, error) {
+	rows, err := s.db.Query(
+		`SELECT id, text, attempts, last_error, next_attempt_at, created_at
+		 FROM embedding_queue WHERE next_attempt_at <= ?
+		 ORDER BY next_attempt_at LIMIT ?`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询离线队列失败: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []EmbeddingTask
+	for rows.Next() {
+		var task EmbeddingTask
+		if err := rows.Scan(&task.ID, &task.Text, &task.Attempts, &task.LastError, &task.NextAttemptAt, &task.CreatedAt); err != nil {
+			continue
+		}
+		if task.Text, err = s.cipher.OpenString(task.Text); err != nil {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// MarkFailed 记录一次失败并按退避策略推迟下次重试
+func (s *SQLiteEmbeddingStore) MarkFailed(task EmbeddingTask, cause error, now time.Time) error {
+	// 密文每次加密都不同，需取出当前文本解密后比较，确认任务未被重新入队
+	var stored string
+	err := s.db.QueryRow("SELECT text FROM embedding_queue WHERE id = ?", task.ID).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("更新离线队列失败: %w", err)
+	}
+	if text, err := s.cipher.OpenString(stored); err != nil || text != task.Text {
+		return nil
+	}
+
+	attempts := task.Attempts + 1
+	_, err = s.db.Exec(
+		`UPDATE embedding_queue SET attempts = ?, last_error = ?, next_attempt_at = ?
+		 WHERE id = ? AND text = ?`,
+		attempts, cause.Error(), now.Add(embeddingRetryDelay(attempts)), task.ID, stored,
+	)
+	if err != nil {
+		return fmt.Errorf("更新离线队列失败: %w", err)
+	}
+	return nil
+}
+
+// Dequeue 从离线队列移除任务
+func (s *SQLiteEmbeddingStore) Dequeue(id string) error {
+	if _, err := s.db.Exec("DELETE FROM embedding_queue WHERE id = ?", id); err != nil {
+		return fmt.Errorf("删除离线任务失败: %w", err)
+	}
+	return nil
+}
+
+// QueueSize 获取离线队列大小
+func (s *SQLiteEmbeddingStore) QueueSize() (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM embedding_queue").Scan(&count); err != nil {
+		return 0, fmt.Errorf("获取离线队列大小失败: %w", err)
+	}
+	return count, nil
+}
+
+// ========== 向量缓存 ==========
+
+// GetCached 按内容哈希读取缓存向量，命中时刷新最近使用时间，过期条目视为未命中
+func (s *SQLiteEmbeddingStore) GetCached(contentHash string) ([]float32, bool) {
+	var blob []byte
+	var usedAt sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT vector, used_at FROM embedding_cache WHERE content_hash = ?", contentHash,
+	).Scan(&blob, &usedAt)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	if s.cacheTTL > 0 && usedAt.Valid && now.Sub(usedAt.Time) > s.cacheTTL {
+		_, _ = s.db.Exec("DELETE FROM embedding_cache WHERE content_hash = ?", contentHash)
+		return nil, false
+	}
+
+	// 刷新失败只影响淘汰顺序
+	_, _ = s.db.Exec("UPDATE embedding_cache SET used_at = ? WHERE content_hash = ?", now, contentHash)
+	return blobToVector(blob), true
+}
+
+// PutCached 写入缓存向量，并淘汰过期及超出上限的条目
+func (s *SQLiteEmbeddingStore) PutCached(contentHash string, vector []float32) error {
+	now := time.Now()
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO embedding_cache (content_hash, vector, created_at, used_at) VALUES (?, ?, ?, ?)",
+		contentHash, vectorToBlob(vector), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("写入 embedding 缓存失败: %w", err)
+	}
+	return s.pruneCache(now)
+}
+
+// pruneCache 删除超过 TTL 未使用的条目，条目数超出上限时删除最久未使用的条目
+func (s *SQLiteEmbeddingStore) pruneCache(now time.Time) error {
+	if s.cacheTTL > 0 {
+		if _, err := s.db.Exec("DELETE FROM embedding_cache WHERE used_at < ?", now.Add(-s.cacheTTL)); err != nil {
+			return fmt.Errorf("清理 embedding 缓存失败: %w", err)
+		}
+	}
+	if s.cacheLimit > 0 {
+		_, err := s.db.Exec(
+			`DELETE FROM embedding_cache WHERE content_hash IN (
+				SELECT content_hash FROM embedding_cache ORDER BY used_at DESC LIMIT -1 OFFSET ?
+			)`, s.cacheLimit,
+		)
+		if err != nil {
+			return fmt.Errorf("清理 embedding 缓存失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClearCache 清空缓存
+func (s *SQLiteEmbeddingStore) ClearCache() error {
+	if _, err := s.db.Exec("DELETE FROM embedding_cache"); err != nil {
+		return fmt.Errorf("清空 embedding 缓存失败: %w", err)
+	}
+	return nil
+}
+
+// CacheSize 获取缓存条目数
+func (s *SQLiteEmbeddingStore) CacheSize() (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM embedding_cache").Scan(&count); err != nil {
+		return 0, fmt.Errorf("获取 embedding 缓存大小失败: %w", err)
+	}
+	return count, nil
+}
+
+// Close 关闭数据库连接
+func (s *SQLiteEmbeddingStore) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// embeddingRetryDelay 计算第 attempts 次失败后的重试间隔（指数退避，有上限）
+func embeddingRetryDelay(attempts int) time.Duration {
+	delay := embeddingRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= embeddingRetryMaxDelay {
+			return embeddingRetryMaxDelay
+		}
+	}
+	return delay
+}
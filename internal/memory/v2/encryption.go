@@ -0,0 +1,556 @@
+// Package v2 提供记忆静态加密：Markdown 文件、会话记录与索引中的内容以 XChaCha20-Poly1305 加密存储
+package v2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 加密数据格式
+// 文件：魔数 + 24 字节随机 nonce + 密文（含认证标签），魔数同时作为附加认证数据
+// 数据库字段：前缀 + base64(nonce + 密文)
+const (
+	encryptedFileMagic   = "AIMATE-ENC1\n"
+	encryptedFieldPrefix = "enc1:"
+)
+
+// editDirName 编辑加密记忆时存放解密草稿的私有目录（位于全局记忆目录下）
+const editDirName = ".edit"
+
+// 口令派生密钥的 Argon2id 参数
+const (
+	keyFileVersion  = 1
+	argon2Time      = 3
+	argon2MemoryKiB = 64 * 1024
+	argon2Threads   = 4
+	keyCheckText    = "aimate-memory-key"
+)
+
+// 加密相关错误
+var (
+	ErrEncryptedData  = errors.New("数据已加密，但未启用加密或未加载密钥")
+	ErrWrongKey       = errors.New("密钥或口令错误，无法解密")
+	ErrKeyFileMissing = errors.New("未找到加密密钥文件")
+)
+
+// keyFile 密钥文件（权限 0600）
+// kdf 为 none 时直接保存随机密钥；为 argon2id 时只保存盐与校验串，密钥由口令派生
+type keyFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Key     string `json:"key,omitempty"`
+	Salt    string `json:"salt,omitempty"`
+	Check   string `json:"check,omitempty"` // 用派生密钥加密的校验串，用于识别错误口令
+}
+
+// MemoryCipher 记忆加密器
+// 方法对 nil 接收者安全：未启用加密时写入原样返回，读取到密文时返回 ErrEncryptedData
+type MemoryCipher struct {
+	key []byte
+}
+
+// NewMemoryCipher 由 32 字节密钥创建加密器
+func NewMemoryCipher(key []byte) (*MemoryCipher, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("密钥长度必须为 %d 字节", chacha20poly1305.KeySize)
+	}
+	return &MemoryCipher{key: append([]byte(nil), key...)}, nil
+}
+
+// IsEncrypted 判断文件内容是否为密文
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedFileMagic))
+}
+
+// Seal 加密文件内容（已是密文时原样返回）
+func (c *MemoryCipher) Seal(plain []byte) ([]byte, error) {
+	if c == nil || IsEncrypted(plain) {
+		return plain, nil
+	}
+	sealed, err := c.seal(plain, []byte(encryptedFileMagic))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(encryptedFileMagic), sealed...), nil
+}
+
+// Open 解密文件内容（明文原样返回，便于迁移期间读取混合状态的目录）
+func (c *MemoryCipher) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrEncryptedData
+	}
+	return c.open(data[len(encryptedFileMagic):], []byte(encryptedFileMagic))
+}
+
+// SealString 加密数据库字段
+func (c *MemoryCipher) SealString(plain string) (string, error) {
+	if c == nil || strings.HasPrefix(plain, encryptedFieldPrefix) {
+		return plain, nil
+	}
+	sealed, err := c.seal([]byte(plain), []byte(encryptedFieldPrefix))
+	if err != nil {
+		return "", err
+	}
+	return encryptedFieldPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenString 解密数据库字段（明文原样返回）
+func (c *MemoryCipher) OpenString(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedFieldPrefix) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrEncryptedData
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedFieldPrefix))
+	if err != nil {
+		return "", fmt.Errorf("解码加密字段失败: %w", err)
+	}
+	plain, err := c.open(sealed, []byte(encryptedFieldPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// seal 生成随机 nonce 并加密，返回 nonce + 密文
+func (c *MemoryCipher) seal(plain, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+// open 解密 nonce + 密文
+func (c *MemoryCipher) open(sealed, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+// LoadMemoryCipher 从密钥文件加载加密器（口令模式从环境变量读取口令）
+func LoadMemoryCipher(cfg EncryptionConfig) (*MemoryCipher, error) {
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyFileMissing, cfg.KeyFile)
+		}
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+
+	switch kf.KDF {
+	case "none":
+		key, err := base64.StdEncoding.DecodeString(kf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("解析密钥失败: %w", err)
+		}
+		return NewMemoryCipher(key)
+	case "argon2id":
+		passphrase := os.Getenv(cfg.PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("密钥由口令派生，请设置环境变量 %s", cfg.PassphraseEnv)
+		}
+		salt, err := base64.StdEncoding.DecodeString(kf.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+		}
+		cipher, err := NewMemoryCipher(deriveKey(passphrase, salt))
+		if err != nil {
+			return nil, err
+		}
+		if check, err := cipher.OpenString(kf.Check); err != nil || check != keyCheckText {
+			return nil, ErrWrongKey
+		}
+		return cipher, nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥派生方式: %s", kf.KDF)
+	}
+}
+
+// CreateMemoryKey 创建密钥文件并返回加密器（文件已存在时直接加载）
+// 设置了口令环境变量时由口令派生密钥，否则生成随机密钥
+func CreateMemoryKey(cfg EncryptionConfig) (*MemoryCipher, error) {
+	if FileExists(cfg.KeyFile) {
+		return LoadMemoryCipher(cfg)
+	}
+
+	kf := keyFile{Version: keyFileVersion}
+	var cipher *MemoryCipher
+	if passphrase := os.Getenv(cfg.PassphraseEnv); passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("生成随机数失败: %w", err)
+		}
+		var err error
+		if cipher, err = NewMemoryCipher(deriveKey(passphrase, salt)); err != nil {
+			return nil, err
+		}
+		check, err := cipher.SealString(keyCheckText)
+		if err != nil {
+			return nil, err
+		}
+		kf.KDF = "argon2id"
+		kf.Salt = base64.StdEncoding.EncodeToString(salt)
+		kf.Check = check
+	} else {
+		key := make([]byte, chacha20poly1305.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("生成密钥失败: %w", err)
+		}
+		var err error
+		if cipher, err = NewMemoryCipher(key); err != nil {
+			return nil, err
+		}
+		kf.KDF = "none"
+		kf.Key = base64.StdEncoding.EncodeToString(key)
+	}
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.KeyFile), 0700); err != nil {
+		return nil, fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+	if err := writeFileAtomic(cfg.KeyFile, data, 0600); err != nil {
+		return nil, fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	return cipher, nil
+}
+
+// deriveKey 由口令派生 32 字节密钥
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2MemoryKiB, argon2Threads, chacha20poly1305.KeySize)
+}
+
+// EncryptionMigrationResult 加密迁移结果
+type EncryptionMigrationResult struct {
+	Encrypt      bool     `json:"encrypt"`
+	Files        int      `json:"files"`         // 转换的 Markdown 文件数
+	Renamed      int      `json:"renamed"`       // 由标题命名改为 ID 命名的记忆文件数
+	Unchanged    int      `json:"unchanged"`     // 已是目标状态的文件数
+	Records      int      `json:"records"`       // 转换的数据库记录数（会话消息、embedding 队列）
+	HistoryRoots []string `json:"history_roots"` // 启用了版本历史的根目录（历史提交不会被改写）
+	SyncClones   []string `json:"sync_clones"`   // 团队同步的本地克隆（始终为明文，不做迁移）
+}
+
+// MigrateEncryption 将记忆根目录中的全部 Markdown 文件与数据库内容加密（encrypt 为 true）或解密为明文
+// 迁移期间持有各根目录的写锁，其他 AIMate 进程的写入会等待迁移完成
+func MigrateEncryption(storage *StorageManager, cipher *MemoryCipher, encrypt bool) (*EncryptionMigrationResult, error) {
+	if cipher == nil {
+		return nil, fmt.Errorf("未加载加密密钥")
+	}
+	result := &EncryptionMigrationResult{Encrypt: encrypt}
+
+	roots := []string{storage.GetGlobalRoot()}
+	if storage.GetProjectRoot() != "" {
+		roots = append(roots, storage.GetProjectRoot())
+	}
+
+	for _, root := range roots {
+		if !FileExists(root) {
+			continue
+		}
+		lock := NewFileLock(filepath.Join(root, writeLockFile))
+		if err := lock.Lock(); err != nil {
+			return result, err
+		}
+		err := migrateRoot(root, cipher, encrypt, result)
+		lock.Unlock()
+		if err != nil {
+			return result, err
+		}
+		if isGitRepo(root) {
+			result.HistoryRoots = append(result.HistoryRoots, root)
+		}
+	}
+
+	syncRoot := teamSyncRoot(storage)
+	if entries, err := os.ReadDir(syncRoot); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				result.SyncClones = append(result.SyncClones, filepath.Join(syncRoot, entry.Name()))
+			}
+		}
+	}
+	return result, nil
+}
+
+// migrateRoot 转换根目录中的 Markdown 文件与数据库
+// 加密时同时将以标题命名的记忆文件改为以 ID 命名，并更新索引中的路径
+func migrateRoot(root string, cipher *MemoryCipher, encrypt bool, result *EncryptionMigrationResult) error {
+	renamed := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".md") && !isEncryptedStateFile(path) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		plain, err := cipher.Open(data)
+		if err != nil {
+			return fmt.Errorf("转换 %s 失败: %w", path, err)
+		}
+
+		target := path
+		if encrypt && strings.HasSuffix(path, ".md") {
+			target = opaqueMemoryPath(path, plain)
+		}
+		if IsEncrypted(data) == encrypt && target == path {
+			result.Unchanged++
+			return nil
+		}
+
+		converted := plain
+		if encrypt {
+			if converted, err = cipher.Seal(data); err != nil {
+				return fmt.Errorf("转换 %s 失败: %w", path, err)
+			}
+		}
+		if err := writeFileAtomic(target, converted, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", target, err)
+		}
+		if target != path {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("删除 %s 失败: %w", path, err)
+			}
+			renamed[path] = target
+			result.Renamed++
+		}
+		if IsEncrypted(data) != encrypt {
+			result.Files++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 索引库中的会话消息与 embedding 队列中的待嵌入文本（向量库不含原文）
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".db") || entry.Name() == "vectors.db" {
+			continue
+		}
+		n, err := migrateDatabase(filepath.Join(root, entry.Name()), encryptedColumns, cipher, encrypt, renamed)
+		if err != nil {
+			return err
+		}
+		result.Records += n
+	}
+	return nil
+}
+
+// encryptedColumn 加密存储的数据库字段
+type encryptedColumn struct {
+	table  string
+	column string
+}
+
+// encryptedColumns 保存原文的数据库字段（不存在的表会被跳过）
+var encryptedColumns = []encryptedColumn{
+	{table: "memory_index", column: "title"},
+	{table: "memory_index", column: "tags"},
+	{table: "session_messages", column: "content"},
+	{table: "embedding_queue", column: "text"},
+}
+
+// encryptedStateFiles 与记忆文件一同加密的状态文件（包含待审核的记忆内容）
+var encryptedStateFiles = []string{"review_queue.json"}
+
+// isEncryptedStateFile 判断是否为需要加密的状态文件
+func isEncryptedStateFile(path string) bool {
+	for _, name := range encryptedStateFiles {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// opaqueMemoryPath 返回以标题命名的记忆文件改为以 ID 命名后的路径（其他文件与目标已存在时返回原路径）
+func opaqueMemoryPath(path string, plain []byte) string {
+	mem, err := NewFrontmatterParser().ParseMemory(plain)
+	if err != nil || mem.ID == "" || filepath.Base(path) != titledFileName(mem) {
+		return path
+	}
+	target := filepath.Join(filepath.Dir(path), opaqueFileName(mem))
+	if FileExists(target) {
+		return path
+	}
+	return target
+}
+
+// migrateDatabase 转换数据库中的加密字段、更新改名文件的索引路径，并清理残留明文的空闲页与全文索引
+func migrateDatabase(path string, columns []encryptedColumn, cipher *MemoryCipher, encrypt bool, renamed map[string]string) (int, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return 0, fmt.Errorf("打开数据库 %s 失败: %w", path, err)
+	}
+	defer db.Close()
+
+	converted := 0
+	for _, col := range columns {
+		var exists int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, col.table).Scan(&exists); err != nil || exists == 0 {
+			continue
+		}
+
+		rows, err := db.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s`, col.column, col.table))
+		if err != nil {
+			return converted, fmt.Errorf("读取 %s 失败: %w", col.table, err)
+		}
+		updates := make(map[int64]string)
+		for rows.Next() {
+			var rowid int64
+			var value sql.NullString
+			if err := rows.Scan(&rowid, &value); err != nil {
+				rows.Close()
+				return converted, err
+			}
+			if !value.Valid || strings.HasPrefix(value.String, encryptedFieldPrefix) == encrypt {
+				continue
+			}
+			var next string
+			if encrypt {
+				next, err = cipher.SealString(value.String)
+			} else {
+				next, err = cipher.OpenString(value.String)
+			}
+			if err != nil {
+				rows.Close()
+				return converted, fmt.Errorf("转换 %s 失败: %w", col.table, err)
+			}
+			updates[rowid] = next
+		}
+		rows.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			return converted, err
+		}
+		for rowid, value := range updates {
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, col.table, col.column), value, rowid); err != nil {
+				tx.Rollback()
+				return converted, fmt.Errorf("更新 %s 失败: %w", col.table, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return converted, err
+		}
+		converted += len(updates)
+	}
+
+	if len(renamed) > 0 {
+		var exists int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'memory_index'`).Scan(&exists); err == nil && exists > 0 {
+			for oldPath, newPath := range renamed {
+				if _, err := db.Exec(`UPDATE memory_index SET file_path = ? WHERE file_path = ?`, newPath, oldPath); err != nil {
+					return converted, fmt.Errorf("更新索引路径失败: %w", err)
+				}
+			}
+		}
+	}
+
+	// 重建全文索引并整理数据库，避免旧明文残留在索引段与空闲页中
+	_, _ = db.Exec(`INSERT INTO memory_fts(memory_fts) VALUES('rebuild')`)
+	_, _ = db.Exec(`INSERT INTO session_message_fts(session_message_fts) VALUES('rebuild')`)
+	if _, err := db.Exec(`VACUUM`); err != nil {
+		return converted, fmt.Errorf("整理数据库 %s 失败: %w", path, err)
+	}
+	_, _ = db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return converted, nil
+}
+
+// EncryptMemoryStorage 加密（encrypt 为 true）或解密全局与 projectPath 所在项目的记忆，并更新全局配置
+// 加密时先启用配置再转换、解密时先转换再关闭配置，使中途失败时已转换的文件仍可读取
+func EncryptMemoryStorage(projectPath string, encrypt bool) (*EncryptionMigrationResult, error) {
+	configMgr, err := NewConfigManager()
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	cfg := configMgr.GetGlobalConfig()
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("初始化存储失败: %w", err)
+	}
+	if projectPath != "" {
+		if err := storage.SetCurrentProject(projectPath); err != nil {
+			return nil, fmt.Errorf("设置项目失败: %w", err)
+		}
+	}
+
+	var cipher *MemoryCipher
+	if encrypt {
+		cipher, err = CreateMemoryKey(cfg.Encryption)
+	} else {
+		cipher, err = LoadMemoryCipher(cfg.Encryption)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("加载加密密钥失败: %w", err)
+	}
+
+	if encrypt {
+		if err := configMgr.SetEncryptionEnabled(true); err != nil {
+			return nil, fmt.Errorf("保存配置失败: %w", err)
+		}
+	}
+	result, err := MigrateEncryption(storage, cipher, encrypt)
+	if err != nil {
+		return result, err
+	}
+	if !encrypt {
+		if err := configMgr.SetEncryptionEnabled(false); err != nil {
+			return result, fmt.Errorf("保存配置失败: %w", err)
+		}
+	}
+	return result, nil
+}
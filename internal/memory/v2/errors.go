@@ -14,6 +14,7 @@ var (
 	ErrFileNotFound      = errors.New("文件不存在")
 	ErrInvalidFilePath   = errors.New("无效的文件路径")
 	ErrFileAlreadyExists = errors.New("文件已存在")
+	ErrSessionModified   = errors.New("会话文件已被其他进程修改")
 
 	// 解析相关错误
 	ErrInvalidFrontmatter  = errors.New("无效的 frontmatter")
@@ -25,6 +26,7 @@ var (
 	ErrIndexNotFound   = errors.New("索引记录不存在")
 	ErrIndexOutOfSync  = errors.New("索引与文件不同步")
 	ErrVectorNotFound  = errors.New("向量记录不存在")
+	ErrVectorSpace     = errors.New("向量库的嵌入模型与当前配置不一致，需要重建向量")
 	ErrDatabaseError   = errors.New("数据库操作失败")
 	ErrEmbeddingFailed = errors.New("向量嵌入失败")
 
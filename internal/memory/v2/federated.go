@@ -0,0 +1,571 @@
+// Package v2 提供全局与项目索引的联合存储
+package v2
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// FederatedIndexStore 联合索引存储
+// 全局记忆写入全局 index.db，项目记忆写入项目目录下的 index.db，查询时合并两者的结果，
+// 使项目的 .aimate/memory 目录自成一体，可随仓库提交
+type FederatedIndexStore struct {
+	global  *SQLiteIndexStore
+	project *SQLiteIndexStore
+	mu      sync.RWMutex
+}
+
+// NewFederatedIndexStore 创建联合索引存储（未打开项目时只使用全局索引）
+func NewFederatedIndexStore(global *SQLiteIndexStore) *FederatedIndexStore {
+	return &FederatedIndexStore{global: global}
+}
+
+// SetProject 切换项目索引，返回之前的项目索引（由调用方关闭）
+func (f *FederatedIndexStore) SetProject(project *SQLiteIndexStore) *SQLiteIndexStore {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous := f.project
+	f.project = project
+	return previous
+}
+
+// Global 返回全局索引
+func (f *FederatedIndexStore) Global() *SQLiteIndexStore {
+	return f.global
+}
+
+// Project 返回当前项目索引（未打开项目时为 nil）
+func (f *FederatedIndexStore) Project() *SQLiteIndexStore {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.project
+}
+
+// stores 返回当前使用的索引（项目在前）
+func (f *FederatedIndexStore) stores() []*SQLiteIndexStore {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.project != nil {
+		return []*SQLiteIndexStore{f.project, f.global}
+	}
+	return []*SQLiteIndexStore{f.global}
+}
+
+// target 返回指定作用域的记忆所在的索引
+func (f *FederatedIndexStore) target(scope MemoryScope) *SQLiteIndexStore {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if scope == ScopeProject && f.project != nil {
+		return f.project
+	}
+	return f.global
+}
+
+// inProject 判断记忆是否保存在项目索引中
+func (f *FederatedIndexStore) inProject(id string) bool {
+	project := f.Project()
+	if project == nil {
+		return false
+	}
+	_, err := project.GetIndex(id)
+	return err == nil
+}
+
+// CreateIndex 按作用域写入对应索引
+func (f *FederatedIndexStore) CreateIndex(idx *MemoryIndex) error {
+	return f.target(idx.Scope).CreateIndex(idx)
+}
+
+// GetIndex 按 ID 查找（先项目后全局）
+func (f *FederatedIndexStore) GetIndex(id string) (*MemoryIndex, error) {
+	for _, store := range f.stores() {
+		idx, err := store.GetIndex(id)
+		if err == nil || !IsNotFound(err) {
+			return idx, err
+		}
+	}
+	return nil, ErrIndexNotFound
+}
+
+// GetIndexByPath 按文件路径查找（先项目后全局）
+func (f *FederatedIndexStore) GetIndexByPath(filePath string) (*MemoryIndex, error) {
+	for _, store := range f.stores() {
+		idx, err := store.GetIndexByPath(filePath)
+		if err == nil || !IsNotFound(err) {
+			return idx, err
+		}
+	}
+	return nil, ErrIndexNotFound
+}
+
+// UpdateIndex 更新索引，作用域变化时将记录迁移到对应索引
+func (f *FederatedIndexStore) UpdateIndex(idx *MemoryIndex) error {
+	target := f.target(idx.Scope)
+	err := target.UpdateIndex(idx)
+	if !IsNotFound(err) {
+		return err
+	}
+
+	for _, store := range f.stores() {
+		if store == target {
+			continue
+		}
+		if delErr := store.DeleteIndex(idx.ID); delErr == nil {
+			return target.CreateIndex(idx)
+		}
+	}
+	return err
+}
+
+// DeleteIndex 从所有索引中删除
+func (f *FederatedIndexStore) DeleteIndex(id string) error {
+	return f.deleteFromAll(func(store *SQLiteIndexStore) error {
+		return store.DeleteIndex(id)
+	})
+}
+
+// DeleteIndexByPath 按文件路径从所有索引中删除
+func (f *FederatedIndexStore) DeleteIndexByPath(filePath string) error {
+	return f.deleteFromAll(func(store *SQLiteIndexStore) error {
+		return store.DeleteIndexByPath(filePath)
+	})
+}
+
+// deleteFromAll 在所有索引上执行删除，均未找到时返回 ErrIndexNotFound
+func (f *FederatedIndexStore) deleteFromAll(del func(store *SQLiteIndexStore) error) error {
+	found := false
+	for _, store := range f.stores() {
+		err := del(store)
+		if err == nil {
+			found = true
+			continue
+		}
+		if !IsNotFound(err) {
+			return err
+		}
+	}
+	if !found {
+		return ErrIndexNotFound
+	}
+	return nil
+}
+
+// GetRecentMemories 获取最近 N 天的记忆
+func (f *FederatedIndexStore) GetRecentMemories(days int, memType MemoryType) ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetRecentMemories(days, memType)
+	})
+}
+
+// GetExpiredMemories 获取过期记忆
+func (f *FederatedIndexStore) GetExpiredMemories() ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetExpiredMemories()
+	})
+}
+
+// GetMemoriesByType 按类型获取记忆
+func (f *FederatedIndexStore) GetMemoriesByType(memType MemoryType) ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetMemoriesByType(memType)
+	})
+}
+
+// GetMemoriesByScope 按作用域获取记忆
+func (f *FederatedIndexStore) GetMemoriesByScope(scope MemoryScope) ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetMemoriesByScope(scope)
+	})
+}
+
+// GetMemoriesByCategory 按分类获取记忆
+func (f *FederatedIndexStore) GetMemoriesByCategory(category MemoryCategory) ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetMemoriesByCategory(category)
+	})
+}
+
+// SearchByKeyword 关键词搜索，两个索引的结果按名次交替合并
+func (f *FederatedIndexStore) SearchByKeyword(keyword string, limit int) ([]*MemoryIndex, error) {
+	var lists [][]*MemoryIndex
+	for _, store := range f.stores() {
+		results, err := store.SearchByKeyword(keyword, limit)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, results)
+	}
+	return interleave(lists, limit), nil
+}
+
+// IncrementAccessCount 增加访问计数
+func (f *FederatedIndexStore) IncrementAccessCount(id string) error {
+	for _, store := range f.stores() {
+		err := store.IncrementAccessCount(id)
+		if err == nil || !IsNotFound(err) {
+			return err
+		}
+	}
+	return ErrIndexNotFound
+}
+
+// GetIndexStats 汇总两个索引的统计
+func (f *FederatedIndexStore) GetIndexStats() (*IndexStats, error) {
+	total := &IndexStats{}
+	for _, store := range f.stores() {
+		stats, err := store.GetIndexStats()
+		if err != nil {
+			return nil, err
+		}
+		total.TotalCount += stats.TotalCount
+		total.CoreCount += stats.CoreCount
+		total.SessionCount += stats.SessionCount
+		total.ShortTermCount += stats.ShortTermCount
+		total.LongTermCount += stats.LongTermCount
+		total.GlobalCount += stats.GlobalCount
+		total.ProjectCount += stats.ProjectCount
+		total.ExpiredCount += stats.ExpiredCount
+	}
+	return total, nil
+}
+
+// GetAllIndexes 获取所有索引
+func (f *FederatedIndexStore) GetAllIndexes() ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetAllIndexes()
+	})
+}
+
+// GetOrphanedIndexes 获取文件已不存在的索引
+func (f *FederatedIndexStore) GetOrphanedIndexes(existingFiles map[string]bool) ([]*MemoryIndex, error) {
+	return f.queryAll(func(store *SQLiteIndexStore) ([]*MemoryIndex, error) {
+		return store.GetOrphanedIndexes(existingFiles)
+	})
+}
+
+// IndexSessionMessage 写入会话消息索引（打开项目时会话保存在项目目录中）
+func (f *FederatedIndexStore) IndexSessionMessage(sessionID string, msg *SessionMessage) error {
+	return f.target(ScopeProject).IndexSessionMessage(sessionID, msg)
+}
+
+// DeleteSessionMessages 从所有索引中删除会话消息
+func (f *FederatedIndexStore) DeleteSessionMessages(sessionID string, fromSequence int) error {
+	for _, store := range f.stores() {
+		if err := store.DeleteSessionMessages(sessionID, fromSequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchSessionMessages 搜索会话消息，两个索引的结果按名次交替合并
+func (f *FederatedIndexStore) SearchSessionMessages(query string, limit int) ([]*SessionMessageHit, error) {
+	var lists [][]*SessionMessageHit
+	for _, store := range f.stores() {
+		hits, err := store.SearchSessionMessages(query, limit)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, hits)
+	}
+	return interleave(lists, limit), nil
+}
+
+// Close 关闭全局与项目索引
+func (f *FederatedIndexStore) Close() error {
+	var firstErr error
+	for _, store := range f.stores() {
+		if err := store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// queryAll 在所有索引上查询并拼接结果
+func (f *FederatedIndexStore) queryAll(query func(store *SQLiteIndexStore) ([]*MemoryIndex, error)) ([]*MemoryIndex, error) {
+	var all []*MemoryIndex
+	for _, store := range f.stores() {
+		results, err := query(store)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, results...)
+	}
+	return all, nil
+}
+
+// interleave 按名次交替合并多个有序列表
+func interleave[T any](lists [][]T, limit int) []T {
+	var merged []T
+	for i := 0; ; i++ {
+		added := false
+		for _, list := range lists {
+			if i < len(list) {
+				merged = append(merged, list[i])
+				added = true
+			}
+		}
+		if !added || (limit > 0 && len(merged) >= limit) {
+			break
+		}
+	}
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
+
+// FederatedVectorStore 联合向量存储
+// 向量与其索引记录保存在同一位置：项目记忆的向量写入项目目录下的 vectors.db
+type FederatedVectorStore struct {
+	global  *SQLiteVectorStore
+	project *SQLiteVectorStore
+	index   *FederatedIndexStore
+	mu      sync.RWMutex
+}
+
+// NewFederatedVectorStore 创建联合向量存储，根据 index 判断记忆属于全局还是项目
+func NewFederatedVectorStore(global *SQLiteVectorStore, index *FederatedIndexStore) *FederatedVectorStore {
+	return &FederatedVectorStore{global: global, index: index}
+}
+
+// SetProject 切换项目向量库，返回之前的项目向量库（由调用方关闭）
+func (f *FederatedVectorStore) SetProject(project *SQLiteVectorStore) *SQLiteVectorStore {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous := f.project
+	f.project = project
+	return previous
+}
+
+// Global 返回全局向量库
+func (f *FederatedVectorStore) Global() *SQLiteVectorStore {
+	return f.global
+}
+
+// stores 返回当前使用的向量库（项目在前）
+func (f *FederatedVectorStore) stores() []*SQLiteVectorStore {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.project != nil {
+		return []*SQLiteVectorStore{f.project, f.global}
+	}
+	return []*SQLiteVectorStore{f.global}
+}
+
+// target 返回记忆向量所在的向量库
+func (f *FederatedVectorStore) target(id string) *SQLiteVectorStore {
+	f.mu.RLock()
+	project := f.project
+	f.mu.RUnlock()
+	if project != nil && f.index.inProject(id) {
+		return project
+	}
+	return f.global
+}
+
+// StoreVector 存储向量
+func (f *FederatedVectorStore) StoreVector(id string, vector []float32) error {
+	return f.target(id).StoreVector(id, vector)
+}
+
+// GetVector 获取向量（先项目后全局）
+func (f *FederatedVectorStore) GetVector(id string) ([]float32, error) {
+	for _, store := range f.stores() {
+		vec, err := store.GetVector(id)
+		if err == nil || !IsNotFound(err) {
+			return vec, err
+		}
+	}
+	return nil, ErrVectorNotFound
+}
+
+// DeleteVector 从所有向量库中删除
+func (f *FederatedVectorStore) DeleteVector(id string) error {
+	found := false
+	for _, store := range f.stores() {
+		err := store.DeleteVector(id)
+		if err == nil {
+			found = true
+			continue
+		}
+		if !IsNotFound(err) {
+			return err
+		}
+	}
+	if !found {
+		return ErrVectorNotFound
+	}
+	return nil
+}
+
+// UpdateVector 更新向量
+func (f *FederatedVectorStore) UpdateVector(id string, vector []float32) error {
+	return f.target(id).UpdateVector(id, vector)
+}
+
+// SearchSimilar 在所有向量库中搜索并按相似度合并
+// 需要重建的向量库被跳过，其余向量库照常搜索；全部需要重建时返回 ErrVectorSpace
+func (f *FederatedVectorStore) SearchSimilar(queryVector []float32, topK int, minSimilarity float64) ([]*VectorSearchResult, error) {
+	var all []*VectorSearchResult
+	stores := f.stores()
+	stale := 0
+	for _, store := range stores {
+		results, err := store.SearchSimilar(queryVector, topK, minSimilarity)
+		if errors.Is(err, ErrVectorSpace) {
+			stale++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, results...)
+	}
+	if stale == len(stores) {
+		return nil, ErrVectorSpace
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Score > all[j].Score
+	})
+	if topK > 0 && len(all) > topK {
+		all = all[:topK]
+	}
+	return all, nil
+}
+
+// BatchStoreVectors 批量存储向量
+func (f *FederatedVectorStore) BatchStoreVectors(items map[string][]float32) error {
+	for store, batch := range f.split(items) {
+		if err := store.BatchStoreVectors(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVectorCount 获取向量总数
+func (f *FederatedVectorStore) GetVectorCount() (int, error) {
+	total := 0
+	for _, store := range f.stores() {
+		count, err := store.GetVectorCount()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// GetVectorStats 汇总向量统计（模型与维度以全局向量库为准）
+func (f *FederatedVectorStore) GetVectorStats() (*VectorStats, error) {
+	stats, err := f.global.GetVectorStats()
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	project := f.project
+	f.mu.RUnlock()
+	if project != nil {
+		projectStats, err := project.GetVectorStats()
+		if err != nil {
+			return nil, err
+		}
+		stats.TotalVectors += projectStats.TotalVectors
+		stats.IndexedVectors += projectStats.IndexedVectors
+		stats.IndexReady = stats.IndexReady && projectStats.IndexReady
+		stats.NeedsReembed = stats.NeedsReembed || projectStats.NeedsReembed
+	}
+	return stats, nil
+}
+
+// Close 关闭全局与项目向量库
+func (f *FederatedVectorStore) Close() error {
+	var firstErr error
+	for _, store := range f.stores() {
+		if err := store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ========== 向量重建 ==========
+
+// Space 返回全局向量库的向量空间
+func (f *FederatedVectorStore) Space() VectorSpace {
+	return f.global.Space()
+}
+
+// TargetSpace 返回当前配置的向量空间
+func (f *FederatedVectorStore) TargetSpace() VectorSpace {
+	return f.global.TargetSpace()
+}
+
+// NeedsReembed 任一向量库与当前配置不一致时返回 true
+func (f *FederatedVectorStore) NeedsReembed() bool {
+	for _, store := range f.stores() {
+		if store.NeedsReembed() {
+			return true
+		}
+	}
+	return false
+}
+
+// BeginReembed 在所有向量库上开始重建
+func (f *FederatedVectorStore) BeginReembed() error {
+	var begun []*SQLiteVectorStore
+	for _, store := range f.stores() {
+		if err := store.BeginReembed(); err != nil {
+			for _, s := range begun {
+				s.AbortReembed()
+			}
+			return err
+		}
+		begun = append(begun, store)
+	}
+	return nil
+}
+
+// StoreReembedded 按记忆所在位置写入重建后的向量
+func (f *FederatedVectorStore) StoreReembedded(items map[string][]float32) error {
+	for store, batch := range f.split(items) {
+		if err := store.StoreReembedded(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitReembed 提交所有向量库的重建
+func (f *FederatedVectorStore) CommitReembed() error {
+	for _, store := range f.stores() {
+		if err := store.CommitReembed(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AbortReembed 放弃所有向量库的重建
+func (f *FederatedVectorStore) AbortReembed() {
+	for _, store := range f.stores() {
+		store.AbortReembed()
+	}
+}
+
+// split 按记忆所在位置拆分向量
+func (f *FederatedVectorStore) split(items map[string][]float32) map[*SQLiteVectorStore]map[string][]float32 {
+	batches := make(map[*SQLiteVectorStore]map[string][]float32)
+	for id, vec := range items {
+		store := f.target(id)
+		if batches[store] == nil {
+			batches[store] = make(map[string][]float32)
+		}
+		batches[store][id] = vec
+	}
+	return batches
+}
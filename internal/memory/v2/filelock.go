@@ -0,0 +1,129 @@
+// Package v2 提供多进程安全的文件写入：咨询式文件锁与原子写入
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 记忆根目录下的锁文件（非 Markdown 文件，不进入版本历史，也不会被监听或扫描）
+const (
+	writeLockFile       = ".write.lock"
+	maintenanceLockFile = ".maintenance.lock"
+)
+
+// ErrLockHeld 锁已被其他进程持有
+var ErrLockHeld = errors.New("锁已被其他进程持有")
+
+// FileLock 基于锁文件的咨询锁（advisory lock）
+// 进程内由互斥锁串行化，跨进程由操作系统文件锁保证（Unix flock / Windows LockFileEx）；
+// 进程退出时操作系统自动释放，不会遗留失效的锁
+type FileLock struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileLock 创建文件锁（锁文件在首次加锁时创建）
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path 返回锁文件路径
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Lock 阻塞直到获得锁
+func (l *FileLock) Lock() error {
+	l.mu.Lock()
+	file, err := l.open()
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	if err := lockFile(file, true); err != nil {
+		file.Close()
+		l.mu.Unlock()
+		return fmt.Errorf("获取文件锁 %s 失败: %w", l.path, err)
+	}
+	l.file = file
+	return nil
+}
+
+// TryLock 尝试获得锁，锁被占用时立即返回 ErrLockHeld
+func (l *FileLock) TryLock() error {
+	if !l.mu.TryLock() {
+		return ErrLockHeld
+	}
+	file, err := l.open()
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	if err := lockFile(file, false); err != nil {
+		file.Close()
+		l.mu.Unlock()
+		if errors.Is(err, errWouldBlock) {
+			return ErrLockHeld
+		}
+		return fmt.Errorf("获取文件锁 %s 失败: %w", l.path, err)
+	}
+	l.file = file
+	return nil
+}
+
+// Unlock 释放锁
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+	l.mu.Unlock()
+	return err
+}
+
+// open 打开（必要时创建）锁文件
+func (l *FileLock) open() (*os.File, error) {
+	if err := EnsureDir(l.path); err != nil {
+		return nil, fmt.Errorf("创建锁目录失败: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开锁文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// writeFileAtomic 原子写入文件：写入同目录临时文件并同步到磁盘后重命名，
+// 其他进程读到的始终是完整的旧文件或新文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后为空操作
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package v2
+
+import (
+	"os"
+	"syscall"
+)
+
+// errWouldBlock 非阻塞加锁时锁已被占用
+var errWouldBlock = syscall.EWOULDBLOCK
+
+// lockFile 对文件加排他锁，wait 为 false 时锁被占用立即返回 errWouldBlock
+func lockFile(file *os.File, wait bool) error {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile 释放文件锁
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
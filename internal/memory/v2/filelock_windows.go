@@ -0,0 +1,26 @@
+//go:build windows
+
+package v2
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// errWouldBlock 非阻塞加锁时锁已被占用
+var errWouldBlock = windows.ERROR_LOCK_VIOLATION
+
+// lockFile 对文件加排他锁，wait 为 false 时锁被占用立即返回 errWouldBlock
+func lockFile(file *os.File, wait bool) error {
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockFile 释放文件锁
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -2,9 +2,14 @@
 package v2
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,19 +36,153 @@ type FileStore interface {
 }
 
 // MarkdownFileStore Markdown 文件存储实现
+// 所有写入都持有所在记忆根目录的写锁并以临时文件重命名的方式原子完成，
+// 多个 AIMate 进程可以安全地共享同一记忆目录
 type MarkdownFileStore struct {
 	storage *StorageManager
 	parser  *FrontmatterParser
+	history *MemoryHistory // 为 nil 时不记录版本历史
+	cipher  *MemoryCipher  // 为 nil 时以明文存储
+
+	locks         map[string]*FileLock // 记忆根目录 → 写锁
+	sessionHashes map[string]string    // 会话文件 → 本进程最后读写时的内容哈希
+	mu            sync.Mutex
 }
 
 // NewMarkdownFileStore 创建 Markdown 文件存储
 func NewMarkdownFileStore(storage *StorageManager) *MarkdownFileStore {
 	return &MarkdownFileStore{
-		storage: storage,
-		parser:  NewFrontmatterParser(),
+		storage:       storage,
+		parser:        NewFrontmatterParser(),
+		locks:         make(map[string]*FileLock),
+		sessionHashes: make(map[string]string),
+	}
+}
+
+// SetCipher 设置静态加密（nil 表示以明文写入）
+func (fs *MarkdownFileStore) SetCipher(cipher *MemoryCipher) {
+	fs.cipher = cipher
+}
+
+// Cipher 返回静态加密器（未启用时为 nil）
+func (fs *MarkdownFileStore) Cipher() *MemoryCipher {
+	return fs.cipher
+}
+
+// ReadFile 读取记忆或会话文件并解密（明文文件原样返回）
+func (fs *MarkdownFileStore) ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.cipher.Open(data)
+}
+
+// WriteFile 持有写锁将编辑后的明文内容写回记忆文件（启用加密时重新加密）
+func (fs *MarkdownFileStore) WriteFile(path string, content []byte) error {
+	return fs.withLock(path, func() error {
+		if err := fs.writeFile(path, content); err != nil {
+			return NewMemoryErrorWithPath("WriteFile", path, err)
+		}
+
+		fs.record("edit "+fs.describeFile(path), path)
+		return nil
+	})
+}
+
+// writeFile 按需加密后原子写入文件（调用方需持有写锁）
+func (fs *MarkdownFileStore) writeFile(path string, content []byte) error {
+	data, err := fs.cipher.Seal(content)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// withLock 持有路径所在记忆根目录的写锁执行 fn（读-改-写与版本历史提交都在锁内完成）
+func (fs *MarkdownFileStore) withLock(path string, fn func() error) error {
+	lock := fs.lockFor(path)
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// lockFor 返回路径所在记忆根目录的写锁（项目优先，其余路径使用全局锁）
+func (fs *MarkdownFileStore) lockFor(path string) *FileLock {
+	root := fs.storage.GetGlobalRoot()
+	if fs.storage.IsProjectPath(path) {
+		root = fs.storage.GetProjectRoot()
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	lock, ok := fs.locks[root]
+	if !ok {
+		lock = NewFileLock(filepath.Join(root, writeLockFile))
+		fs.locks[root] = lock
+	}
+	return lock
+}
+
+// rememberSession 记录会话文件的内容哈希，用于检测其他进程的修改
+func (fs *MarkdownFileStore) rememberSession(path string, content []byte) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.sessionHashes[path] = CalculateContentHash(content)
+}
+
+// checkSession 检查会话文件在本进程最后一次读写后是否被外部修改
+func (fs *MarkdownFileStore) checkSession(path string) error {
+	fs.mu.Lock()
+	known, ok := fs.sessionHashes[path]
+	fs.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	current, err := fs.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if CalculateContentHash(current) != known {
+		return ErrSessionModified
+	}
+	return nil
+}
+
+// SetHistory 设置记忆版本历史（nil 表示不记录）
+func (fs *MarkdownFileStore) SetHistory(history *MemoryHistory) {
+	fs.history = history
+}
+
+// History 返回记忆版本历史（未启用时为 nil）
+func (fs *MarkdownFileStore) History() *MemoryHistory {
+	return fs.history
+}
+
+// record 将记忆文件变更提交到版本历史，失败时只打印警告
+func (fs *MarkdownFileStore) record(message string, paths ...string) {
+	if fs.history == nil {
+		return
+	}
+	if err := fs.history.Record(message, paths...); err != nil {
+		fmt.Printf("警告: 记录记忆历史失败: %v\n", err)
 	}
 }
 
+// describeFile 读取记忆文件生成提交描述，无法解析时使用文件名
+func (fs *MarkdownFileStore) describeFile(path string) string {
+	if mem, err := fs.ReadMemory(path); err == nil {
+		return fs.describeMemory(mem)
+	}
+	return filepath.Base(path)
+}
+
 // ========== 记忆操作 ==========
 
 // CreateMemory 创建记忆文件
@@ -73,23 +212,26 @@ func (fs *MarkdownFileStore) CreateMemory(mem *Memory) error {
 		return NewMemoryErrorWithPath("CreateMemory", filePath, err)
 	}
 
-	// 检查文件是否已存在
-	if FileExists(filePath) {
-		return NewMemoryErrorWithPath("CreateMemory", filePath, ErrFileAlreadyExists)
-	}
-
 	// 序列化为 Markdown
 	content, err := fs.parser.SerializeMemory(mem)
 	if err != nil {
 		return NewMemoryErrorWithPath("CreateMemory", filePath, err)
 	}
 
-	// 写入文件
-	if err := os.WriteFile(filePath, content, 0644); err != nil {
-		return NewMemoryErrorWithPath("CreateMemory", filePath, err)
-	}
+	return fs.withLock(filePath, func() error {
+		// 检查文件是否已存在
+		if FileExists(filePath) {
+			return NewMemoryErrorWithPath("CreateMemory", filePath, ErrFileAlreadyExists)
+		}
 
-	return nil
+		// 写入文件
+		if err := fs.writeFile(filePath, content); err != nil {
+			return NewMemoryErrorWithPath("CreateMemory", filePath, err)
+		}
+
+		fs.record("create "+fs.describeMemory(mem), filePath)
+		return nil
+	})
 }
 
 // ReadMemory 读取记忆文件
@@ -100,7 +242,7 @@ func (fs *MarkdownFileStore) ReadMemory(filePath string) (*Memory, error) {
 	}
 
 	// 读取文件内容
-	content, err := os.ReadFile(filePath)
+	content, err := fs.ReadFile(filePath)
 	if err != nil {
 		return nil, NewMemoryErrorWithPath("ReadMemory", filePath, err)
 	}
@@ -117,13 +259,37 @@ func (fs *MarkdownFileStore) ReadMemory(filePath string) (*Memory, error) {
 
 // UpdateMemory 更新记忆文件
 func (fs *MarkdownFileStore) UpdateMemory(mem *Memory) error {
+	return fs.withLock(mem.FilePath, func() error {
+		if err := fs.writeMemory("UpdateMemory", mem); err != nil {
+			return err
+		}
+
+		fs.record("update "+fs.describeMemory(mem), mem.FilePath)
+		return nil
+	})
+}
+
+// RevertMemory 用历史版本的内容覆盖记忆文件，并记录为一次回滚提交
+func (fs *MarkdownFileStore) RevertMemory(mem *Memory, rev string) error {
+	return fs.withLock(mem.FilePath, func() error {
+		if err := fs.writeMemory("RevertMemory", mem); err != nil {
+			return err
+		}
+
+		fs.record(fmt.Sprintf("revert %s to %s", fs.describeMemory(mem), rev), mem.FilePath)
+		return nil
+	})
+}
+
+// writeMemory 将记忆写回已有文件（不加锁、不记录历史，调用方需持有写锁）
+func (fs *MarkdownFileStore) writeMemory(op string, mem *Memory) error {
 	if mem.FilePath == "" {
-		return NewMemoryError("UpdateMemory", ErrInvalidFilePath)
+		return NewMemoryError(op, ErrInvalidFilePath)
 	}
 
 	// 检查文件是否存在
 	if !FileExists(mem.FilePath) {
-		return NewMemoryErrorWithPath("UpdateMemory", mem.FilePath, ErrFileNotFound)
+		return NewMemoryErrorWithPath(op, mem.FilePath, ErrFileNotFound)
 	}
 
 	// 更新时间戳
@@ -135,12 +301,12 @@ func (fs *MarkdownFileStore) UpdateMemory(mem *Memory) error {
 	// 序列化为 Markdown
 	content, err := fs.parser.SerializeMemory(mem)
 	if err != nil {
-		return NewMemoryErrorWithPath("UpdateMemory", mem.FilePath, err)
+		return NewMemoryErrorWithPath(op, mem.FilePath, err)
 	}
 
 	// 写入文件
-	if err := os.WriteFile(mem.FilePath, content, 0644); err != nil {
-		return NewMemoryErrorWithPath("UpdateMemory", mem.FilePath, err)
+	if err := fs.writeFile(mem.FilePath, content); err != nil {
+		return NewMemoryErrorWithPath(op, mem.FilePath, err)
 	}
 
 	return nil
@@ -148,19 +314,41 @@ func (fs *MarkdownFileStore) UpdateMemory(mem *Memory) error {
 
 // DeleteMemory 删除记忆文件
 func (fs *MarkdownFileStore) DeleteMemory(filePath string) error {
-	if !FileExists(filePath) {
-		return NewMemoryErrorWithPath("DeleteMemory", filePath, ErrFileNotFound)
-	}
+	return fs.withLock(filePath, func() error {
+		if !FileExists(filePath) {
+			return NewMemoryErrorWithPath("DeleteMemory", filePath, ErrFileNotFound)
+		}
 
-	if err := os.Remove(filePath); err != nil {
-		return NewMemoryErrorWithPath("DeleteMemory", filePath, err)
-	}
+		var desc string
+		if fs.history != nil {
+			desc = fs.describeFile(filePath)
+		}
 
-	return nil
+		if err := os.Remove(filePath); err != nil {
+			return NewMemoryErrorWithPath("DeleteMemory", filePath, err)
+		}
+
+		fs.record("delete "+desc, filePath)
+		return nil
+	})
 }
 
 // MoveMemory 移动记忆文件（用于归档）
 func (fs *MarkdownFileStore) MoveMemory(srcPath, dstPath string) error {
+	return fs.withLock(srcPath, func() error {
+		if err := fs.moveFile(srcPath, dstPath); err != nil {
+			return err
+		}
+
+		if fs.history != nil {
+			fs.record("move "+fs.describeFile(dstPath), srcPath, dstPath)
+		}
+		return nil
+	})
+}
+
+// moveFile 移动记忆文件（不加锁、不记录历史）
+func (fs *MarkdownFileStore) moveFile(srcPath, dstPath string) error {
 	if !FileExists(srcPath) {
 		return NewMemoryErrorWithPath("MoveMemory", srcPath, ErrFileNotFound)
 	}
@@ -209,12 +397,15 @@ func (fs *MarkdownFileStore) CreateSession(sess *Session) error {
 		return NewMemoryErrorWithPath("CreateSession", filePath, err)
 	}
 
-	// 写入文件
-	if err := os.WriteFile(filePath, content, 0644); err != nil {
-		return NewMemoryErrorWithPath("CreateSession", filePath, err)
-	}
+	return fs.withLock(filePath, func() error {
+		// 写入文件
+		if err := fs.writeFile(filePath, content); err != nil {
+			return NewMemoryErrorWithPath("CreateSession", filePath, err)
+		}
 
-	return nil
+		fs.rememberSession(filePath, content)
+		return nil
+	})
 }
 
 // ReadSession 读取会话文件
@@ -224,7 +415,7 @@ func (fs *MarkdownFileStore) ReadSession(filePath string) (*Session, []SessionMe
 	}
 
 	// 读取文件内容
-	content, err := os.ReadFile(filePath)
+	content, err := fs.ReadFile(filePath)
 	if err != nil {
 		return nil, nil, NewMemoryErrorWithPath("ReadSession", filePath, err)
 	}
@@ -236,6 +427,7 @@ func (fs *MarkdownFileStore) ReadSession(filePath string) (*Session, []SessionMe
 	}
 
 	sess.FilePath = filePath
+	fs.rememberSession(filePath, content)
 
 	// 解析消息列表（从 body 中解析）
 	messages := fs.parseSessionMessages(body)
@@ -244,11 +436,22 @@ func (fs *MarkdownFileStore) ReadSession(filePath string) (*Session, []SessionMe
 }
 
 // UpdateSession 更新会话文件
+// 会话文件在本进程最后一次读写后被其他进程修改时返回 ErrSessionModified，不覆盖外部变更
 func (fs *MarkdownFileStore) UpdateSession(sess *Session, messages []SessionMessage) error {
 	if sess.FilePath == "" {
 		return NewMemoryError("UpdateSession", ErrInvalidFilePath)
 	}
 
+	return fs.withLock(sess.FilePath, func() error {
+		if err := fs.checkSession(sess.FilePath); err != nil {
+			return NewMemoryErrorWithPath("UpdateSession", sess.FilePath, err)
+		}
+		return fs.writeSession("UpdateSession", sess, messages)
+	})
+}
+
+// writeSession 写入会话文件（不加锁，调用方需持有写锁）
+func (fs *MarkdownFileStore) writeSession(op string, sess *Session, messages []SessionMessage) error {
 	// 更新时间戳和统计
 	sess.UpdatedAt = time.Now()
 	sess.MessageCount = len(messages)
@@ -266,51 +469,89 @@ func (fs *MarkdownFileStore) UpdateSession(sess *Session, messages []SessionMess
 	// 序列化为 Markdown
 	content, err := fs.parser.SerializeSession(sess, body)
 	if err != nil {
-		return NewMemoryErrorWithPath("UpdateSession", sess.FilePath, err)
+		return NewMemoryErrorWithPath(op, sess.FilePath, err)
 	}
 
 	// 写入文件
-	if err := os.WriteFile(sess.FilePath, content, 0644); err != nil {
-		return NewMemoryErrorWithPath("UpdateSession", sess.FilePath, err)
+	if err := fs.writeFile(sess.FilePath, content); err != nil {
+		return NewMemoryErrorWithPath(op, sess.FilePath, err)
 	}
 
+	fs.rememberSession(sess.FilePath, content)
 	return nil
 }
 
-// AppendSessionMessage 追加会话消息
+// AppendSessionMessage 追加会话消息（在写锁内重新读取文件，不会丢失其他进程追加的消息）
 func (fs *MarkdownFileStore) AppendSessionMessage(filePath string, msg *SessionMessage) error {
-	// 读取现有会话
-	sess, messages, err := fs.ReadSession(filePath)
-	if err != nil {
-		return err
-	}
+	return fs.withLock(filePath, func() error {
+		// 读取现有会话
+		sess, messages, err := fs.ReadSession(filePath)
+		if err != nil {
+			return err
+		}
 
-	// 设置消息序号
-	msg.Sequence = len(messages) + 1
-	if msg.Timestamp.IsZero() {
-		msg.Timestamp = time.Now()
-	}
+		// 设置消息序号
+		msg.Sequence = len(messages) + 1
+		if msg.Timestamp.IsZero() {
+			msg.Timestamp = time.Now()
+		}
 
-	// 追加消息
-	messages = append(messages, *msg)
+		// 追加消息
+		messages = append(messages, *msg)
 
-	// 更新会话
-	return fs.UpdateSession(sess, messages)
+		// 更新会话
+		return fs.writeSession("AppendSessionMessage", sess, messages)
+	})
 }
 
+// sessionMessageHeaderRe 匹配会话消息头：### [序号] 角色 (时间)
+var sessionMessageHeaderRe = regexp.MustCompile(`^### \[(\d+)\] (.+) \((\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\)$`)
+
 // parseSessionMessages 从 Markdown body 解析消息列表
+// 消息格式：
+// ### [序号] 角色 (时间)
+//
+// 内容
+//
+// 工具调用元数据以 HTML 注释保存在内容之前：<!-- tool_calls: "..." -->、<!-- tool_call_id: "..." -->
 func (fs *MarkdownFileStore) parseSessionMessages(body []byte) []SessionMessage {
-	// 简化实现：按消息块解析
-	// 实际消息格式：
-	// ### [序号] 角色 (时间)
-	// 内容
-	//
-	// 这里返回空列表，实际实现需要更复杂的解析逻辑
-
 	var messages []SessionMessage
-	// TODO: 实现完整的消息解析逻辑
-	// 当前简化返回空列表，消息主要通过索引数据库查询
-	_ = body
+	var current *SessionMessage
+	var lines []string
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Content = strings.Trim(strings.Join(lines, "\n"), "\n")
+		// 文件中不保存单条 token 数，按字符数估算
+		current.TokenCount = len(current.Content) / 4
+		messages = append(messages, *current)
+		current = nil
+		lines = nil
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if m := sessionMessageHeaderRe.FindStringSubmatch(line); m != nil {
+			flush()
+			seq, _ := strconv.Atoi(m[1])
+			ts, _ := time.ParseInLocation("2006-01-02 15:04:05", m[3], time.Local)
+			current = &SessionMessage{
+				Sequence:  seq,
+				Role:      fs.parseRole(m[2]),
+				Timestamp: ts,
+			}
+			continue
+		}
+		if current != nil {
+			if len(strings.TrimSpace(strings.Join(lines, ""))) == 0 && parseToolMetadata(current, line) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	flush()
+
 	return messages
 }
 
@@ -325,6 +566,7 @@ func (fs *MarkdownFileStore) formatSessionMessages(messages []SessionMessage) []
 		timeStr := msg.Timestamp.Format("2006-01-02 15:04:05")
 
 		content += fmt.Sprintf("### [%d] %s (%s)\n\n", msg.Sequence, roleDisplay, timeStr)
+		content += formatToolMetadata(msg)
 		content += msg.Content
 		if !endsWith(msg.Content, "\n") {
 			content += "\n"
@@ -335,6 +577,48 @@ func (fs *MarkdownFileStore) formatSessionMessages(messages []SessionMessage) []
 	return []byte(content)
 }
 
+// 工具调用元数据注释的前后缀
+const (
+	toolCallsCommentPrefix  = "<!-- tool_calls: "
+	toolCallIDCommentPrefix = "<!-- tool_call_id: "
+	toolCommentSuffix       = " -->"
+)
+
+// formatToolMetadata 将工具调用元数据格式化为 HTML 注释（值编码为 JSON 字符串，不含换行与 -->）
+func formatToolMetadata(msg SessionMessage) string {
+	var content string
+	if msg.ToolCalls != "" {
+		value, _ := json.Marshal(msg.ToolCalls)
+		content += toolCallsCommentPrefix + string(value) + toolCommentSuffix + "\n"
+	}
+	if msg.ToolCallID != "" {
+		value, _ := json.Marshal(msg.ToolCallID)
+		content += toolCallIDCommentPrefix + string(value) + toolCommentSuffix + "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	return content
+}
+
+// parseToolMetadata 解析工具调用元数据注释，返回该行是否为元数据
+func parseToolMetadata(msg *SessionMessage, line string) bool {
+	if !strings.HasSuffix(line, toolCommentSuffix) {
+		return false
+	}
+	var target *string
+	var raw string
+	switch {
+	case strings.HasPrefix(line, toolCallsCommentPrefix):
+		target, raw = &msg.ToolCalls, strings.TrimPrefix(line, toolCallsCommentPrefix)
+	case strings.HasPrefix(line, toolCallIDCommentPrefix):
+		target, raw = &msg.ToolCallID, strings.TrimPrefix(line, toolCallIDCommentPrefix)
+	default:
+		return false
+	}
+	return json.Unmarshal([]byte(strings.TrimSuffix(raw, toolCommentSuffix)), target) == nil
+}
+
 // formatRole 格式化角色显示
 func (fs *MarkdownFileStore) formatRole(role string) string {
 	switch role {
@@ -351,6 +635,22 @@ func (fs *MarkdownFileStore) formatRole(role string) string {
 	}
 }
 
+// parseRole 将角色显示文本还原为角色标识
+func (fs *MarkdownFileStore) parseRole(display string) string {
+	switch display {
+	case "👤 用户":
+		return "user"
+	case "🤖 助手":
+		return "assistant"
+	case "⚙️ 系统":
+		return "system"
+	case "🔧 工具":
+		return "tool"
+	default:
+		return display
+	}
+}
+
 // ========== 批量操作 ==========
 
 // ListMemories 列出指定目录下的所有记忆
@@ -434,14 +734,22 @@ func (fs *MarkdownFileStore) ArchiveMemory(mem *Memory) error {
 	fileName := filepath.Base(mem.FilePath)
 	dstPath := filepath.Join(archivePath, fileName)
 
-	// 更新状态
-	mem.Status = StatusArchived
-	if err := fs.UpdateMemory(mem); err != nil {
-		return err
-	}
+	return fs.withLock(mem.FilePath, func() error {
+		// 更新状态
+		mem.Status = StatusArchived
+		if err := fs.writeMemory("ArchiveMemory", mem); err != nil {
+			return err
+		}
 
-	// 移动文件
-	return fs.MoveMemory(mem.FilePath, dstPath)
+		// 移动文件
+		srcPath := mem.FilePath
+		if err := fs.moveFile(srcPath, dstPath); err != nil {
+			return err
+		}
+
+		fs.record("archive "+fs.describeMemory(mem), srcPath, dstPath)
+		return nil
+	})
 }
 
 // GetMemoryStats 获取记忆文件统计
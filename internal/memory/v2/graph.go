@@ -0,0 +1,266 @@
+// Package v2 提供记忆关联图：带类型的关联、相似记忆自动关联与图导出
+package v2
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RelationType 记忆关联类型
+type RelationType string
+
+const (
+	RelationRelated     RelationType = "related"     // 普通关联
+	RelationSupersedes  RelationType = "supersedes"  // 取代目标记忆
+	RelationDependsOn   RelationType = "depends-on"  // 依赖目标记忆
+	RelationContradicts RelationType = "contradicts" // 与目标记忆矛盾
+	RelationExampleOf   RelationType = "example-of"  // 是目标记忆的示例
+)
+
+// AllRelationTypes 返回所有关联类型
+func AllRelationTypes() []RelationType {
+	return []RelationType{
+		RelationRelated,
+		RelationSupersedes,
+		RelationDependsOn,
+		RelationContradicts,
+		RelationExampleOf,
+	}
+}
+
+// ParseRelationType 解析关联类型
+func ParseRelationType(s string) (RelationType, error) {
+	for _, t := range AllRelationTypes() {
+		if string(t) == strings.ToLower(strings.TrimSpace(s)) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("未知的关联类型: %s", s)
+}
+
+// RelationTo 返回到目标记忆的关联类型，未关联时返回空
+func (m *Memory) RelationTo(id string) RelationType {
+	for _, r := range m.Related {
+		if r != id {
+			continue
+		}
+		if t, ok := m.RelationTypes[id]; ok {
+			return t
+		}
+		return RelationRelated
+	}
+	return ""
+}
+
+// SetRelation 添加或更新到目标记忆的关联，返回是否有变化
+func (m *Memory) SetRelation(id string, relType RelationType) bool {
+	if m.RelationTo(id) == relType {
+		return false
+	}
+	if m.RelationTo(id) == "" {
+		m.Related = append(m.Related, id)
+	}
+	if relType == RelationRelated {
+		delete(m.RelationTypes, id)
+		if len(m.RelationTypes) == 0 {
+			m.RelationTypes = nil
+		}
+		return true
+	}
+	if m.RelationTypes == nil {
+		m.RelationTypes = make(map[string]RelationType)
+	}
+	m.RelationTypes[id] = relType
+	return true
+}
+
+// UnsetRelation 移除到目标记忆的关联，返回是否有变化
+func (m *Memory) UnsetRelation(id string) bool {
+	if m.RelationTo(id) == "" {
+		return false
+	}
+	var related []string
+	for _, r := range m.Related {
+		if r != id {
+			related = append(related, r)
+		}
+	}
+	m.Related = related
+	delete(m.RelationTypes, id)
+	if len(m.RelationTypes) == 0 {
+		m.RelationTypes = nil
+	}
+	return true
+}
+
+// RelationSuggestion 按向量相似度建议的关联
+type RelationSuggestion struct {
+	Memory *Memory
+	Score  float64
+}
+
+// GraphNode 记忆图中的节点
+type GraphNode struct {
+	ID       string
+	Title    string
+	Type     MemoryType
+	Category MemoryCategory
+}
+
+// GraphEdge 记忆图中的有向边
+type GraphEdge struct {
+	From     string
+	To       string
+	Relation RelationType
+}
+
+// MemoryGraph 以某条记忆为起点的关联子图
+type MemoryGraph struct {
+	Root  string
+	Nodes []*GraphNode
+	Edges []GraphEdge
+}
+
+// BuildMemoryGraph 从起点记忆出发按关联广度优先展开 depth 层
+// load 用于按 ID 加载记忆，加载失败的关联（如已删除）会被忽略
+func BuildMemoryGraph(rootID string, depth int, load func(id string) (*Memory, error)) (*MemoryGraph, error) {
+	root, err := load(rootID)
+	if err != nil {
+		return nil, err
+	}
+	if depth < 1 {
+		depth = 1
+	}
+
+	graph := &MemoryGraph{Root: root.ID}
+	memories := map[string]*Memory{root.ID: root}
+	graph.Nodes = append(graph.Nodes, newGraphNode(root))
+
+	frontier := []*Memory{root}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []*Memory
+		for _, mem := range frontier {
+			for _, relatedID := range mem.Related {
+				if _, ok := memories[relatedID]; !ok {
+					related, err := load(relatedID)
+					if err != nil {
+						continue
+					}
+					memories[relatedID] = related
+					graph.Nodes = append(graph.Nodes, newGraphNode(related))
+					next = append(next, related)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	// 收集节点之间的全部边（包括最外层节点之间的边）
+	for _, node := range graph.Nodes {
+		mem := memories[node.ID]
+		for _, relatedID := range mem.Related {
+			if _, ok := memories[relatedID]; ok {
+				graph.Edges = append(graph.Edges, GraphEdge{
+					From:     mem.ID,
+					To:       relatedID,
+					Relation: mem.RelationTo(relatedID),
+				})
+			}
+		}
+	}
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+
+	return graph, nil
+}
+
+// newGraphNode 由记忆创建图节点
+func newGraphNode(mem *Memory) *GraphNode {
+	return &GraphNode{
+		ID:       mem.ID,
+		Title:    mem.Title,
+		Type:     mem.Type,
+		Category: mem.Category,
+	}
+}
+
+// DOT 导出为 Graphviz DOT 格式
+func (g *MemoryGraph) DOT() string {
+	var builder strings.Builder
+	builder.WriteString("digraph memory {\n")
+	builder.WriteString("  rankdir=LR;\n")
+	builder.WriteString("  node [shape=box];\n")
+	for _, node := range g.Nodes {
+		attrs := fmt.Sprintf("label=\"%s\"", escapeDOT(graphLabel(node)))
+		if node.ID == g.Root {
+			attrs += ", style=bold"
+		}
+		builder.WriteString(fmt.Sprintf("  \"%s\" [%s];\n", graphNodeID(node.ID), attrs))
+	}
+	for _, edge := range g.Edges {
+		attrs := ""
+		if edge.Relation != RelationRelated {
+			attrs = fmt.Sprintf(" [label=\"%s\"]", edge.Relation)
+		}
+		builder.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\"%s;\n",
+			graphNodeID(edge.From), graphNodeID(edge.To), attrs))
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// Mermaid 导出为 Mermaid flowchart 格式
+func (g *MemoryGraph) Mermaid() string {
+	var builder strings.Builder
+	builder.WriteString("graph LR\n")
+	for _, node := range g.Nodes {
+		builder.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", graphNodeID(node.ID), escapeMermaid(graphLabel(node))))
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Relation != RelationRelated {
+			arrow = fmt.Sprintf("-->|%s|", edge.Relation)
+		}
+		builder.WriteString(fmt.Sprintf("  %s %s %s\n", graphNodeID(edge.From), arrow, graphNodeID(edge.To)))
+	}
+	if len(g.Nodes) > 0 {
+		builder.WriteString(fmt.Sprintf("  style %s stroke-width:3px\n", graphNodeID(g.Root)))
+	}
+	return builder.String()
+}
+
+// shortMemoryID 返回记忆 ID 的前 8 位
+func shortMemoryID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// graphNodeID 生成图中的节点标识（m + 去除连字符后的 ID）
+func graphNodeID(id string) string {
+	return "m" + strings.ReplaceAll(id, "-", "")
+}
+
+// graphLabel 生成节点标签
+func graphLabel(node *GraphNode) string {
+	return fmt.Sprintf("%s\n[%s/%s]", node.Title, node.Type, node.Category)
+}
+
+// escapeDOT 转义 DOT 标签中的特殊字符
+func escapeDOT(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+// escapeMermaid 转义 Mermaid 标签中的特殊字符
+func escapeMermaid(s string) string {
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
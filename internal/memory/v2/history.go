@@ -0,0 +1,268 @@
+// Package v2 提供基于 git 的记忆版本历史：记忆根目录作为 git 仓库，每次文件变更提交一次
+package v2
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 版本历史仓库只跟踪 Markdown 文件，索引库、向量库与状态文件不入库
+const historyGitignore = `# 由 AIMate 生成：只跟踪记忆与会话的 Markdown 文件
+*
+!*/
+!*.md
+!.gitignore
+`
+
+// 仓库未配置提交者时使用的身份
+const (
+	historyAuthorName  = "AIMate"
+	historyAuthorEmail = "aimate@localhost"
+)
+
+// HistoryEntry 一条记忆文件的历史版本
+type HistoryEntry struct {
+	Rev      string    `json:"rev"`
+	ShortRev string    `json:"short_rev"`
+	Date     time.Time `json:"date"`
+	Message  string    `json:"message"`
+	Path     string    `json:"path"` // 该版本中文件的绝对路径（归档或重命名前后可能不同）
+}
+
+// MemoryHistory 记忆版本历史
+// 全局与项目记忆根目录各自是一个 git 仓库，首次写入时自动初始化；
+// 每次创建、更新、删除、归档记忆只暂存并提交涉及的文件
+type MemoryHistory struct {
+	storage *StorageManager
+	git     string
+
+	ready map[string]bool // 已初始化的仓库根目录
+	mu    sync.Mutex
+}
+
+// NewMemoryHistory 创建记忆版本历史（需要本地 git 可执行文件）
+func NewMemoryHistory(storage *StorageManager) (*MemoryHistory, error) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return nil, fmt.Errorf("未找到 git，无法启用记忆版本历史: %w", err)
+	}
+	return &MemoryHistory{
+		storage: storage,
+		git:     git,
+		ready:   make(map[string]bool),
+	}, nil
+}
+
+// Record 提交涉及的文件变更（路径可以是已删除或移走的文件），没有变化时不提交
+func (h *MemoryHistory) Record(message string, paths ...string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	byRoot := make(map[string][]string)
+	var roots []string
+	for _, path := range paths {
+		root := h.rootFor(path)
+		if root == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		if _, ok := byRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], rel)
+	}
+
+	for _, root := range roots {
+		if err := h.ensureRepo(root, byRoot[root]); err != nil {
+			return err
+		}
+		args := append([]string{"add", "-A", "--"}, byRoot[root]...)
+		if _, err := h.run(root, args...); err != nil {
+			return fmt.Errorf("暂存记忆文件失败: %w", err)
+		}
+		if err := h.commit(root, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Log 返回记忆文件的历史版本（最新在前，跟踪重命名与归档）
+func (h *MemoryHistory) Log(path string, limit int) ([]*HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	root := h.rootFor(path)
+	if root == "" {
+		return nil, fmt.Errorf("文件不在记忆目录中: %s", path)
+	}
+	if !isGitRepo(root) {
+		return nil, nil
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"log", "--follow", "--name-only", "--format=%x1e%H%x1f%h%x1f%aI%x1f%s"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", limit))
+	}
+	args = append(args, "--", rel)
+	out, err := h.run(root, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取记忆历史失败: %w", err)
+	}
+
+	var entries []*HistoryEntry
+	for _, record := range strings.Split(out, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		entry := &HistoryEntry{Rev: fields[0], ShortRev: fields[1], Message: fields[3]}
+		entry.Date, _ = time.Parse(time.RFC3339, fields[2])
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" {
+				entry.Path = filepath.Join(root, line)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Show 返回文件在指定版本中的内容
+func (h *MemoryHistory) Show(rev, path string) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	root := h.rootFor(path)
+	if root == "" {
+		return nil, fmt.Errorf("文件不在记忆目录中: %s", path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := h.run(root, "show", rev+":"+filepath.ToSlash(rel))
+	if err != nil {
+		return nil, fmt.Errorf("版本 %s 中不存在该记忆文件", rev)
+	}
+	return []byte(out), nil
+}
+
+// rootFor 返回路径所在的记忆根目录（项目优先）
+func (h *MemoryHistory) rootFor(path string) string {
+	if h.storage.IsProjectPath(path) {
+		return h.storage.GetProjectRoot()
+	}
+	if h.storage.IsGlobalPath(path) {
+		return h.storage.GetGlobalRoot()
+	}
+	return ""
+}
+
+// ensureRepo 初始化仓库：写入 .gitignore、设置缺省提交者并提交已有文件
+// pending 为本次将要提交的文件，不计入基线版本，以保留其单独的提交
+func (h *MemoryHistory) ensureRepo(root string, pending []string) error {
+	if h.ready[root] {
+		return nil
+	}
+
+	if !isGitRepo(root) {
+		if _, err := h.run(root, "init", "-q"); err != nil {
+			return fmt.Errorf("初始化记忆仓库失败: %w", err)
+		}
+	}
+
+	ignorePath := filepath.Join(root, ".gitignore")
+	if !FileExists(ignorePath) {
+		if err := os.WriteFile(ignorePath, []byte(historyGitignore), 0644); err != nil {
+			return fmt.Errorf("写入 .gitignore 失败: %w", err)
+		}
+	}
+
+	ensureGitIdentity(h.git, root)
+
+	// 首次启用时为已有文件建立基线版本
+	if _, err := h.run(root, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		if _, err := h.run(root, "add", "-A"); err != nil {
+			return fmt.Errorf("暂存已有记忆失败: %w", err)
+		}
+		args := append([]string{"rm", "-q", "--cached", "--ignore-unmatch", "--"}, pending...)
+		if _, err := h.run(root, args...); err != nil {
+			return fmt.Errorf("暂存已有记忆失败: %w", err)
+		}
+		if err := h.commit(root, "snapshot existing memories"); err != nil {
+			return err
+		}
+	}
+
+	h.ready[root] = true
+	return nil
+}
+
+// commit 提交已暂存的变更，没有变更时跳过
+func (h *MemoryHistory) commit(root, message string) error {
+	if _, err := h.run(root, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	if _, err := h.run(root, "commit", "-q", "--no-verify", "--no-gpg-sign", "-m", message); err != nil {
+		return fmt.Errorf("提交记忆历史失败: %w", err)
+	}
+	return nil
+}
+
+// run 在仓库目录中执行 git 命令
+func (h *MemoryHistory) run(root string, args ...string) (string, error) {
+	return runGit(h.git, root, args...)
+}
+
+// runGit 在仓库目录中执行 git 命令（文件名按原样输出，不转义中文）
+func runGit(git, root string, args ...string) (string, error) {
+	cmd := exec.Command(git, append([]string{"-C", root, "-c", "core.quotepath=off"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return stdout.String(), fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// ensureGitIdentity 仓库未配置提交者时设置缺省身份
+func ensureGitIdentity(git, root string) {
+	if out, _ := runGit(git, root, "config", "user.email"); strings.TrimSpace(out) == "" {
+		_, _ = runGit(git, root, "config", "user.name", historyAuthorName)
+		_, _ = runGit(git, root, "config", "user.email", historyAuthorEmail)
+	}
+}
+
+// isGitRepo 判断目录本身是否为 git 仓库根目录
+func isGitRepo(root string) bool {
+	return FileExists(filepath.Join(root, ".git"))
+}
+
+// describeMemory 生成提交信息中的记忆描述
+// 启用静态加密时省略标题，避免其以明文写入提交历史
+func (fs *MarkdownFileStore) describeMemory(mem *Memory) string {
+	if fs.cipher != nil {
+		return fmt.Sprintf("%s/%s [%s]", mem.Type, mem.Category, shortMemoryID(mem.ID))
+	}
+	return fmt.Sprintf("%s/%s: %s [%s]", mem.Type, mem.Category, mem.Title, shortMemoryID(mem.ID))
+}
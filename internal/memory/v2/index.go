@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -40,6 +41,11 @@ type IndexStore interface {
 	GetAllIndexes() ([]*MemoryIndex, error)
 	GetOrphanedIndexes(existingFiles map[string]bool) ([]*MemoryIndex, error)
 
+	// 会话消息索引
+	IndexSessionMessage(sessionID string, msg *SessionMessage) error
+	DeleteSessionMessages(sessionID string, fromSequence int) error
+	SearchSessionMessages(query string, limit int) ([]*SessionMessageHit, error)
+
 	// 关闭
 	Close() error
 }
@@ -75,11 +81,22 @@ type IndexStats struct {
 	ExpiredCount   int `json:"expired_count"`
 }
 
+// SessionMessageHit 会话消息搜索结果
+type SessionMessageHit struct {
+	SessionID string    `json:"session_id"`
+	Sequence  int       `json:"sequence"`
+	Role      string    `json:"role"`
+	Snippet   string    `json:"snippet"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // SQLiteIndexStore SQLite 索引存储实现
 type SQLiteIndexStore struct {
 	db         *sql.DB
 	dbPath     string
-	ftsEnabled bool // FTS5 是否启用
+	ftsEnabled bool          // FTS5 是否启用
+	sessionFTS bool          // 会话消息 trigram 全文索引是否启用（支持中文子串匹配）
+	cipher     *MemoryCipher // 非 nil 时记忆标题、标签与会话消息内容加密存储
 }
 
 // NewSQLiteIndexStore 创建 SQLite 索引存储
@@ -144,6 +161,17 @@ func (s *SQLiteIndexStore) initTables() error {
 		// 为标题和标签添加索引以支持 LIKE 搜索
 		`CREATE INDEX IF NOT EXISTS idx_memory_title ON memory_index(title)`,
 		`CREATE INDEX IF NOT EXISTS idx_memory_tags ON memory_index(tags)`,
+
+		// 会话消息表（用于历史对话搜索）
+		`CREATE TABLE IF NOT EXISTS session_messages (
+			session_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (session_id, sequence)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_session_messages_created_at ON session_messages(created_at)`,
 	}
 
 	// 执行基础查询
@@ -197,10 +225,62 @@ func (s *SQLiteIndexStore) initTables() error {
 			}
 		}
 	}
+	if s.ftsEnabled {
+		s.sessionFTS = s.initSessionFTS() == nil
+	}
 
 	return nil
 }
 
+// initSessionFTS 创建会话消息全文索引
+// 使用 trigram 分词器以支持中文等无空格文本的子串匹配；旧版按词分词的索引会被重建
+func (s *SQLiteIndexStore) initSessionFTS() error {
+	var existing string
+	err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'session_message_fts'`).Scan(&existing)
+	rebuild := err == sql.ErrNoRows
+	if err == nil && !strings.Contains(existing, "trigram") {
+		if _, err := s.db.Exec(`DROP TABLE session_message_fts`); err != nil {
+			return err
+		}
+		rebuild = true
+	}
+
+	queries := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS session_message_fts USING fts5(
+			content,
+			content='session_messages',
+			content_rowid='rowid',
+			tokenize='trigram'
+		)`,
+
+		`CREATE TRIGGER IF NOT EXISTS session_message_ai AFTER INSERT ON session_messages BEGIN
+			INSERT INTO session_message_fts(rowid, content) VALUES (NEW.rowid, NEW.content);
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS session_message_ad AFTER DELETE ON session_messages BEGIN
+			INSERT INTO session_message_fts(session_message_fts, rowid, content) VALUES('delete', OLD.rowid, OLD.content);
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS session_message_au AFTER UPDATE ON session_messages BEGIN
+			INSERT INTO session_message_fts(session_message_fts, rowid, content) VALUES('delete', OLD.rowid, OLD.content);
+			INSERT INTO session_message_fts(rowid, content) VALUES (NEW.rowid, NEW.content);
+		END`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			// 不支持 trigram 的旧版 SQLite 降级到 LIKE 搜索
+			return err
+		}
+	}
+
+	if rebuild {
+		if _, err := s.db.Exec(`INSERT INTO session_message_fts(session_message_fts) VALUES('rebuild')`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CreateIndex 创建索引记录
 func (s *SQLiteIndexStore) CreateIndex(idx *MemoryIndex) error {
 	query := `INSERT INTO memory_index 
@@ -208,8 +288,13 @@ func (s *SQLiteIndexStore) CreateIndex(idx *MemoryIndex) error {
 		 importance, access_count, token_count, expires_at, created_at, updated_at, accessed_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.db.Exec(query,
-		idx.ID, idx.FilePath, idx.Type, idx.Scope, idx.Category, idx.Title, idx.Tags, idx.ContentHash,
+	title, tags, err := s.sealIndexFields(idx)
+	if err != nil {
+		return fmt.Errorf("创建索引失败: %w", err)
+	}
+
+	_, err = s.db.Exec(query,
+		idx.ID, idx.FilePath, idx.Type, idx.Scope, idx.Category, title, tags, idx.ContentHash,
 		idx.Importance, idx.AccessCount, idx.TokenCount, idx.ExpiresAt, idx.CreatedAt, idx.UpdatedAt, idx.AccessedAt,
 	)
 	if err != nil {
@@ -238,6 +323,9 @@ func (s *SQLiteIndexStore) GetIndex(id string) (*MemoryIndex, error) {
 	if err != nil {
 		return nil, fmt.Errorf("获取索引失败: %w", err)
 	}
+	if err := s.openIndexFields(idx); err != nil {
+		return nil, fmt.Errorf("获取索引失败: %w", err)
+	}
 
 	if expiresAt.Valid {
 		idx.ExpiresAt = &expiresAt.Time
@@ -265,6 +353,9 @@ func (s *SQLiteIndexStore) GetIndexByPath(filePath string) (*MemoryIndex, error)
 	if err != nil {
 		return nil, fmt.Errorf("获取索引失败: %w", err)
 	}
+	if err := s.openIndexFields(idx); err != nil {
+		return nil, fmt.Errorf("获取索引失败: %w", err)
+	}
 
 	if expiresAt.Valid {
 		idx.ExpiresAt = &expiresAt.Time
@@ -281,8 +372,13 @@ func (s *SQLiteIndexStore) UpdateIndex(idx *MemoryIndex) error {
 		expires_at = ?, updated_at = ?, accessed_at = ?
 		WHERE id = ?`
 
+	title, tags, err := s.sealIndexFields(idx)
+	if err != nil {
+		return fmt.Errorf("更新索引失败: %w", err)
+	}
+
 	result, err := s.db.Exec(query,
-		idx.FilePath, idx.Type, idx.Scope, idx.Category, idx.Title, idx.Tags,
+		idx.FilePath, idx.Type, idx.Scope, idx.Category, title, tags,
 		idx.ContentHash, idx.Importance, idx.AccessCount, idx.TokenCount,
 		idx.ExpiresAt, idx.UpdatedAt, idx.AccessedAt, idx.ID,
 	)
@@ -409,6 +505,11 @@ func (s *SQLiteIndexStore) GetMemoriesByCategory(category MemoryCategory) ([]*Me
 
 // SearchByKeyword 关键词搜索
 func (s *SQLiteIndexStore) SearchByKeyword(keyword string, limit int) ([]*MemoryIndex, error) {
+	// 加密存储时标题与标签无法在数据库内匹配，逐条解密后过滤
+	if s.cipher != nil {
+		return s.searchEncryptedIndexes(keyword, limit)
+	}
+
 	if s.ftsEnabled {
 		// 使用 FTS5 全文搜索
 		query := `SELECT m.id, m.file_path, m.type, m.scope, m.category, m.title, m.tags, m.content_hash,
@@ -436,6 +537,31 @@ func (s *SQLiteIndexStore) SearchByKeyword(keyword string, limit int) ([]*Memory
 	return s.queryIndexes(query, likePattern, likePattern, limit)
 }
 
+// searchEncryptedIndexes 解密全部索引后按标题与标签匹配关键词
+func (s *SQLiteIndexStore) searchEncryptedIndexes(keyword string, limit int) ([]*MemoryIndex, error) {
+	query := `SELECT id, file_path, type, scope, category, title, tags, content_hash,
+		importance, access_count, token_count, expires_at, created_at, updated_at, accessed_at
+		FROM memory_index
+		ORDER BY updated_at DESC`
+
+	indexes, err := s.queryIndexes(query)
+	if err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(keyword)
+	var matched []*MemoryIndex
+	for _, idx := range indexes {
+		if len(matched) >= limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(idx.Title), lower) || strings.Contains(strings.ToLower(idx.Tags), lower) {
+			matched = append(matched, idx)
+		}
+	}
+	return matched, nil
+}
+
 // IncrementAccessCount 增加访问计数
 func (s *SQLiteIndexStore) IncrementAccessCount(id string) error {
 	query := `UPDATE memory_index SET 
@@ -554,6 +680,249 @@ func (s *SQLiteIndexStore) GetOrphanedIndexes(existingFiles map[string]bool) ([]
 	return orphaned, nil
 }
 
+// ========== 会话消息索引 ==========
+
+// SetCipher 设置记忆标题、标签与会话消息内容的加密器（nil 表示明文存储）
+// 启用后关键词搜索不再使用全文索引，改为逐条解密后匹配
+func (s *SQLiteIndexStore) SetCipher(cipher *MemoryCipher) {
+	s.cipher = cipher
+}
+
+// sealIndexFields 返回写入数据库的标题与标签（启用加密时为密文）
+func (s *SQLiteIndexStore) sealIndexFields(idx *MemoryIndex) (string, string, error) {
+	title, err := s.cipher.SealString(idx.Title)
+	if err != nil {
+		return "", "", err
+	}
+	tags, err := s.cipher.SealString(idx.Tags)
+	if err != nil {
+		return "", "", err
+	}
+	return title, tags, nil
+}
+
+// openIndexFields 解密从数据库读出的标题与标签
+func (s *SQLiteIndexStore) openIndexFields(idx *MemoryIndex) error {
+	title, err := s.cipher.OpenString(idx.Title)
+	if err != nil {
+		return err
+	}
+	tags, err := s.cipher.OpenString(idx.Tags)
+	if err != nil {
+		return err
+	}
+	idx.Title, idx.Tags = title, tags
+	return nil
+}
+
+// IndexSessionMessage 写入或更新会话消息索引
+func (s *SQLiteIndexStore) IndexSessionMessage(sessionID string, msg *SessionMessage) error {
+	query := `INSERT INTO session_messages (session_id, sequence, role, content, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(session_id, sequence) DO UPDATE SET
+			role = excluded.role, content = excluded.content, created_at = excluded.created_at`
+
+	content, err := s.cipher.SealString(msg.Content)
+	if err != nil {
+		return fmt.Errorf("索引会话消息失败: %w", err)
+	}
+
+	if _, err := s.db.Exec(query, sessionID, msg.Sequence, msg.Role, content, msg.Timestamp); err != nil {
+		return fmt.Errorf("索引会话消息失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteSessionMessages 删除会话中序号不小于 fromSequence 的消息索引
+func (s *SQLiteIndexStore) DeleteSessionMessages(sessionID string, fromSequence int) error {
+	_, err := s.db.Exec("DELETE FROM session_messages WHERE session_id = ? AND sequence >= ?",
+		sessionID, fromSequence)
+	if err != nil {
+		return fmt.Errorf("删除会话消息索引失败: %w", err)
+	}
+	return nil
+}
+
+// SearchSessionMessages 全文搜索历史会话消息
+func (s *SQLiteIndexStore) SearchSessionMessages(query string, limit int) ([]*SessionMessageHit, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// 加密存储时无法在数据库内匹配，逐条解密后过滤
+	if s.cipher != nil {
+		return s.searchEncryptedSessionMessages(terms, limit)
+	}
+
+	// trigram 索引只能匹配不少于 3 个字符的词，较短的词（如两个汉字）使用 LIKE
+	if s.sessionFTS && shortestTermLength(terms) >= 3 {
+		// 每个词加引号，避免用户输入被解析为 FTS5 语法
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		}
+
+		sqlQuery := `SELECT m.session_id, m.sequence, m.role, m.created_at,
+			snippet(session_message_fts, 0, '[', ']', '…', 16)
+			FROM session_message_fts f
+			JOIN session_messages m ON m.rowid = f.rowid
+			WHERE session_message_fts MATCH ?
+			ORDER BY rank
+			LIMIT ?`
+
+		rows, err := s.db.Query(sqlQuery, strings.Join(quoted, " "), limit)
+		if err != nil {
+			return nil, fmt.Errorf("搜索会话消息失败: %w", err)
+		}
+		defer rows.Close()
+
+		var hits []*SessionMessageHit
+		for rows.Next() {
+			hit := &SessionMessageHit{}
+			if err := rows.Scan(&hit.SessionID, &hit.Sequence, &hit.Role, &hit.Timestamp, &hit.Snippet); err != nil {
+				continue
+			}
+			hits = append(hits, hit)
+		}
+		return hits, nil
+	}
+
+	// 降级：所有词都需 LIKE 匹配
+	conds := make([]string, len(terms))
+	args := make([]interface{}, 0, len(terms)+1)
+	for i, term := range terms {
+		conds[i] = "content LIKE ?"
+		args = append(args, "%"+term+"%")
+	}
+	args = append(args, limit)
+
+	sqlQuery := `SELECT session_id, sequence, role, created_at, content
+		FROM session_messages
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY created_at DESC
+		LIMIT ?`
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜索会话消息失败: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []*SessionMessageHit
+	for rows.Next() {
+		hit := &SessionMessageHit{}
+		var content string
+		if err := rows.Scan(&hit.SessionID, &hit.Sequence, &hit.Role, &hit.Timestamp, &content); err != nil {
+			continue
+		}
+		hit.Snippet = makeSnippet(content, terms[0], 16)
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
+
+// searchEncryptedSessionMessages 解密全部会话消息后按词过滤（所有词都需匹配）
+func (s *SQLiteIndexStore) searchEncryptedSessionMessages(terms []string, limit int) ([]*SessionMessageHit, error) {
+	rows, err := s.db.Query(`SELECT session_id, sequence, role, created_at, content
+		FROM session_messages
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("搜索会话消息失败: %w", err)
+	}
+	defer rows.Close()
+
+	lowerTerms := make([]string, len(terms))
+	for i, term := range terms {
+		lowerTerms[i] = strings.ToLower(term)
+	}
+
+	var hits []*SessionMessageHit
+	for rows.Next() && len(hits) < limit {
+		hit := &SessionMessageHit{}
+		var stored string
+		if err := rows.Scan(&hit.SessionID, &hit.Sequence, &hit.Role, &hit.Timestamp, &stored); err != nil {
+			continue
+		}
+		content, err := s.cipher.OpenString(stored)
+		if err != nil {
+			continue
+		}
+
+		lower := strings.ToLower(content)
+		matched := true
+		for _, term := range lowerTerms {
+			if !strings.Contains(lower, term) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		hit.Snippet = makeSnippet(content, terms[0], 16)
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
+
+// shortestTermLength 返回最短搜索词的字符数
+func shortestTermLength(terms []string) int {
+	shortest := -1
+	for _, term := range terms {
+		if n := utf8.RuneCountInString(term); shortest < 0 || n < shortest {
+			shortest = n
+		}
+	}
+	return shortest
+}
+
+// makeSnippet 截取关键词附近的文本片段，关键词用 [] 标记
+func makeSnippet(content, term string, radius int) string {
+	runes := []rune(strings.ReplaceAll(content, "\n", " "))
+	lower := []rune(strings.ToLower(string(runes)))
+	termRunes := []rune(strings.ToLower(term))
+
+	pos := -1
+	for i := 0; i+len(termRunes) <= len(lower); i++ {
+		if string(lower[i:i+len(termRunes)]) == string(termRunes) {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		if len(runes) > radius*2 {
+			return string(runes[:radius*2]) + "…"
+		}
+		return string(runes)
+	}
+
+	start := pos - radius
+	if start < 0 {
+		start = 0
+	}
+	end := pos + len(termRunes) + radius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("…")
+	}
+	builder.WriteString(string(runes[start:pos]))
+	builder.WriteString("[" + string(runes[pos:pos+len(termRunes)]) + "]")
+	builder.WriteString(string(runes[pos+len(termRunes) : end]))
+	if end < len(runes) {
+		builder.WriteString("…")
+	}
+
+	return builder.String()
+}
+
 // queryIndexes 查询索引列表的通用方法
 func (s *SQLiteIndexStore) queryIndexes(query string, args ...interface{}) ([]*MemoryIndex, error) {
 	rows, err := s.db.Query(query, args...)
@@ -573,6 +942,9 @@ func (s *SQLiteIndexStore) queryIndexes(query string, args ...interface{}) ([]*M
 		); err != nil {
 			continue
 		}
+		if err := s.openIndexFields(idx); err != nil {
+			continue
+		}
 
 		if expiresAt.Valid {
 			idx.ExpiresAt = &expiresAt.Time
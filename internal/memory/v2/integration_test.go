@@ -2,11 +2,20 @@
 package v2
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/hession/aimate/internal/redact"
 )
 
 // ========== 存储层集成测试 ==========
@@ -556,3 +565,1796 @@ func TestMultiComponent_SearchAcrossLayers(t *testing.T) {
 		t.Error("应找到长期记忆")
 	}
 }
+
+// TestLifecycle_CompressSimilarMemories 测试相似长期记忆的合并
+func TestLifecycle_CompressSimilarMemories(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "compress-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	longTermMgr := NewLongTermMemoryManager(storage, fileStore, index, nil, cfg)
+
+	content := "项目使用 Go 1.21 开发，索引存储在 SQLite 中，向量检索基于 HNSW 索引实现"
+	first, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "项目技术栈", content, []string{"go"})
+	second, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "技术栈", content+"。", []string{"sqlite"})
+	other, _ := longTermMgr.Add(CategoryPreference, ScopeGlobal, "回复语言", "用户偏好使用中文回复，代码注释保持简洁", nil)
+	_ = longTermMgr.SetImportance(second.ID, 5)
+	_ = longTermMgr.AddRelation(first.ID, other.ID)
+	_ = longTermMgr.AddRelation(other.ID, second.ID)
+
+	var mergedCount int
+	compressor := NewMemoryCompressor(longTermMgr, nil, nil, cfg, func(ctx context.Context, memories []*Memory) (string, string, error) {
+		mergedCount = len(memories)
+		return "项目技术栈（合并）", content, nil
+	})
+	lifecycle := NewLifecycleManager(nil, longTermMgr, nil, nil, compressor, cfg)
+
+	result := lifecycle.RunMaintenance(context.Background())
+	if len(result.Errors) > 0 {
+		t.Fatalf("维护出错: %v", result.Errors)
+	}
+	if result.CompressionClusters != 1 || result.MemoriesCompressed != 2 || mergedCount != 2 {
+		t.Fatalf("应合并 1 簇 2 条记忆，实际 %d 簇 %d 条", result.CompressionClusters, result.MemoriesCompressed)
+	}
+
+	active, _ := longTermMgr.LoadActive()
+	if len(active) != 2 {
+		t.Fatalf("合并后应剩 2 条活跃记忆，实际 %d", len(active))
+	}
+
+	merged, _ := longTermMgr.FindByTitle("项目技术栈（合并）")
+	if merged == nil {
+		t.Fatal("未找到合并后的记忆")
+	}
+	if merged.Importance != 5 {
+		t.Errorf("合并后应继承最高重要性 5，实际 %d", merged.Importance)
+	}
+	sort.Strings(merged.Tags)
+	if strings.Join(merged.Tags, ",") != "go,sqlite" {
+		t.Errorf("合并后应继承全部标签，实际 %v", merged.Tags)
+	}
+	if len(merged.Related) != 1 || merged.Related[0] != other.ID {
+		t.Errorf("合并后应继承关联，实际 %v", merged.Related)
+	}
+
+	// 指向原记忆的关联改为指向合并后的记忆
+	updated, err := longTermMgr.FindByID(other.ID)
+	if err != nil {
+		t.Fatalf("读取记忆失败: %v", err)
+	}
+	if len(updated.Related) != 1 || updated.Related[0] != merged.ID {
+		t.Errorf("关联应指向合并后的记忆，实际 %v", updated.Related)
+	}
+
+	if _, err := index.GetIndex(first.ID); err == nil {
+		t.Error("原记忆的索引应被移除")
+	}
+}
+
+// TestFederatedVectorStore_StaleProjectStore 测试项目向量库需要重建时不影响全局向量检索
+func TestFederatedVectorStore_StaleProjectStore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	globalVector, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "global-vectors.db"), "new-model", 3)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	_ = globalVector.StoreVector("global-1", []float32{1, 0, 0})
+
+	// 项目向量库由旧模型生成
+	projectPath := filepath.Join(tmpDir, "project-vectors.db")
+	projectVector, err := NewSQLiteVectorStore(projectPath, "old-model", 2)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	_ = projectVector.StoreVector("project-1", []float32{1, 0})
+	projectVector.Close()
+	projectVector, err = NewSQLiteVectorStore(projectPath, "new-model", 3)
+	if err != nil {
+		t.Fatalf("重新打开向量存储失败: %v", err)
+	}
+
+	vector := NewFederatedVectorStore(globalVector, NewFederatedIndexStore(index))
+	defer vector.Close()
+	vector.SetProject(projectVector)
+
+	results, err := vector.SearchSimilar([]float32{1, 0, 0}, 5, 0)
+	if err != nil {
+		t.Fatalf("项目向量库过期时全局检索不应失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "global-1" {
+		t.Errorf("应只返回全局向量库的结果，实际 %v", results)
+	}
+	if stats, _ := vector.GetVectorStats(); !stats.NeedsReembed {
+		t.Error("统计信息应标记需要重建")
+	}
+
+	// 全部向量库都需要重建时返回 ErrVectorSpace
+	vector.SetProject(nil)
+	defer projectVector.Close()
+	staleGlobal, err := NewSQLiteVectorStore(projectPath, "other-model", 3)
+	if err != nil {
+		t.Fatalf("打开向量存储失败: %v", err)
+	}
+	defer staleGlobal.Close()
+	if _, err := NewFederatedVectorStore(staleGlobal, NewFederatedIndexStore(index)).SearchSimilar([]float32{1, 0, 0}, 5, 0); !errors.Is(err, ErrVectorSpace) {
+		t.Errorf("全部需要重建时应返回 ErrVectorSpace, 实际 %v", err)
+	}
+}
+
+// TestLongTermMemory_MergeArchiveFailure 测试归档原记忆失败时不留下重复的合并记忆
+func TestLongTermMemory_MergeArchiveFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+	longTermMgr := NewLongTermMemoryManager(storage, NewMarkdownFileStore(storage), index, nil, cfg)
+
+	first, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "技术栈", "项目使用 Go 开发", nil)
+	second, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "语言", "项目使用 Go 语言", nil)
+
+	// 归档目录被同名文件占用，归档必然失败
+	archiveRoot := storage.GetGlobalArchivePath()
+	_ = os.RemoveAll(archiveRoot)
+	if err := os.WriteFile(archiveRoot, []byte("x"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	if _, err := longTermMgr.Merge([]*Memory{first, second}, "技术栈（合并）", "项目使用 Go 开发"); err == nil {
+		t.Fatal("归档失败时合并应返回错误")
+	}
+	if merged, _ := longTermMgr.FindByTitle("技术栈（合并）"); merged != nil {
+		t.Error("归档失败时不应保留合并记忆")
+	}
+	active, _ := longTermMgr.LoadActive()
+	if len(active) != 2 {
+		t.Errorf("原记忆应保持活跃，实际 %d 条", len(active))
+	}
+}
+
+// TestReflector_DistillSessions 测试会话反思写入长期记忆与核心记忆审核队列
+func TestReflector_DistillSessions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "reflect-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
+	coreMgr := NewCoreMemoryManager(storage, fileStore, index, cfg)
+	longTermMgr := NewLongTermMemoryManager(storage, fileStore, index, nil, cfg)
+	review := NewReviewQueue(filepath.Join(tmpDir, "review_queue.json"), coreMgr)
+
+	sess, err := sessionMgr.CreateSession()
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	_ = sessionMgr.AddMessage("user", "以后回复都用中文。我们决定用 SQLite 存储索引", 20)
+	_ = sessionMgr.AddMessage("assistant", "好的，已记录", 5)
+
+	calls := 0
+	complete := func(ctx context.Context, prompt string) (string, error) {
+		calls++
+		if calls > 2 {
+			if strings.Contains(prompt, "go test") || !strings.Contains(prompt, "make test") {
+				t.Errorf("截断后应反思复用序号的新消息: %s", prompt)
+			}
+			return `[]`, nil
+		}
+		if calls > 1 {
+			if strings.Contains(prompt, "决定用 SQLite") || !strings.Contains(prompt, "测试用 go test") {
+				t.Errorf("再次反思只应包含新消息: %s", prompt)
+			}
+			return `[{"kind": "fact", "title": "测试命令", "content": "使用 go test 运行测试"}]`, nil
+		}
+		if !strings.Contains(prompt, "决定用 SQLite") {
+			t.Errorf("提示词应包含对话内容")
+		}
+		return `[
+			{"kind": "decision", "title": "索引存储选型", "content": "使用 SQLite 存储索引", "tags": ["sqlite"]},
+			{"kind": "preference", "title": "回复语言", "content": "始终使用中文回复"},
+			{"kind": "chitchat", "title": "忽略", "content": "无关内容"}
+		]`, nil
+	}
+
+	reflector := NewReflector(storage, fileStore, sessionMgr, coreMgr, longTermMgr, review,
+		filepath.Join(tmpDir, "reflection_state.json"), complete)
+
+	result, err := reflector.Run(context.Background())
+	if err != nil {
+		t.Fatalf("反思失败: %v", err)
+	}
+	if result.Sessions != 1 || result.LongTermAdded != 1 || result.CoreQueued != 1 {
+		t.Fatalf("反思结果错误: %+v", result)
+	}
+
+	decision, _ := longTermMgr.FindByTitle("索引存储选型")
+	if decision == nil || decision.Category != CategoryDecision {
+		t.Fatalf("应写入决策记忆，实际 %+v", decision)
+	}
+	if decision.Source != "session:"+sess.ID {
+		t.Errorf("来源应指向会话，实际 %s", decision.Source)
+	}
+
+	// 核心记忆需审核后才写入
+	if existing, _ := coreMgr.FindByTitle("回复语言"); existing != nil {
+		t.Fatal("核心记忆不应在审核前写入")
+	}
+	items, _ := review.List()
+	if len(items) != 1 {
+		t.Fatalf("审核队列应有 1 条变更，实际 %d", len(items))
+	}
+	mem, err := review.Approve(items[0].ID[:8])
+	if err != nil {
+		t.Fatalf("批准变更失败: %v", err)
+	}
+	if mem.Type != MemoryTypeCore || mem.Source != "session:"+sess.ID {
+		t.Errorf("批准后应写入核心记忆并保留来源，实际 %s %s", mem.Type, mem.Source)
+	}
+	if review.Size() != 0 {
+		t.Error("批准后应从审核队列移除")
+	}
+
+	// 未更新的会话不会被再次处理
+	result, err = reflector.Run(context.Background())
+	if err != nil {
+		t.Fatalf("反思失败: %v", err)
+	}
+	if result.Sessions != 0 || calls != 1 {
+		t.Errorf("未更新的会话不应再次反思，处理 %d 个会话，调用 LLM %d 次", result.Sessions, calls)
+	}
+
+	// 会话更新后只反思新消息
+	time.Sleep(10 * time.Millisecond)
+	_ = sessionMgr.AddMessage("user", "测试用 go test 运行", 10)
+	result, err = reflector.Run(context.Background())
+	if err != nil {
+		t.Fatalf("反思失败: %v", err)
+	}
+	if result.Sessions != 1 || result.LongTermAdded != 1 || calls != 2 {
+		t.Errorf("应只反思新消息，结果 %+v，调用 LLM %d 次", result, calls)
+	}
+
+	// 截断后重新生成的消息复用序号，仍会被反思
+	sessionMgr.SetTruncateHook(func(sessionID string, fromSequence int) {
+		if err := reflector.Rewind(sessionID, fromSequence); err != nil {
+			t.Errorf("回退反思进度失败: %v", err)
+		}
+	})
+	time.Sleep(10 * time.Millisecond)
+	if err := sessionMgr.TruncateMessages(3); err != nil {
+		t.Fatalf("截断消息失败: %v", err)
+	}
+	_ = sessionMgr.AddMessage("user", "改用 make test 运行", 10)
+	if _, err := reflector.Run(context.Background()); err != nil {
+		t.Fatalf("反思失败: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("截断后重新生成的消息应被反思，调用 LLM %d 次", calls)
+	}
+}
+
+func TestFileWatcher_SyncExternalEdits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "watcher-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	syncer := NewIndexSyncer(storage, fileStore, index, nil)
+	watcher := NewFileWatcher(storage, fileStore, syncer, nil, 50*time.Millisecond)
+	if err := watcher.Start(); err != nil {
+		t.Fatalf("启动监听失败: %v", err)
+	}
+	defer watcher.Stop()
+
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("等待超时: %s", desc)
+	}
+
+	// 1. 新建文件（所在分类目录也是新建的）
+	mem := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "部署方式", "使用 Docker 部署")
+	if err := fileStore.CreateMemory(mem); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	waitFor("新文件建立索引", func() bool {
+		idx, err := index.GetIndex(mem.ID)
+		return err == nil && idx.FilePath == mem.FilePath
+	})
+
+	// 2. 外部编辑内容
+	edited, _ := fileStore.ReadMemory(mem.FilePath)
+	edited.Content = "使用 Kubernetes 部署"
+	if err := fileStore.UpdateMemory(edited); err != nil {
+		t.Fatalf("编辑记忆失败: %v", err)
+	}
+	edited, _ = fileStore.ReadMemory(mem.FilePath)
+	waitFor("内容变更同步到索引", func() bool {
+		idx, err := index.GetIndex(mem.ID)
+		return err == nil && idx.ContentHash == CalculateContentHash([]byte(edited.Content))
+	})
+
+	// 3. 移动到其他分类目录
+	moved := filepath.Join(storage.GetLongTermDecisionsPath(ScopeGlobal), filepath.Base(mem.FilePath))
+	if err := fileStore.MoveMemory(mem.FilePath, moved); err != nil {
+		t.Fatalf("移动记忆失败: %v", err)
+	}
+	waitFor("移动后更新路径与分类", func() bool {
+		idx, err := index.GetIndex(mem.ID)
+		return err == nil && idx.FilePath == moved && idx.Category == CategoryDecision
+	})
+	reread, err := fileStore.ReadMemory(moved)
+	if err != nil || reread.Category != CategoryDecision {
+		t.Errorf("frontmatter 应改为新分类: %+v %v", reread, err)
+	}
+
+	// 4. 删除文件
+	if err := os.Remove(moved); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	waitFor("删除后移除索引", func() bool {
+		_, err := index.GetIndex(mem.ID)
+		return IsNotFound(err)
+	})
+}
+
+func TestFederatedStores_RouteByScope(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "federated-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	openStores := func(name string) (*SQLiteIndexStore, *SQLiteVectorStore) {
+		t.Helper()
+		index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, name+"-index.db"))
+		if err != nil {
+			t.Fatalf("创建索引存储失败: %v", err)
+		}
+		vector, err := NewSQLiteVectorStore(filepath.Join(tmpDir, name+"-vectors.db"), "test", 3)
+		if err != nil {
+			t.Fatalf("创建向量存储失败: %v", err)
+		}
+		return index, vector
+	}
+
+	globalIndex, globalVector := openStores("global")
+	projectIndex, projectVector := openStores("project")
+
+	index := NewFederatedIndexStore(globalIndex)
+	vector := NewFederatedVectorStore(globalVector, index)
+	defer index.Close()
+	defer vector.Close()
+	index.SetProject(projectIndex)
+	vector.SetProject(projectVector)
+
+	newIndex := func(id string, scope MemoryScope) *MemoryIndex {
+		now := time.Now()
+		return &MemoryIndex{
+			ID:          id,
+			FilePath:    filepath.Join(tmpDir, id+".md"),
+			Type:        MemoryTypeLongTerm,
+			Scope:       scope,
+			Category:    CategoryKnowledge,
+			Title:       "缓存策略 " + id,
+			ContentHash: id,
+			Importance:  3,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			AccessedAt:  now,
+		}
+	}
+
+	// 按作用域写入对应存储
+	if err := index.CreateIndex(newIndex("global-1", ScopeGlobal)); err != nil {
+		t.Fatalf("创建全局索引失败: %v", err)
+	}
+	if err := index.CreateIndex(newIndex("project-1", ScopeProject)); err != nil {
+		t.Fatalf("创建项目索引失败: %v", err)
+	}
+	if _, err := projectIndex.GetIndex("project-1"); err != nil {
+		t.Errorf("项目记忆应写入项目索引: %v", err)
+	}
+	if _, err := globalIndex.GetIndex("project-1"); !IsNotFound(err) {
+		t.Error("项目记忆不应写入全局索引")
+	}
+
+	// 向量跟随索引所在位置
+	if err := vector.StoreVector("global-1", []float32{1, 0, 0}); err != nil {
+		t.Fatalf("存储向量失败: %v", err)
+	}
+	if err := vector.StoreVector("project-1", []float32{0.9, 0.1, 0}); err != nil {
+		t.Fatalf("存储向量失败: %v", err)
+	}
+	if _, err := projectVector.GetVector("project-1"); err != nil {
+		t.Errorf("项目记忆的向量应写入项目向量库: %v", err)
+	}
+
+	// 查询合并两个存储的结果
+	all, err := index.GetAllIndexes()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("应返回 2 条索引, 实际 %d (%v)", len(all), err)
+	}
+	hits, err := index.SearchByKeyword("缓存", 10)
+	if err != nil || len(hits) != 2 {
+		t.Errorf("关键词搜索应命中 2 条, 实际 %d (%v)", len(hits), err)
+	}
+	similar, err := vector.SearchSimilar([]float32{1, 0, 0}, 10, 0)
+	if err != nil || len(similar) != 2 {
+		t.Fatalf("向量搜索应命中 2 条, 实际 %d (%v)", len(similar), err)
+	}
+	if similar[0].ID != "global-1" {
+		t.Errorf("结果应按相似度排序, 首条为 %s", similar[0].ID)
+	}
+	stats, err := index.GetIndexStats()
+	if err != nil || stats.GlobalCount != 1 || stats.ProjectCount != 1 {
+		t.Errorf("统计应汇总两个索引: %+v (%v)", stats, err)
+	}
+
+	// 作用域变化时迁移到对应存储
+	moved := newIndex("global-1", ScopeProject)
+	if err := index.UpdateIndex(moved); err != nil {
+		t.Fatalf("更新索引失败: %v", err)
+	}
+	if _, err := globalIndex.GetIndex("global-1"); !IsNotFound(err) {
+		t.Error("改为项目作用域后应从全局索引移除")
+	}
+	if _, err := projectIndex.GetIndex("global-1"); err != nil {
+		t.Errorf("改为项目作用域后应写入项目索引: %v", err)
+	}
+
+	// 删除在两个存储中查找
+	if err := index.DeleteIndex("project-1"); err != nil {
+		t.Fatalf("删除索引失败: %v", err)
+	}
+	if err := index.DeleteIndex("project-1"); !IsNotFound(err) {
+		t.Errorf("重复删除应返回未找到, 实际 %v", err)
+	}
+
+	// 关闭项目后只查询全局存储
+	index.SetProject(nil)
+	vector.SetProject(nil)
+	defer projectIndex.Close()
+	defer projectVector.Close()
+	if _, err := index.GetIndex("global-1"); !IsNotFound(err) {
+		t.Error("关闭项目后不应再查到项目记忆")
+	}
+}
+
+func TestCoreRefiner_ProposeAndApply(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "refine-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	coreMgr := NewCoreMemoryManager(storage, fileStore, index, cfg)
+	tabs, _ := coreMgr.AddPreference("缩进", "使用 Tab 缩进")
+	_, _ = coreMgr.AddPreference("缩进宽度", "Tab 显示为 4 个空格")
+	_, _ = coreMgr.AddPersona("助手身份", "你是 AIMate")
+
+	refiner := NewCoreRefiner(storage, fileStore, coreMgr, cfg, nil)
+	if _, err := refiner.Propose(context.Background()); err == nil {
+		t.Fatal("未配置 LLM 时应返回错误")
+	}
+
+	refiner.SetCompleteFunc(func(ctx context.Context, prompt string) (string, error) {
+		if !strings.Contains(prompt, "你是 AIMate") {
+			t.Errorf("提示词应包含现有核心记忆")
+		}
+		return `{"memories": [
+			{"category": "preference", "title": "缩进风格", "content": "使用 Tab 缩进，显示宽度 4"},
+			{"category": "persona", "title": "助手身份", "content": "你是 AIMate"}
+		]}`, nil
+	})
+
+	plan, err := refiner.Propose(context.Background())
+	if err != nil {
+		t.Fatalf("生成精炼方案失败: %v", err)
+	}
+	diff := plan.Diff()
+	for _, want := range []string{"- [preference] 缩进", "+ [preference] 缩进风格", "助手身份（未变化）"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("差异应包含 %q:\n%s", want, diff)
+		}
+	}
+
+	result, err := refiner.Apply()
+	if err != nil {
+		t.Fatalf("应用精炼方案失败: %v", err)
+	}
+	if result.Created != 1 || result.Archived != 2 || result.Unchanged != 1 {
+		t.Fatalf("精炼结果错误: %+v", result)
+	}
+	if refiner.Pending() != nil {
+		t.Error("应用后应清除待确认方案")
+	}
+
+	memories, _ := coreMgr.LoadAll()
+	if len(memories) != 2 {
+		t.Fatalf("精炼后应有 2 条核心记忆，实际 %d", len(memories))
+	}
+	if _, err := index.GetIndex(tabs.ID); !IsNotFound(err) {
+		t.Error("旧记忆的索引应被删除")
+	}
+	archived, err := fileStore.ReadMemory(filepath.Join(result.ArchiveDir, filepath.Base(tabs.FilePath)))
+	if err != nil {
+		t.Fatalf("旧版本应保存在归档目录: %v", err)
+	}
+	if archived.Status != StatusArchived || strings.TrimSpace(archived.Content) != tabs.Content {
+		t.Errorf("归档的旧版本错误: %+v", archived)
+	}
+
+	// 生成方案后核心记忆被修改时拒绝应用
+	if _, err := refiner.Propose(context.Background()); err != nil {
+		t.Fatalf("生成精炼方案失败: %v", err)
+	}
+	_, _ = coreMgr.AddRule("提交规范", "提交信息使用英文")
+	if _, err := refiner.Apply(); err == nil {
+		t.Error("核心记忆变化后应拒绝应用旧方案")
+	}
+}
+
+// TestMemoryGraph_RelationsAndExpansion 测试带类型关联、自动关联、图扩展检索与图导出
+func TestMemoryGraph_RelationsAndExpansion(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "graph-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+	vector, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "vectors.db"), "mock", 3)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer vector.Close()
+
+	longTermMgr := NewLongTermMemoryManager(storage, fileStore, index, vector, cfg)
+
+	deploy, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "部署流程", "服务通过 Kubernetes 滚动发布", nil)
+	oldDeploy, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "旧发布方式", "服务通过脚本手动发布到虚拟机", nil)
+	helm, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "Helm 配置", "Chart 位于 deploy/chart 目录", nil)
+	other, _ := longTermMgr.Add(CategoryPreference, ScopeGlobal, "回复语言", "用户偏好使用中文回复", nil)
+
+	_ = vector.StoreVector(deploy.ID, []float32{1, 0, 0})
+	_ = vector.StoreVector(oldDeploy.ID, []float32{0, 1, 0})
+	_ = vector.StoreVector(helm.ID, []float32{0.9, 0.1, 0})
+	_ = vector.StoreVector(other.ID, []float32{0, 0, 1})
+
+	// 自动关联：只关联足够相似的记忆，且为双向关联
+	n, err := longTermMgr.RelateSimilar(helm.ID)
+	if err != nil {
+		t.Fatalf("自动关联失败: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("应自动关联 1 条记忆，实际 %d", n)
+	}
+	deploy, _ = longTermMgr.FindByID(deploy.ID)
+	if deploy.RelationTo(helm.ID) != RelationRelated {
+		t.Errorf("自动关联应为双向普通关联，实际 %q", deploy.RelationTo(helm.ID))
+	}
+
+	// 带类型关联写入 frontmatter 并可更新类型
+	if err := longTermMgr.AddTypedRelation(deploy.ID, oldDeploy.ID, RelationSupersedes); err != nil {
+		t.Fatalf("添加关联失败: %v", err)
+	}
+	if err := longTermMgr.AddTypedRelation(helm.ID, deploy.ID, RelationExampleOf); err != nil {
+		t.Fatalf("更新关联类型失败: %v", err)
+	}
+	if err := longTermMgr.AddTypedRelation(deploy.ID, deploy.ID, RelationRelated); err == nil {
+		t.Error("记忆关联自身应返回错误")
+	}
+	helm, _ = longTermMgr.FindByID(helm.ID)
+	if len(helm.Related) != 1 || helm.RelationTo(deploy.ID) != RelationExampleOf {
+		t.Errorf("关联类型应更新为 example-of，实际 %v %v", helm.Related, helm.RelationTypes)
+	}
+
+	// 检索时扩展一跳邻居，分数按衰减系数降低
+	retriever := NewHybridRetriever(index, vector, fileStore, nil, &cfg.Retrieval)
+	results, err := retriever.Search(context.Background(), "部署流程", DefaultRetrievalOptions())
+	if err != nil {
+		t.Fatalf("检索失败: %v", err)
+	}
+	scores := make(map[string]*MemorySearchResult)
+	for _, r := range results {
+		scores[r.Memory.ID] = r
+	}
+	parent, ok := scores[deploy.ID]
+	if !ok {
+		t.Fatalf("应命中部署流程，实际 %d 条结果", len(results))
+	}
+	neighbour, ok := scores[oldDeploy.ID]
+	if !ok {
+		t.Fatal("应沿关联扩展到旧发布方式")
+	}
+	if neighbour.MatchType != "graph" || neighbour.Explanation.GraphFrom != deploy.ID ||
+		neighbour.Explanation.GraphRelation != RelationSupersedes {
+		t.Errorf("扩展结果说明不正确: %s %+v", neighbour.MatchType, neighbour.Explanation)
+	}
+	if neighbour.Score >= parent.Score {
+		t.Errorf("扩展结果分数应低于来源记忆: %.3f >= %.3f", neighbour.Score, parent.Score)
+	}
+	if _, ok := scores[other.ID]; ok {
+		t.Error("未关联的记忆不应被扩展")
+	}
+
+	// 图导出
+	graph, err := BuildMemoryGraph(deploy.ID, 1, longTermMgr.FindByID)
+	if err != nil {
+		t.Fatalf("构建关联图失败: %v", err)
+	}
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 3 {
+		t.Fatalf("关联图应有 3 个节点 3 条边，实际 %d 个节点 %d 条边", len(graph.Nodes), len(graph.Edges))
+	}
+	dot := graph.DOT()
+	if !strings.Contains(dot, "digraph memory") || !strings.Contains(dot, "[label=\"supersedes\"]") {
+		t.Errorf("DOT 输出不正确:\n%s", dot)
+	}
+	mermaid := graph.Mermaid()
+	if !strings.HasPrefix(mermaid, "graph LR") || !strings.Contains(mermaid, "-->|example-of|") {
+		t.Errorf("Mermaid 输出不正确:\n%s", mermaid)
+	}
+
+	// 移除关联同时清理类型
+	if err := longTermMgr.RemoveRelation(deploy.ID, oldDeploy.ID); err != nil {
+		t.Fatalf("移除关联失败: %v", err)
+	}
+	deploy, _ = longTermMgr.FindByID(deploy.ID)
+	if deploy.RelationTo(oldDeploy.ID) != "" || len(deploy.RelationTypes) != 0 {
+		t.Errorf("关联应被移除，实际 %v %v", deploy.Related, deploy.RelationTypes)
+	}
+}
+
+// TestSupersessionDetector_ArchiveSuperseded 测试新记忆取代旧记忆时归档旧记忆并记录关联
+func TestSupersessionDetector_ArchiveSuperseded(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "supersede-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+	vector, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "vectors.db"), "mock", 3)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer vector.Close()
+
+	longTermMgr := NewLongTermMemoryManager(storage, fileStore, index, vector, cfg)
+
+	postgres, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "数据库选型", "我们使用 PostgreSQL", nil)
+	pinned, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "数据库版本", "数据库固定使用 PostgreSQL 15", nil)
+	pinned.Pinned = true
+	_ = fileStore.UpdateMemory(pinned)
+	other, _ := longTermMgr.Add(CategoryPreference, ScopeGlobal, "回复语言", "用户偏好使用中文回复", nil)
+	mysql, _ := longTermMgr.Add(CategoryProject, ScopeGlobal, "数据库迁移", "我们已迁移到 MySQL", nil)
+
+	_ = vector.StoreVector(postgres.ID, []float32{1, 0, 0})
+	_ = vector.StoreVector(pinned.ID, []float32{0.9, 0.3, 0})
+	_ = vector.StoreVector(other.ID, []float32{0, 0, 1})
+	_ = vector.StoreVector(mysql.ID, []float32{1, 0.1, 0})
+
+	// 两条相似的旧记忆都判断为被取代，固定的记忆降级为矛盾
+	var prompt string
+	complete := func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return `{"results": [{"index": 1, "relation": "supersedes", "reason": "数据库已迁移"}, {"index": 2, "relation": "supersedes"}]}`, nil
+	}
+
+	detector := NewSupersessionDetector(longTermMgr, cfg, nil)
+	if result, err := detector.Detect(context.Background(), mysql); err != nil || result != nil {
+		t.Fatalf("未配置 LLM 时不应检测，实际 %v %v", result, err)
+	}
+
+	detector.SetCompleteFunc(complete)
+	result, err := detector.Detect(context.Background(), mysql)
+	if err != nil {
+		t.Fatalf("取代检测失败: %v", err)
+	}
+	if strings.Contains(prompt, "回复语言") {
+		t.Error("不相似的记忆不应送入 LLM")
+	}
+	if result == nil || len(result.Changes) != 2 {
+		t.Fatalf("应有 2 条变化，实际 %+v", result)
+	}
+
+	changes := make(map[string]RelationType)
+	for _, change := range result.Changes {
+		changes[change.Old.ID] = change.Relation
+	}
+	if changes[postgres.ID] != RelationSupersedes || changes[pinned.ID] != RelationContradicts {
+		t.Errorf("变化类型不正确: %v", changes)
+	}
+
+	// 被取代的记忆已归档并移除索引与向量
+	if _, err := index.GetIndex(postgres.ID); !IsNotFound(err) {
+		t.Errorf("被取代记忆的索引应被移除: %v", err)
+	}
+	if _, err := vector.GetVector(postgres.ID); !IsNotFound(err) {
+		t.Errorf("被取代记忆的向量应被移除: %v", err)
+	}
+	if _, err := longTermMgr.FindByID(pinned.ID); err != nil {
+		t.Errorf("固定的记忆应保留: %v", err)
+	}
+
+	updated, _ := longTermMgr.FindByID(mysql.ID)
+	if updated.RelationTo(postgres.ID) != RelationSupersedes || updated.RelationTo(pinned.ID) != RelationContradicts {
+		t.Errorf("新记忆应记录关联，实际 %v %v", updated.Related, updated.RelationTypes)
+	}
+
+	summary := result.Summary()
+	if !strings.Contains(summary, "取代了「数据库选型」") || !strings.Contains(summary, "与「数据库版本」") {
+		t.Errorf("变化说明不正确:\n%s", summary)
+	}
+}
+
+// TestMemoryHistory_RecordAndShow 测试记忆变更提交到 git 并可读取历史版本
+func TestMemoryHistory_RecordAndShow(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("未安装 git")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "history-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	history, err := NewMemoryHistory(storage)
+	if err != nil {
+		t.Fatalf("创建版本历史失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	fileStore.SetHistory(history)
+
+	// 索引库等非 Markdown 文件不入库
+	if err := os.WriteFile(filepath.Join(storage.GetGlobalRoot(), "index.db"), []byte("db"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	mem := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "数据库选型", "我们使用 PostgreSQL")
+	if err := fileStore.CreateMemory(mem); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	mem.Content = "我们已迁移到 MySQL"
+	if err := fileStore.UpdateMemory(mem); err != nil {
+		t.Fatalf("更新记忆失败: %v", err)
+	}
+
+	entries, err := history.Log(mem.FilePath, 0)
+	if err != nil {
+		t.Fatalf("读取历史失败: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("应有 2 个版本，实际 %d", len(entries))
+	}
+	if !strings.HasPrefix(entries[0].Message, "update long_term/knowledge: 数据库选型") ||
+		!strings.HasPrefix(entries[1].Message, "create ") {
+		t.Errorf("提交信息不正确: %q, %q", entries[0].Message, entries[1].Message)
+	}
+
+	content, err := history.Show(entries[1].Rev, entries[1].Path)
+	if err != nil {
+		t.Fatalf("读取历史版本失败: %v", err)
+	}
+	old, err := NewFrontmatterParser().ParseMemory(content)
+	if err != nil {
+		t.Fatalf("解析历史版本失败: %v", err)
+	}
+	if old.ID != mem.ID || strings.TrimSpace(old.Content) != "我们使用 PostgreSQL" {
+		t.Errorf("历史版本内容不正确: %s %q", old.ID, old.Content)
+	}
+
+	// 回滚提交后当前内容恢复
+	old.FilePath = mem.FilePath
+	if err := fileStore.RevertMemory(old, entries[1].ShortRev); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	reverted, _ := fileStore.ReadMemory(mem.FilePath)
+	if strings.TrimSpace(reverted.Content) != "我们使用 PostgreSQL" {
+		t.Errorf("回滚后内容不正确: %q", reverted.Content)
+	}
+
+	// 归档后沿重命名继续跟踪历史
+	archivedPath := filepath.Join(storage.GetArchivePath(mem), filepath.Base(mem.FilePath))
+	if err := fileStore.ArchiveMemory(mem); err != nil {
+		t.Fatalf("归档失败: %v", err)
+	}
+	entries, err = history.Log(archivedPath, 0)
+	if err != nil {
+		t.Fatalf("读取归档历史失败: %v", err)
+	}
+	if len(entries) != 4 || !strings.HasPrefix(entries[0].Message, "archive ") || !strings.HasPrefix(entries[1].Message, "revert ") {
+		t.Errorf("归档后历史不正确: %d 个版本", len(entries))
+	}
+
+	tracked, err := exec.Command("git", "-C", storage.GetGlobalRoot(), "ls-files").Output()
+	if err != nil {
+		t.Fatalf("列出仓库文件失败: %v", err)
+	}
+	if strings.Contains(string(tracked), "index.db") {
+		t.Errorf("索引库不应入库:\n%s", tracked)
+	}
+}
+
+func TestTeamSync_ShareProjectMemories(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("未安装 git")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "teamsync-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	remote := filepath.Join(tmpDir, "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("创建裸仓库失败: %v %s", err, out)
+	}
+
+	// 两名成员：各自的全局目录与同一项目的不同工作副本
+	newMember := func(name string) (*TeamSync, *MarkdownFileStore, *StorageManager) {
+		cfg := DefaultMemoryConfig()
+		cfg.Storage.GlobalRoot = filepath.Join(tmpDir, name, "home", "memory")
+		cfg.TeamSync.Remote = remote
+
+		project := filepath.Join(tmpDir, name, "project")
+		if err := os.MkdirAll(project, 0755); err != nil {
+			t.Fatalf("创建项目目录失败: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(project, "go.mod"), []byte("module demo\n"), 0644); err != nil {
+			t.Fatalf("写入项目标记失败: %v", err)
+		}
+
+		storage, err := NewStorageManager(cfg)
+		if err != nil {
+			t.Fatalf("创建存储管理器失败: %v", err)
+		}
+		if err := storage.SetCurrentProject(project); err != nil {
+			t.Fatalf("设置项目失败: %v", err)
+		}
+		fileStore := NewMarkdownFileStore(storage)
+		ts, err := NewTeamSync(storage, fileStore, cfg.TeamSync)
+		if err != nil {
+			t.Fatalf("创建团队同步失败: %v", err)
+		}
+		return ts, fileStore, storage
+	}
+	syncA, storeA, storageA := newMember("alice")
+	syncB, storeB, storageB := newMember("bob")
+
+	runSync := func(ts *TeamSync) *TeamSyncResult {
+		result, err := ts.Sync()
+		if err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		return result
+	}
+	projectMemories := func(store *MarkdownFileStore, storage *StorageManager, category MemoryCategory) []*Memory {
+		var dir string
+		switch category {
+		case CategoryDecision:
+			dir = storage.GetLongTermDecisionsPath(ScopeProject)
+		case CategoryKnowledge:
+			dir = storage.GetLongTermKnowledgePath(ScopeProject)
+		}
+		if !FileExists(dir) {
+			return nil
+		}
+		memories, err := store.ListMemories(dir)
+		if err != nil {
+			t.Fatalf("列出记忆失败: %v", err)
+		}
+		return memories
+	}
+
+	decision := NewMemory(MemoryTypeLongTerm, ScopeProject, CategoryDecision, "数据库选型", "我们使用 PostgreSQL")
+	knowledge := NewMemory(MemoryTypeLongTerm, ScopeProject, CategoryKnowledge, "个人笔记", "不共享的知识")
+	core := NewMemory(MemoryTypeCore, ScopeGlobal, CategoryPreference, "偏好", "喜欢简洁的回答")
+	for _, mem := range []*Memory{decision, knowledge, core} {
+		if err := storeA.CreateMemory(mem); err != nil {
+			t.Fatalf("创建记忆失败: %v", err)
+		}
+	}
+
+	if result := runSync(syncA); result.Exported != 1 || !result.Pushed {
+		t.Fatalf("应推送 1 条决策记忆: %+v", result)
+	}
+	if result := runSync(syncB); result.Imported != 1 {
+		t.Fatalf("应拉取 1 条决策记忆: %+v", result)
+	}
+	decisionsB := projectMemories(storeB, storageB, CategoryDecision)
+	if len(decisionsB) != 1 || decisionsB[0].ID != decision.ID {
+		t.Fatalf("成员 B 应收到共享决策: %v", decisionsB)
+	}
+	if len(projectMemories(storeB, storageB, CategoryKnowledge)) != 0 {
+		t.Error("未共享的分类不应同步")
+	}
+	if paths, _ := storageB.ListMemoryFiles(storageB.GetGlobalCorePath()); len(paths) != 0 {
+		t.Error("核心记忆不应同步")
+	}
+
+	// 两端同时修改：保留更新时间较新的一份
+	decision.Content = "我们使用 MySQL"
+	if err := storeA.UpdateMemory(decision); err != nil {
+		t.Fatalf("更新记忆失败: %v", err)
+	}
+	memB := decisionsB[0]
+	memB.Content = "我们使用 SQLite"
+	if err := storeB.UpdateMemory(memB); err != nil {
+		t.Fatalf("更新记忆失败: %v", err)
+	}
+	runSync(syncA)
+	if result := runSync(syncB); result.Conflicts != 1 || result.Exported != 1 {
+		t.Fatalf("应检测到 1 个冲突并保留 B 的修改: %+v", result)
+	}
+	runSync(syncA)
+	decisionsA := projectMemories(storeA, storageA, CategoryDecision)
+	if len(decisionsA) != 1 || strings.TrimSpace(decisionsA[0].Content) != "我们使用 SQLite" {
+		t.Fatalf("冲突应按更新时间解决: %v", decisionsA)
+	}
+
+	// 删除传播：B 删除后 A 本地归档
+	if err := storeB.DeleteMemory(memB.FilePath); err != nil {
+		t.Fatalf("删除记忆失败: %v", err)
+	}
+	if result := runSync(syncB); result.DeletedRemote != 1 {
+		t.Fatalf("应从远端移除 1 条记忆: %+v", result)
+	}
+	if result := runSync(syncA); result.ArchivedLocal != 1 {
+		t.Fatalf("应在本地归档 1 条记忆: %+v", result)
+	}
+	if len(projectMemories(storeA, storageA, CategoryDecision)) != 0 {
+		t.Error("远端删除的记忆应从共享目录移走")
+	}
+	if len(projectMemories(storeA, storageA, CategoryKnowledge)) != 1 {
+		t.Error("未共享的记忆不应受同步影响")
+	}
+
+	// 推送被拒绝后重试：第一次尝试中导入的记忆仍需返回给调用方重建索引
+	shared := NewMemory(MemoryTypeLongTerm, ScopeProject, CategoryDecision, "部署方式", "使用 Docker 部署")
+	if err := storeA.CreateMemory(shared); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	runSync(syncA)
+	local := NewMemory(MemoryTypeLongTerm, ScopeProject, CategoryDecision, "日志格式", "使用 JSON 日志")
+	if err := storeB.CreateMemory(local); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	marker := filepath.Join(tmpDir, "rejected-once")
+	hook := fmt.Sprintf("#!/bin/sh\nif [ ! -f %q ]; then touch %q; echo rejected >&2; exit 1; fi\n", marker, marker)
+	if err := os.WriteFile(filepath.Join(remote, "hooks", "pre-receive"), []byte(hook), 0755); err != nil {
+		t.Fatalf("写入钩子失败: %v", err)
+	}
+	result := runSync(syncB)
+	if !FileExists(marker) {
+		t.Fatal("第一次推送应被拒绝")
+	}
+	if result.Imported != 1 || len(result.importedPaths) != 1 || !result.Pushed {
+		t.Errorf("重试后应保留第一次尝试导入的记忆: %+v %v", result, result.importedPaths)
+	}
+}
+
+func TestTeamSync_RequiresOptInWhenEncrypted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("未安装 git")
+	}
+
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatalf("创建项目目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "go.mod"), []byte("module demo\n"), 0644); err != nil {
+		t.Fatalf("写入项目标记失败: %v", err)
+	}
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "home", "memory")
+	cfg.Encryption.Enabled = true
+	cfg.TeamSync.Remote = filepath.Join(tmpDir, "remote.git")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	if err := storage.SetCurrentProject(project); err != nil {
+		t.Fatalf("设置项目失败: %v", err)
+	}
+	fileStore := NewMarkdownFileStore(storage)
+
+	// 同步克隆与远端为明文，未显式允许时拒绝同步
+	if _, err := NewTeamSync(storage, fileStore, cfg.TeamSync); err == nil || !strings.Contains(err.Error(), "allow_plaintext") {
+		t.Fatalf("启用加密时应拒绝团队同步，得到: %v", err)
+	}
+
+	cfg.TeamSync.AllowPlaintext = true
+	ts, err := NewTeamSync(storage, fileStore, cfg.TeamSync)
+	if err != nil {
+		t.Fatalf("允许明文后创建团队同步失败: %v", err)
+	}
+	status := ts.Status()
+	if !status.Plaintext || !strings.HasPrefix(status.Dir, filepath.Join(tmpDir, "home", "sync")) {
+		t.Errorf("状态应提示明文同步克隆的位置，得到: %+v", status)
+	}
+}
+
+func TestMultiProcess_SharedSessionFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "multiprocess-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	// 每个“进程”有独立的存储与文件存储实例，共享同一记忆目录
+	newProcess := func() (*MarkdownFileStore, *SessionManager) {
+		storage, err := NewStorageManager(cfg)
+		if err != nil {
+			t.Fatalf("创建存储管理器失败: %v", err)
+		}
+		fileStore := NewMarkdownFileStore(storage)
+		return fileStore, NewSessionManager(storage, fileStore, nil, cfg)
+	}
+	storeA, sessA := newProcess()
+	storeB, _ := newProcess()
+
+	sess, err := sessA.CreateSession()
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if err := sessA.AddMessage("user", "第一条消息", 5); err != nil {
+		t.Fatalf("添加消息失败: %v", err)
+	}
+
+	// 进程 B 追加消息后，A 的整体覆盖会被拒绝
+	if err := storeB.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "user", Content: "来自另一个终端"}); err != nil {
+		t.Fatalf("追加消息失败: %v", err)
+	}
+	if err := storeA.UpdateSession(sessA.GetCurrentSession(), sessA.GetMessages()); !errors.Is(err, ErrSessionModified) {
+		t.Fatalf("应检测到外部修改，实际 %v", err)
+	}
+
+	// 会话管理器追加消息时合并外部变更
+	if err := sessA.AddMessage("assistant", "收到", 3); err != nil {
+		t.Fatalf("添加消息失败: %v", err)
+	}
+	_, messages, err := storeA.ReadSession(sess.FilePath)
+	if err != nil {
+		t.Fatalf("读取会话失败: %v", err)
+	}
+	if len(messages) != 3 || messages[1].Content != "来自另一个终端" || messages[2].Content != "收到" {
+		t.Fatalf("外部追加的消息不应丢失: %+v", messages)
+	}
+	if len(sessA.GetMessages()) != 3 || sessA.GetMessages()[2].Sequence != 3 {
+		t.Errorf("会话管理器应重新加载文件内容: %+v", sessA.GetMessages())
+	}
+
+	// 并发追加：每条消息都被保留
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		store := storeA
+		if i%2 == 1 {
+			store = storeB
+		}
+		wg.Add(1)
+		go func(store *MarkdownFileStore, i int) {
+			defer wg.Done()
+			msg := &SessionMessage{Role: "user", Content: fmt.Sprintf("并发消息 %d", i)}
+			if err := store.AppendSessionMessage(sess.FilePath, msg); err != nil {
+				t.Errorf("并发追加失败: %v", err)
+			}
+		}(store, i)
+	}
+	wg.Wait()
+
+	_, messages, err = storeB.ReadSession(sess.FilePath)
+	if err != nil {
+		t.Fatalf("读取会话失败: %v", err)
+	}
+	if len(messages) != 13 {
+		t.Errorf("并发追加后应有 13 条消息，实际 %d", len(messages))
+	}
+}
+
+func TestLifecycleManager_SingleMaintenanceRunner(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := DefaultMemoryConfig()
+	lockPath := filepath.Join(tmpDir, maintenanceLockFile)
+
+	lifecycle := NewLifecycleManager(nil, nil, nil, nil, nil, cfg)
+	lifecycle.SetRunLock(NewFileLock(lockPath))
+
+	// 另一个进程持有维护锁时跳过
+	other := NewFileLock(lockPath)
+	if err := other.Lock(); err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+	if result := lifecycle.RunMaintenance(context.Background()); !result.Skipped {
+		t.Error("其他进程维护时应跳过")
+	}
+	_ = other.Unlock()
+
+	if result := lifecycle.RunMaintenance(context.Background()); result.Skipped {
+		t.Error("锁释放后应执行维护")
+	}
+}
+
+// newTestMemorySystem 在临时 HOME 下初始化记忆系统，embedding 使用模拟客户端
+func newTestMemorySystem(t *testing.T) *MemorySystem {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	ms, err := NewMemorySystem()
+	if err != nil {
+		t.Fatalf("创建记忆系统失败: %v", err)
+	}
+	if err := ms.Initialize(""); err != nil {
+		t.Fatalf("初始化记忆系统失败: %v", err)
+	}
+	t.Cleanup(func() { ms.Close() })
+
+	ms.embedding = NewEmbeddingManager(NewMockEmbeddingClient(ms.config.Embedding.Dimension), ms.vector, nil, &ms.config.Embedding)
+	return ms
+}
+
+// TestMemorySystem_ReembedLongTermOnly 测试重建向量只为长期记忆生成向量
+func TestMemorySystem_ReembedLongTermOnly(t *testing.T) {
+	ms := newTestMemorySystem(t)
+	ctx := context.Background()
+
+	core, err := ms.SaveMemory(ctx, MemoryTypeCore, CategoryPreference, ScopeGlobal, "回复语言", "使用中文回复", nil, "user")
+	if err != nil {
+		t.Fatalf("保存核心记忆失败: %v", err)
+	}
+	shortTerm, err := ms.SaveMemory(ctx, MemoryTypeShortTerm, CategoryTask, ScopeGlobal, "待办", "补充单元测试", nil, "user")
+	if err != nil {
+		t.Fatalf("保存短期记忆失败: %v", err)
+	}
+	longTerm, err := ms.SaveMemory(ctx, MemoryTypeLongTerm, CategoryKnowledge, ScopeGlobal, "数据库", "项目使用 SQLite", nil, "user")
+	if err != nil {
+		t.Fatalf("保存长期记忆失败: %v", err)
+	}
+
+	result, err := ms.Reembed(ctx, nil)
+	if err != nil {
+		t.Fatalf("重建向量失败: %v", err)
+	}
+	if result.Total != 1 || result.Embedded != 1 {
+		t.Errorf("应只重建 1 条长期记忆的向量: %+v", result)
+	}
+	if vec, err := ms.vector.GetVector(longTerm.ID); err != nil || len(vec) == 0 {
+		t.Errorf("长期记忆应有向量: %v", err)
+	}
+	for _, mem := range []*Memory{core, shortTerm} {
+		if vec, err := ms.vector.GetVector(mem.ID); err == nil && len(vec) > 0 {
+			t.Errorf("%s 记忆不应有向量", mem.Type)
+		}
+	}
+}
+
+// TestMemorySystem_SyncMemoryFileVectors 测试同步记忆文件时只为活跃的长期记忆保留向量
+func TestMemorySystem_SyncMemoryFileVectors(t *testing.T) {
+	ms := newTestMemorySystem(t)
+	ctx := context.Background()
+
+	core, err := ms.SaveMemory(ctx, MemoryTypeCore, CategoryPreference, ScopeGlobal, "回复语言", "使用中文回复", nil, "user")
+	if err != nil {
+		t.Fatalf("保存核心记忆失败: %v", err)
+	}
+	if _, err := ms.SyncMemoryFile(ctx, core.FilePath); err != nil {
+		t.Fatalf("同步核心记忆失败: %v", err)
+	}
+	if vec, err := ms.vector.GetVector(core.ID); err == nil && len(vec) > 0 {
+		t.Error("核心记忆同步后不应有向量")
+	}
+
+	longTerm, err := ms.SaveMemory(ctx, MemoryTypeLongTerm, CategoryKnowledge, ScopeGlobal, "数据库", "项目使用 SQLite", nil, "user")
+	if err != nil {
+		t.Fatalf("保存长期记忆失败: %v", err)
+	}
+	if vec, err := ms.vector.GetVector(longTerm.ID); err != nil || len(vec) == 0 {
+		t.Fatalf("长期记忆应有向量: %v", err)
+	}
+
+	// 移出 long_term/ 后删除旧向量
+	moved := filepath.Join(ms.storage.GetShortTermNotesPath(ScopeGlobal), filepath.Base(longTerm.FilePath))
+	if err := ms.fileStore.MoveMemory(longTerm.FilePath, moved); err != nil {
+		t.Fatalf("移动记忆失败: %v", err)
+	}
+	mem, err := ms.SyncMemoryFile(ctx, moved)
+	if err != nil {
+		t.Fatalf("同步记忆失败: %v", err)
+	}
+	if mem.Type != MemoryTypeShortTerm {
+		t.Errorf("移动后应变为短期记忆，实际 %s", mem.Type)
+	}
+	if vec, err := ms.vector.GetVector(longTerm.ID); err == nil && len(vec) > 0 {
+		t.Error("移出长期记忆后应删除向量")
+	}
+}
+
+// ========== 静态加密集成测试 ==========
+
+// TestEncryption_NoPlaintextOnDisk 测试加密迁移后磁盘上不再残留明文，且读写与搜索透明
+func TestEncryption_NoPlaintextOnDisk(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "encryption-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const secret = "sk-live-4f9d2c7e1b"
+	t.Setenv("AIMATE_TEST_PASSPHRASE", "correct horse battery staple")
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+	cfg.Encryption.KeyFile = filepath.Join(tmpDir, "keys", "memory.key")
+	cfg.Encryption.PassphraseEnv = "AIMATE_TEST_PASSPHRASE"
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	if err := storage.SetCurrentProject(filepath.Join(tmpDir, "project")); err != nil {
+		t.Fatalf("设置项目失败: %v", err)
+	}
+
+	// 以明文写入记忆、会话、会话消息索引、embedding 队列与审核队列
+	fileStore := NewMarkdownFileStore(storage)
+	mem := NewMemory(MemoryTypeLongTerm, ScopeProject, CategoryKnowledge, "部署凭据", "测试环境密钥为 "+secret)
+	if err := fileStore.CreateMemory(mem); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	sessions := NewSessionManager(storage, fileStore, nil, cfg)
+	sess, err := sessions.CreateSession()
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if err := sessions.AddMessage("user", "我的 token 是 "+secret, 5); err != nil {
+		t.Fatalf("添加消息失败: %v", err)
+	}
+
+	index, err := NewSQLiteIndexStore(storage.GetProjectIndexDBPath())
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	if err := index.IndexSessionMessage(sess.ID, &SessionMessage{Sequence: 1, Role: "user", Content: "我的 token 是 " + secret, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("索引会话消息失败: %v", err)
+	}
+	index.Close()
+
+	embeddings, err := NewSQLiteEmbeddingStore(filepath.Join(storage.GetGlobalRoot(), "embeddings.db"))
+	if err != nil {
+		t.Fatalf("创建 embedding 存储失败: %v", err)
+	}
+	if err := embeddings.Enqueue(EmbeddingTask{ID: mem.ID, Text: "密钥 " + secret}); err != nil {
+		t.Fatalf("写入离线队列失败: %v", err)
+	}
+	embeddings.Close()
+
+	queue := NewReviewQueue(filepath.Join(storage.GetGlobalRoot(), "review_queue.json"), nil)
+	if _, err := queue.Submit(ReviewItem{Action: ReviewAdd, Category: CategoryPreference, Title: "凭据", Content: secret}); err != nil {
+		t.Fatalf("提交审核失败: %v", err)
+	}
+
+	if files := filesContaining(t, tmpDir, secret); len(files) == 0 {
+		t.Fatal("迁移前应能在磁盘上找到明文")
+	}
+
+	// 加密迁移后磁盘上不应残留明文
+	cipher, err := CreateMemoryKey(cfg.Encryption)
+	if err != nil {
+		t.Fatalf("创建密钥失败: %v", err)
+	}
+	result, err := MigrateEncryption(storage, cipher, true)
+	if err != nil {
+		t.Fatalf("加密迁移失败: %v", err)
+	}
+	if result.Files < 2 || result.Records < 2 {
+		t.Errorf("迁移计数不符合预期: %+v", result)
+	}
+	if files := filesContaining(t, tmpDir, secret); len(files) > 0 {
+		t.Fatalf("加密后仍有明文残留: %v", files)
+	}
+	// 以标题命名的记忆文件加密时改为以 ID 命名
+	mem.FilePath = filepath.Join(filepath.Dir(mem.FilePath), opaqueFileName(mem))
+
+	// 重新加载密钥后读写、搜索透明
+	reloaded, err := LoadMemoryCipher(cfg.Encryption)
+	if err != nil {
+		t.Fatalf("加载密钥失败: %v", err)
+	}
+	encStore := NewMarkdownFileStore(storage)
+	encStore.SetCipher(reloaded)
+	readMem, err := encStore.ReadMemory(mem.FilePath)
+	if err != nil || !strings.Contains(readMem.Content, secret) {
+		t.Fatalf("应能透明读取加密记忆: %v", err)
+	}
+	if _, err := NewMarkdownFileStore(storage).ReadMemory(mem.FilePath); !errors.Is(err, ErrEncryptedData) {
+		t.Errorf("未加载密钥时读取应返回 ErrEncryptedData，实际 %v", err)
+	}
+
+	second := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "新凭据", "备用密钥 "+secret)
+	if err := encStore.CreateMemory(second); err != nil {
+		t.Fatalf("创建加密记忆失败: %v", err)
+	}
+	encIndex, err := NewSQLiteIndexStore(storage.GetProjectIndexDBPath())
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	encIndex.SetCipher(reloaded)
+	if err := encIndex.IndexSessionMessage(sess.ID, &SessionMessage{Sequence: 2, Role: "assistant", Content: "已记录 " + secret, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("索引会话消息失败: %v", err)
+	}
+	hits, err := encIndex.SearchSessionMessages(secret+" token", 10)
+	if err != nil {
+		t.Fatalf("搜索会话消息失败: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Sequence != 1 || !strings.Contains(hits[0].Snippet, secret) {
+		t.Errorf("应能搜索加密的会话消息: %+v", hits)
+	}
+	encIndex.Close()
+
+	if files := filesContaining(t, tmpDir, secret); len(files) > 0 {
+		t.Fatalf("加密写入后仍有明文残留: %v", files)
+	}
+
+	// 口令错误时拒绝加载
+	t.Setenv("AIMATE_TEST_PASSPHRASE", "wrong passphrase")
+	if _, err := LoadMemoryCipher(cfg.Encryption); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("口令错误应返回 ErrWrongKey，实际 %v", err)
+	}
+
+	// 解密迁移后恢复为明文
+	if _, err := MigrateEncryption(storage, reloaded, false); err != nil {
+		t.Fatalf("解密迁移失败: %v", err)
+	}
+	data, err := os.ReadFile(second.FilePath)
+	if err != nil || IsEncrypted(data) || !strings.Contains(string(data), secret) {
+		t.Errorf("解密后文件应为明文: %v", err)
+	}
+	plainIndex, err := NewSQLiteIndexStore(storage.GetProjectIndexDBPath())
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	defer plainIndex.Close()
+	if hits, _ := plainIndex.SearchSessionMessages(secret, 10); len(hits) != 2 {
+		t.Errorf("解密后应能直接搜索会话消息: %+v", hits)
+	}
+}
+
+// TestEncryption_TitleNotOnDisk 测试标题与标签中的敏感信息不会出现在索引、文件名与提交历史中
+func TestEncryption_TitleNotOnDisk(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "encryption-title-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const secret = "hunter2-9c4e1f"
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+	cfg.Encryption.KeyFile = filepath.Join(tmpDir, "keys", "memory.key")
+	t.Setenv(cfg.Encryption.PassphraseEnv, "")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	// 以明文写入标题与标签包含敏感信息的记忆及其索引
+	fileStore := NewMarkdownFileStore(storage)
+	plain := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "root password "+secret, "见标题")
+	plain.Tags = []string{"cred-" + secret}
+	if err := fileStore.CreateMemory(plain); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+	index, err := NewSQLiteIndexStore(storage.GetGlobalIndexDBPath())
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	if err := index.CreateIndex(MemoryToIndex(plain)); err != nil {
+		t.Fatalf("创建索引失败: %v", err)
+	}
+	index.Close()
+
+	if !strings.Contains(filepath.Base(plain.FilePath), secret) || len(filesContaining(t, tmpDir, secret)) == 0 {
+		t.Fatal("迁移前文件名与索引中应包含明文标题")
+	}
+
+	// 加密迁移后文件改为以 ID 命名，索引路径随之更新
+	cipher, err := CreateMemoryKey(cfg.Encryption)
+	if err != nil {
+		t.Fatalf("创建密钥失败: %v", err)
+	}
+	result, err := MigrateEncryption(storage, cipher, true)
+	if err != nil {
+		t.Fatalf("加密迁移失败: %v", err)
+	}
+	if result.Renamed != 1 {
+		t.Errorf("应改名 1 个记忆文件: %+v", result)
+	}
+	cfg.Encryption.Enabled = true
+
+	encStore := NewMarkdownFileStore(storage)
+	encStore.SetCipher(cipher)
+	if _, err := exec.LookPath("git"); err == nil {
+		history, err := NewMemoryHistory(storage)
+		if err != nil {
+			t.Fatalf("创建版本历史失败: %v", err)
+		}
+		encStore.SetHistory(history)
+	}
+
+	encIndex, err := NewSQLiteIndexStore(storage.GetGlobalIndexDBPath())
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	defer encIndex.Close()
+	encIndex.SetCipher(cipher)
+
+	migrated, err := encIndex.GetIndex(plain.ID)
+	if err != nil {
+		t.Fatalf("获取索引失败: %v", err)
+	}
+	if migrated.Title != plain.Title || strings.Contains(migrated.FilePath, secret) {
+		t.Errorf("迁移后的索引应解密出标题并指向改名后的文件: %+v", migrated)
+	}
+	if _, err := encStore.ReadMemory(migrated.FilePath); err != nil {
+		t.Errorf("应能读取改名后的记忆: %v", err)
+	}
+
+	// 启用加密后新建的记忆同样不泄露标题
+	mem := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "api token "+secret, "见标题")
+	if err := encStore.CreateMemory(mem); err != nil {
+		t.Fatalf("创建加密记忆失败: %v", err)
+	}
+	mem.Content = "已轮换"
+	if err := encStore.UpdateMemory(mem); err != nil {
+		t.Fatalf("更新加密记忆失败: %v", err)
+	}
+	if err := encIndex.CreateIndex(MemoryToIndex(mem)); err != nil {
+		t.Fatalf("创建索引失败: %v", err)
+	}
+
+	hits, err := encIndex.SearchByKeyword(secret, 10)
+	if err != nil {
+		t.Fatalf("关键词搜索失败: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Errorf("应能按加密的标题与标签搜索到 2 条记忆，实际 %d", len(hits))
+	}
+
+	if files := filesContaining(t, tmpDir, secret); len(files) > 0 {
+		t.Errorf("磁盘上仍有明文标题: %v", files)
+	}
+	err = filepath.Walk(tmpDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.Contains(path, secret) {
+			t.Errorf("文件名包含明文标题: %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("扫描目录失败: %v", err)
+	}
+
+	if encStore.History() != nil {
+		out, err := exec.Command("git", "-C", storage.GetGlobalRoot(), "log", "--all", "--name-only", "--format=%B").CombinedOutput()
+		if err != nil {
+			t.Fatalf("读取提交历史失败: %v: %s", err, out)
+		}
+		if strings.Contains(string(out), secret) {
+			t.Errorf("提交信息或文件名包含明文标题:\n%s", out)
+		}
+	}
+}
+
+// filesContaining 返回目录下内容包含指定文本的文件（包括 SQLite 数据库及其 WAL 文件）
+func filesContaining(t *testing.T, root, text string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), text) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("扫描目录失败: %v", err)
+	}
+	return files
+}
+
+// ========== 敏感信息脱敏集成测试 ==========
+
+// recordingEmbeddingClient 记录发送到 embedding API 的文本
+type recordingEmbeddingClient struct {
+	*MockEmbeddingClient
+	texts []string
+}
+
+func (c *recordingEmbeddingClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	c.texts = append(c.texts, text)
+	return c.MockEmbeddingClient.Embed(ctx, text)
+}
+
+func (c *recordingEmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	c.texts = append(c.texts, texts...)
+	return c.MockEmbeddingClient.EmbedBatch(ctx, texts)
+}
+
+// TestRedaction_SessionsAndEmbeddings 测试会话文件与 embedding 请求中不出现敏感信息
+func TestRedaction_SessionsAndEmbeddings(t *testing.T) {
+	tmpDir := t.TempDir()
+	const apiKey = "sk-proj-Zx81aQ03LmN7pR5tVb2c"
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+	cfg.Embedding.Dimension = 8
+	cfg.Redaction.Patterns = []redact.Pattern{{Name: "employee", Regex: `EMP-\d{6}`}}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("配置应有效: %v", err)
+	}
+
+	redactor, err := redact.New(cfg.Redaction.Options())
+	if err != nil {
+		t.Fatalf("创建脱敏器失败: %v", err)
+	}
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	fileStore := NewMarkdownFileStore(storage)
+	sessions := NewSessionManager(storage, fileStore, nil, cfg)
+	sessions.SetRedactor(redactor)
+
+	secrets := []string{apiKey, "alice@example.com", "EMP-204816"}
+	if err := sessions.AddMessage("user", "用 "+apiKey+" 调用接口，结果发给 alice@example.com（工号 EMP-204816）", 20); err != nil {
+		t.Fatalf("添加消息失败: %v", err)
+	}
+	if err := sessions.AddToolMessage(`[{"arguments":"{\"key\":\"`+apiKey+`\"}"}]`, "", "", 5); err != nil {
+		t.Fatalf("添加工具消息失败: %v", err)
+	}
+	if err := sessions.AddToolMessage(`[{"arguments":"{\"command\":\"export TOKEN=abcd1234\"}"}]`, "", "", 5); err != nil {
+		t.Fatalf("添加工具消息失败: %v", err)
+	}
+
+	data, err := os.ReadFile(sessions.GetCurrentSession().FilePath)
+	if err != nil {
+		t.Fatalf("读取会话文件失败: %v", err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("会话文件不应包含 %s", secret)
+		}
+	}
+	content := sessions.GetMessages()[0].Content
+	for _, kind := range []string{"API_KEY", "EMAIL", "EMPLOYEE"} {
+		if !strings.Contains(content, "[REDACTED_"+kind+"_") {
+			t.Errorf("消息应包含 %s 占位符: %s", kind, content)
+		}
+	}
+
+	// 同一密钥在不同消息中使用相同占位符，便于模型关联
+	placeholder := redactor.Redact(apiKey)
+	if !strings.Contains(sessions.GetMessages()[1].ToolCalls, placeholder) {
+		t.Errorf("工具调用应使用相同占位符 %s: %s", placeholder, sessions.GetMessages()[1].ToolCalls)
+	}
+
+	// 脱敏后的工具调用及其参数仍是合法 JSON
+	var calls []struct {
+		Arguments string `json:"arguments"`
+	}
+	toolCalls := sessions.GetMessages()[2].ToolCalls
+	if err := json.Unmarshal([]byte(toolCalls), &calls); err != nil || len(calls) != 1 {
+		t.Fatalf("脱敏后的工具调用应为合法 JSON: %v: %s", err, toolCalls)
+	}
+	if !json.Valid([]byte(calls[0].Arguments)) || strings.Contains(calls[0].Arguments, "abcd1234") {
+		t.Errorf("工具调用参数应为已脱敏的合法 JSON: %s", calls[0].Arguments)
+	}
+
+	// embedding 请求中的文本已脱敏
+	vectorStore, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "vectors.db"), "test", 8)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer vectorStore.Close()
+	client := &recordingEmbeddingClient{MockEmbeddingClient: NewMockEmbeddingClient(8)}
+	mgr := NewEmbeddingManager(client, vectorStore, nil, &cfg.Embedding)
+	mgr.SetRedactor(redactor)
+
+	ctx := context.Background()
+	if err := mgr.EmbedAndStore(ctx, "mem-1", "部署密钥 "+apiKey); err != nil {
+		t.Fatalf("生成 embedding 失败: %v", err)
+	}
+	if _, err := mgr.EmbedTexts(ctx, []string{"联系 alice@example.com"}); err != nil {
+		t.Fatalf("生成 embedding 失败: %v", err)
+	}
+	if _, err := mgr.SearchSimilar(ctx, "EMP-204816 的权限", 5); err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(client.texts) != 3 {
+		t.Fatalf("应发送 3 段文本，实际 %d", len(client.texts))
+	}
+	for _, text := range client.texts {
+		for _, secret := range secrets {
+			if strings.Contains(text, secret) {
+				t.Errorf("发送到 embedding API 的文本不应包含 %s: %s", secret, text)
+			}
+		}
+	}
+
+	counts := redactor.Counts()
+	if counts["API_KEY"] < 3 || counts["EMAIL"] < 2 || counts["EMPLOYEE"] < 2 {
+		t.Errorf("脱敏计数不正确: %v", counts)
+	}
+
+	// 无效的自定义规则在配置校验时报错
+	cfg.Redaction.Patterns = []redact.Pattern{{Name: "bad", Regex: "("}}
+	if err := ValidateConfig(cfg); err == nil {
+		t.Error("无效的脱敏规则应导致配置错误")
+	}
+}
+
+// TestRedaction_SaveMemory 测试显式保存的记忆在写入前脱敏
+func TestRedaction_SaveMemory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	const apiKey = "sk-proj-Zx81aQ03LmN7pR5tVb2c"
+
+	ms, err := NewMemorySystem()
+	if err != nil {
+		t.Fatalf("创建记忆系统失败: %v", err)
+	}
+	if err := ms.Initialize(""); err != nil {
+		t.Fatalf("初始化记忆系统失败: %v", err)
+	}
+	defer ms.Close()
+
+	mem, err := ms.SaveMemory(context.Background(), MemoryTypeLongTerm, CategoryKnowledge, ScopeGlobal,
+		"部署 token="+apiKey, "测试环境密钥为 "+apiKey, []string{"key-" + apiKey}, "user")
+	if err != nil {
+		t.Fatalf("保存记忆失败: %v", err)
+	}
+	if strings.Contains(mem.Title+mem.Content+strings.Join(mem.Tags, ","), apiKey) {
+		t.Errorf("保存的记忆不应包含密钥: %+v", mem)
+	}
+	data, err := os.ReadFile(mem.FilePath)
+	if err != nil {
+		t.Fatalf("读取记忆文件失败: %v", err)
+	}
+	if strings.Contains(mem.FilePath, apiKey) || strings.Contains(string(data), apiKey) {
+		t.Errorf("记忆文件不应包含密钥: %s", mem.FilePath)
+	}
+}
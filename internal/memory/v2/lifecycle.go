@@ -3,6 +3,7 @@ package v2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -14,8 +15,13 @@ type LifecycleManager struct {
 	shortTermMgr *ShortTermMemoryManager
 	longTermMgr  *LongTermMemoryManager
 	syncer       *IndexSyncer
+	embedding    *EmbeddingManager
+	compressor   *MemoryCompressor
 	config       *MemoryConfig
 
+	// 跨进程的维护锁：多个 AIMate 进程共享记忆目录时只有一个执行维护
+	runLock *FileLock
+
 	// 运行状态
 	running bool
 	stopCh  chan struct{}
@@ -31,17 +37,26 @@ func NewLifecycleManager(
 	shortTermMgr *ShortTermMemoryManager,
 	longTermMgr *LongTermMemoryManager,
 	syncer *IndexSyncer,
+	embedding *EmbeddingManager,
+	compressor *MemoryCompressor,
 	config *MemoryConfig,
 ) *LifecycleManager {
 	return &LifecycleManager{
 		shortTermMgr: shortTermMgr,
 		longTermMgr:  longTermMgr,
 		syncer:       syncer,
+		embedding:    embedding,
+		compressor:   compressor,
 		config:       config,
 		stopCh:       make(chan struct{}),
 	}
 }
 
+// SetRunLock 设置维护锁（nil 表示不做跨进程互斥）
+func (m *LifecycleManager) SetRunLock(lock *FileLock) {
+	m.runLock = lock
+}
+
 // Start 启动后台维护任务
 func (m *LifecycleManager) Start() {
 	m.mu.Lock()
@@ -102,6 +117,19 @@ func (m *LifecycleManager) RunMaintenance(ctx context.Context) *MaintenanceResul
 		return result
 	}
 
+	// 其他进程（或本进程的另一次调用）正在维护时跳过本次
+	if m.runLock != nil {
+		if err := m.runLock.TryLock(); err != nil {
+			result.Skipped = true
+			if !errors.Is(err, ErrLockHeld) {
+				result.Errors = append(result.Errors, fmt.Sprintf("获取维护锁失败: %v", err))
+			}
+			result.EndTime = time.Now()
+			return result
+		}
+		defer m.runLock.Unlock()
+	}
+
 	// 1. 清理过期短期记忆
 	if m.config.Maintenance.CleanupExpired && m.shortTermMgr != nil {
 		cleaned, err := m.shortTermMgr.CleanExpired()
@@ -120,7 +148,17 @@ func (m *LifecycleManager) RunMaintenance(ctx context.Context) *MaintenanceResul
 		result.InactiveArchived = archived
 	}
 
-	// 3. 自动提升高频访问的短期记忆
+	// 3. 合并相似的长期记忆
+	if m.config.Maintenance.CompressMemories && m.compressor != nil {
+		compressed, err := m.compressor.Compress(ctx)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("压缩长期记忆失败: %v", err))
+		}
+		result.CompressionClusters = compressed.Clusters
+		result.MemoriesCompressed = compressed.Merged
+	}
+
+	// 4. 自动提升高频访问的短期记忆
 	if m.shortTermMgr != nil && m.longTermMgr != nil {
 		promoted, err := m.promoteHighAccessMemories()
 		if err != nil {
@@ -129,7 +167,7 @@ func (m *LifecycleManager) RunMaintenance(ctx context.Context) *MaintenanceResul
 		result.Promoted = promoted
 	}
 
-	// 4. 同步索引
+	// 5. 同步索引
 	if m.config.Maintenance.SyncIndex && m.syncer != nil {
 		syncResult, err := m.syncer.SyncAll()
 		if err != nil {
@@ -140,6 +178,15 @@ func (m *LifecycleManager) RunMaintenance(ctx context.Context) *MaintenanceResul
 		}
 	}
 
+	// 6. 重试离线 embedding 队列中到期的任务
+	if m.embedding != nil {
+		retried, err := m.embedding.ProcessOfflineQueue(ctx)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("处理离线 embedding 队列失败: %v", err))
+		}
+		result.EmbeddingsRetried = retried
+	}
+
 	m.lastMaintenance = time.Now()
 	result.EndTime = time.Now()
 	result.DurationMs = result.EndTime.Sub(result.StartTime).Milliseconds()
@@ -175,15 +222,19 @@ func (m *LifecycleManager) promoteHighAccessMemories() (int, error) {
 
 // MaintenanceResult 维护结果
 type MaintenanceResult struct {
-	StartTime        time.Time `json:"start_time"`
-	EndTime          time.Time `json:"end_time"`
-	DurationMs       int64     `json:"duration_ms"`
-	ExpiredCleaned   int       `json:"expired_cleaned"`
-	InactiveArchived int       `json:"inactive_archived"`
-	Promoted         int       `json:"promoted"`
-	IndexSynced      int       `json:"index_synced"`
-	OrphanedCleaned  int       `json:"orphaned_cleaned"`
-	Errors           []string  `json:"errors,omitempty"`
+	StartTime           time.Time `json:"start_time"`
+	EndTime             time.Time `json:"end_time"`
+	DurationMs          int64     `json:"duration_ms"`
+	ExpiredCleaned      int       `json:"expired_cleaned"`
+	InactiveArchived    int       `json:"inactive_archived"`
+	CompressionClusters int       `json:"compression_clusters"`
+	MemoriesCompressed  int       `json:"memories_compressed"`
+	Promoted            int       `json:"promoted"`
+	IndexSynced         int       `json:"index_synced"`
+	OrphanedCleaned     int       `json:"orphaned_cleaned"`
+	EmbeddingsRetried   int       `json:"embeddings_retried"`
+	Skipped             bool      `json:"skipped,omitempty"` // 其他进程正在维护，本次未执行
+	Errors              []string  `json:"errors,omitempty"`
 }
 
 // GetLastMaintenanceTime 获取上次维护时间
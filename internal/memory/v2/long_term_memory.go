@@ -40,6 +40,11 @@ func NewLongTermMemoryManager(
 
 // Add 添加长期记忆
 func (m *LongTermMemoryManager) Add(category MemoryCategory, scope MemoryScope, title, content string, tags []string) (*Memory, error) {
+	return m.AddWithSource(category, scope, title, content, tags, "")
+}
+
+// AddWithSource 添加长期记忆并记录来源（如 session:<id>）
+func (m *LongTermMemoryManager) AddWithSource(category MemoryCategory, scope MemoryScope, title, content string, tags []string, source string) (*Memory, error) {
 	mem := &Memory{
 		ID:         uuid.New().String(),
 		Type:       MemoryTypeLongTerm,
@@ -48,6 +53,7 @@ func (m *LongTermMemoryManager) Add(category MemoryCategory, scope MemoryScope,
 		Title:      title,
 		Content:    content,
 		Tags:       tags,
+		Source:     source,
 		Status:     StatusActive,
 		Importance: 3,
 		CreatedAt:  time.Now(),
@@ -85,11 +91,15 @@ func (m *LongTermMemoryManager) Add(category MemoryCategory, scope MemoryScope,
 
 // AddProjectKnowledge 添加项目知识
 func (m *LongTermMemoryManager) AddProjectKnowledge(title, content string, tags []string) (*Memory, error) {
-	scope := ScopeProject
+	return m.Add(CategoryProject, m.DefaultScope(), title, content, tags)
+}
+
+// DefaultScope 返回项目相关记忆的作用域：有当前项目时为项目作用域，否则为全局
+func (m *LongTermMemoryManager) DefaultScope() MemoryScope {
 	if m.storage.GetCurrentProject() == "" {
-		scope = ScopeGlobal
+		return ScopeGlobal
 	}
-	return m.Add(CategoryProject, scope, title, content, tags)
+	return ScopeProject
 }
 
 // AddKnowledge 添加通用知识
@@ -99,11 +109,7 @@ func (m *LongTermMemoryManager) AddKnowledge(title, content string, tags []strin
 
 // AddDecision 添加决策记录
 func (m *LongTermMemoryManager) AddDecision(title, content string, tags []string) (*Memory, error) {
-	scope := ScopeProject
-	if m.storage.GetCurrentProject() == "" {
-		scope = ScopeGlobal
-	}
-	return m.Add(CategoryDecision, scope, title, content, tags)
+	return m.Add(CategoryDecision, m.DefaultScope(), title, content, tags)
 }
 
 // LoadAll 加载所有长期记忆
@@ -356,7 +362,7 @@ func (m *LongTermMemoryManager) GetInactive() ([]*Memory, error) {
 
 	var inactive []*Memory
 	for _, mem := range allMemories {
-		if mem.AccessedAt.Before(threshold) {
+		if !mem.Pinned && mem.AccessedAt.Before(threshold) {
 			inactive = append(inactive, mem)
 		}
 	}
@@ -383,8 +389,17 @@ func (m *LongTermMemoryManager) ArchiveInactive() (int, error) {
 	return archived, nil
 }
 
-// AddRelation 添加记忆关联
+// AddRelation 添加普通记忆关联
 func (m *LongTermMemoryManager) AddRelation(id, relatedID string) error {
+	return m.AddTypedRelation(id, relatedID, RelationRelated)
+}
+
+// AddTypedRelation 添加或更新带类型的记忆关联
+func (m *LongTermMemoryManager) AddTypedRelation(id, relatedID string, relType RelationType) error {
+	if id == relatedID {
+		return fmt.Errorf("记忆不能关联自身")
+	}
+
 	idx, err := m.index.GetIndex(id)
 	if err != nil {
 		return err
@@ -395,14 +410,9 @@ func (m *LongTermMemoryManager) AddRelation(id, relatedID string) error {
 		return err
 	}
 
-	// 检查是否已存在关联
-	for _, r := range mem.Related {
-		if r == relatedID {
-			return nil // 已存在
-		}
+	if !mem.SetRelation(relatedID, relType) {
+		return nil // 已存在
 	}
-
-	mem.Related = append(mem.Related, relatedID)
 	mem.UpdatedAt = time.Now()
 
 	if err := m.fileStore.UpdateMemory(mem); err != nil {
@@ -424,14 +434,9 @@ func (m *LongTermMemoryManager) RemoveRelation(id, relatedID string) error {
 		return err
 	}
 
-	// 移除关联
-	var newRelated []string
-	for _, r := range mem.Related {
-		if r != relatedID {
-			newRelated = append(newRelated, r)
-		}
+	if !mem.UnsetRelation(relatedID) {
+		return nil
 	}
-	mem.Related = newRelated
 	mem.UpdatedAt = time.Now()
 
 	if err := m.fileStore.UpdateMemory(mem); err != nil {
@@ -464,6 +469,234 @@ func (m *LongTermMemoryManager) GetRelated(id string) ([]*Memory, error) {
 	return related, nil
 }
 
+// SuggestRelations 按向量相似度为记忆建议关联
+// 只返回尚未关联的其他长期记忆，记忆本身没有向量时返回空
+func (m *LongTermMemoryManager) SuggestRelations(id string, minSimilarity float64, limit int) ([]*RelationSuggestion, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	mem, err := m.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多取一些候选，排除已关联的记忆
+	candidates, err := m.FindSimilar(id, minSimilarity, limit+len(mem.Related))
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestions []*RelationSuggestion
+	for _, candidate := range candidates {
+		if mem.RelationTo(candidate.Memory.ID) != "" {
+			continue
+		}
+		suggestions = append(suggestions, candidate)
+		if len(suggestions) >= limit {
+			break
+		}
+	}
+
+	return suggestions, nil
+}
+
+// FindSimilar 按向量相似度查找其他活跃长期记忆，记忆本身没有向量时返回空
+func (m *LongTermMemoryManager) FindSimilar(id string, minSimilarity float64, limit int) ([]*RelationSuggestion, error) {
+	if m.vector == nil || limit <= 0 {
+		return nil, nil
+	}
+
+	vec, err := m.vector.GetVector(id)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// 多取一些候选，排除自身与非长期记忆
+	results, err := m.vector.SearchSimilar(vec, limit+5, minSimilarity)
+	if err != nil {
+		return nil, fmt.Errorf("搜索相似记忆失败: %w", err)
+	}
+
+	var similar []*RelationSuggestion
+	for _, result := range results {
+		if result.ID == id {
+			continue
+		}
+		candidate, err := m.FindByID(result.ID)
+		if err != nil || candidate.Type != MemoryTypeLongTerm || candidate.Status != StatusActive {
+			continue
+		}
+		similar = append(similar, &RelationSuggestion{Memory: candidate, Score: result.Score})
+		if len(similar) >= limit {
+			break
+		}
+	}
+
+	return similar, nil
+}
+
+// RelateSimilar 将记忆与最相似的若干长期记忆双向关联，返回新建的关联数
+func (m *LongTermMemoryManager) RelateSimilar(id string) (int, error) {
+	cfg := m.config.LongTerm
+	if cfg.RelationSimilarity <= 0 || cfg.MaxAutoRelations <= 0 {
+		return 0, nil
+	}
+
+	suggestions, err := m.SuggestRelations(id, cfg.RelationSimilarity, cfg.MaxAutoRelations)
+	if err != nil {
+		return 0, err
+	}
+
+	related := 0
+	for _, suggestion := range suggestions {
+		if err := m.AddRelation(id, suggestion.Memory.ID); err != nil {
+			return related, err
+		}
+		if suggestion.Memory.RelationTo(id) == "" {
+			_ = m.AddRelation(suggestion.Memory.ID, id)
+		}
+		related++
+	}
+
+	return related, nil
+}
+
+// Supersede 记录新记忆取代旧记忆，并归档旧记忆（同时移除其索引与向量）
+func (m *LongTermMemoryManager) Supersede(newID, oldID string) error {
+	old, err := m.FindByID(oldID)
+	if err != nil {
+		return err
+	}
+	if old.Pinned {
+		return fmt.Errorf("记忆已固定，不能被取代: %s", old.Title)
+	}
+
+	if err := m.AddTypedRelation(newID, oldID, RelationSupersedes); err != nil {
+		return fmt.Errorf("添加取代关联失败: %w", err)
+	}
+
+	if err := m.fileStore.ArchiveMemory(old); err != nil {
+		return fmt.Errorf("归档旧记忆失败: %w", err)
+	}
+	_ = m.index.DeleteIndex(old.ID)
+	if m.vector != nil {
+		_ = m.vector.DeleteVector(old.ID)
+	}
+	return nil
+}
+
+// Merge 将多条记忆合并为一条新记忆并归档原记忆
+// 新记忆继承原记忆的标签、关联与最高重要性，指向原记忆的关联改为指向新记忆
+func (m *LongTermMemoryManager) Merge(sources []*Memory, title, content string) (*Memory, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("没有需要合并的记忆")
+	}
+
+	sourceIDs := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		sourceIDs[src.ID] = true
+	}
+
+	var tags []string
+	var related []string
+	relationTypes := make(map[string]RelationType)
+	seenTags := make(map[string]bool)
+	seenRelated := make(map[string]bool)
+	importance, accessCount := 0, 0
+	for _, src := range sources {
+		for _, tag := range src.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		for _, r := range src.Related {
+			if !sourceIDs[r] && !seenRelated[r] {
+				seenRelated[r] = true
+				related = append(related, r)
+				relationTypes[r] = src.RelationTo(r)
+			}
+		}
+		if src.Importance > importance {
+			importance = src.Importance
+		}
+		accessCount += src.AccessCount
+	}
+
+	merged, err := m.Add(sources[0].Category, sources[0].Scope, title, content, tags)
+	if err != nil {
+		return nil, fmt.Errorf("创建合并记忆失败: %w", err)
+	}
+
+	for _, r := range related {
+		merged.SetRelation(r, relationTypes[r])
+	}
+	merged.Importance = importance
+	merged.AccessCount = accessCount
+	if err := m.fileStore.UpdateMemory(merged); err != nil {
+		_ = m.Delete(merged.ID)
+		return nil, err
+	}
+	if err := m.index.UpdateIndex(MemoryToIndex(merged)); err != nil {
+		_ = m.Delete(merged.ID)
+		return nil, err
+	}
+
+	// 归档原记忆，归档目录不参与检索，同时移除索引与向量
+	// 尚未归档任何原记忆时失败则删除合并记忆，避免与原记忆重复；
+	// 已有原记忆归档时保留合并记忆，它是这些内容唯一仍可检索的副本
+	for i, src := range sources {
+		if err := m.fileStore.ArchiveMemory(src); err != nil {
+			if i == 0 {
+				_ = m.Delete(merged.ID)
+				return nil, fmt.Errorf("归档原记忆失败: %w", err)
+			}
+			return merged, fmt.Errorf("归档原记忆失败: %w", err)
+		}
+		_ = m.index.DeleteIndex(src.ID)
+		if m.vector != nil {
+			_ = m.vector.DeleteVector(src.ID)
+		}
+	}
+
+	// 指向原记忆的关联改为指向合并后的记忆
+	others, err := m.LoadAll()
+	if err != nil {
+		return merged, nil
+	}
+	for _, mem := range others {
+		if mem.ID == merged.ID {
+			continue
+		}
+
+		changed := false
+		for _, r := range append([]string(nil), mem.Related...) {
+			if !sourceIDs[r] {
+				continue
+			}
+			relType := mem.RelationTo(r)
+			mem.UnsetRelation(r)
+			if mem.RelationTo(merged.ID) == "" {
+				mem.SetRelation(merged.ID, relType)
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		if err := m.fileStore.UpdateMemory(mem); err == nil {
+			_ = m.index.UpdateIndex(MemoryToIndex(mem))
+		}
+	}
+
+	return merged, nil
+}
+
 // SetImportance 设置记忆重要性
 func (m *LongTermMemoryManager) SetImportance(id string, importance int) error {
 	if importance < 1 || importance > 5 {
@@ -4,8 +4,17 @@ package v2
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/hession/aimate/internal/logger"
+	"github.com/hession/aimate/internal/redact"
 )
 
 // MemorySystem 记忆系统主结构
@@ -20,8 +29,9 @@ type MemorySystem struct {
 	fileStore *MarkdownFileStore
 
 	// 索引层
-	index  *SQLiteIndexStore
-	vector *SQLiteVectorStore
+	index          *FederatedIndexStore
+	vector         *FederatedVectorStore
+	embeddingStore *SQLiteEmbeddingStore
 
 	// 记忆管理器
 	coreMgr      *CoreMemoryManager
@@ -31,18 +41,49 @@ type MemorySystem struct {
 
 	// 辅助组件
 	classifier     *MemoryClassifier
+	active         Classifier
 	embedding      *EmbeddingManager
 	retriever      *HybridRetriever
 	contextBuilder *ContextBuilder
 	lifecycle      *LifecycleManager
+	compressor     *MemoryCompressor
+	reviewQueue    *ReviewQueue
+	reflector      *Reflector
+	refiner        *CoreRefiner
+	supersession   *SupersessionDetector
+	scheduler      *TaskScheduler
+	watcher        *FileWatcher
 	syncer         *IndexSyncer
 	trimmer        *SessionTrimmer
+	redactor       *redact.Redactor
 
 	// 状态
 	initialized bool
 	mu          sync.RWMutex
 }
 
+// CompleteFunc LLM 补全函数：输入提示词，返回模型回复
+type CompleteFunc func(ctx context.Context, prompt string) (string, error)
+
+// decodeLLMJSON 从 LLM 回复中截取 JSON 并解码到 v，what 用于错误信息
+// v 指向切片时截取首个 [ 到最后一个 ]，否则截取首个 { 到最后一个 }
+func decodeLLMJSON(reply string, v any, what string) error {
+	opening, closing := "{", "}"
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Slice {
+		opening, closing = "[", "]"
+	}
+
+	start := strings.Index(reply, opening)
+	end := strings.LastIndex(reply, closing)
+	if start < 0 || end <= start {
+		return fmt.Errorf("%s格式错误: %s", what, truncateContent(reply, 100))
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), v); err != nil {
+		return fmt.Errorf("解析%s失败: %w", what, err)
+	}
+	return nil
+}
+
 // NewMemorySystem 创建记忆系统
 func NewMemorySystem() (*MemorySystem, error) {
 	return &MemorySystem{}, nil
@@ -72,8 +113,36 @@ func (ms *MemorySystem) Initialize(apiKey string) error {
 	}
 	ms.storage = storage
 
-	// 3. 初始化文件存储
+	// 3. 初始化文件存储（可选 git 版本历史）
 	ms.fileStore = NewMarkdownFileStore(storage)
+	if ms.config.Storage.GitHistory {
+		history, err := NewMemoryHistory(storage)
+		if err != nil {
+			fmt.Printf("警告: %v\n", err)
+		} else {
+			ms.fileStore.SetHistory(history)
+		}
+	}
+	if ms.config.Encryption.Enabled {
+		cipher, err := LoadMemoryCipher(ms.config.Encryption)
+		if err != nil {
+			return fmt.Errorf("加载加密密钥失败: %w", err)
+		}
+		ms.fileStore.SetCipher(cipher)
+	}
+
+	// 敏感信息脱敏（同时作用于日志）
+	if ms.config.Redaction.Enabled {
+		redactor, err := redact.New(ms.config.Redaction.Options())
+		if err != nil {
+			fmt.Printf("警告: 自定义脱敏规则无效，仅使用内置规则: %v\n", err)
+			redactor, _ = redact.New(redact.Options{Emails: ms.config.Redaction.Emails, Phones: ms.config.Redaction.Phones})
+		}
+		ms.redactor = redactor
+		logger.SetRedactor(redactor)
+	} else {
+		logger.SetRedactor(nil)
+	}
 
 	// 4. 初始化索引
 	indexPath := storage.GetGlobalIndexDBPath()
@@ -81,30 +150,43 @@ func (ms *MemorySystem) Initialize(apiKey string) error {
 	if err != nil {
 		return fmt.Errorf("初始化索引失败: %w", err)
 	}
-	ms.index = index
+	index.SetCipher(ms.fileStore.Cipher())
+	ms.index = NewFederatedIndexStore(index)
 
 	// 5. 初始化向量存储
-	vectorPath := storage.GetGlobalRoot() + "/vectors.db"
-	vector, err := NewSQLiteVectorStore(vectorPath, ms.config.Embedding.Dimension)
+	vectorPath := filepath.Join(storage.GetGlobalRoot(), "vectors.db")
+	vector, err := NewSQLiteVectorStore(vectorPath, ms.config.Embedding.ModelID(), ms.config.Embedding.Dimension)
 	if err != nil {
 		return fmt.Errorf("初始化向量存储失败: %w", err)
 	}
-	ms.vector = vector
+	ms.vector = NewFederatedVectorStore(vector, ms.index)
 
-	// 6. 初始化 Embedding（如果有 API Key）
-	if apiKey != "" && ms.config.Embedding.Enabled {
+	// 嵌入模型变化后旧向量不可用于检索，需要重建
+	warnReembed(vector)
+
+	// 6. 初始化 Embedding（需要 API Key，本地提供商除外）
+	if ms.config.Embedding.Enabled && (apiKey != "" || ms.config.Embedding.Provider == "local") {
 		embeddingClient := NewEmbeddingClient(&ms.config.Embedding, apiKey)
-		ms.embedding = NewEmbeddingManager(embeddingClient, vector, &ms.config.Embedding)
+		embeddingStore, err := NewSQLiteEmbeddingStore(filepath.Join(storage.GetGlobalRoot(), "embeddings.db"))
+		if err != nil {
+			return fmt.Errorf("初始化 embedding 存储失败: %w", err)
+		}
+		embeddingStore.SetCipher(ms.fileStore.Cipher())
+		ms.embeddingStore = embeddingStore
+		ms.embedding = NewEmbeddingManager(embeddingClient, ms.vector, embeddingStore, &ms.config.Embedding)
+		ms.embedding.SetRedactor(ms.redactor)
 	}
 
 	// 7. 初始化各层记忆管理器
 	ms.coreMgr = NewCoreMemoryManager(storage, ms.fileStore, ms.index, ms.config)
 	ms.sessionMgr = NewSessionManager(storage, ms.fileStore, ms.index, ms.config)
+	ms.sessionMgr.SetRedactor(ms.redactor)
 	ms.shortTermMgr = NewShortTermMemoryManager(storage, ms.fileStore, ms.index, ms.config)
 	ms.longTermMgr = NewLongTermMemoryManager(storage, ms.fileStore, ms.index, ms.vector, ms.config)
 
 	// 8. 初始化辅助组件
 	ms.classifier = NewMemoryClassifier()
+	ms.active = ms.buildClassifier(nil)
 
 	ms.syncer = NewIndexSyncer(storage, ms.fileStore, ms.index, ms.vector)
 
@@ -119,7 +201,22 @@ func (ms *MemorySystem) Initialize(apiKey string) error {
 		ms.config,
 	)
 
-	ms.lifecycle = NewLifecycleManager(ms.shortTermMgr, ms.longTermMgr, ms.syncer, ms.config)
+	ms.compressor = NewMemoryCompressor(ms.longTermMgr, ms.vector, ms.embedding, ms.config, nil)
+
+	ms.lifecycle = NewLifecycleManager(ms.shortTermMgr, ms.longTermMgr, ms.syncer, ms.embedding, ms.compressor, ms.config)
+	ms.lifecycle.SetRunLock(NewFileLock(filepath.Join(storage.GetGlobalRoot(), maintenanceLockFile)))
+
+	ms.reviewQueue = NewReviewQueue(filepath.Join(storage.GetGlobalRoot(), "review_queue.json"), ms.coreMgr)
+	ms.reviewQueue.SetCipher(ms.fileStore.Cipher())
+	ms.reflector = NewReflector(storage, ms.fileStore, ms.sessionMgr, ms.coreMgr, ms.longTermMgr,
+		ms.reviewQueue, filepath.Join(storage.GetGlobalRoot(), "reflection_state.json"), nil)
+	ms.sessionMgr.SetTruncateHook(func(sessionID string, fromSequence int) {
+		if err := ms.reflector.Rewind(sessionID, fromSequence); err != nil {
+			logger.Warn("[memory] 回退反思进度失败: %v", err)
+		}
+	})
+	ms.refiner = NewCoreRefiner(storage, ms.fileStore, ms.coreMgr, ms.config, nil)
+	ms.supersession = NewSupersessionDetector(ms.longTermMgr, ms.config, nil)
 
 	// 创建默认摘要函数
 	summarizeFunc := DefaultSummarizeFunc
@@ -136,6 +233,27 @@ func (ms *MemorySystem) Initialize(apiKey string) error {
 		ms.lifecycle.Start()
 	}
 
+	// 11. 启动定期反思任务
+	ms.scheduler = NewTaskScheduler()
+	if ms.config.Maintenance.Enabled && ms.config.Maintenance.ReflectionEnabled && ms.config.Maintenance.ReflectionIntervalHours > 0 {
+		interval := time.Duration(ms.config.Maintenance.ReflectionIntervalHours) * time.Hour
+		ms.scheduler.AddTask("reflection", interval, func(ctx context.Context) error {
+			_, err := ms.reflector.Run(ctx)
+			return err
+		})
+		ms.scheduler.Start()
+	}
+
+	// 12. 监听记忆文件变化
+	ms.watcher = NewFileWatcher(storage, ms.fileStore, ms.syncer, ms.embedding,
+		time.Duration(ms.config.Maintenance.WatchDebounceMs)*time.Millisecond)
+	if ms.config.Maintenance.WatchFiles {
+		if err := ms.watcher.Start(); err != nil {
+			// 非致命错误，由定期维护同步索引
+			fmt.Printf("监听记忆文件失败: %v\n", err)
+		}
+	}
+
 	ms.initialized = true
 	return nil
 }
@@ -145,6 +263,7 @@ func (ms *MemorySystem) SetProject(projectPath string) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
+	previousRoot := ms.storage.GetProjectRoot()
 	if err := ms.storage.SetCurrentProject(projectPath); err != nil {
 		return err
 	}
@@ -153,9 +272,130 @@ func (ms *MemorySystem) SetProject(projectPath string) error {
 	ms.shortTermMgr.EnsureDirectories()
 	ms.longTermMgr.EnsureDirectories()
 
+	if ms.storage.GetProjectRoot() == previousRoot && ms.index.Project() != nil {
+		return nil
+	}
+
+	// 切换期间暂停监听，避免旧项目的变更写入新项目的索引
+	ms.watcher.Stop()
+
+	if err := ms.openProjectStores(); err != nil {
+		return err
+	}
+
+	// 重新监听以包含新项目的记忆目录
+	if ms.config.Maintenance.WatchFiles {
+		if err := ms.watcher.Restart(); err != nil {
+			fmt.Printf("监听记忆文件失败: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// openProjectStores 打开当前项目的索引与向量库，并关闭之前项目的存储
+// 项目记忆的索引与向量保存在项目的记忆目录中，使该目录自成一体，可随仓库提交
+func (ms *MemorySystem) openProjectStores() error {
+	index, err := NewSQLiteIndexStore(ms.storage.GetProjectIndexDBPath())
+	if err != nil {
+		return fmt.Errorf("初始化项目索引失败: %w", err)
+	}
+	index.SetCipher(ms.fileStore.Cipher())
+	vector, err := NewSQLiteVectorStore(ms.storage.GetProjectVectorDBPath(),
+		ms.config.Embedding.ModelID(), ms.config.Embedding.Dimension)
+	if err != nil {
+		index.Close()
+		return fmt.Errorf("初始化项目向量存储失败: %w", err)
+	}
+	warnReembed(vector)
+
+	if previous := ms.index.SetProject(index); previous != nil {
+		previous.Close()
+	}
+	if previous := ms.vector.SetProject(vector); previous != nil {
+		previous.Close()
+	}
+
+	// 迁移此前写入全局索引的本项目记忆
+	if moved, err := ms.migrateProjectIndexes(); err != nil {
+		fmt.Printf("迁移项目记忆索引失败: %v\n", err)
+	} else if moved > 0 {
+		fmt.Printf("已将 %d 条项目记忆的索引迁移到 %s\n", moved, ms.storage.GetProjectRoot())
+	}
+
+	// 补齐随仓库检出、尚未建立索引的记忆文件
+	ms.syncProjectFiles()
 	return nil
 }
 
+// migrateProjectIndexes 将全局索引中属于当前项目的记录及其向量移入项目存储
+func (ms *MemorySystem) migrateProjectIndexes() (int, error) {
+	global, project := ms.index.Global(), ms.index.Project()
+	indexes, err := global.GetMemoriesByScope(ScopeProject)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, idx := range indexes {
+		if !ms.storage.IsProjectPath(idx.FilePath) {
+			continue
+		}
+		if _, err := project.GetIndex(idx.ID); IsNotFound(err) {
+			if err := project.CreateIndex(idx); err != nil {
+				return moved, err
+			}
+		}
+		if vec, err := ms.vector.Global().GetVector(idx.ID); err == nil {
+			if err := ms.vector.StoreVector(idx.ID, vec); err != nil {
+				return moved, err
+			}
+			_ = ms.vector.Global().DeleteVector(idx.ID)
+		}
+		if err := global.DeleteIndex(idx.ID); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// syncProjectFiles 为项目目录中尚未建立索引的记忆文件建立索引
+func (ms *MemorySystem) syncProjectFiles() {
+	for _, dir := range []string{ms.storage.GetProjectShortTermPath(), ms.storage.GetProjectLongTermPath()} {
+		files, err := ms.storage.ListMemoryFiles(dir)
+		if err != nil {
+			continue
+		}
+		for _, path := range files {
+			if err := ms.syncer.SyncSingle(path); err != nil {
+				fmt.Printf("同步项目记忆 %s 失败: %v\n", path, err)
+				continue
+			}
+			if ms.embedding == nil {
+				continue
+			}
+			mem, err := ms.fileStore.ReadMemory(path)
+			if err != nil || mem.Type != MemoryTypeLongTerm {
+				continue
+			}
+			if _, err := ms.vector.GetVector(mem.ID); IsNotFound(err) {
+				_ = ms.embedding.EmbedAndStore(context.Background(), mem.ID, memoryEmbeddingText(mem))
+			}
+		}
+	}
+}
+
+// warnReembed 向量库与当前嵌入模型不一致时提示重建
+func warnReembed(vector *SQLiteVectorStore) {
+	if !vector.NeedsReembed() {
+		return
+	}
+	current, target := vector.Space(), vector.TargetSpace()
+	fmt.Printf("向量库使用 %s (%d 维)，当前配置为 %s (%d 维)，向量检索已暂停，请运行 /memory reembed 重建向量\n",
+		current.Model, current.Dimension, target.Model, target.Dimension)
+}
+
 // Close 关闭记忆系统
 func (ms *MemorySystem) Close() error {
 	ms.mu.Lock()
@@ -165,6 +405,12 @@ func (ms *MemorySystem) Close() error {
 	if ms.lifecycle != nil {
 		ms.lifecycle.Stop()
 	}
+	if ms.scheduler != nil {
+		ms.scheduler.Stop()
+	}
+	if ms.watcher != nil {
+		ms.watcher.Stop()
+	}
 
 	// 关闭索引
 	if ms.index != nil {
@@ -176,6 +422,11 @@ func (ms *MemorySystem) Close() error {
 		ms.vector.Close()
 	}
 
+	// 关闭 embedding 存储
+	if ms.embeddingStore != nil {
+		ms.embeddingStore.Close()
+	}
+
 	ms.initialized = false
 	return nil
 }
@@ -212,6 +463,47 @@ func (ms *MemorySystem) Retriever() *HybridRetriever {
 	return ms.retriever
 }
 
+// buildClassifier 按配置组装分类器（complete 为 nil 时只使用正则分类器）
+func (ms *MemorySystem) buildClassifier(complete CompleteFunc) Classifier {
+	if complete == nil {
+		return ms.classifier
+	}
+
+	llmClassifier := NewLLMClassifier(complete)
+	primary, other := Classifier(ms.classifier), Classifier(llmClassifier)
+	if ms.config.Classifier.Mode == ClassifierLLM {
+		primary, other = other, primary
+	}
+	if ms.config.Classifier.Shadow {
+		return NewShadowClassifier(primary, other, nil)
+	}
+	return primary
+}
+
+// SetCompleteFunc 设置 LLM 补全函数，用于记忆分类、检索结果重排序、记忆合并、会话反思与核心记忆精炼（nil 表示不使用 LLM）
+func (ms *MemorySystem) SetCompleteFunc(complete CompleteFunc) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.retriever == nil {
+		return
+	}
+	ms.active = ms.buildClassifier(complete)
+	if complete == nil {
+		ms.retriever.SetReranker(nil)
+		ms.compressor.SetMergeFunc(nil)
+		ms.reflector.SetCompleteFunc(nil)
+		ms.refiner.SetCompleteFunc(nil)
+		ms.supersession.SetCompleteFunc(nil)
+		return
+	}
+	ms.retriever.SetReranker(NewLLMReranker(complete))
+	ms.compressor.SetMergeFunc(NewLLMMergeFunc(complete))
+	ms.reflector.SetCompleteFunc(complete)
+	ms.refiner.SetCompleteFunc(complete)
+	ms.supersession.SetCompleteFunc(complete)
+}
+
 // Context 获取上下文构建器
 func (ms *MemorySystem) Context() *ContextBuilder {
 	return ms.contextBuilder
@@ -226,12 +518,28 @@ func (ms *MemorySystem) Trimmer() *SessionTrimmer {
 
 // ProcessUserInput 处理用户输入（自动识别并存储记忆）
 func (ms *MemorySystem) ProcessUserInput(ctx context.Context, userMessage string) (*ClassificationResult, error) {
-	// 分类
-	result := ms.classifier.Classify(userMessage)
+	ms.mu.RLock()
+	classifier := ms.active
+	ms.mu.RUnlock()
+
+	// 分类与存储前脱敏（LLM 分类器会将文本发送到远程 API）
+	userMessage = ms.redactor.Redact(userMessage)
+
+	// 分类（LLM 分类失败时回退到正则分类）
+	result, err := classifier.ClassifyText(ctx, userMessage)
+	if err != nil {
+		logger.Warn("[memory] 记忆分类失败，使用规则分类: %v", err)
+		result, _ = ms.classifier.ClassifyText(ctx, userMessage)
+	}
 
 	if !result.ShouldStore {
 		return result, nil
 	}
+	if result.Confidence < ms.config.Classifier.MinConfidence {
+		result.ShouldStore = false
+		result.Reason = fmt.Sprintf("置信度 %.2f 低于阈值 %.2f", result.Confidence, ms.config.Classifier.MinConfidence)
+		return result, nil
+	}
 
 	// 根据分类结果存储
 	switch result.MemoryType {
@@ -248,12 +556,447 @@ func (ms *MemorySystem) ProcessUserInput(ctx context.Context, userMessage string
 		}
 
 	case MemoryTypeLongTerm:
-		_, err := ms.longTermMgr.Add(result.Category, result.Scope, result.Title, userMessage, result.Tags)
+		mem, err := ms.longTermMgr.Add(result.Category, result.Scope, result.Title, userMessage, result.Tags)
 		if err != nil {
 			return result, err
 		}
+		if result.Importance > 0 && result.Importance != mem.Importance {
+			_ = ms.longTermMgr.SetImportance(mem.ID, result.Importance)
+		}
+		result.Supersession = ms.embedAndRelate(ctx, mem, true)
+	}
+
+	return result, nil
+}
+
+// SaveMemory 按指定类型保存记忆（短期记忆使用分类默认 TTL）
+func (ms *MemorySystem) SaveMemory(ctx context.Context, memType MemoryType, category MemoryCategory, scope MemoryScope, title, content string, tags []string, source string) (*Memory, error) {
+	if err := validateMemoryCategory(memType, category); err != nil {
+		return nil, err
+	}
+	if scope == "" {
+		scope = ms.longTermMgr.DefaultScope()
+	}
+	if scope != ScopeGlobal && scope != ScopeProject {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMemoryScope, scope)
+	}
+
+	// 写入前脱敏：手动添加或由模型保存的内容同样可能包含用户粘贴的凭据
+	title = ms.redactor.Redact(title)
+	content = ms.redactor.Redact(content)
+	if len(tags) > 0 {
+		redactedTags := make([]string, len(tags))
+		for i, tag := range tags {
+			redactedTags[i] = ms.redactor.Redact(tag)
+		}
+		tags = redactedTags
+	}
+
+	switch memType {
+	case MemoryTypeCore:
+		return ms.coreMgr.AddWithSource(category, title, content, source)
+	case MemoryTypeShortTerm:
+		mem, err := ms.shortTermMgr.Add(category, scope, title, content, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 {
+			mem.Tags = tags
+			if err := ms.fileStore.UpdateMemory(mem); err != nil {
+				return nil, err
+			}
+			if err := ms.index.UpdateIndex(MemoryToIndex(mem)); err != nil {
+				return nil, err
+			}
+		}
+		return mem, nil
+	default:
+		mem, err := ms.longTermMgr.AddWithSource(category, scope, title, content, tags, source)
+		if err != nil {
+			return nil, err
+		}
+		ms.embedAndRelate(ctx, mem, false)
+		return mem, nil
+	}
+}
+
+// embedAndRelate 为新的长期记忆生成向量，可选检测其是否取代或与已有记忆矛盾，
+// 再与其余相似的长期记忆自动关联；返回取代检测结果（无变化时为 nil）
+func (ms *MemorySystem) embedAndRelate(ctx context.Context, mem *Memory, detectSupersession bool) *SupersessionResult {
+	if ms.embedding == nil {
+		return nil
+	}
+	if err := ms.embedding.EmbedAndStore(ctx, mem.ID, memoryEmbeddingText(mem)); err != nil {
+		return nil
+	}
+
+	var supersession *SupersessionResult
+	if detectSupersession {
+		var err error
+		supersession, err = ms.supersession.Detect(ctx, mem)
+		if err != nil {
+			fmt.Printf("警告: 记忆取代检测失败: %v\n", err)
+		}
+	}
+	if _, err := ms.longTermMgr.RelateSimilar(mem.ID); err != nil {
+		fmt.Printf("警告: 自动关联记忆失败: %v\n", err)
+	}
+	return supersession
+}
+
+// GetMemory 按 ID 获取核心、短期或长期记忆
+func (ms *MemorySystem) GetMemory(id string) (*Memory, error) {
+	idx, err := ms.index.GetIndex(id)
+	if err == ErrIndexNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrMemoryNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ms.fileStore.ReadMemory(idx.FilePath)
+}
+
+// UpdateMemory 更新记忆内容（tags 为 nil 时保留原标签）
+func (ms *MemorySystem) UpdateMemory(ctx context.Context, id, content string, tags []string) (*Memory, error) {
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := memoryTypeCategories[mem.Type]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMemoryType, mem.Type)
+	}
+
+	mem.Content = content
+	if tags != nil {
+		mem.Tags = tags
+	}
+	mem.UpdatedAt = time.Now()
+
+	if err := ms.fileStore.UpdateMemory(mem); err != nil {
+		return nil, fmt.Errorf("更新记忆失败: %w", err)
+	}
+	if err := ms.index.UpdateIndex(MemoryToIndex(mem)); err != nil {
+		return nil, fmt.Errorf("更新索引失败: %w", err)
+	}
+
+	if mem.Type == MemoryTypeLongTerm && ms.embedding != nil {
+		_ = ms.embedding.EmbedAndStore(ctx, mem.ID, memoryEmbeddingText(mem))
+	}
+	return mem, nil
+}
+
+// DeleteMemory 删除记忆，返回被删除的记忆
+func (ms *MemorySystem) DeleteMemory(id string) (*Memory, error) {
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mem.Type {
+	case MemoryTypeCore:
+		err = ms.coreMgr.Delete(id)
+	case MemoryTypeShortTerm:
+		err = ms.shortTermMgr.Delete(id)
+	case MemoryTypeLongTerm:
+		err = ms.longTermMgr.Delete(id)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMemoryType, mem.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("删除记忆失败: %w", err)
+	}
+	return mem, nil
+}
+
+// ResolveMemoryID 将完整 ID 或 ID 前缀解析为记忆 ID（前缀匹配多条时返回错误）
+func (ms *MemorySystem) ResolveMemoryID(prefix string) (string, error) {
+	if prefix == "" {
+		return "", ErrMemoryNotFound
+	}
+	if _, err := ms.index.GetIndex(prefix); err == nil {
+		return prefix, nil
+	}
+
+	indexes, err := ms.index.GetAllIndexes()
+	if err != nil {
+		return "", fmt.Errorf("读取索引失败: %w", err)
+	}
+
+	found := ""
+	for _, idx := range indexes {
+		if !strings.HasPrefix(idx.ID, prefix) {
+			continue
+		}
+		if found != "" && found != idx.ID {
+			return "", fmt.Errorf("ID 前缀 %s 匹配多条记忆", prefix)
+		}
+		found = idx.ID
+	}
+	if found == "" {
+		return "", fmt.Errorf("%w: %s", ErrMemoryNotFound, prefix)
+	}
+	return found, nil
+}
+
+// SetMemoryTags 替换记忆标签
+func (ms *MemorySystem) SetMemoryTags(ctx context.Context, id string, tags []string) (*Memory, error) {
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return ms.UpdateMemory(ctx, id, mem.Content, tags)
+}
+
+// PinMemory 固定或取消固定记忆
+// 固定的记忆不会过期、归档或被合并；短期记忆取消固定后重新按默认 TTL 计算过期时间
+func (ms *MemorySystem) PinMemory(id string, pinned bool) (*Memory, error) {
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	mem.Pinned = pinned
+	if pinned {
+		mem.ExpiresAt = nil
+	} else if mem.Type == MemoryTypeShortTerm && mem.ExpiresAt == nil {
+		mem.SetTTL(time.Duration(ms.config.ShortTerm.DefaultTTLDays) * 24 * time.Hour)
+	}
+
+	if err := ms.fileStore.UpdateMemory(mem); err != nil {
+		return nil, fmt.Errorf("更新记忆失败: %w", err)
+	}
+	if err := ms.index.UpdateIndex(MemoryToIndex(mem)); err != nil {
+		return nil, fmt.Errorf("更新索引失败: %w", err)
+	}
+	return mem, nil
+}
+
+// ArchiveMemory 将记忆移入归档目录，并删除其索引与向量
+func (ms *MemorySystem) ArchiveMemory(id string) (*Memory, error) {
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := memoryTypeCategories[mem.Type]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMemoryType, mem.Type)
+	}
+	if mem.Pinned {
+		return nil, fmt.Errorf("记忆已固定，请先取消固定再归档")
+	}
+
+	if err := ms.fileStore.ArchiveMemory(mem); err != nil {
+		return nil, fmt.Errorf("归档记忆失败: %w", err)
+	}
+	if err := ms.index.DeleteIndex(mem.ID); err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("删除索引失败: %w", err)
+	}
+	_ = ms.vector.DeleteVector(mem.ID)
+	return mem, nil
+}
+
+// LinkMemories 添加或更新从 id 到 targetID 的带类型关联
+func (ms *MemorySystem) LinkMemories(id, targetID string, relType RelationType) error {
+	if _, err := ms.GetMemory(targetID); err != nil {
+		return err
+	}
+	if _, err := ms.GetMemory(id); err != nil {
+		return err
+	}
+	return ms.longTermMgr.AddTypedRelation(id, targetID, relType)
+}
+
+// UnlinkMemories 移除从 id 到 targetID 的关联
+func (ms *MemorySystem) UnlinkMemories(id, targetID string) error {
+	if _, err := ms.GetMemory(id); err != nil {
+		return err
+	}
+	return ms.longTermMgr.RemoveRelation(id, targetID)
+}
+
+// SuggestRelations 按向量相似度为长期记忆建议关联
+func (ms *MemorySystem) SuggestRelations(id string, limit int) ([]*RelationSuggestion, error) {
+	threshold := ms.config.LongTerm.RelationSimilarity
+	if threshold <= 0 {
+		threshold = ms.config.Retrieval.MinSimilarity
+	}
+	return ms.longTermMgr.SuggestRelations(id, threshold, limit)
+}
+
+// BuildMemoryGraph 构建以某条记忆为起点、展开 depth 层的关联图
+func (ms *MemorySystem) BuildMemoryGraph(id string, depth int) (*MemoryGraph, error) {
+	return BuildMemoryGraph(id, depth, ms.GetMemory)
+}
+
+// SyncMemoryFile 同步手动编辑过的记忆文件，并为长期记忆重新生成向量
+func (ms *MemorySystem) SyncMemoryFile(ctx context.Context, path string) (*Memory, error) {
+	if err := ms.syncer.SyncSingle(path); err != nil {
+		return nil, fmt.Errorf("同步索引失败: %w", err)
+	}
+
+	mem, err := ms.fileStore.ReadMemory(path)
+	if err != nil {
+		return nil, err
+	}
+	syncMemoryVector(ctx, ms.embedding, ms.vector, mem)
+	return mem, nil
+}
+
+// Redactor 返回敏感信息脱敏器（未启用时为 nil），用于诊断中的脱敏计数
+func (ms *MemorySystem) Redactor() *redact.Redactor {
+	return ms.redactor
+}
+
+// Encrypted 返回记忆文件是否启用了静态加密
+func (ms *MemorySystem) Encrypted() bool {
+	return ms.fileStore.Cipher() != nil
+}
+
+// EditDir 返回编辑解密内容时使用的私有目录（位于全局记忆目录下，仅当前用户可访问）
+// 避免明文草稿写入系统临时目录
+func (ms *MemorySystem) EditDir() (string, error) {
+	dir := filepath.Join(ms.storage.GetGlobalRoot(), editDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建编辑目录失败: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", fmt.Errorf("设置编辑目录权限失败: %w", err)
+	}
+	return dir, nil
+}
+
+// ReadMemoryFile 读取记忆文件的明文内容（加密文件会被解密）
+func (ms *MemorySystem) ReadMemoryFile(path string) ([]byte, error) {
+	return ms.fileStore.ReadFile(path)
+}
+
+// WriteMemoryFile 将编辑后的明文写回记忆文件并同步索引与向量
+func (ms *MemorySystem) WriteMemoryFile(ctx context.Context, path string, content []byte) (*Memory, error) {
+	if err := ms.fileStore.WriteFile(path, content); err != nil {
+		return nil, err
+	}
+	return ms.SyncMemoryFile(ctx, path)
+}
+
+// MemoryHistory 返回记忆文件的版本历史（最新在前）
+func (ms *MemorySystem) MemoryHistory(id string, limit int) ([]*HistoryEntry, error) {
+	history := ms.fileStore.History()
+	if history == nil {
+		return nil, fmt.Errorf("未启用记忆版本历史，请在配置中设置 storage.git_history: true")
+	}
+
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	return history.Log(mem.FilePath, limit)
+}
+
+// RevertMemory 将记忆恢复到指定历史版本（rev 支持前缀），并同步索引与向量
+func (ms *MemorySystem) RevertMemory(ctx context.Context, id, rev string) (*Memory, error) {
+	history := ms.fileStore.History()
+	if history == nil {
+		return nil, fmt.Errorf("未启用记忆版本历史，请在配置中设置 storage.git_history: true")
+	}
+
+	mem, err := ms.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := history.Log(mem.FilePath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *HistoryEntry
+	for _, entry := range entries {
+		if rev != "" && strings.HasPrefix(entry.Rev, rev) {
+			target = entry
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("记忆历史中没有版本 %s", rev)
+	}
+
+	content, err := history.Show(target.Rev, target.Path)
+	if err != nil {
+		return nil, err
+	}
+	// 历史版本可能是加密前的明文，也可能是密文
+	if content, err = ms.fileStore.Cipher().Open(content); err != nil {
+		return nil, fmt.Errorf("解密历史版本失败: %w", err)
 	}
+	old, err := ms.fileStore.parser.ParseMemory(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析历史版本失败: %w", err)
+	}
+	if old.ID != mem.ID {
+		return nil, fmt.Errorf("版本 %s 中的记忆 ID 不一致", target.ShortRev)
+	}
+
+	// 保留当前位置与状态，只恢复内容与元数据
+	old.FilePath = mem.FilePath
+	old.Status = mem.Status
+	if err := ms.fileStore.RevertMemory(old, target.ShortRev); err != nil {
+		return nil, fmt.Errorf("写入历史版本失败: %w", err)
+	}
+	return ms.SyncMemoryFile(ctx, mem.FilePath)
+}
+
+// teamSync 按当前项目配置创建团队同步器
+func (ms *MemorySystem) teamSync() (*TeamSync, error) {
+	project, _ := ms.GetProject()
+	if project == "" {
+		return nil, fmt.Errorf("未设置项目，无法同步团队记忆")
+	}
+	cfg, err := ms.configMgr.GetProjectConfig(project)
+	if err != nil {
+		return nil, err
+	}
+	return NewTeamSync(ms.storage, ms.fileStore, cfg.TeamSync)
+}
 
+// TeamSyncStatus 返回当前项目的团队同步配置与上次同步状态
+func (ms *MemorySystem) TeamSyncStatus() (*TeamSyncStatus, error) {
+	ts, err := ms.teamSync()
+	if err != nil {
+		return nil, err
+	}
+	return ts.Status(), nil
+}
+
+// SyncTeam 与团队远端同步共享的项目记忆，并为本地变化的记忆重建索引与向量
+func (ms *MemorySystem) SyncTeam(ctx context.Context) (*TeamSyncResult, error) {
+	ts, err := ms.teamSync()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ts.Sync()
+	if result != nil {
+		for _, id := range result.archivedIDs {
+			if err := ms.index.DeleteIndex(id); err != nil && !IsNotFound(err) {
+				fmt.Printf("警告: 删除索引失败: %v\n", err)
+			}
+			_ = ms.vector.DeleteVector(id)
+		}
+		for _, path := range result.removedPaths {
+			if err := ms.index.DeleteIndexByPath(path); err != nil && !IsNotFound(err) {
+				fmt.Printf("警告: 删除索引失败: %v\n", err)
+			}
+		}
+		for _, path := range result.importedPaths {
+			if _, err := ms.SyncMemoryFile(ctx, path); err != nil {
+				fmt.Printf("警告: 同步团队记忆索引失败: %v\n", err)
+			}
+		}
+	}
+	if err != nil {
+		return result, fmt.Errorf("同步团队记忆失败: %w", err)
+	}
 	return result, nil
 }
 
@@ -272,6 +1015,32 @@ func (ms *MemorySystem) Search(ctx context.Context, query string, topK int) ([]*
 	return ms.retriever.QuickSearch(ctx, query, topK)
 }
 
+// Reflect 立即执行一次会话反思
+func (ms *MemorySystem) Reflect(ctx context.Context) (*ReflectionResult, error) {
+	return ms.reflector.Run(ctx)
+}
+
+// ReviewQueue 获取核心记忆审核队列
+func (ms *MemorySystem) ReviewQueue() *ReviewQueue {
+	return ms.reviewQueue
+}
+
+// SearchDetailed 搜索记忆并返回分数与得分说明
+func (ms *MemorySystem) SearchDetailed(ctx context.Context, query string, topK int) ([]*MemorySearchResult, error) {
+	return ms.retriever.Search(ctx, query, &RetrievalOptions{
+		TopK:          topK,
+		UseVector:     ms.embedding != nil,
+		UseKeyword:    true,
+		UseTimeWeight: true,
+		MinSimilarity: 0.5,
+	})
+}
+
+// SearchHistory 搜索历史会话消息
+func (ms *MemorySystem) SearchHistory(query string, limit int) ([]*SessionMessageHit, error) {
+	return ms.sessionMgr.SearchHistory(query, limit)
+}
+
 // NewSession 创建新会话
 func (ms *MemorySystem) NewSession() (*Session, error) {
 	return ms.sessionMgr.CreateSession()
@@ -296,6 +1065,8 @@ func (ms *MemorySystem) GetStats() *MemorySystemStats {
 	// 核心记忆
 	coreTokens, _ := ms.coreMgr.GetTotalTokens()
 	stats.CoreTokens = coreTokens
+	stats.CoreNeedsRefine, _ = ms.coreMgr.NeedsRefine()
+	stats.PendingReviews = ms.reviewQueue.Size()
 
 	// 会话
 	sessionStats := ms.sessionMgr.GetSessionStats()
@@ -326,6 +1097,8 @@ func (ms *MemorySystem) GetStats() *MemorySystemStats {
 	vectorStats, _ := ms.vector.GetVectorStats()
 	if vectorStats != nil {
 		stats.VectorCount = vectorStats.TotalVectors
+		stats.VectorModel = vectorStats.Model
+		stats.VectorNeedsReembed = vectorStats.NeedsReembed
 	}
 
 	return stats
@@ -333,15 +1106,19 @@ func (ms *MemorySystem) GetStats() *MemorySystemStats {
 
 // MemorySystemStats 记忆系统统计
 type MemorySystemStats struct {
-	CoreTokens        int     `json:"core_tokens"`
-	SessionTokens     int     `json:"session_tokens"`
-	SessionMessages   int     `json:"session_messages"`
-	SessionUsageRatio float64 `json:"session_usage_ratio"`
-	ShortTermCount    int     `json:"short_term_count"`
-	ShortTermExpired  int     `json:"short_term_expired"`
-	LongTermCount     int     `json:"long_term_count"`
-	IndexedCount      int     `json:"indexed_count"`
-	VectorCount       int     `json:"vector_count"`
+	CoreTokens         int     `json:"core_tokens"`
+	CoreNeedsRefine    bool    `json:"core_needs_refine"`
+	PendingReviews     int     `json:"pending_reviews"`
+	SessionTokens      int     `json:"session_tokens"`
+	SessionMessages    int     `json:"session_messages"`
+	SessionUsageRatio  float64 `json:"session_usage_ratio"`
+	ShortTermCount     int     `json:"short_term_count"`
+	ShortTermExpired   int     `json:"short_term_expired"`
+	LongTermCount      int     `json:"long_term_count"`
+	IndexedCount       int     `json:"indexed_count"`
+	VectorCount        int     `json:"vector_count"`
+	VectorModel        string  `json:"vector_model"`
+	VectorNeedsReembed bool    `json:"vector_needs_reembed"`
 }
 
 // CheckWarnings 检查警告
@@ -349,6 +1126,26 @@ func (ms *MemorySystem) CheckWarnings() []ContextWarning {
 	return ms.contextBuilder.CheckContextWarnings()
 }
 
+// ProposeCoreRefine 由 LLM 生成核心记忆精炼方案，确认后调用 ApplyCoreRefine 应用
+func (ms *MemorySystem) ProposeCoreRefine(ctx context.Context) (*CoreRefinePlan, error) {
+	return ms.refiner.Propose(ctx)
+}
+
+// PendingCoreRefine 返回待确认的核心记忆精炼方案
+func (ms *MemorySystem) PendingCoreRefine() *CoreRefinePlan {
+	return ms.refiner.Pending()
+}
+
+// ApplyCoreRefine 应用待确认的核心记忆精炼方案，旧版本保存在归档目录
+func (ms *MemorySystem) ApplyCoreRefine() (*CoreRefineResult, error) {
+	return ms.refiner.Apply()
+}
+
+// DiscardCoreRefine 放弃待确认的核心记忆精炼方案
+func (ms *MemorySystem) DiscardCoreRefine() bool {
+	return ms.refiner.Discard()
+}
+
 // SyncIndex 同步索引
 func (ms *MemorySystem) SyncIndex() (*SyncResult, error) {
 	return ms.syncer.SyncAll()
@@ -359,6 +1156,108 @@ func (ms *MemorySystem) Reindex() (*SyncResult, error) {
 	return ms.syncer.Reindex()
 }
 
+// ReembedResult 向量重建结果
+type ReembedResult struct {
+	Total      int         `json:"total"`
+	Embedded   int         `json:"embedded"`
+	Skipped    int         `json:"skipped"`
+	Space      VectorSpace `json:"space"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// Reembed 使用当前配置的嵌入模型分批重建全部记忆向量
+// 重建完成前旧向量保持不变；任一批失败则放弃本次重建
+func (ms *MemorySystem) Reembed(ctx context.Context, progress func(done, total int)) (*ReembedResult, error) {
+	startTime := time.Now()
+	if ms.embedding == nil {
+		return nil, fmt.Errorf("未启用 embedding，无法重建向量")
+	}
+
+	// 先开始重建再列出记忆：影子表会被清空，此后新写入的向量同时进入影子表
+	if err := ms.vector.BeginReembed(); err != nil {
+		return nil, err
+	}
+
+	indexes, err := ms.index.GetAllIndexes()
+	if err != nil {
+		ms.vector.AbortReembed()
+		return nil, fmt.Errorf("获取索引失败: %w", err)
+	}
+
+	result := &ReembedResult{Space: ms.vector.TargetSpace()}
+	var ids, texts []string
+	for _, idx := range indexes {
+		// 与其他写入路径一致，只有长期记忆有向量
+		if idx.Type != MemoryTypeLongTerm {
+			continue
+		}
+		mem, err := ms.fileStore.ReadMemory(idx.FilePath)
+		if err != nil {
+			result.Skipped++
+			continue
+		}
+		ids = append(ids, mem.ID)
+		texts = append(texts, memoryEmbeddingText(mem))
+	}
+	result.Total = len(ids)
+
+	batchSize := ms.config.Embedding.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10
+	}
+	for i := 0; i < len(ids); i += batchSize {
+		end := min(i+batchSize, len(ids))
+
+		vectors, err := ms.embedding.EmbedTexts(ctx, texts[i:end])
+		if err != nil {
+			ms.vector.AbortReembed()
+			return result, fmt.Errorf("生成 embedding 失败: %w", err)
+		}
+
+		batch := make(map[string][]float32, end-i)
+		for j, id := range ids[i:end] {
+			batch[id] = vectors[j]
+		}
+		if err := ms.vector.StoreReembedded(batch); err != nil {
+			ms.vector.AbortReembed()
+			return result, err
+		}
+
+		result.Embedded = end
+		if progress != nil {
+			progress(end, len(ids))
+		}
+	}
+
+	if err := ms.vector.CommitReembed(); err != nil {
+		ms.vector.AbortReembed()
+		return result, err
+	}
+
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	return result, nil
+}
+
+// memoryEmbeddingText 返回用于生成 embedding 的记忆文本
+func memoryEmbeddingText(mem *Memory) string {
+	return mem.Title + "\n" + mem.Content
+}
+
+// syncMemoryVector 按记忆文件的当前内容更新向量：活跃的长期记忆生成向量，
+// 其他记忆（如被移出 long_term/ 或已归档）删除残留的向量
+func syncMemoryVector(ctx context.Context, embedding *EmbeddingManager, vector VectorStore, mem *Memory) {
+	if mem.Type == MemoryTypeLongTerm && (mem.Status == StatusActive || mem.Status == "") {
+		if embedding != nil {
+			// 向量生成失败时已进入离线队列，内容未变时命中缓存
+			_ = embedding.EmbedAndStore(ctx, mem.ID, memoryEmbeddingText(mem))
+		}
+		return
+	}
+	if vector != nil {
+		_ = vector.DeleteVector(mem.ID)
+	}
+}
+
 // RunMaintenance 运行维护任务
 func (ms *MemorySystem) RunMaintenance(ctx context.Context) *MaintenanceResult {
 	return ms.lifecycle.RunMaintenance(ctx)
@@ -375,3 +1274,10 @@ func (ms *MemorySystem) IsInitialized() bool {
 func (ms *MemorySystem) GetConfig() *MemoryConfig {
 	return ms.config
 }
+
+// GetProject 获取当前项目路径及其记忆目录
+func (ms *MemorySystem) GetProject() (project, root string) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.storage.GetCurrentProject(), ms.storage.GetProjectRoot()
+}
@@ -3,6 +3,9 @@ package v2
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -217,6 +220,26 @@ func TestMemory_IsExpired(t *testing.T) {
 	if mem.IsExpired() {
 		t.Error("未来的时间不应过期")
 	}
+
+	// 固定的记忆不会过期
+	mem.ExpiresAt = &pastTime
+	mem.Pinned = true
+	if mem.IsExpired() {
+		t.Error("固定的记忆不应过期")
+	}
+
+	parser := NewFrontmatterParser()
+	data, err := parser.SerializeMemory(mem)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	parsed, err := parser.ParseMemory(data)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if !parsed.Pinned {
+		t.Error("固定状态应写入 frontmatter")
+	}
 }
 
 // ========== 分类器测试 ==========
@@ -417,7 +440,7 @@ func TestSQLiteVectorStore(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	dbPath := filepath.Join(tmpDir, "vectors.db")
-	store, err := NewSQLiteVectorStore(dbPath, 3)
+	store, err := NewSQLiteVectorStore(dbPath, "test", 3)
 	if err != nil {
 		t.Fatalf("创建向量存储失败: %v", err)
 	}
@@ -471,6 +494,379 @@ func TestSQLiteVectorStore(t *testing.T) {
 	}
 }
 
+// randomVectors 生成可复现的随机向量
+func randomVectors(n, dim int, seed int64) map[string][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make(map[string][]float32, n)
+	for i := 0; i < n; i++ {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		vectors[fmt.Sprintf("vec-%05d", i)] = v
+	}
+	return vectors
+}
+
+// bruteForceTopK 暴力计算 Top-K 作为召回率基准
+func bruteForceTopK(vectors map[string][]float32, query []float32, k int) map[string]bool {
+	type scored struct {
+		id    string
+		score float64
+	}
+	all := make([]scored, 0, len(vectors))
+	for id, v := range vectors {
+		all = append(all, scored{id, CosineSimilarity(query, v)})
+	}
+	for i := 0; i < k && i < len(all); i++ {
+		best := i
+		for j := i + 1; j < len(all); j++ {
+			if all[j].score > all[best].score {
+				best = j
+			}
+		}
+		all[i], all[best] = all[best], all[i]
+	}
+	top := make(map[string]bool, k)
+	for i := 0; i < k && i < len(all); i++ {
+		top[all[i].id] = true
+	}
+	return top
+}
+
+func TestHNSWIndex_Recall(t *testing.T) {
+	const dim, k = 32, 10
+	vectors := randomVectors(2000, dim, 1)
+
+	index := NewHNSWIndex(dim, DefaultHNSWConfig())
+	for id, v := range vectors {
+		if err := index.Insert(id, v); err != nil {
+			t.Fatalf("插入失败: %v", err)
+		}
+	}
+
+	queries := randomVectors(50, dim, 2)
+	hits, total := 0, 0
+	for _, q := range queries {
+		truth := bruteForceTopK(vectors, q, k)
+		results := index.Search(q, k)
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Fatal("结果应按相似度降序")
+			}
+		}
+		for _, r := range results {
+			if truth[r.ID] {
+				hits++
+			}
+		}
+		total += k
+	}
+
+	recall := float64(hits) / float64(total)
+	t.Logf("HNSW recall@%d = %.3f", k, recall)
+	if recall < 0.95 {
+		t.Errorf("召回率过低: %.3f", recall)
+	}
+}
+
+func TestHNSWIndex_DeleteAndUpdate(t *testing.T) {
+	const dim = 16
+	vectors := randomVectors(500, dim, 3)
+
+	index := NewHNSWIndex(dim, DefaultHNSWConfig())
+	for id, v := range vectors {
+		index.Insert(id, v)
+	}
+
+	// 删除后不再出现在结果中
+	target := vectors["vec-00042"]
+	index.Delete("vec-00042")
+	for _, r := range index.Search(target, 10) {
+		if r.ID == "vec-00042" {
+			t.Error("已删除的向量不应被搜索到")
+		}
+	}
+
+	// 更新后按新向量命中
+	updated := vectors["vec-00007"]
+	index.Insert("vec-00001", updated)
+	results := index.Search(updated, 2)
+	found := false
+	for _, r := range results {
+		if r.ID == "vec-00001" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("更新后的向量应能被搜索到")
+	}
+
+	// 大量删除触发重建后仍可搜索
+	for i := 100; i < 400; i++ {
+		index.Delete(fmt.Sprintf("vec-%05d", i))
+	}
+	if index.Len() != 199 {
+		t.Errorf("有效节点数应为 199, 实际 %d", index.Len())
+	}
+	results = index.Search(vectors["vec-00450"], 1)
+	if len(results) == 0 || results[0].ID != "vec-00450" {
+		t.Error("重建后应能精确命中")
+	}
+}
+
+func TestSQLiteVectorStore_ANNIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "vectors.db")
+	const dim = 16
+
+	store, err := NewSQLiteVectorStore(dbPath, "test", dim)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	store.SetANNThreshold(0)
+	store.WaitANNReady()
+
+	vectors := randomVectors(300, dim, 4)
+	if err := store.BatchStoreVectors(vectors); err != nil {
+		t.Fatalf("批量存储失败: %v", err)
+	}
+	if err := store.StoreVector("extra", vectors["vec-00010"]); err != nil {
+		t.Fatalf("存储向量失败: %v", err)
+	}
+	if err := store.DeleteVector("vec-00010"); err != nil {
+		t.Fatalf("删除向量失败: %v", err)
+	}
+
+	results, err := store.SearchSimilar(vectors["vec-00010"], 1, 0.5)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "extra" {
+		t.Errorf("ANN 搜索应命中 extra, 实际 %v", results)
+	}
+
+	stats, _ := store.GetVectorStats()
+	if !stats.IndexReady || stats.IndexedVectors != 300 {
+		t.Errorf("索引状态不正确: %+v", stats)
+	}
+	store.Close()
+
+	if _, err := os.Stat(dbPath + ".hnsw"); err != nil {
+		t.Fatalf("关闭时应持久化索引: %v", err)
+	}
+
+	// 重新打开时直接加载索引文件
+	store, err = NewSQLiteVectorStore(dbPath, "test", dim)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	stats, _ = store.GetVectorStats()
+	if !stats.IndexReady || stats.IndexedVectors != 300 {
+		t.Errorf("应从文件加载索引: %+v", stats)
+	}
+	store.Close()
+
+	// 索引文件过期时后台重建
+	os.WriteFile(dbPath+".hnsw", []byte("corrupted"), 0644)
+	store, err = NewSQLiteVectorStore(dbPath, "test", dim)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer store.Close()
+	store.SetANNThreshold(0)
+	store.WaitANNReady()
+
+	results, err = store.SearchSimilar(vectors["vec-00020"], 1, 0.5)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "vec-00020" {
+		t.Errorf("重建后应命中 vec-00020, 实际 %v", results)
+	}
+}
+
+func TestSQLiteVectorStore_ANNMultiProcess(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "vectors.db")
+	const dim = 16
+
+	open := func() *SQLiteVectorStore {
+		store, err := NewSQLiteVectorStore(dbPath, "test", dim)
+		if err != nil {
+			t.Fatalf("创建向量存储失败: %v", err)
+		}
+		store.SetANNThreshold(0)
+		store.WaitANNReady()
+		return store
+	}
+
+	vectors := randomVectors(50, dim, 5)
+	first := open()
+	if err := first.BatchStoreVectors(vectors); err != nil {
+		t.Fatalf("批量存储失败: %v", err)
+	}
+
+	// 两个进程同时打开，交替写入
+	a, b := first, open()
+	extra := randomVectors(2, dim, 6)
+	if err := a.StoreVector("from-a", extra["vec-00000"]); err != nil {
+		t.Fatalf("存储向量失败: %v", err)
+	}
+	if err := b.StoreVector("from-b", extra["vec-00001"]); err != nil {
+		t.Fatalf("存储向量失败: %v", err)
+	}
+
+	// 索引落后于数据库时不能漏掉其他进程写入的向量
+	results, err := a.SearchSimilar(extra["vec-00001"], 1, 0.5)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "from-b" {
+		t.Errorf("应命中其他进程写入的 from-b, 实际 %v", results)
+	}
+	a.WaitANNReady()
+	a.Close()
+
+	// b 的索引不含 from-a，持久化的版本号不能声称已是最新
+	b.Close()
+	c := open()
+	defer c.Close()
+	results, err = c.SearchSimilar(extra["vec-00000"], 1, 0.5)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "from-a" {
+		t.Errorf("重新打开后应命中 from-a, 实际 %v", results)
+	}
+}
+
+func TestSQLiteVectorStore_Reembed(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "vectors.db")
+
+	store, err := NewSQLiteVectorStore(dbPath, "old-model", 3)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	store.StoreVector("a", []float32{1, 0, 0})
+	store.StoreVector("b", []float32{0, 1, 0})
+	store.Close()
+
+	// 切换到不同维度的模型
+	store, err = NewSQLiteVectorStore(dbPath, "new-model", 4)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer store.Close()
+
+	if !store.NeedsReembed() {
+		t.Fatal("模型变化后应需要重建")
+	}
+	if store.Space() != (VectorSpace{Model: "old-model", Dimension: 3}) {
+		t.Errorf("应保留旧向量空间, 实际 %+v", store.Space())
+	}
+	if _, err := store.SearchSimilar([]float32{1, 0, 0, 0}, 5, 0); err != ErrVectorSpace {
+		t.Errorf("空间不一致时搜索应返回 ErrVectorSpace, 实际 %v", err)
+	}
+	if count, _ := store.GetVectorCount(); count != 2 {
+		t.Errorf("重建前旧向量应保留, 实际 %d", count)
+	}
+
+	// 重建期间的新写入进入影子表
+	if err := store.StoreVector("c", []float32{0, 0, 1, 0}); err != nil {
+		t.Fatalf("存储新向量失败: %v", err)
+	}
+	if v, err := store.GetVector("c"); err != nil || len(v) != 4 {
+		t.Errorf("应能读取新空间向量: %v", err)
+	}
+	store.StoreVector("gone", []float32{0, 0, 0, 1})
+
+	// 开始重建时清空影子表，只保留本次重建写入的向量
+	if err := store.BeginReembed(); err != nil {
+		t.Fatalf("开始重建失败: %v", err)
+	}
+	if err := store.StoreReembedded(map[string][]float32{
+		"a": {1, 0, 0, 0},
+		"b": {0, 1, 0, 0},
+		"c": {0, 0, 1, 0},
+	}); err != nil {
+		t.Fatalf("写入重建向量失败: %v", err)
+	}
+	if err := store.CommitReembed(); err != nil {
+		t.Fatalf("提交重建失败: %v", err)
+	}
+
+	if store.NeedsReembed() {
+		t.Error("重建后不应再需要重建")
+	}
+	results, err := store.SearchSimilar([]float32{0, 0, 1, 0}, 1, 0.5)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "c" {
+		t.Errorf("重建后应命中 c, 实际 %v", results)
+	}
+	if count, _ := store.GetVectorCount(); count != 3 {
+		t.Errorf("重建后应有 3 条向量, 实际 %d", count)
+	}
+	if _, err := store.GetVector("gone"); err == nil {
+		t.Error("重建前残留在影子表中的向量不应保留")
+	}
+
+	stats, _ := store.GetVectorStats()
+	if stats.Model != "new-model" || stats.Dimension != 4 || stats.NeedsReembed {
+		t.Errorf("统计信息不正确: %+v", stats)
+	}
+}
+
+func TestSQLiteVectorStore_AbortReembed(t *testing.T) {
+	store, err := NewSQLiteVectorStore(filepath.Join(t.TempDir(), "vectors.db"), "model", 3)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer store.Close()
+
+	store.StoreVector("a", []float32{1, 0, 0})
+	if err := store.BeginReembed(); err != nil {
+		t.Fatalf("开始重建失败: %v", err)
+	}
+	store.StoreReembedded(map[string][]float32{"a": {0, 1, 0}})
+	store.AbortReembed()
+
+	v, err := store.GetVector("a")
+	if err != nil || v[0] != 1 {
+		t.Errorf("放弃重建后旧向量应保持不变: %v %v", v, err)
+	}
+	if err := store.BeginReembed(); err != nil {
+		t.Errorf("放弃后应可重新开始重建: %v", err)
+	}
+}
+
+func BenchmarkSQLiteVectorStore_Search(b *testing.B) {
+	const dim = 256
+	store, err := NewSQLiteVectorStore(filepath.Join(b.TempDir(), "vectors.db"), "test", dim)
+	if err != nil {
+		b.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer store.Close()
+	store.WaitANNReady()
+
+	if err := store.BatchStoreVectors(randomVectors(5000, dim, 5)); err != nil {
+		b.Fatalf("批量存储失败: %v", err)
+	}
+	query := randomVectors(1, dim, 6)["vec-00000"]
+
+	b.Run("ann", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchSimilar(query, 10, 0)
+		}
+	})
+	b.Run("exact", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchExact(query, 10, 0)
+		}
+	})
+}
+
 // ========== Mock Embedding 测试 ==========
 
 func TestMockEmbeddingClient(t *testing.T) {
@@ -505,6 +901,258 @@ func TestMockEmbeddingClient(t *testing.T) {
 	}
 }
 
+// ========== 本地 Embedding 测试 ==========
+
+func TestLocalEmbeddingClient(t *testing.T) {
+	ctx := context.Background()
+	client := NewLocalEmbeddingClient(256)
+
+	if client.GetDimension() != 256 {
+		t.Errorf("维度应为 256，实际为 %d", client.GetDimension())
+	}
+	if NewLocalEmbeddingClient(0).GetDimension() != defaultLocalEmbeddingDimension {
+		t.Error("维度为 0 时应使用默认维度")
+	}
+
+	// 确定性
+	vec1, _ := client.Embed(ctx, "The project uses SQLite for storage")
+	vec2, _ := client.Embed(ctx, "The project uses SQLite for storage")
+	if CosineSimilarity(vec1, vec2) < 0.9999 {
+		t.Error("相同文本应生成相同向量")
+	}
+	if norm := calculateNorm(vec1); norm < 0.999 || norm > 1.001 {
+		t.Errorf("向量应归一化，实际范数为 %f", norm)
+	}
+
+	// 相关文本相似度高于无关文本
+	related, _ := client.Embed(ctx, "We store project data in a SQLite database")
+	unrelated, _ := client.Embed(ctx, "My favourite fruit is mango")
+	if CosineSimilarity(vec1, related) <= CosineSimilarity(vec1, unrelated) {
+		t.Errorf("相关文本相似度应更高: related=%.3f unrelated=%.3f",
+			CosineSimilarity(vec1, related), CosineSimilarity(vec1, unrelated))
+	}
+
+	// 中文
+	zh1, _ := client.Embed(ctx, "我喜欢使用 Go 语言编写后端服务")
+	zh2, _ := client.Embed(ctx, "后端服务用 Go 语言开发")
+	zh3, _ := client.Embed(ctx, "今天天气很好，适合去公园散步")
+	if CosineSimilarity(zh1, zh2) <= CosineSimilarity(zh1, zh3) {
+		t.Errorf("中文相关文本相似度应更高: related=%.3f unrelated=%.3f",
+			CosineSimilarity(zh1, zh2), CosineSimilarity(zh1, zh3))
+	}
+
+	// 空文本返回零向量
+	empty, err := client.Embed(ctx, "")
+	if err != nil || len(empty) != 256 || calculateNorm(empty) != 0 {
+		t.Error("空文本应返回零向量")
+	}
+}
+
+func TestLocalEmbeddingClient_SemanticSearch(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "local-embedding-test-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Embedding.Provider = "local"
+	cfg.Embedding.Dimension = 256
+
+	client := NewEmbeddingClient(&cfg.Embedding, "")
+	if _, ok := client.(*LocalEmbeddingClient); !ok {
+		t.Fatalf("provider=local 应创建本地客户端，实际为 %T", client)
+	}
+
+	vectorStore, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "vectors.db"), cfg.Embedding.ModelID(), cfg.Embedding.Dimension)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer vectorStore.Close()
+
+	mgr := NewEmbeddingManager(client, vectorStore, nil, &cfg.Embedding)
+	ctx := context.Background()
+
+	docs := map[string]string{
+		"db":    "项目使用 SQLite 数据库存储索引",
+		"lang":  "后端代码使用 Go 语言编写",
+		"style": "用户喜欢简洁的回答风格",
+	}
+	if err := mgr.EmbedBatchAndStore(ctx, docs); err != nil {
+		t.Fatalf("批量存储失败: %v", err)
+	}
+
+	queryVec, _ := client.Embed(ctx, "SQLite 数据库")
+	results, err := vectorStore.SearchSimilar(queryVec, 1, 0)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "db" {
+		t.Errorf("最相似的应为 db 记忆，实际为 %+v", results)
+	}
+}
+
+// flakyEmbeddingClient 可模拟离线并统计调用次数的客户端
+type flakyEmbeddingClient struct {
+	*MockEmbeddingClient
+	offline bool
+	calls   int
+}
+
+func (c *flakyEmbeddingClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	c.calls++
+	if c.offline {
+		return nil, fmt.Errorf("network unreachable")
+	}
+	return c.MockEmbeddingClient.Embed(ctx, text)
+}
+
+func (c *flakyEmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	c.calls++
+	if c.offline {
+		return nil, fmt.Errorf("network unreachable")
+	}
+	return c.MockEmbeddingClient.EmbedBatch(ctx, texts)
+}
+
+func TestEmbeddingManager_PersistentQueueAndCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := DefaultMemoryConfig()
+	cfg.Embedding.Dimension = 8
+
+	vectorStore, err := NewSQLiteVectorStore(filepath.Join(tmpDir, "vectors.db"), "test", 8)
+	if err != nil {
+		t.Fatalf("创建向量存储失败: %v", err)
+	}
+	defer vectorStore.Close()
+
+	store, err := NewSQLiteEmbeddingStore(filepath.Join(tmpDir, "embeddings.db"))
+	if err != nil {
+		t.Fatalf("创建 embedding 存储失败: %v", err)
+	}
+
+	client := &flakyEmbeddingClient{MockEmbeddingClient: NewMockEmbeddingClient(8), offline: true}
+	mgr := NewEmbeddingManager(client, vectorStore, store, &cfg.Embedding)
+	ctx := context.Background()
+
+	// 离线时写入失败，任务进入持久化队列
+	if err := mgr.EmbedAndStore(ctx, "mem-1", "offline content"); err == nil {
+		t.Fatal("离线时应返回错误")
+	}
+	store.Close()
+
+	// 重新打开后队列仍在
+	store, err = NewSQLiteEmbeddingStore(filepath.Join(tmpDir, "embeddings.db"))
+	if err != nil {
+		t.Fatalf("重新打开 embedding 存储失败: %v", err)
+	}
+	defer store.Close()
+	mgr = NewEmbeddingManager(client, vectorStore, store, &cfg.Embedding)
+	if mgr.GetOfflineQueueSize() != 1 {
+		t.Fatalf("离线队列应持久化, 实际大小 %d", mgr.GetOfflineQueueSize())
+	}
+
+	// 未到重试时间时不处理
+	client.offline = false
+	if n, _ := mgr.ProcessOfflineQueue(ctx); n != 0 {
+		t.Errorf("退避期内不应重试, 实际处理 %d", n)
+	}
+
+	// 到期后重试成功并出队
+	tasks, _ := store.DueTasks(time.Now().Add(time.Hour), 10)
+	if len(tasks) != 1 || tasks[0].Attempts != 1 || tasks[0].LastError == "" {
+		t.Fatalf("任务状态不正确: %+v", tasks)
+	}
+	tasks[0].NextAttemptAt = time.Now().Add(-time.Second)
+	store.Enqueue(tasks[0])
+
+	if n, _ := mgr.ProcessOfflineQueue(ctx); n != 1 {
+		t.Errorf("应处理 1 个任务, 实际 %d", n)
+	}
+	if mgr.GetOfflineQueueSize() != 0 {
+		t.Error("成功后应出队")
+	}
+	if _, err := vectorStore.GetVector("mem-1"); err != nil {
+		t.Errorf("向量应已存储: %v", err)
+	}
+
+	// 内容不变时命中缓存，不再请求 API；新的管理器也能命中持久化缓存
+	calls := client.calls
+	mgr = NewEmbeddingManager(client, vectorStore, store, &cfg.Embedding)
+	if err := mgr.EmbedAndStore(ctx, "mem-2", "offline content"); err != nil {
+		t.Fatalf("存储失败: %v", err)
+	}
+	if err := mgr.EmbedBatchAndStore(ctx, map[string]string{"mem-3": "offline content"}); err != nil {
+		t.Fatalf("批量存储失败: %v", err)
+	}
+	if client.calls != calls {
+		t.Errorf("内容未变化不应调用 API, 新增调用 %d 次", client.calls-calls)
+	}
+
+	// 内容变化时重新请求
+	if err := mgr.EmbedAndStore(ctx, "mem-2", "changed content"); err != nil {
+		t.Fatalf("存储失败: %v", err)
+	}
+	if client.calls != calls+1 {
+		t.Errorf("内容变化应调用 API")
+	}
+}
+
+func TestEmbeddingCache_Limits(t *testing.T) {
+	store, err := NewSQLiteEmbeddingStore(filepath.Join(t.TempDir(), "embeddings.db"))
+	if err != nil {
+		t.Fatalf("创建 embedding 存储失败: %v", err)
+	}
+	defer store.Close()
+
+	// 超出上限时淘汰最久未使用的条目
+	store.SetCacheLimits(2, time.Hour)
+	store.PutCached("a", []float32{1})
+	store.PutCached("b", []float32{2})
+	if _, ok := store.GetCached("a"); !ok {
+		t.Fatal("a 应命中缓存")
+	}
+	store.PutCached("c", []float32{3})
+	if size, _ := store.CacheSize(); size != 2 {
+		t.Errorf("缓存条目数应为 2, 实际 %d", size)
+	}
+	if _, ok := store.GetCached("b"); ok {
+		t.Error("最久未使用的 b 应被淘汰")
+	}
+	if _, ok := store.GetCached("a"); !ok {
+		t.Error("最近使用过的 a 应保留")
+	}
+
+	// 超过 TTL 未使用的条目过期
+	store.SetCacheLimits(0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := store.GetCached("c"); ok {
+		t.Error("过期条目不应命中")
+	}
+
+	// 内存缓存同样按最近使用淘汰
+	cache := newVectorCache(2)
+	cache.put("a", []float32{1})
+	cache.put("b", []float32{2})
+	cache.get("a")
+	cache.put("c", []float32{3})
+	if _, ok := cache.get("b"); ok || cache.len() != 2 {
+		t.Errorf("内存缓存应淘汰 b, 实际条目数 %d", cache.len())
+	}
+}
+
+func TestEmbeddingRetryDelay(t *testing.T) {
+	if embeddingRetryDelay(1) != embeddingRetryBaseDelay {
+		t.Errorf("首次重试间隔应为基础间隔")
+	}
+	if embeddingRetryDelay(3) != 4*embeddingRetryBaseDelay {
+		t.Errorf("应按指数退避, 实际 %v", embeddingRetryDelay(3))
+	}
+	if embeddingRetryDelay(100) != embeddingRetryMaxDelay {
+		t.Errorf("重试间隔应有上限, 实际 %v", embeddingRetryDelay(100))
+	}
+}
+
 // ========== MarkdownFileStore 测试 ==========
 
 func TestMarkdownFileStore_CreateAndReadMemory(t *testing.T) {
@@ -582,20 +1230,206 @@ func TestMarkdownFileStore_UpdateMemory(t *testing.T) {
 		t.Fatalf("更新记忆失败: %v", err)
 	}
 
-	// 验证更新
-	readMem, err := fileStore.ReadMemory(mem.FilePath)
-	if err != nil {
-		t.Fatalf("读取记忆失败: %v", err)
+	// 验证更新
+	readMem, err := fileStore.ReadMemory(mem.FilePath)
+	if err != nil {
+		t.Fatalf("读取记忆失败: %v", err)
+	}
+
+	// 内容可能有尾部换行符的差异，使用 TrimSpace 比较
+	if strings.TrimSpace(readMem.Content) != strings.TrimSpace("更新后的内容") {
+		t.Errorf("内容未更新: %q", readMem.Content)
+	}
+}
+
+func TestMarkdownFileStore_DeleteMemory(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "filestore-delete-test-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+
+	// 创建记忆
+	mem := NewMemory(MemoryTypeCore, ScopeGlobal, CategoryRule, "待删除", "内容")
+	if err := fileStore.CreateMemory(mem); err != nil {
+		t.Fatalf("创建记忆失败: %v", err)
+	}
+
+	// 删除记忆
+	if err := fileStore.DeleteMemory(mem.FilePath); err != nil {
+		t.Fatalf("删除记忆失败: %v", err)
+	}
+
+	// 验证文件不存在
+	if FileExists(mem.FilePath) {
+		t.Error("删除后文件不应存在")
+	}
+}
+
+// ========== SessionManager 测试 ==========
+
+func TestSessionManager_CreateSession(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	dbPath := filepath.Join(tmpDir, "index.db")
+	index, err := NewSQLiteIndexStore(dbPath)
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
+
+	// 创建会话
+	sess, err := sessionMgr.CreateSession()
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	if sess.ID == "" {
+		t.Error("会话 ID 不应为空")
+	}
+
+	if sess.Status != StatusActive {
+		t.Error("会话状态应为 Active")
+	}
+
+	// 验证当前会话
+	current := sessionMgr.GetCurrentSession()
+	if current == nil {
+		t.Error("当前会话不应为 nil")
+	}
+
+	if current.ID != sess.ID {
+		t.Error("当前会话 ID 不匹配")
+	}
+}
+
+func TestSessionManager_AddMessage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-msg-test-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	dbPath := filepath.Join(tmpDir, "index.db")
+	index, err := NewSQLiteIndexStore(dbPath)
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
+
+	// 创建会话并添加消息
+	_, err = sessionMgr.CreateSession()
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	// 添加用户消息
+	err = sessionMgr.AddMessage("user", "你好", 10)
+	if err != nil {
+		t.Fatalf("添加用户消息失败: %v", err)
+	}
+
+	// 添加助手消息
+	err = sessionMgr.AddMessage("assistant", "你好！有什么可以帮助你的？", 20)
+	if err != nil {
+		t.Fatalf("添加助手消息失败: %v", err)
+	}
+
+	// 验证消息
+	messages := sessionMgr.GetMessages()
+	if len(messages) != 2 {
+		t.Errorf("消息数量应为 2，实际为 %d", len(messages))
+	}
+
+	if messages[0].Role != "user" {
+		t.Errorf("第一条消息角色应为 user，实际为 %s", messages[0].Role)
+	}
+}
+
+func TestSessionManager_TokenUsage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-token-test-*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := DefaultMemoryConfig()
+	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
+	cfg.Session.MaxTokens = 1000
+
+	storage, err := NewStorageManager(cfg)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+
+	fileStore := NewMarkdownFileStore(storage)
+	dbPath := filepath.Join(tmpDir, "index.db")
+	index, err := NewSQLiteIndexStore(dbPath)
+	if err != nil {
+		t.Fatalf("创建索引存储失败: %v", err)
+	}
+	defer index.Close()
+
+	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
+
+	_, _ = sessionMgr.CreateSession()
+	_ = sessionMgr.AddMessage("user", "消息1", 100)
+	_ = sessionMgr.AddMessage("assistant", "消息2", 200)
+
+	current, max, ratio := sessionMgr.GetTokenUsage()
+
+	if current != 300 {
+		t.Errorf("当前 Token 数应为 300，实际为 %d", current)
+	}
+
+	if max != 1000 {
+		t.Errorf("最大 Token 数应为 1000，实际为 %d", max)
 	}
 
-	// 内容可能有尾部换行符的差异，使用 TrimSpace 比较
-	if strings.TrimSpace(readMem.Content) != strings.TrimSpace("更新后的内容") {
-		t.Errorf("内容未更新: %q", readMem.Content)
+	expectedRatio := 0.3
+	if ratio < expectedRatio-0.01 || ratio > expectedRatio+0.01 {
+		t.Errorf("Token 使用比例应约为 0.3，实际为 %.2f", ratio)
 	}
 }
 
-func TestMarkdownFileStore_DeleteMemory(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "filestore-delete-test-*")
+func TestMarkdownFileStore_SessionMessagesRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-parse-test-*")
 	if err != nil {
 		t.Fatalf("创建临时目录失败: %v", err)
 	}
@@ -610,28 +1444,40 @@ func TestMarkdownFileStore_DeleteMemory(t *testing.T) {
 	}
 
 	fileStore := NewMarkdownFileStore(storage)
-
-	// 创建记忆
-	mem := NewMemory(MemoryTypeCore, ScopeGlobal, CategoryRule, "待删除", "内容")
-	if err := fileStore.CreateMemory(mem); err != nil {
-		t.Fatalf("创建记忆失败: %v", err)
+	sess := &Session{Status: StatusActive}
+	if err := fileStore.CreateSession(sess); err != nil {
+		t.Fatalf("创建会话失败: %v", err)
 	}
 
-	// 删除记忆
-	if err := fileStore.DeleteMemory(mem.FilePath); err != nil {
-		t.Fatalf("删除记忆失败: %v", err)
+	_ = fileStore.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "user", Content: "第一行\n\n第二行"})
+	_ = fileStore.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "assistant", Content: "回复"})
+	_ = fileStore.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "assistant", ToolCalls: `[{"id":"call_1","function":{"arguments":"{\"cmd\":\"echo --> done\"}"}}]`})
+	_ = fileStore.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "tool", ToolCallID: "call_1", Content: "done"})
+
+	_, messages, err := fileStore.ReadSession(sess.FilePath)
+	if err != nil {
+		t.Fatalf("读取会话失败: %v", err)
 	}
 
-	// 验证文件不存在
-	if FileExists(mem.FilePath) {
-		t.Error("删除后文件不应存在")
+	if len(messages) != 4 {
+		t.Fatalf("消息数量应为 4，实际为 %d", len(messages))
+	}
+	if messages[0].Role != "user" || messages[0].Content != "第一行\n\n第二行" {
+		t.Errorf("第一条消息解析错误: %+v", messages[0])
+	}
+	if messages[1].Sequence != 2 || messages[1].Role != "assistant" {
+		t.Errorf("第二条消息解析错误: %+v", messages[1])
+	}
+	if messages[2].ToolCalls != `[{"id":"call_1","function":{"arguments":"{\"cmd\":\"echo --> done\"}"}}]` || messages[2].Content != "" {
+		t.Errorf("工具调用元数据应保留: %+v", messages[2])
+	}
+	if messages[3].ToolCallID != "call_1" || messages[3].Content != "done" {
+		t.Errorf("工具结果的调用 ID 应保留: %+v", messages[3])
 	}
 }
 
-// ========== SessionManager 测试 ==========
-
-func TestSessionManager_CreateSession(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "session-test-*")
+func TestSessionManager_ForkAndTree(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-fork-test-*")
 	if err != nil {
 		t.Fatalf("创建临时目录失败: %v", err)
 	}
@@ -646,8 +1492,7 @@ func TestSessionManager_CreateSession(t *testing.T) {
 	}
 
 	fileStore := NewMarkdownFileStore(storage)
-	dbPath := filepath.Join(tmpDir, "index.db")
-	index, err := NewSQLiteIndexStore(dbPath)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
 	if err != nil {
 		t.Fatalf("创建索引存储失败: %v", err)
 	}
@@ -655,33 +1500,65 @@ func TestSessionManager_CreateSession(t *testing.T) {
 
 	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
 
-	// 创建会话
-	sess, err := sessionMgr.CreateSession()
+	parent, err := sessionMgr.CreateSession()
 	if err != nil {
 		t.Fatalf("创建会话失败: %v", err)
 	}
+	_ = sessionMgr.AddMessage("user", "消息1", 10)
+	_ = sessionMgr.AddMessage("assistant", "消息2", 10)
+	_ = sessionMgr.AddMessage("user", "消息3", 10)
 
-	if sess.ID == "" {
-		t.Error("会话 ID 不应为空")
+	if _, err := sessionMgr.ForkSession(9); err == nil {
+		t.Error("不存在的序号应返回错误")
 	}
 
-	if sess.Status != StatusActive {
-		t.Error("会话状态应为 Active")
+	fork, err := sessionMgr.ForkSession(2)
+	if err != nil {
+		t.Fatalf("分支会话失败: %v", err)
 	}
 
-	// 验证当前会话
-	current := sessionMgr.GetCurrentSession()
-	if current == nil {
-		t.Error("当前会话不应为 nil")
+	if fork.ParentID != parent.ID || fork.ForkSequence != 2 {
+		t.Errorf("分支会话父信息错误: parent=%s seq=%d", fork.ParentID, fork.ForkSequence)
+	}
+	if sessionMgr.GetCurrentSession().ID != fork.ID {
+		t.Error("当前会话应切换到分支会话")
+	}
+	if len(sessionMgr.GetMessages()) != 2 {
+		t.Errorf("分支会话消息数应为 2，实际为 %d", len(sessionMgr.GetMessages()))
+	}
+	if fork.TokenCount != 20 {
+		t.Errorf("分支会话 token 数应为复制消息之和 20，实际为 %d", fork.TokenCount)
+	}
+	parentSess, _, err := fileStore.ReadSession(parent.FilePath)
+	if err != nil || parentSess.Status != StatusActive {
+		t.Errorf("父会话应保持活跃: %v", err)
 	}
 
-	if current.ID != sess.ID {
-		t.Error("当前会话 ID 不匹配")
+	// 重新加载分支会话，验证文件内容
+	if err := sessionMgr.LoadSession(fork.ID); err != nil {
+		t.Fatalf("加载分支会话失败: %v", err)
+	}
+	if sessionMgr.GetCurrentSession().ParentID != parent.ID {
+		t.Error("分支会话文件应记录父会话 ID")
+	}
+	if len(sessionMgr.GetMessages()) != 2 {
+		t.Errorf("加载后消息数应为 2，实际为 %d", len(sessionMgr.GetMessages()))
+	}
+
+	roots, err := sessionMgr.BuildSessionTree()
+	if err != nil {
+		t.Fatalf("构建会话树失败: %v", err)
+	}
+	if len(roots) != 1 || roots[0].Session.ID != parent.ID {
+		t.Fatalf("会话树根节点应为父会话")
+	}
+	if len(roots[0].Children) != 1 || roots[0].Children[0].Session.ID != fork.ID {
+		t.Error("父会话应有一个分支子节点")
 	}
 }
 
-func TestSessionManager_AddMessage(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "session-msg-test-*")
+func TestSessionManager_SearchHistory(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-search-test-*")
 	if err != nil {
 		t.Fatalf("创建临时目录失败: %v", err)
 	}
@@ -696,8 +1573,7 @@ func TestSessionManager_AddMessage(t *testing.T) {
 	}
 
 	fileStore := NewMarkdownFileStore(storage)
-	dbPath := filepath.Join(tmpDir, "index.db")
-	index, err := NewSQLiteIndexStore(dbPath)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
 	if err != nil {
 		t.Fatalf("创建索引存储失败: %v", err)
 	}
@@ -705,37 +1581,58 @@ func TestSessionManager_AddMessage(t *testing.T) {
 
 	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
 
-	// 创建会话并添加消息
-	_, err = sessionMgr.CreateSession()
-	if err != nil {
-		t.Fatalf("创建会话失败: %v", err)
-	}
+	sess, _ := sessionMgr.CreateSession()
+	_ = sessionMgr.AddMessage("user", "我们用 PostgreSQL 还是 SQLite 做存储？", 10)
+	_ = sessionMgr.AddMessage("assistant", "本地工具建议使用 SQLite", 10)
+	_ = sessionMgr.AddMessage("user", "好的，再聊聊部署", 10)
 
-	// 添加用户消息
-	err = sessionMgr.AddMessage("user", "你好", 10)
+	hits, err := sessionMgr.SearchHistory("sqlite", 10)
 	if err != nil {
-		t.Fatalf("添加用户消息失败: %v", err)
+		t.Fatalf("搜索历史失败: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("应命中 2 条消息，实际为 %d", len(hits))
+	}
+	for _, hit := range hits {
+		if hit.SessionID != sess.ID {
+			t.Errorf("会话 ID 错误: %s", hit.SessionID)
+		}
+		if !strings.Contains(hit.Snippet, "[SQLite]") {
+			t.Errorf("片段应标记关键词，实际为 %s", hit.Snippet)
+		}
 	}
 
-	// 添加助手消息
-	err = sessionMgr.AddMessage("assistant", "你好！有什么可以帮助你的？", 20)
-	if err != nil {
-		t.Fatalf("添加助手消息失败: %v", err)
+	// 多个关键词需同时匹配
+	hits, _ = sessionMgr.SearchHistory("SQLite PostgreSQL", 10)
+	if len(hits) != 1 || hits[0].Sequence != 1 {
+		t.Errorf("多关键词应只命中第 1 条消息，实际为 %d 条", len(hits))
 	}
 
-	// 验证消息
-	messages := sessionMgr.GetMessages()
-	if len(messages) != 2 {
-		t.Errorf("消息数量应为 2，实际为 %d", len(messages))
+	// 中文子串：不少于 3 个字走 trigram 索引，更短的词走 LIKE
+	if index.ftsEnabled && !index.sessionFTS {
+		t.Error("FTS5 可用时会话消息应使用 trigram 索引")
+	}
+	hits, _ = sessionMgr.SearchHistory("建议使用", 10)
+	if len(hits) != 1 || hits[0].Sequence != 2 {
+		t.Errorf("中文子串应命中第 2 条消息，实际为 %+v", hits)
+	}
+	hits, _ = sessionMgr.SearchHistory("部署", 10)
+	if len(hits) != 1 || hits[0].Sequence != 3 {
+		t.Errorf("两个汉字的词应命中第 3 条消息，实际为 %+v", hits)
 	}
 
-	if messages[0].Role != "user" {
-		t.Errorf("第一条消息角色应为 user，实际为 %s", messages[0].Role)
+	// 清空会话后索引同步删除
+	if err := sessionMgr.ClearMessages(); err != nil {
+		t.Fatalf("清空消息失败: %v", err)
+	}
+	hits, _ = sessionMgr.SearchHistory("sqlite", 10)
+	if len(hits) != 0 {
+		t.Errorf("清空后不应命中，实际为 %d 条", len(hits))
 	}
 }
 
-func TestSessionManager_TokenUsage(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "session-token-test-*")
+func TestSessionManager_TruncateMessages(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "session-truncate-test-*")
 	if err != nil {
 		t.Fatalf("创建临时目录失败: %v", err)
 	}
@@ -743,7 +1640,6 @@ func TestSessionManager_TokenUsage(t *testing.T) {
 
 	cfg := DefaultMemoryConfig()
 	cfg.Storage.GlobalRoot = filepath.Join(tmpDir, "global")
-	cfg.Session.MaxTokens = 1000
 
 	storage, err := NewStorageManager(cfg)
 	if err != nil {
@@ -751,8 +1647,7 @@ func TestSessionManager_TokenUsage(t *testing.T) {
 	}
 
 	fileStore := NewMarkdownFileStore(storage)
-	dbPath := filepath.Join(tmpDir, "index.db")
-	index, err := NewSQLiteIndexStore(dbPath)
+	index, err := NewSQLiteIndexStore(filepath.Join(tmpDir, "index.db"))
 	if err != nil {
 		t.Fatalf("创建索引存储失败: %v", err)
 	}
@@ -760,23 +1655,68 @@ func TestSessionManager_TokenUsage(t *testing.T) {
 
 	sessionMgr := NewSessionManager(storage, fileStore, index, cfg)
 
-	_, _ = sessionMgr.CreateSession()
-	_ = sessionMgr.AddMessage("user", "消息1", 100)
-	_ = sessionMgr.AddMessage("assistant", "消息2", 200)
+	sess, _ := sessionMgr.CreateSession()
+	_ = sessionMgr.AddMessage("user", "问题一", 10)
+	_ = sessionMgr.AddMessage("assistant", "回答一", 10)
+	_ = sessionMgr.AddMessage("user", "问题二", 10)
+	_ = sessionMgr.AddToolMessage(`[{"id":"call_1"}]`, "", "", 10)
+	_ = sessionMgr.AddToolMessage("", "call_1", "工具结果", 10)
+	_ = sessionMgr.AddMessage("assistant", "回答二", 10)
 
-	current, max, ratio := sessionMgr.GetTokenUsage()
+	last := sessionMgr.LastUserMessage()
+	if last == nil || last.Content != "问题二" || last.Sequence != 3 {
+		t.Fatalf("最后一条用户消息错误: %+v", last)
+	}
 
-	if current != 300 {
-		t.Errorf("当前 Token 数应为 300，实际为 %d", current)
+	// 删除最后一轮回复（含工具消息）
+	if err := sessionMgr.TruncateMessages(last.Sequence + 1); err != nil {
+		t.Fatalf("截断消息失败: %v", err)
+	}
+	if len(sessionMgr.GetMessages()) != 3 {
+		t.Errorf("截断后消息数应为 3，实际为 %d", len(sessionMgr.GetMessages()))
+	}
+	if sess.TokenCount != 30 {
+		t.Errorf("截断后 Token 数应为 30，实际为 %d", sess.TokenCount)
 	}
 
-	if max != 1000 {
-		t.Errorf("最大 Token 数应为 1000，实际为 %d", max)
+	_, fileMessages, err := fileStore.ReadSession(sess.FilePath)
+	if err != nil {
+		t.Fatalf("读取会话失败: %v", err)
+	}
+	if len(fileMessages) != 3 {
+		t.Errorf("会话文件消息数应为 3，实际为 %d", len(fileMessages))
 	}
 
-	expectedRatio := 0.3
-	if ratio < expectedRatio-0.01 || ratio > expectedRatio+0.01 {
-		t.Errorf("Token 使用比例应约为 0.3，实际为 %.2f", ratio)
+	hits, _ := sessionMgr.SearchHistory("工具结果", 10)
+	if len(hits) != 0 {
+		t.Error("被删除的消息不应出现在历史索引中")
+	}
+
+	// 新消息序号接续
+	_ = sessionMgr.AddMessage("assistant", "新回答", 10)
+	msgs := sessionMgr.GetMessages()
+	if msgs[len(msgs)-1].Sequence != 4 {
+		t.Errorf("新消息序号应为 4，实际为 %d", msgs[len(msgs)-1].Sequence)
+	}
+
+	// 其他进程追加消息后截断：以文件内容为准，不返回 ErrSessionModified
+	other := NewMarkdownFileStore(storage)
+	if err := other.AppendSessionMessage(sess.FilePath, &SessionMessage{Role: "user", Content: "另一个终端"}); err != nil {
+		t.Fatalf("追加消息失败: %v", err)
+	}
+	if err := sessionMgr.TruncateMessages(4); err != nil {
+		t.Fatalf("外部修改后截断失败: %v", err)
+	}
+	_, fileMessages, _ = fileStore.ReadSession(sess.FilePath)
+	if len(fileMessages) != 3 || len(sessionMgr.GetMessages()) != 3 {
+		t.Errorf("截断后应保留 3 条消息，文件 %d 条，内存 %d 条", len(fileMessages), len(sessionMgr.GetMessages()))
+	}
+	kept := 0
+	for _, msg := range sessionMgr.GetMessages() {
+		kept += msg.TokenCount
+	}
+	if sessionMgr.GetCurrentSession().TokenCount != kept {
+		t.Errorf("截断后 Token 数应为保留消息之和 %d，实际为 %d", kept, sessionMgr.GetCurrentSession().TokenCount)
 	}
 }
 
@@ -1253,6 +2193,173 @@ func TestDefaultRetrievalOptions(t *testing.T) {
 	}
 }
 
+// rankedResults 按给定分数构造检索结果
+func rankedResults(matchType string, items map[string]float64) []*MemorySearchResult {
+	var results []*MemorySearchResult
+	for id, score := range items {
+		mem := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, id, "内容 "+id)
+		mem.ID = id
+		results = append(results, &MemorySearchResult{Memory: mem, Score: score, MatchType: matchType})
+	}
+	sortResults(results)
+	return results
+}
+
+func TestFuseResults_RRF(t *testing.T) {
+	cfg := DefaultMemoryConfig().Retrieval
+
+	// 关键词分数尺度远大于向量分数，RRF 只看名次
+	vector := rankedResults("vector", map[string]float64{"a": 0.9, "b": 0.8, "c": 0.7})
+	keyword := rankedResults("keyword", map[string]float64{"b": 1.0, "d": 0.9})
+
+	results := fuseResults(FusionRRF, &cfg, vector, keyword)
+	sortResults(results)
+
+	if len(results) != 4 {
+		t.Fatalf("融合后应有 4 条结果，实际 %d", len(results))
+	}
+	if results[0].Memory.ID != "b" {
+		t.Errorf("两路都命中的结果应排第一，实际 %s", results[0].Memory.ID)
+	}
+	if results[0].MatchType != "hybrid" {
+		t.Errorf("两路都命中应标记为 hybrid，实际 %s", results[0].MatchType)
+	}
+
+	exp := results[0].Explanation
+	if exp.VectorRank != 2 || exp.KeywordRank != 1 {
+		t.Errorf("名次记录错误: 向量 #%d, 关键词 #%d", exp.VectorRank, exp.KeywordRank)
+	}
+	if results[0].Score <= 0 || results[0].Score > 1 {
+		t.Errorf("RRF 分数应归一化到 0-1，实际 %f", results[0].Score)
+	}
+}
+
+func TestFuseResults_Weighted(t *testing.T) {
+	cfg := DefaultMemoryConfig().Retrieval
+	cfg.VectorWeight = 0.5
+
+	vector := rankedResults("vector", map[string]float64{"a": 0.9, "b": 0.5})
+	keyword := rankedResults("keyword", map[string]float64{"b": 0.3, "c": 0.1})
+
+	results := fuseResults(FusionWeighted, &cfg, vector, keyword)
+	scores := make(map[string]float64)
+	for _, r := range results {
+		scores[r.Memory.ID] = r.Score
+	}
+
+	// a: 0.5×1；b: 0.5×0 + 0.5×1；c: 0.5×0
+	if math.Abs(scores["a"]-0.5) > 1e-9 || math.Abs(scores["b"]-0.5) > 1e-9 || scores["c"] != 0 {
+		t.Errorf("加权融合分数错误: %v", scores)
+	}
+}
+
+func TestParseRerankScores(t *testing.T) {
+	scores, err := parseRerankScores("相关性评分如下：\n[10, 5, 0, 12]", 4)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	expected := []float64{1, 0.5, 0, 1}
+	for i, s := range scores {
+		if math.Abs(s-expected[i]) > 1e-9 {
+			t.Errorf("分数 %d 应为 %f，实际 %f", i, expected[i], s)
+		}
+	}
+
+	if _, err := parseRerankScores("[1, 2]", 3); err == nil {
+		t.Error("数量不匹配应返回错误")
+	}
+	if _, err := parseRerankScores("无法评分", 1); err == nil {
+		t.Error("格式错误应返回错误")
+	}
+}
+
+func TestParseMergeReply(t *testing.T) {
+	title, content, err := parseMergeReply("```json\n{\"title\": \"技术栈\", \"content\": \"Go + SQLite\"}\n```")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if title != "技术栈" || content != "Go + SQLite" {
+		t.Errorf("解析结果错误: %q %q", title, content)
+	}
+
+	if _, _, err := parseMergeReply(`{"title": "", "content": "x"}`); err == nil {
+		t.Error("缺少标题应返回错误")
+	}
+}
+
+func TestParseReflectionItems(t *testing.T) {
+	items, err := parseReflectionItems(`提取结果：[{"kind": "Fact", "title": "构建工具", "content": "使用 make 构建", "tags": ["build"]}, {"kind": "fact", "title": "", "content": "缺少标题"}]`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(items) != 1 || items[0].Kind != "fact" || items[0].Tags[0] != "build" {
+		t.Errorf("解析结果错误: %+v", items)
+	}
+
+	if items, err := parseReflectionItems("[]"); err != nil || len(items) != 0 {
+		t.Errorf("空数组应解析为空结果: %v %v", items, err)
+	}
+}
+
+func TestRerankResults(t *testing.T) {
+	results := rankedResults("vector", map[string]float64{"a": 0.9, "b": 0.8, "c": 0.7})
+	for _, r := range results {
+		r.Explanation = &ScoreExplanation{}
+	}
+
+	// 重排序只作用于前两条
+	rerank := NewLLMReranker(func(ctx context.Context, prompt string) (string, error) {
+		return "[2, 9]", nil
+	})
+	reranked := rerankResults(context.Background(), rerank, "查询", results, 2)
+
+	order := []string{reranked[0].Memory.ID, reranked[1].Memory.ID, reranked[2].Memory.ID}
+	if strings.Join(order, ",") != "b,a,c" {
+		t.Errorf("重排序后顺序应为 b,a,c，实际 %v", order)
+	}
+	if !reranked[0].Explanation.Reranked || reranked[2].Explanation.Reranked {
+		t.Error("应只标记参与重排序的结果")
+	}
+
+	// 重排序失败时保持原顺序
+	failing := func(ctx context.Context, query string, candidates []string) ([]float64, error) {
+		return nil, fmt.Errorf("模型不可用")
+	}
+	kept := rerankResults(context.Background(), failing, "查询", reranked, 3)
+	if kept[0].Memory.ID != "b" {
+		t.Error("重排序失败时应保持原顺序")
+	}
+}
+
+func TestDiversifyMMR(t *testing.T) {
+	newResult := func(id, content string, score float64) *MemorySearchResult {
+		mem := NewMemory(MemoryTypeLongTerm, ScopeGlobal, CategoryKnowledge, "", content)
+		mem.ID = id
+		return &MemorySearchResult{Memory: mem, Score: score, Explanation: &ScoreExplanation{}}
+	}
+
+	duplicate := "项目使用 Go 1.21 和 SQLite 存储索引，向量检索基于 HNSW"
+	results := []*MemorySearchResult{
+		newResult("a", duplicate, 1.0),
+		newResult("b", duplicate+"。", 0.95),
+		newResult("c", "用户偏好使用中文回复，代码注释保持简洁", 0.8),
+	}
+
+	diversified := diversifyMMR(results, 2, 0.5)
+	if len(diversified) != 2 {
+		t.Fatalf("应返回 2 条结果，实际 %d", len(diversified))
+	}
+	if diversified[0].Memory.ID != "a" || diversified[1].Memory.ID != "c" {
+		t.Errorf("MMR 应跳过近似重复的结果，实际 %s,%s", diversified[0].Memory.ID, diversified[1].Memory.ID)
+	}
+
+	// lambda 为 0 时不做多样化
+	plain := diversifyMMR(results, 2, 0)
+	if plain[1].Memory.ID != "b" {
+		t.Error("关闭 MMR 时应保持原顺序")
+	}
+}
+
 // ========== 辅助函数测试 ==========
 
 func TestSanitizeFileName(t *testing.T) {
@@ -1328,3 +2435,176 @@ func TestMockEmbeddingClient_EmbedBatch(t *testing.T) {
 		}
 	}
 }
+
+func TestParseClassification(t *testing.T) {
+	result, err := parseClassification("```json\n{\"should_store\": true, \"type\": \"long_term\", \"category\": \"decision\", \"scope\": \"project\", \"title\": \"选用 SQLite\", \"tags\": [\"db\"], \"importance\": 9, \"confidence\": 0.8}\n```")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if !result.ShouldStore || result.MemoryType != MemoryTypeLongTerm || result.Category != CategoryDecision {
+		t.Errorf("解析结果错误: %+v", result)
+	}
+	if result.Scope != ScopeProject || result.Importance != 3 || result.Confidence != 0.8 {
+		t.Errorf("作用域或重要性错误: %+v", result)
+	}
+
+	// 核心记忆始终为全局作用域
+	result, err = parseClassification(`{"should_store": true, "type": "core", "category": "rule", "scope": "project", "title": "规则", "confidence": 0.9}`)
+	if err != nil || result.Scope != ScopeGlobal {
+		t.Errorf("核心记忆应为全局作用域: %+v %v", result, err)
+	}
+
+	if _, err := parseClassification(`{"should_store": true, "type": "core", "category": "task"}`); err == nil {
+		t.Error("类型与分类不匹配应返回错误")
+	}
+
+	result, err = parseClassification(`{"should_store": false, "confidence": 0.9}`)
+	if err != nil || result.ShouldStore {
+		t.Errorf("无需存储的结果解析错误: %+v %v", result, err)
+	}
+}
+
+func TestShadowClassifier(t *testing.T) {
+	shadow := NewLLMClassifier(func(ctx context.Context, prompt string) (string, error) {
+		return `{"should_store": false, "confidence": 0.9, "reason": "闲聊"}`, nil
+	})
+
+	var logs []string
+	classifier := NewShadowClassifier(NewMemoryClassifier(), shadow, func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+
+	// 以主分类器的结果为准，并记录分歧
+	result, err := classifier.ClassifyText(context.Background(), "我喜欢使用 Go 语言")
+	if err != nil {
+		t.Fatalf("分类失败: %v", err)
+	}
+	if !result.ShouldStore || result.Importance == 0 {
+		t.Errorf("应使用主分类器的结果: %+v", result)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "分类不一致") {
+		t.Errorf("应记录一次分歧: %v", logs)
+	}
+
+	// 结果一致时不记录
+	logs = nil
+	if _, err := classifier.ClassifyText(context.Background(), "你好"); err != nil {
+		t.Fatalf("分类失败: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("结果一致时不应记录: %v", logs)
+	}
+}
+
+// ========== 文件锁测试 ==========
+
+func TestFileLock_Exclusive(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "locks", maintenanceLockFile)
+
+	// 两个锁对象各自打开锁文件，与两个进程的行为一致
+	first := NewFileLock(path)
+	second := NewFileLock(path)
+
+	if err := first.TryLock(); err != nil {
+		t.Fatalf("首次加锁失败: %v", err)
+	}
+	if err := second.TryLock(); err != ErrLockHeld {
+		t.Fatalf("锁被占用时应返回 ErrLockHeld，实际 %v", err)
+	}
+	if err := first.TryLock(); err != ErrLockHeld {
+		t.Fatalf("同一锁对象重复加锁应返回 ErrLockHeld，实际 %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := second.Lock(); err != nil {
+			t.Errorf("阻塞加锁失败: %v", err)
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("锁释放前不应获得锁")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("释放锁失败: %v", err)
+	}
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("锁释放后应获得锁")
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("释放锁失败: %v", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "memory.md")
+
+	if err := writeFileAtomic(path, []byte("旧内容"), 0644); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte("新内容"), 0644); err != nil {
+		t.Fatalf("覆盖失败: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "新内容" {
+		t.Errorf("内容不正确: %q", data)
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 1 {
+		t.Errorf("不应残留临时文件: %d 个文件", len(entries))
+	}
+}
+
+// ========== 静态加密测试 ==========
+
+func TestMemoryCipher_SealOpen(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	cipher, err := NewMemoryCipher(key)
+	if err != nil {
+		t.Fatalf("创建加密器失败: %v", err)
+	}
+
+	sealed, err := cipher.Seal([]byte("记忆内容"))
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(string(sealed), "记忆内容") {
+		t.Fatalf("密文不应包含明文: %q", sealed)
+	}
+	if plain, err := cipher.Open(sealed); err != nil || string(plain) != "记忆内容" {
+		t.Errorf("解密结果不正确: %q, %v", plain, err)
+	}
+	if plain, err := cipher.Open([]byte("明文文件")); err != nil || string(plain) != "明文文件" {
+		t.Errorf("明文应原样返回: %q, %v", plain, err)
+	}
+
+	field, err := cipher.SealString("消息")
+	if err != nil {
+		t.Fatalf("加密字段失败: %v", err)
+	}
+	if value, err := cipher.OpenString(field); err != nil || value != "消息" {
+		t.Errorf("解密字段不正确: %q, %v", value, err)
+	}
+
+	// 其他密钥与未加载密钥都无法解密
+	other, _ := NewMemoryCipher(make([]byte, 32))
+	if _, err := other.Open(sealed); err != ErrWrongKey {
+		t.Errorf("密钥错误应返回 ErrWrongKey，实际 %v", err)
+	}
+	var none *MemoryCipher
+	if _, err := none.Open(sealed); err != ErrEncryptedData {
+		t.Errorf("未加载密钥应返回 ErrEncryptedData，实际 %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Package v2 提供检索结果的融合、重排序与多样化
+package v2
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 融合策略
+const (
+	FusionRRF      = "rrf"      // 倒数排名融合，只看名次，不受分数尺度影响
+	FusionWeighted = "weighted" // 各路分数 min-max 归一化后加权求和
+	FusionMax      = "max"      // 取各路最高分（旧行为）
+)
+
+// RerankFunc 重排序函数：返回每个候选与查询的相关性分数（0-1），顺序与候选一致
+type RerankFunc func(ctx context.Context, query string, candidates []string) ([]float64, error)
+
+// ScoreExplanation 单条检索结果的得分说明
+type ScoreExplanation struct {
+	Fusion       string  `json:"fusion"`
+	VectorRank   int     `json:"vector_rank,omitempty"` // 0 表示未命中
+	VectorScore  float64 `json:"vector_score,omitempty"`
+	KeywordRank  int     `json:"keyword_rank,omitempty"`
+	KeywordScore float64 `json:"keyword_score,omitempty"`
+	FusedScore   float64 `json:"fused_score"`
+	TimeWeight   float64 `json:"time_weight"`            // 时间衰减、重要性与访问频率的综合乘数
+	ScopeWeight  float64 `json:"scope_weight,omitempty"` // 当前项目记忆的加权乘数
+	// 沿关联扩展得到的结果：来源记忆、关联类型、来源相关性与衰减系数
+	GraphFrom     string       `json:"graph_from,omitempty"`
+	GraphRelation RelationType `json:"graph_relation,omitempty"`
+	GraphScore    float64      `json:"graph_score,omitempty"`
+	GraphDecay    float64      `json:"graph_decay,omitempty"`
+	Reranked      bool         `json:"reranked,omitempty"`
+	RerankScore   float64      `json:"rerank_score,omitempty"`
+	MMRPenalty    float64      `json:"mmr_penalty,omitempty"` // 与已选结果的最大相似度
+	FinalScore    float64      `json:"final_score"`
+}
+
+// String 返回单行可读说明
+func (e *ScoreExplanation) String() string {
+	var parts []string
+	if e.VectorRank > 0 {
+		parts = append(parts, fmt.Sprintf("向量 #%d %.3f", e.VectorRank, e.VectorScore))
+	}
+	if e.KeywordRank > 0 {
+		parts = append(parts, fmt.Sprintf("关键词 #%d %.3f", e.KeywordRank, e.KeywordScore))
+	}
+	if e.GraphFrom != "" {
+		parts = append(parts, fmt.Sprintf("关联 %s ← %s ×%.2f", e.GraphRelation, shortMemoryID(e.GraphFrom), e.GraphDecay))
+	}
+	parts = append(parts, fmt.Sprintf("%s 融合 %.3f", e.Fusion, e.FusedScore))
+	parts = append(parts, fmt.Sprintf("时间权重 ×%.2f", e.TimeWeight))
+	if e.ScopeWeight > 0 && e.ScopeWeight != 1 {
+		parts = append(parts, fmt.Sprintf("项目权重 ×%.2f", e.ScopeWeight))
+	}
+	if e.Reranked {
+		parts = append(parts, fmt.Sprintf("重排序 %.3f", e.RerankScore))
+	}
+	if e.MMRPenalty > 0 {
+		parts = append(parts, fmt.Sprintf("相似度惩罚 %.2f", e.MMRPenalty))
+	}
+	parts = append(parts, fmt.Sprintf("最终 %.3f", e.FinalScore))
+	return strings.Join(parts, " · ")
+}
+
+// relevance 返回融合前各路的最高原始分数（关联扩展结果沿用来源记忆的相关性）
+func (e *ScoreExplanation) relevance() float64 {
+	return math.Max(math.Max(e.VectorScore, e.KeywordScore), e.GraphScore)
+}
+
+// ========== 融合 ==========
+
+// fuseResults 按策略融合向量与关键词两路结果（两路均需按分数降序）
+func fuseResults(strategy string, config *RetrievalConfig, vectorResults, keywordResults []*MemorySearchResult) []*MemorySearchResult {
+	merged := make(map[string]*MemorySearchResult)
+	var order []string
+
+	add := func(result *MemorySearchResult, rank int, isVector bool) {
+		if result.Memory == nil {
+			return
+		}
+		id := result.Memory.ID
+		existing, ok := merged[id]
+		if !ok {
+			existing = &MemorySearchResult{
+				Memory:      result.Memory,
+				MatchType:   result.MatchType,
+				Highlights:  result.Highlights,
+				Explanation: &ScoreExplanation{Fusion: strategy, TimeWeight: 1},
+			}
+			merged[id] = existing
+			order = append(order, id)
+		} else if existing.MatchType != result.MatchType {
+			existing.MatchType = "hybrid"
+		}
+
+		exp := existing.Explanation
+		if isVector && exp.VectorRank == 0 {
+			exp.VectorRank, exp.VectorScore = rank, result.Score
+		}
+		if !isVector && exp.KeywordRank == 0 {
+			exp.KeywordRank, exp.KeywordScore = rank, result.Score
+		}
+	}
+
+	for i, r := range vectorResults {
+		add(r, i+1, true)
+	}
+	for i, r := range keywordResults {
+		add(r, i+1, false)
+	}
+
+	vecMin, vecMax := scoreRange(vectorResults)
+	kwMin, kwMax := scoreRange(keywordResults)
+
+	results := make([]*MemorySearchResult, 0, len(order))
+	for _, id := range order {
+		result := merged[id]
+		exp := result.Explanation
+
+		switch strategy {
+		case FusionRRF:
+			k := float64(config.RRFK)
+			if k <= 0 {
+				k = 60
+			}
+			// 按两路均排第一时的最大值归一化到 0-1
+			var score float64
+			if exp.VectorRank > 0 {
+				score += 1 / (k + float64(exp.VectorRank))
+			}
+			if exp.KeywordRank > 0 {
+				score += 1 / (k + float64(exp.KeywordRank))
+			}
+			exp.FusedScore = score / (2 / (k + 1))
+		case FusionWeighted:
+			var score float64
+			if exp.VectorRank > 0 {
+				score += config.VectorWeight * normalizeScore(exp.VectorScore, vecMin, vecMax)
+			}
+			if exp.KeywordRank > 0 {
+				score += (1 - config.VectorWeight) * normalizeScore(exp.KeywordScore, kwMin, kwMax)
+			}
+			exp.FusedScore = score
+		default:
+			exp.FusedScore = exp.relevance()
+		}
+
+		result.Score = exp.FusedScore
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// scoreRange 返回结果分数的最小值与最大值
+func scoreRange(results []*MemorySearchResult) (float64, float64) {
+	if len(results) == 0 {
+		return 0, 0
+	}
+	lo, hi := results[0].Score, results[0].Score
+	for _, r := range results[1:] {
+		lo = math.Min(lo, r.Score)
+		hi = math.Max(hi, r.Score)
+	}
+	return lo, hi
+}
+
+// normalizeScore min-max 归一化，所有分数相同时视为 1
+func normalizeScore(score, lo, hi float64) float64 {
+	if hi-lo < 1e-9 {
+		return 1
+	}
+	return (score - lo) / (hi - lo)
+}
+
+// ========== 重排序 ==========
+
+// rerankResults 对前 topN 个结果重排序，重排序失败时保持原顺序
+// 重排序后的结果按新分数排在未参与重排序的结果之前
+func rerankResults(ctx context.Context, rerank RerankFunc, query string, results []*MemorySearchResult, topN int) []*MemorySearchResult {
+	if rerank == nil || topN <= 0 || len(results) == 0 {
+		return results
+	}
+	if topN > len(results) {
+		topN = len(results)
+	}
+
+	head := results[:topN]
+	docs := make([]string, len(head))
+	for i, r := range head {
+		docs[i] = r.Memory.Title + "\n" + truncateContent(r.Memory.Content, 500)
+	}
+
+	scores, err := rerank(ctx, query, docs)
+	if err != nil || len(scores) != len(head) {
+		return results
+	}
+
+	reranked := make([]*MemorySearchResult, len(head))
+	copy(reranked, head)
+	for i, r := range reranked {
+		r.Explanation.Reranked = true
+		r.Explanation.RerankScore = scores[i]
+		r.Score = scores[i]
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Score > reranked[j].Score
+	})
+
+	return append(reranked, results[topN:]...)
+}
+
+// NewLLMReranker 创建基于 LLM 的重排序函数：一次请求为全部候选打分
+func NewLLMReranker(complete CompleteFunc) RerankFunc {
+	return func(ctx context.Context, query string, candidates []string) ([]float64, error) {
+		var prompt strings.Builder
+		prompt.WriteString("请评估以下每条记忆与查询的相关程度，给出 0-10 的分数（10 表示完全相关）。\n")
+		prompt.WriteString("只输出一个 JSON 数字数组，长度与记忆条数相同，顺序一致，不要输出其他内容。\n\n")
+		prompt.WriteString(fmt.Sprintf("查询: %s\n\n", query))
+		for i, c := range candidates {
+			prompt.WriteString(fmt.Sprintf("[%d]\n%s\n\n", i+1, c))
+		}
+
+		reply, err := complete(ctx, prompt.String())
+		if err != nil {
+			return nil, fmt.Errorf("LLM 重排序失败: %w", err)
+		}
+
+		scores, err := parseRerankScores(reply, len(candidates))
+		if err != nil {
+			return nil, err
+		}
+		return scores, nil
+	}
+}
+
+// parseRerankScores 从 LLM 回复中解析 0-10 分数数组并归一化到 0-1
+func parseRerankScores(reply string, n int) ([]float64, error) {
+	var raw []float64
+	if err := decodeLLMJSON(reply, &raw, "重排序结果"); err != nil {
+		return nil, err
+	}
+	if len(raw) != n {
+		return nil, fmt.Errorf("重排序结果数量不匹配: 期望 %d, 实际 %d", n, len(raw))
+	}
+
+	scores := make([]float64, n)
+	for i, s := range raw {
+		scores[i] = math.Max(0, math.Min(1, s/10))
+	}
+	return scores, nil
+}
+
+// ========== 多样化 ==========
+
+// diversifyMMR 使用最大边际相关性（MMR）从候选中挑选 topK 个结果
+// lambda 越小越偏向多样性；候选需按分数降序
+func diversifyMMR(results []*MemorySearchResult, topK int, lambda float64) []*MemorySearchResult {
+	if topK > len(results) {
+		topK = len(results)
+	}
+	if lambda <= 0 || lambda >= 1 || len(results) <= 1 {
+		return results[:topK]
+	}
+
+	// 使用本地 n-gram 向量衡量候选之间的相似度
+	memories := make([]*Memory, len(results))
+	for i, r := range results {
+		memories[i] = r.Memory
+	}
+	vectors := localMemoryVectors(memories)
+
+	maxScore := results[0].Score
+	for _, r := range results {
+		maxScore = math.Max(maxScore, r.Score)
+	}
+	if maxScore <= 0 {
+		maxScore = 1
+	}
+
+	selected := make([]int, 0, topK)
+	used := make([]bool, len(results))
+	maxSim := make([]float64, len(results))
+
+	for len(selected) < topK {
+		best, bestMMR := -1, math.Inf(-1)
+		for i, r := range results {
+			if used[i] {
+				continue
+			}
+			mmr := lambda*(r.Score/maxScore) - (1-lambda)*maxSim[i]
+			if mmr > bestMMR {
+				best, bestMMR = i, mmr
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, best)
+		results[best].Explanation.MMRPenalty = maxSim[best]
+
+		for i := range results {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], CosineSimilarity(vectors[i], vectors[best]))
+			}
+		}
+	}
+
+	diversified := make([]*MemorySearchResult, len(selected))
+	for i, idx := range selected {
+		diversified[i] = results[idx]
+	}
+	return diversified
+}
@@ -0,0 +1,393 @@
+// Package v2 提供会话反思功能：从近期会话中提炼长期知识
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 反思参数
+const (
+	maxReflectionSessions   = 10    // 单次最多处理的会话数
+	maxReflectionTranscript = 12000 // 单个会话送入 LLM 的最大字符数（保留最新部分）
+	maxReflectionMessageLen = 1000  // 单条消息的最大字符数
+)
+
+// 反思提取的条目类型
+const (
+	reflectionFact       = "fact"
+	reflectionDecision   = "decision"
+	reflectionPreference = "preference"
+	reflectionRule       = "rule"
+)
+
+// ReflectionResult 反思结果
+type ReflectionResult struct {
+	Sessions      int `json:"sessions"`        // 处理的会话数
+	LongTermAdded int `json:"long_term_added"` // 新增的长期记忆数
+	CoreQueued    int `json:"core_queued"`     // 提交审核的核心记忆变更数
+	Skipped       int `json:"skipped"`         // 已存在而跳过的条目数
+}
+
+// reflectionState 反思进度
+type reflectionState struct {
+	Since    map[string]time.Time `json:"since"`    // 各存储位置（项目根目录，全局为空）上次反思到的会话更新时间
+	Messages map[string]int       `json:"messages"` // 各会话已反思到的消息序号，会话更新后只反思新消息
+}
+
+// reflectionItem LLM 提取的单条知识
+type reflectionItem struct {
+	Kind    string   `json:"kind"`
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Reflector 会话反思器
+// 定期读取上次运行后更新过的会话，由 LLM 提取事实、决策与用户偏好：
+// 事实与决策直接写入长期记忆，偏好与规则提交到审核队列，确认后才写入核心记忆
+type Reflector struct {
+	storage     *StorageManager
+	fileStore   *MarkdownFileStore
+	sessionMgr  *SessionManager
+	coreMgr     *CoreMemoryManager
+	longTermMgr *LongTermMemoryManager
+	review      *ReviewQueue
+	statePath   string
+
+	complete CompleteFunc
+	mu       sync.Mutex
+}
+
+// NewReflector 创建会话反思器（complete 为 nil 时不执行反思）
+func NewReflector(
+	storage *StorageManager,
+	fileStore *MarkdownFileStore,
+	sessionMgr *SessionManager,
+	coreMgr *CoreMemoryManager,
+	longTermMgr *LongTermMemoryManager,
+	review *ReviewQueue,
+	statePath string,
+	complete CompleteFunc,
+) *Reflector {
+	return &Reflector{
+		storage:     storage,
+		fileStore:   fileStore,
+		sessionMgr:  sessionMgr,
+		coreMgr:     coreMgr,
+		longTermMgr: longTermMgr,
+		review:      review,
+		statePath:   statePath,
+		complete:    complete,
+	}
+}
+
+// SetCompleteFunc 设置 LLM 补全函数
+func (r *Reflector) SetCompleteFunc(complete CompleteFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.complete = complete
+}
+
+// Run 执行一次反思
+// 会话按更新时间依次处理，某个会话失败时停止，下次从该会话继续
+func (r *Reflector) Run(ctx context.Context) (*ReflectionResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &ReflectionResult{}
+	if r.complete == nil {
+		return result, nil
+	}
+
+	state, err := r.loadState()
+	if err != nil {
+		return result, err
+	}
+	key := r.storage.GetProjectRoot()
+	since := state.Since[key]
+
+	sessions, err := r.sessionMgr.ListSessions()
+	if err != nil {
+		return result, fmt.Errorf("列出会话失败: %w", err)
+	}
+
+	var pending []*Session
+	for _, sess := range sessions {
+		if sess.UpdatedAt.After(since) {
+			pending = append(pending, sess)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].UpdatedAt.Before(pending[j].UpdatedAt)
+	})
+	if len(pending) > maxReflectionSessions {
+		pending = pending[:maxReflectionSessions]
+	}
+
+	for _, sess := range pending {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+
+		processed, err := r.reflectSession(ctx, sess, state.Messages[sess.ID], result)
+		if err != nil {
+			return result, fmt.Errorf("反思会话 %s 失败: %w", sess.ID, err)
+		}
+
+		result.Sessions++
+		state.Since[key] = sess.UpdatedAt
+		state.Messages[sess.ID] = processed
+		if err := r.saveState(state); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Rewind 会话中序号不小于 fromSequence 的消息被删除后回退反思进度
+// 这些序号会被重新生成的消息复用，回退后下次反思会处理它们
+func (r *Reflector) Rewind(sessionID string, fromSequence int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, err := r.loadState()
+	if err != nil {
+		return err
+	}
+	if processed, ok := state.Messages[sessionID]; !ok || processed < fromSequence {
+		return nil
+	}
+	state.Messages[sessionID] = fromSequence - 1
+	return r.saveState(state)
+}
+
+// reflectSession 反思单个会话中序号大于 after 的消息，返回已反思到的消息序号
+func (r *Reflector) reflectSession(ctx context.Context, sess *Session, after int, result *ReflectionResult) (int, error) {
+	_, messages, err := r.fileStore.ReadSession(sess.FilePath)
+	if err != nil {
+		return after, err
+	}
+
+	processed := after
+	var unseen []SessionMessage
+	for _, msg := range messages {
+		if msg.Sequence > after {
+			unseen = append(unseen, msg)
+			processed = max(processed, msg.Sequence)
+		}
+	}
+
+	transcript := buildReflectionTranscript(unseen)
+	if transcript == "" {
+		return processed, nil
+	}
+
+	reply, err := r.complete(ctx, buildReflectionPrompt(transcript))
+	if err != nil {
+		return after, fmt.Errorf("LLM 调用失败: %w", err)
+	}
+
+	items, err := parseReflectionItems(reply)
+	if err != nil {
+		return after, err
+	}
+
+	source := "session:" + sess.ID
+	for _, item := range items {
+		if err := r.apply(item, source, result); err != nil {
+			return after, err
+		}
+	}
+	return processed, nil
+}
+
+// apply 写入单条提取结果
+func (r *Reflector) apply(item reflectionItem, source string, result *ReflectionResult) error {
+	switch item.Kind {
+	case reflectionPreference, reflectionRule:
+		category := CategoryPreference
+		if item.Kind == reflectionRule {
+			category = CategoryRule
+		}
+
+		change := ReviewItem{
+			Action:   ReviewAdd,
+			Category: category,
+			Title:    item.Title,
+			Content:  item.Content,
+			Source:   source,
+		}
+		existing, _ := r.coreMgr.FindByTitle(item.Title)
+		if existing != nil {
+			if strings.TrimSpace(existing.Content) == item.Content {
+				result.Skipped++
+				return nil
+			}
+			change.Action = ReviewUpdate
+			change.TargetID = existing.ID
+			change.Category = existing.Category
+		}
+
+		queued, err := r.review.Submit(change)
+		if err != nil {
+			return err
+		}
+		if queued {
+			result.CoreQueued++
+		} else {
+			result.Skipped++
+		}
+
+	case reflectionFact, reflectionDecision:
+		existing, _ := r.longTermMgr.FindByTitle(item.Title)
+		if existing != nil {
+			result.Skipped++
+			return nil
+		}
+
+		category := CategoryProject
+		if item.Kind == reflectionDecision {
+			category = CategoryDecision
+		} else if r.longTermMgr.DefaultScope() == ScopeGlobal {
+			category = CategoryKnowledge
+		}
+
+		if _, err := r.longTermMgr.AddWithSource(category, r.longTermMgr.DefaultScope(), item.Title, item.Content, item.Tags, source); err != nil {
+			return fmt.Errorf("写入长期记忆失败: %w", err)
+		}
+		result.LongTermAdded++
+	}
+
+	return nil
+}
+
+// buildReflectionTranscript 生成送入 LLM 的对话记录（仅用户与助手消息，保留最新部分）
+func buildReflectionTranscript(messages []SessionMessage) string {
+	var lines []string
+	for _, msg := range messages {
+		var role string
+		switch msg.Role {
+		case "user":
+			role = "用户"
+		case "assistant":
+			role = "助手"
+		default:
+			continue
+		}
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		if runes := []rune(content); len(runes) > maxReflectionMessageLen {
+			content = string(runes[:maxReflectionMessageLen]) + "..."
+		}
+		lines = append(lines, role+": "+content)
+	}
+
+	transcript := strings.Join(lines, "\n\n")
+	if runes := []rune(transcript); len(runes) > maxReflectionTranscript {
+		transcript = string(runes[len(runes)-maxReflectionTranscript:])
+	}
+	return transcript
+}
+
+// buildReflectionPrompt 生成反思提示词
+func buildReflectionPrompt(transcript string) string {
+	var prompt strings.Builder
+	prompt.WriteString("请阅读以下对话，提取其中值得长期记住的信息：\n")
+	prompt.WriteString("- fact: 关于项目或技术的持久事实\n")
+	prompt.WriteString("- decision: 做出的决策及其原因\n")
+	prompt.WriteString("- preference: 用户明确表达的偏好\n")
+	prompt.WriteString("- rule: 用户要求始终遵守的规则\n\n")
+	prompt.WriteString("忽略临时性的任务细节、闲聊和已被推翻的结论。没有值得记住的内容时输出 []。\n")
+	prompt.WriteString("只输出 JSON 数组，每项格式：{\"kind\": \"fact\", \"title\": \"简短标题\", \"content\": \"完整描述\", \"tags\": [\"标签\"]}\n\n")
+	prompt.WriteString("对话：\n")
+	prompt.WriteString(transcript)
+	return prompt.String()
+}
+
+// parseReflectionItems 解析 LLM 返回的提取结果
+func parseReflectionItems(reply string) ([]reflectionItem, error) {
+	var raw []reflectionItem
+	if err := decodeLLMJSON(reply, &raw, "反思结果"); err != nil {
+		return nil, err
+	}
+
+	var items []reflectionItem
+	for _, item := range raw {
+		item.Kind = strings.ToLower(strings.TrimSpace(item.Kind))
+		item.Title = strings.TrimSpace(item.Title)
+		item.Content = strings.TrimSpace(item.Content)
+		if item.Title == "" || item.Content == "" {
+			continue
+		}
+		switch item.Kind {
+		case reflectionFact, reflectionDecision, reflectionPreference, reflectionRule:
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// loadState 读取反思进度
+// 旧版本状态文件只记录各存储位置的会话更新时间
+func (r *Reflector) loadState() (*reflectionState, error) {
+	state := &reflectionState{
+		Since:    make(map[string]time.Time),
+		Messages: make(map[string]int),
+	}
+
+	data, err := os.ReadFile(r.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取反思状态失败: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("解析反思状态失败: %w", err)
+	}
+	if _, ok := fields["since"]; !ok {
+		if err := json.Unmarshal(data, &state.Since); err != nil {
+			return nil, fmt.Errorf("解析反思状态失败: %w", err)
+		}
+		return state, nil
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("解析反思状态失败: %w", err)
+	}
+	if state.Since == nil {
+		state.Since = make(map[string]time.Time)
+	}
+	if state.Messages == nil {
+		state.Messages = make(map[string]int)
+	}
+	return state, nil
+}
+
+// saveState 保存反思状态
+func (r *Reflector) saveState(state *reflectionState) error {
+	if err := EnsureDir(r.statePath); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化反思状态失败: %w", err)
+	}
+	if err := os.WriteFile(r.statePath, data, 0644); err != nil {
+		return fmt.Errorf("写入反思状态失败: %w", err)
+	}
+	return nil
+}
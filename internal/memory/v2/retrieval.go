@@ -64,6 +64,7 @@ type HybridRetriever struct {
 	fileStore *MarkdownFileStore
 	embedding *EmbeddingManager
 	config    *RetrievalConfig
+	reranker  RerankFunc
 }
 
 // NewHybridRetriever 创建混合检索器
@@ -89,51 +90,81 @@ func (r *HybridRetriever) Search(ctx context.Context, query string, opts *Retrie
 		opts = DefaultRetrievalOptions()
 	}
 
-	var allResults []*MemorySearchResult
+	var vectorResults, keywordResults []*MemorySearchResult
 
 	// 1. 向量检索
 	if opts.UseVector && r.embedding != nil {
-		vectorResults, err := r.searchByVector(ctx, query, r.config.VectorTopK)
+		results, err := r.searchByVector(ctx, query, r.config.VectorTopK)
 		if err == nil {
-			allResults = append(allResults, vectorResults...)
+			vectorResults = results
 		}
 	}
 
 	// 2. 关键词检索
 	if opts.UseKeyword {
-		keywordResults, err := r.searchByKeyword(query, r.config.KeywordTopK)
+		results, err := r.searchByKeyword(query, r.config.KeywordTopK)
 		if err == nil {
-			allResults = append(allResults, keywordResults...)
+			keywordResults = results
 		}
 	}
 
-	// 3. 合并去重
-	merged := r.mergeResults(allResults)
+	// 3. 融合两路结果（各路需按分数排序以确定名次）
+	sortResults(vectorResults)
+	sortResults(keywordResults)
+	merged := fuseResults(r.fusionStrategy(), r.config, vectorResults, keywordResults)
 
 	// 4. 应用时间权重
 	if opts.UseTimeWeight {
 		r.applyTimeWeight(merged)
 	}
+	r.applyScopeWeight(merged)
 
 	// 5. 过滤条件
 	filtered := r.filterResults(merged, opts)
 
-	// 6. 排序并截取
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].Score > filtered[j].Score
-	})
+	// 6. 排序，并沿关联扩展排名靠前结果的一跳邻居
+	sortResults(filtered)
+	filtered = r.expandGraph(filtered, opts)
+
+	// 7. LLM 重排序
+	filtered = rerankResults(ctx, r.reranker, query, filtered, r.config.RerankTopN)
 
+	// 8. MMR 多样化并截取
 	topK := opts.TopK
 	if topK <= 0 {
 		topK = r.config.FinalTopK
 	}
-	if len(filtered) > topK {
-		filtered = filtered[:topK]
+	filtered = diversifyMMR(filtered, topK, r.config.MMRLambda)
+
+	for _, result := range filtered {
+		result.Explanation.FinalScore = result.Score
 	}
 
 	return filtered, nil
 }
 
+// SetReranker 设置重排序函数（nil 表示不启用）
+func (r *HybridRetriever) SetReranker(rerank RerankFunc) {
+	r.reranker = rerank
+}
+
+// fusionStrategy 返回配置的融合策略
+func (r *HybridRetriever) fusionStrategy() string {
+	switch r.config.FusionStrategy {
+	case FusionWeighted, FusionMax:
+		return r.config.FusionStrategy
+	default:
+		return FusionRRF
+	}
+}
+
+// sortResults 按分数降序排序
+func sortResults(results []*MemorySearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
 // searchByVector 向量检索
 func (r *HybridRetriever) searchByVector(ctx context.Context, query string, topK int) ([]*MemorySearchResult, error) {
 	// 使用 embedding 管理器搜索
@@ -296,64 +327,113 @@ func (r *HybridRetriever) calculateKeywordScore(query string, mem *Memory) float
 	return math.Min(score, 1.0)
 }
 
-// mergeResults 合并去重结果
-func (r *HybridRetriever) mergeResults(results []*MemorySearchResult) []*MemorySearchResult {
-	// 按 ID 合并，保留最高分数
-	mergedMap := make(map[string]*MemorySearchResult)
+// applyTimeWeight 应用时间权重
+func (r *HybridRetriever) applyTimeWeight(results []*MemorySearchResult) {
+	now := time.Now()
 
 	for _, result := range results {
 		if result.Memory == nil {
 			continue
 		}
 
-		existing, ok := mergedMap[result.Memory.ID]
-		if !ok {
-			mergedMap[result.Memory.ID] = result
-		} else {
-			// 合并分数和匹配类型
-			if result.Score > existing.Score {
-				existing.Score = result.Score
-			}
-			if existing.MatchType != result.MatchType {
-				existing.MatchType = "hybrid"
-			}
+		// 计算时间衰减
+		daysSinceUpdate := now.Sub(result.Memory.UpdatedAt).Hours() / 24
+		weight := math.Pow(r.config.TimeDecayFactor, daysSinceUpdate/30) // 每30天衰减
+
+		// 重要性加成
+		importanceBoost := float64(result.Memory.Importance) / 5.0
+		weight *= (0.8 + 0.2*importanceBoost)
+
+		// 访问频率加成
+		if result.Memory.AccessCount > 0 {
+			accessBoost := math.Log10(float64(result.Memory.AccessCount)+1) / 3.0
+			weight *= (1 + accessBoost*0.1)
 		}
-	}
 
-	var merged []*MemorySearchResult
-	for _, result := range mergedMap {
-		merged = append(merged, result)
+		result.Score *= weight
+		if result.Explanation != nil {
+			result.Explanation.TimeWeight = weight
+		}
 	}
-
-	return merged
 }
 
-// applyTimeWeight 应用时间权重
-func (r *HybridRetriever) applyTimeWeight(results []*MemorySearchResult) {
-	now := time.Now()
+// applyScopeWeight 提升当前项目记忆的分数，使其在与全局记忆的联合检索中优先
+// 只影响排序，不参与相关性阈值过滤
+func (r *HybridRetriever) applyScopeWeight(results []*MemorySearchResult) {
+	weight := r.config.ProjectWeight
+	if weight <= 0 || weight == 1 {
+		return
+	}
 
 	for _, result := range results {
-		if result.Memory == nil {
+		if result.Memory == nil || result.Memory.Scope != ScopeProject {
 			continue
 		}
+		result.Score *= weight
+		if result.Explanation != nil {
+			result.Explanation.ScopeWeight = weight
+		}
+	}
+}
 
-		// 计算时间衰减
-		daysSinceUpdate := now.Sub(result.Memory.UpdatedAt).Hours() / 24
-		timeWeight := math.Pow(r.config.TimeDecayFactor, daysSinceUpdate/30) // 每30天衰减
+// expandGraph 将排名靠前结果的一跳关联记忆加入结果
+// 邻居分数为来源分数乘以衰减系数，相关性沿用来源记忆，已在结果中的记忆不重复加入
+func (r *HybridRetriever) expandGraph(results []*MemorySearchResult, opts *RetrievalOptions) []*MemorySearchResult {
+	decay := r.config.GraphDecay
+	if decay <= 0 || len(results) == 0 {
+		return results
+	}
 
-		// 应用时间权重
-		result.Score *= timeWeight
+	seen := make(map[string]bool, len(results))
+	for _, result := range results {
+		seen[result.Memory.ID] = true
+	}
 
-		// 重要性加成
-		importanceBoost := float64(result.Memory.Importance) / 5.0
-		result.Score *= (0.8 + 0.2*importanceBoost)
+	parents := results
+	if limit := r.config.FinalTopK; limit > 0 && len(parents) > limit {
+		parents = parents[:limit]
+	}
 
-		// 访问频率加成
-		if result.Memory.AccessCount > 0 {
-			accessBoost := math.Log10(float64(result.Memory.AccessCount)+1) / 3.0
-			result.Score *= (1 + accessBoost*0.1)
+	var neighbours []*MemorySearchResult
+	for _, parent := range parents {
+		for _, relatedID := range parent.Memory.Related {
+			if seen[relatedID] {
+				continue
+			}
+			idx, err := r.index.GetIndex(relatedID)
+			if err != nil {
+				continue
+			}
+			mem, err := r.fileStore.ReadMemory(idx.FilePath)
+			if err != nil {
+				continue
+			}
+			seen[relatedID] = true
+
+			exp := &ScoreExplanation{
+				Fusion:        r.fusionStrategy(),
+				TimeWeight:    1,
+				GraphFrom:     parent.Memory.ID,
+				GraphRelation: parent.Memory.RelationTo(relatedID),
+				GraphDecay:    decay,
+			}
+			if parent.Explanation != nil {
+				exp.Fusion = parent.Explanation.Fusion
+				exp.GraphScore = parent.Explanation.relevance() * parent.Explanation.TimeWeight
+			}
+			exp.FusedScore = parent.Score * decay
+			neighbours = append(neighbours, &MemorySearchResult{
+				Memory:      mem,
+				Score:       parent.Score * decay,
+				MatchType:   "graph",
+				Explanation: exp,
+			})
 		}
 	}
+
+	results = append(results, r.filterResults(neighbours, opts)...)
+	sortResults(results)
+	return results
 }
 
 // filterResults 过滤结果
@@ -365,8 +445,12 @@ func (r *HybridRetriever) filterResults(results []*MemorySearchResult, opts *Ret
 			continue
 		}
 
-		// 过滤分数
-		if result.Score < opts.MinSimilarity {
+		// 过滤分数：融合分数只反映名次，阈值按各路原始分数判断
+		relevance := result.Score
+		if result.Explanation != nil {
+			relevance = result.Explanation.relevance() * result.Explanation.TimeWeight
+		}
+		if relevance < opts.MinSimilarity {
 			continue
 		}
 
@@ -0,0 +1,205 @@
+// Package v2 提供核心记忆变更的审核队列
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReviewAction 待审核的操作
+type ReviewAction string
+
+const (
+	ReviewAdd    ReviewAction = "add"    // 新增核心记忆
+	ReviewUpdate ReviewAction = "update" // 更新已有核心记忆
+)
+
+// ReviewItem 待审核的核心记忆变更
+type ReviewItem struct {
+	ID        string         `json:"id"`
+	Action    ReviewAction   `json:"action"`
+	TargetID  string         `json:"target_id,omitempty"` // 仅 update
+	Category  MemoryCategory `json:"category"`
+	Title     string         `json:"title"`
+	Content   string         `json:"content"`
+	Source    string         `json:"source,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ReviewQueue 核心记忆审核队列
+// 自动提取的核心记忆变更需经用户确认后才会生效，队列以 JSON 文件保存
+type ReviewQueue struct {
+	path    string
+	coreMgr *CoreMemoryManager
+	cipher  *MemoryCipher // 非 nil 时队列文件加密存储
+	mu      sync.Mutex
+}
+
+// NewReviewQueue 创建审核队列
+func NewReviewQueue(path string, coreMgr *CoreMemoryManager) *ReviewQueue {
+	return &ReviewQueue{
+		path:    path,
+		coreMgr: coreMgr,
+	}
+}
+
+// SetCipher 设置队列文件的加密器（nil 表示明文存储）
+func (q *ReviewQueue) SetCipher(cipher *MemoryCipher) {
+	q.cipher = cipher
+}
+
+// Submit 提交待审核变更，队列中已有相同标题与内容的变更时忽略
+func (q *ReviewQueue) Submit(item ReviewItem) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return false, err
+	}
+
+	for _, existing := range items {
+		if existing.Title == item.Title && existing.Content == item.Content {
+			return false, nil
+		}
+	}
+
+	if item.ID == "" {
+		item.ID = uuid.New().String()
+	}
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	return true, q.save(append(items, &item))
+}
+
+// List 列出待审核变更
+func (q *ReviewQueue) List() ([]*ReviewItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.load()
+}
+
+// Approve 批准变更并写入核心记忆（id 支持前缀匹配）
+func (q *ReviewQueue) Approve(id string) (*Memory, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	i, err := findReviewItem(items, id)
+	if err != nil {
+		return nil, err
+	}
+	item := items[i]
+
+	var mem *Memory
+	switch item.Action {
+	case ReviewUpdate:
+		if err := q.coreMgr.Update(item.TargetID, item.Content); err != nil {
+			return nil, fmt.Errorf("更新核心记忆失败: %w", err)
+		}
+		mem, err = q.coreMgr.FindByID(item.TargetID)
+	default:
+		mem, err = q.coreMgr.AddWithSource(item.Category, item.Title, item.Content, item.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return mem, q.save(append(items[:i], items[i+1:]...))
+}
+
+// Reject 拒绝变更（id 支持前缀匹配）
+func (q *ReviewQueue) Reject(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+	i, err := findReviewItem(items, id)
+	if err != nil {
+		return err
+	}
+
+	return q.save(append(items[:i], items[i+1:]...))
+}
+
+// Size 返回待审核变更数
+func (q *ReviewQueue) Size() int {
+	items, err := q.List()
+	if err != nil {
+		return 0
+	}
+	return len(items)
+}
+
+// load 读取队列文件
+func (q *ReviewQueue) load() ([]*ReviewItem, error) {
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取审核队列失败: %w", err)
+	}
+	if data, err = q.cipher.Open(data); err != nil {
+		return nil, fmt.Errorf("读取审核队列失败: %w", err)
+	}
+
+	var items []*ReviewItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("解析审核队列失败: %w", err)
+	}
+	return items, nil
+}
+
+// save 写入队列文件
+func (q *ReviewQueue) save(items []*ReviewItem) error {
+	if err := EnsureDir(q.path); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化审核队列失败: %w", err)
+	}
+	if data, err = q.cipher.Seal(data); err != nil {
+		return fmt.Errorf("写入审核队列失败: %w", err)
+	}
+	if err := writeFileAtomic(q.path, data, 0644); err != nil {
+		return fmt.Errorf("写入审核队列失败: %w", err)
+	}
+	return nil
+}
+
+// findReviewItem 按 ID 或 ID 前缀查找变更
+func findReviewItem(items []*ReviewItem, id string) (int, error) {
+	found := -1
+	for i, item := range items {
+		if item.ID == id {
+			return i, nil
+		}
+		if strings.HasPrefix(item.ID, id) {
+			if found >= 0 {
+				return -1, fmt.Errorf("ID 前缀 %s 匹配多条待审核变更", id)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("未找到待审核变更: %s", id)
+	}
+	return found, nil
+}
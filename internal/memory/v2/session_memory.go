@@ -3,6 +3,7 @@ package v2
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hession/aimate/internal/redact"
 )
 
 // SessionManager 会话记忆管理器
@@ -19,6 +21,10 @@ type SessionManager struct {
 	fileStore *MarkdownFileStore
 	index     IndexStore
 	config    *MemoryConfig
+	redactor  *redact.Redactor // 非 nil 时消息写入前脱敏
+
+	// 截断消息后的回调（可选），参数为会话 ID 与被删除的起始序号
+	onTruncate func(sessionID string, fromSequence int)
 
 	// 当前活跃会话
 	currentSession *Session
@@ -153,55 +159,103 @@ func (m *SessionManager) LoadLatestSession() error {
 	return nil
 }
 
+// SetRedactor 设置消息脱敏器（nil 表示不脱敏）
+func (m *SessionManager) SetRedactor(redactor *redact.Redactor) {
+	m.redactor = redactor
+}
+
+// SetTruncateHook 设置截断消息后的回调，截断后的序号会被新消息复用
+func (m *SessionManager) SetTruncateHook(hook func(sessionID string, fromSequence int)) {
+	m.onTruncate = hook
+}
+
 // AddMessage 添加消息到当前会话
 func (m *SessionManager) AddMessage(role, content string, tokenCount int) error {
+	return m.appendMessage(SessionMessage{
+		Role:       role,
+		Content:    content,
+		TokenCount: tokenCount,
+	})
+}
+
+// AddToolMessage 添加工具调用消息
+func (m *SessionManager) AddToolMessage(toolCalls string, toolCallID string, content string, tokenCount int) error {
+	return m.appendMessage(SessionMessage{
+		Role:       "tool",
+		Content:    content,
+		ToolCalls:  toolCalls,
+		ToolCallID: toolCallID,
+		TokenCount: tokenCount,
+	})
+}
+
+// appendMessage 追加消息：写入会话文件并更新会话消息索引
+func (m *SessionManager) appendMessage(msg SessionMessage) error {
 	if m.currentSession == nil {
 		if _, err := m.CreateSession(); err != nil {
 			return err
 		}
 	}
 
-	msg := SessionMessage{
-		Sequence:   len(m.messages) + 1,
-		Role:       role,
-		Content:    content,
-		Timestamp:  time.Now(),
-		TokenCount: tokenCount,
-	}
+	msg.Content = m.redactor.Redact(msg.Content)
+	msg.ToolCalls = m.redactor.RedactJSON(msg.ToolCalls)
+	msg.Sequence = len(m.messages) + 1
+	msg.Timestamp = time.Now()
 
 	m.messages = append(m.messages, msg)
 	m.currentSession.MessageCount = len(m.messages)
-	m.currentSession.TokenCount += tokenCount
+	m.currentSession.TokenCount += msg.TokenCount
 	m.currentSession.UpdatedAt = time.Now()
 
 	// 保存到文件
-	return m.fileStore.UpdateSession(m.currentSession, m.messages)
-}
-
-// AddToolMessage 添加工具调用消息
-func (m *SessionManager) AddToolMessage(toolCalls string, toolCallID string, content string, tokenCount int) error {
-	if m.currentSession == nil {
-		if _, err := m.CreateSession(); err != nil {
+	if err := m.fileStore.UpdateSession(m.currentSession, m.messages); err != nil {
+		if !errors.Is(err, ErrSessionModified) {
+			return err
+		}
+		// 其他进程修改了会话文件：在其内容上追加，并以文件内容为准重新加载
+		if err := m.mergeExternalChanges(&msg); err != nil {
 			return err
 		}
 	}
 
-	msg := SessionMessage{
-		Sequence:   len(m.messages) + 1,
-		Role:       "tool",
-		Content:    content,
-		ToolCalls:  toolCalls,
-		ToolCallID: toolCallID,
-		Timestamp:  time.Now(),
-		TokenCount: tokenCount,
+	return m.indexMessages(m.currentSession.ID, msg)
+}
+
+// mergeExternalChanges 会话文件被外部修改时，重新读取文件后追加消息
+func (m *SessionManager) mergeExternalChanges(msg *SessionMessage) error {
+	path := m.currentSession.FilePath
+	if err := m.fileStore.AppendSessionMessage(path, msg); err != nil {
+		return err
 	}
 
-	m.messages = append(m.messages, msg)
-	m.currentSession.MessageCount = len(m.messages)
-	m.currentSession.TokenCount += tokenCount
-	m.currentSession.UpdatedAt = time.Now()
+	sess, messages, err := m.fileStore.ReadSession(path)
+	if err != nil {
+		return err
+	}
+	m.currentSession = sess
+	m.messages = messages
+	return nil
+}
 
-	return m.fileStore.UpdateSession(m.currentSession, m.messages)
+// indexMessages 将消息写入会话消息索引
+func (m *SessionManager) indexMessages(sessionID string, messages ...SessionMessage) error {
+	if m.index == nil {
+		return nil
+	}
+	for i := range messages {
+		if err := m.index.IndexSessionMessage(sessionID, &messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchHistory 搜索历史会话消息
+func (m *SessionManager) SearchHistory(query string, limit int) ([]*SessionMessageHit, error) {
+	if m.index == nil {
+		return nil, nil
+	}
+	return m.index.SearchSessionMessages(query, limit)
 }
 
 // GetMessages 获取当前会话的消息
@@ -209,6 +263,67 @@ func (m *SessionManager) GetMessages() []SessionMessage {
 	return m.messages
 }
 
+// LastUserMessage 获取当前会话最后一条用户消息
+func (m *SessionManager) LastUserMessage() *SessionMessage {
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Role == "user" {
+			msg := m.messages[i]
+			return &msg
+		}
+	}
+	return nil
+}
+
+// TruncateMessages 删除当前会话中序号不小于 fromSequence 的消息
+// 同步更新会话文件和会话消息索引，并按保留的消息重新计算 token 数
+func (m *SessionManager) TruncateMessages(fromSequence int) error {
+	if m.currentSession == nil {
+		return ErrSessionNotFound
+	}
+
+	m.truncateLocal(fromSequence)
+	if err := m.fileStore.UpdateSession(m.currentSession, m.messages); err != nil {
+		if !errors.Is(err, ErrSessionModified) {
+			return err
+		}
+		// 其他进程修改了会话文件：以文件内容为准重新截断
+		sess, messages, err := m.fileStore.ReadSession(m.currentSession.FilePath)
+		if err != nil {
+			return err
+		}
+		m.currentSession = sess
+		m.messages = messages
+		m.truncateLocal(fromSequence)
+		if err := m.fileStore.UpdateSession(m.currentSession, m.messages); err != nil {
+			return err
+		}
+	}
+
+	if m.onTruncate != nil {
+		m.onTruncate(m.currentSession.ID, fromSequence)
+	}
+	if m.index != nil {
+		return m.index.DeleteSessionMessages(m.currentSession.ID, fromSequence)
+	}
+	return nil
+}
+
+// truncateLocal 在内存中删除序号不小于 fromSequence 的消息并更新会话统计
+func (m *SessionManager) truncateLocal(fromSequence int) {
+	kept := make([]SessionMessage, 0, len(m.messages))
+	tokenCount := 0
+	for _, msg := range m.messages {
+		if msg.Sequence < fromSequence {
+			kept = append(kept, msg)
+			tokenCount += msg.TokenCount
+		}
+	}
+	m.messages = kept
+	m.currentSession.MessageCount = len(kept)
+	m.currentSession.TokenCount = tokenCount
+	m.currentSession.UpdatedAt = time.Now()
+}
+
 // GetRecentMessages 获取最近 N 条消息
 func (m *SessionManager) GetRecentMessages(n int) []SessionMessage {
 	if len(m.messages) <= n {
@@ -324,6 +439,96 @@ func (m *SessionManager) RestoreSession(sessionID string) error {
 	return m.LoadSession(sessionID)
 }
 
+// ForkSession 从当前会话的指定消息序号处创建分支会话
+// 新会话复制序号不大于 seq 的消息，并记录父会话信息；原会话保持活跃，可随时切回
+func (m *SessionManager) ForkSession(seq int) (*Session, error) {
+	if m.currentSession == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var copied []SessionMessage
+	tokenCount := 0
+	found := false
+	for _, msg := range m.messages {
+		if msg.Sequence <= seq {
+			copied = append(copied, msg)
+			tokenCount += msg.TokenCount
+		}
+		if msg.Sequence == seq {
+			found = true
+		}
+	}
+	if !found {
+		return nil, NewMemoryError("ForkSession", fmt.Errorf("消息序号 %d 不存在", seq))
+	}
+
+	parent := m.currentSession
+	fork := &Session{
+		ID:           uuid.New().String(),
+		Title:        parent.Title,
+		ProjectPath:  parent.ProjectPath,
+		Status:       StatusActive,
+		ParentID:     parent.ID,
+		ForkSequence: seq,
+		MessageCount: len(copied),
+		TokenCount:   tokenCount,
+		CreatedAt:    time.Now(),
+	}
+
+	if err := m.fileStore.CreateSession(fork); err != nil {
+		return nil, err
+	}
+	if err := m.fileStore.UpdateSession(fork, copied); err != nil {
+		return nil, err
+	}
+	if err := m.indexMessages(fork.ID, copied...); err != nil {
+		return nil, err
+	}
+
+	// 切换到分支
+	m.currentSession = fork
+	m.messages = copied
+
+	return fork, nil
+}
+
+// SessionTreeNode 会话树节点
+type SessionTreeNode struct {
+	Session  *Session
+	Children []*SessionTreeNode
+}
+
+// BuildSessionTree 按父子关系构建会话树
+// 父会话不存在的分支会话作为根节点返回
+func (m *SessionManager) BuildSessionTree() ([]*SessionTreeNode, error) {
+	sessions, err := m.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	// 按创建时间升序，保证子节点顺序稳定
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	nodes := make(map[string]*SessionTreeNode, len(sessions))
+	for _, sess := range sessions {
+		nodes[sess.ID] = &SessionTreeNode{Session: sess}
+	}
+
+	var roots []*SessionTreeNode
+	for _, sess := range sessions {
+		node := nodes[sess.ID]
+		if parent, ok := nodes[sess.ParentID]; ok && sess.ParentID != sess.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots, nil
+}
+
 // BuildContext 构建会话上下文
 func (m *SessionManager) BuildContext() (string, error) {
 	if len(m.messages) == 0 {
@@ -380,7 +585,14 @@ func (m *SessionManager) ClearMessages() error {
 	m.currentSession.TokenCount = 0
 	m.currentSession.UpdatedAt = time.Now()
 
-	return m.fileStore.UpdateSession(m.currentSession, m.messages)
+	if err := m.fileStore.UpdateSession(m.currentSession, m.messages); err != nil {
+		return err
+	}
+
+	if m.index != nil {
+		return m.index.DeleteSessionMessages(m.currentSession.ID, 1)
+	}
+	return nil
 }
 
 // findSessionFile 查找会话文件
@@ -392,6 +604,15 @@ func (m *SessionManager) findSessionFile(sessionID string) (string, error) {
 		sessDir = m.storage.GetGlobalSessionsPath()
 	}
 
+	// 文件名仅包含 ID 前 8 位
+	prefix := sessionID
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+	if prefix == "" {
+		return "", ErrSessionNotFound
+	}
+
 	var found string
 	err := filepath.Walk(sessDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -399,7 +620,7 @@ func (m *SessionManager) findSessionFile(sessionID string) (string, error) {
 		}
 		if !info.IsDir() && strings.HasSuffix(path, ".md") {
 			// 检查文件名是否包含 sessionID
-			if strings.Contains(filepath.Base(path), sessionID[:8]) {
+			if strings.Contains(filepath.Base(path), prefix) {
 				found = path
 				return filepath.SkipAll
 			}
@@ -214,7 +214,7 @@ func (m *ShortTermMemoryManager) GetExpired() ([]*Memory, error) {
 	for _, idx := range indexes {
 		if idx.Type == MemoryTypeShortTerm {
 			mem, err := m.fileStore.ReadMemory(idx.FilePath)
-			if err == nil {
+			if err == nil && !mem.Pinned {
 				expired = append(expired, mem)
 			}
 		}
@@ -215,6 +215,14 @@ func (sm *StorageManager) GetProjectIndexDBPath() string {
 	return filepath.Join(sm.projectRoot, sm.config.Storage.IndexDBName)
 }
 
+// GetProjectVectorDBPath 获取项目向量数据库路径
+func (sm *StorageManager) GetProjectVectorDBPath() string {
+	if sm.projectRoot == "" {
+		return ""
+	}
+	return filepath.Join(sm.projectRoot, "vectors.db")
+}
+
 // ========== 短期记忆子目录 ==========
 
 // GetShortTermTasksPath 获取短期记忆任务目录（根据 scope）
@@ -334,12 +342,20 @@ func (sm *StorageManager) getLongTermCategoryPath(category MemoryCategory, scope
 }
 
 // generateFileName 生成文件名
-// 格式：YYYYMMDD_category_title.md
+// 格式：YYYYMMDD_category_title.md；启用静态加密时以 ID 代替标题，避免文件名泄露内容
 func (sm *StorageManager) generateFileName(mem *Memory) string {
+	if sm.config.Encryption.Enabled {
+		return opaqueFileName(mem)
+	}
+	return titledFileName(mem)
+}
+
+// titledFileName 生成包含标题的文件名
+func titledFileName(mem *Memory) string {
 	date := mem.CreatedAt.Format("20060102")
 	title := sanitizeFileName(mem.Title)
 	if title == "" {
-		title = mem.ID[:8] // 使用 ID 前 8 位
+		title = shortMemoryID(mem.ID) // 使用 ID 前 8 位
 	}
 
 	// 限制文件名长度
@@ -350,6 +366,12 @@ func (sm *StorageManager) generateFileName(mem *Memory) string {
 	return fmt.Sprintf("%s_%s_%s.md", date, string(mem.Category), title)
 }
 
+// opaqueFileName 生成不含标题的文件名
+// 格式：YYYYMMDD_category_<ID 前 8 位>.md
+func opaqueFileName(mem *Memory) string {
+	return fmt.Sprintf("%s_%s_%s.md", mem.CreatedAt.Format("20060102"), string(mem.Category), shortMemoryID(mem.ID))
+}
+
 // GenerateSessionFilePath 生成会话文件路径
 func (sm *StorageManager) GenerateSessionFilePath(sess *Session) string {
 	var basePath string
@@ -458,6 +480,34 @@ func (sm *StorageManager) GetMemoryTypeFromPath(path string) MemoryType {
 	return MemoryTypeLongTerm // 默认
 }
 
+// 分类目录名 -> 分类
+var categoryDirs = map[string]MemoryCategory{
+	"tasks":     CategoryTask,
+	"notes":     CategoryNote,
+	"contexts":  CategoryContext,
+	"projects":  CategoryProject,
+	"knowledge": CategoryKnowledge,
+	"decisions": CategoryDecision,
+}
+
+// GetCategoryFromPath 从所在目录推断记忆分类（无法推断时返回空）
+func (sm *StorageManager) GetCategoryFromPath(path string) MemoryCategory {
+	return categoryDirs[filepath.Base(filepath.Dir(path))]
+}
+
+// GetMemoryRoots 获取存放记忆文件的目录（全局+项目）
+func (sm *StorageManager) GetMemoryRoots() []string {
+	roots := []string{
+		sm.GetGlobalCorePath(),
+		sm.GetGlobalShortTermPath(),
+		sm.GetGlobalLongTermPath(),
+	}
+	if sm.projectRoot != "" {
+		roots = append(roots, sm.GetProjectShortTermPath(), sm.GetProjectLongTermPath())
+	}
+	return roots
+}
+
 // ListMemoryFiles 列出指定目录下的所有记忆文件
 func (sm *StorageManager) ListMemoryFiles(dir string) ([]string, error) {
 	var files []string
@@ -483,14 +533,7 @@ func (sm *StorageManager) ListMemoryFiles(dir string) ([]string, error) {
 func (sm *StorageManager) GetAllMemoryPaths() ([]string, error) {
 	var allFiles []string
 
-	// 全局记忆
-	globalDirs := []string{
-		sm.GetGlobalCorePath(),
-		sm.GetGlobalShortTermPath(),
-		sm.GetGlobalLongTermPath(),
-	}
-
-	for _, dir := range globalDirs {
+	for _, dir := range sm.GetMemoryRoots() {
 		files, err := sm.ListMemoryFiles(dir)
 		if err != nil && !os.IsNotExist(err) {
 			return nil, err
@@ -498,22 +541,6 @@ func (sm *StorageManager) GetAllMemoryPaths() ([]string, error) {
 		allFiles = append(allFiles, files...)
 	}
 
-	// 项目记忆
-	if sm.projectRoot != "" {
-		projectDirs := []string{
-			sm.GetProjectShortTermPath(),
-			sm.GetProjectLongTermPath(),
-		}
-
-		for _, dir := range projectDirs {
-			files, err := sm.ListMemoryFiles(dir)
-			if err != nil && !os.IsNotExist(err) {
-				return nil, err
-			}
-			allFiles = append(allFiles, files...)
-		}
-	}
-
 	return allFiles, nil
 }
 
@@ -0,0 +1,187 @@
+// Package v2 提供记忆取代检测：新记忆写入时由 LLM 判断是否更新或与相似的旧记忆矛盾
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 单次检测最多比较的相似旧记忆数
+const maxSupersessionCandidates = 3
+
+// SupersessionChange 新记忆与一条旧记忆的关系变化
+type SupersessionChange struct {
+	Old        *Memory      `json:"old"`
+	Relation   RelationType `json:"relation"` // supersedes（旧记忆已归档）或 contradicts（两者均保留）
+	Reason     string       `json:"reason,omitempty"`
+	Similarity float64      `json:"similarity"`
+}
+
+// SupersessionResult 取代检测结果
+type SupersessionResult struct {
+	Memory  *Memory               `json:"memory"`
+	Changes []*SupersessionChange `json:"changes"`
+}
+
+// Summary 返回面向用户的变化说明
+func (r *SupersessionResult) Summary() string {
+	if r == nil || len(r.Changes) == 0 {
+		return ""
+	}
+
+	var lines []string
+	for _, change := range r.Changes {
+		reason := ""
+		if change.Reason != "" {
+			reason = "：" + change.Reason
+		}
+		switch change.Relation {
+		case RelationSupersedes:
+			lines = append(lines, fmt.Sprintf("🔄 新记忆「%s」取代了「%s」，旧记忆已归档%s",
+				r.Memory.Title, change.Old.Title, reason))
+		case RelationContradicts:
+			lines = append(lines, fmt.Sprintf("⚠️  新记忆「%s」与「%s」[%s] 矛盾，可用 /memory archive %s 归档旧记忆%s",
+				r.Memory.Title, change.Old.Title, shortMemoryID(change.Old.ID), shortMemoryID(change.Old.ID), reason))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// supersessionVerdict LLM 对一条旧记忆的判断
+type supersessionVerdict struct {
+	Index    int    `json:"index"`
+	Relation string `json:"relation"`
+	Reason   string `json:"reason"`
+}
+
+// SupersessionDetector 记忆取代检测器
+// 新的长期记忆写入后，查找高相似度的旧记忆并由 LLM 判断：
+// 被更新的旧记忆归档并记录 supersedes 关联，相互矛盾但无法判断新旧的记录 contradicts 关联
+type SupersessionDetector struct {
+	longTermMgr *LongTermMemoryManager
+	config      *MemoryConfig
+
+	complete CompleteFunc
+	mu       sync.RWMutex
+}
+
+// NewSupersessionDetector 创建取代检测器（complete 为 nil 时不执行检测）
+func NewSupersessionDetector(longTermMgr *LongTermMemoryManager, config *MemoryConfig, complete CompleteFunc) *SupersessionDetector {
+	return &SupersessionDetector{
+		longTermMgr: longTermMgr,
+		config:      config,
+		complete:    complete,
+	}
+}
+
+// SetCompleteFunc 设置 LLM 补全函数
+func (d *SupersessionDetector) SetCompleteFunc(complete CompleteFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.complete = complete
+}
+
+// Detect 检测新记忆是否取代或与已有记忆矛盾，并记录关联、归档被取代的记忆
+// 新记忆需已生成向量；未配置 LLM、未启用或没有相似记忆时返回 nil
+func (d *SupersessionDetector) Detect(ctx context.Context, mem *Memory) (*SupersessionResult, error) {
+	d.mu.RLock()
+	complete := d.complete
+	d.mu.RUnlock()
+
+	threshold := d.config.LongTerm.SupersedeSimilarity
+	if complete == nil || threshold <= 0 {
+		return nil, nil
+	}
+
+	candidates, err := d.longTermMgr.FindSimilar(mem.ID, threshold, maxSupersessionCandidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	reply, err := complete(ctx, buildSupersessionPrompt(mem, candidates))
+	if err != nil {
+		return nil, fmt.Errorf("LLM 取代检测失败: %w", err)
+	}
+
+	verdicts, err := parseSupersessionReply(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SupersessionResult{Memory: mem}
+	for _, verdict := range verdicts {
+		if verdict.Index < 1 || verdict.Index > len(candidates) {
+			continue
+		}
+		candidate := candidates[verdict.Index-1]
+		change := &SupersessionChange{
+			Old:        candidate.Memory,
+			Reason:     strings.TrimSpace(verdict.Reason),
+			Similarity: candidate.Score,
+		}
+
+		relation, err := ParseRelationType(verdict.Relation)
+		if err != nil {
+			continue
+		}
+		// 固定的记忆不会被归档，只记录矛盾
+		if relation == RelationSupersedes && candidate.Memory.Pinned {
+			relation = RelationContradicts
+		}
+
+		switch relation {
+		case RelationSupersedes:
+			if err := d.longTermMgr.Supersede(mem.ID, candidate.Memory.ID); err != nil {
+				return result, err
+			}
+		case RelationContradicts:
+			if err := d.longTermMgr.AddTypedRelation(mem.ID, candidate.Memory.ID, RelationContradicts); err != nil {
+				return result, err
+			}
+		default:
+			continue
+		}
+
+		change.Relation = relation
+		result.Changes = append(result.Changes, change)
+	}
+
+	if len(result.Changes) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// buildSupersessionPrompt 生成取代检测提示词
+func buildSupersessionPrompt(mem *Memory, candidates []*RelationSuggestion) string {
+	var prompt strings.Builder
+	prompt.WriteString("用户刚保存了一条新记忆，下面是与它相似的旧记忆。请逐条判断新记忆与旧记忆的关系：\n")
+	prompt.WriteString("- supersedes：新记忆更新或取代了旧记忆（如技术选型变更、旧信息已过时），旧记忆不应再使用\n")
+	prompt.WriteString("- contradicts：两者相互矛盾，但无法确定新记忆是否取代旧记忆\n")
+	prompt.WriteString("- none：两者兼容，可以同时成立\n\n")
+	prompt.WriteString("只输出 JSON：{\"results\": [{\"index\": 1, \"relation\": \"supersedes\", \"reason\": \"简短原因\"}]}\n\n")
+	prompt.WriteString(fmt.Sprintf("新记忆（%s）：%s\n%s\n\n", mem.CreatedAt.Format("2006-01-02"), mem.Title, strings.TrimSpace(mem.Content)))
+	prompt.WriteString("旧记忆：\n")
+	for i, candidate := range candidates {
+		old := candidate.Memory
+		prompt.WriteString(fmt.Sprintf("[%d]（%s）%s\n%s\n\n",
+			i+1, old.UpdatedAt.Format("2006-01-02"), old.Title, strings.TrimSpace(old.Content)))
+	}
+	return prompt.String()
+}
+
+// parseSupersessionReply 解析 LLM 返回的取代判断
+func parseSupersessionReply(reply string) ([]supersessionVerdict, error) {
+	var raw struct {
+		Results []supersessionVerdict `json:"results"`
+	}
+	if err := decodeLLMJSON(reply, &raw, "取代检测结果"); err != nil {
+		return nil, err
+	}
+	return raw.Results, nil
+}
@@ -4,6 +4,8 @@ package v2
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -157,11 +159,21 @@ func (s *IndexSyncer) syncFile(filePath string, existingIndex *MemoryIndex, resu
 }
 
 // SyncSingle 同步单个文件
+// 文件被移动到其他分类目录时，按新路径校正记忆的类型、作用域与分类，并沿用原索引
 func (s *IndexSyncer) SyncSingle(filePath string) error {
-	// 检查文件是否存在
+	// 文件不存在，删除索引与向量
 	if !FileExists(filePath) {
-		// 文件不存在，删除索引
-		return s.index.DeleteIndexByPath(filePath)
+		existingIndex, err := s.index.GetIndexByPath(filePath)
+		if err != nil {
+			return err
+		}
+		if err := s.index.DeleteIndex(existingIndex.ID); err != nil {
+			return err
+		}
+		if s.vector != nil {
+			_ = s.vector.DeleteVector(existingIndex.ID)
+		}
+		return nil
 	}
 
 	// 读取文件
@@ -170,11 +182,24 @@ func (s *IndexSyncer) SyncSingle(filePath string) error {
 		return err
 	}
 
-	// 检查现有索引
+	// 按所在目录校正元数据，并写回 frontmatter
+	if s.applyPathMetadata(mem) {
+		if err := s.fileStore.UpdateMemory(mem); err != nil {
+			return err
+		}
+	}
+
+	// 检查现有索引，路径未命中时按 ID 查找（文件被移动或重命名）
 	existingIndex, err := s.index.GetIndexByPath(filePath)
 	if err != nil && !IsNotFound(err) {
 		return err
 	}
+	if existingIndex == nil {
+		existingIndex, err = s.index.GetIndex(mem.ID)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
 
 	// 计算内容哈希
 	currentHash := CalculateContentHash([]byte(mem.Content))
@@ -187,7 +212,8 @@ func (s *IndexSyncer) SyncSingle(filePath string) error {
 	}
 
 	// 检查是否需要更新
-	if existingIndex.ContentHash != currentHash {
+	if existingIndex.ContentHash != currentHash || existingIndex.FilePath != filePath ||
+		existingIndex.Type != mem.Type || existingIndex.Scope != mem.Scope || existingIndex.Category != mem.Category {
 		idx := MemoryToIndex(mem)
 		idx.ContentHash = currentHash
 		idx.AccessCount = existingIndex.AccessCount
@@ -197,6 +223,45 @@ func (s *IndexSyncer) SyncSingle(filePath string) error {
 	return nil
 }
 
+// applyPathMetadata 按文件所在目录校正记忆的类型、作用域与分类，返回是否有修改
+func (s *IndexSyncer) applyPathMetadata(mem *Memory) bool {
+	path := mem.FilePath
+	if !s.storage.IsGlobalPath(path) && !s.storage.IsProjectPath(path) {
+		return false
+	}
+
+	memType := s.storage.GetMemoryTypeFromPath(path)
+	if memType == MemoryTypeSession {
+		return false
+	}
+
+	scope := s.storage.GetScopeFromPath(path)
+	category := s.storage.GetCategoryFromPath(path)
+	if memType == MemoryTypeCore {
+		scope = ScopeGlobal
+		category = mem.Category
+	}
+	if category == "" || validateMemoryCategory(memType, category) != nil {
+		category = mem.Category
+	}
+	if validateMemoryCategory(memType, category) != nil {
+		category = memoryTypeCategories[memType][0]
+	}
+
+	if mem.Type == memType && mem.Scope == scope && mem.Category == category {
+		return false
+	}
+
+	// 离开短期记忆目录后不再过期
+	if mem.Type == MemoryTypeShortTerm && memType != MemoryTypeShortTerm {
+		mem.ExpiresAt = nil
+	}
+	mem.Type = memType
+	mem.Scope = scope
+	mem.Category = category
+	return true
+}
+
 // CheckConsistency 检查索引一致性
 func (s *IndexSyncer) CheckConsistency() (*ConsistencyReport, error) {
 	report := &ConsistencyReport{
@@ -238,7 +303,7 @@ func (s *IndexSyncer) CheckConsistency() (*ConsistencyReport, error) {
 		}
 
 		// 检查哈希是否匹配
-		content, err := os.ReadFile(filePath)
+		content, err := s.fileStore.ReadFile(filePath)
 		if err != nil {
 			continue
 		}
@@ -335,10 +400,44 @@ func (s *IndexSyncer) Reindex() (*SyncResult, error) {
 		}
 	}
 
+	// 重建会话消息索引
+	s.reindexSessionMessages(result)
+
 	result.DurationMs = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
+// reindexSessionMessages 从会话文件重建会话消息索引
+func (s *IndexSyncer) reindexSessionMessages(result *SyncResult) {
+	dirs := []string{s.storage.GetGlobalSessionsPath()}
+	if s.storage.GetProjectRoot() != "" {
+		dirs = append(dirs, s.storage.GetProjectSessionsPath())
+	}
+
+	for _, dir := range dirs {
+		_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".md") {
+				return nil
+			}
+
+			sess, messages, err := s.fileStore.ReadSession(path)
+			if err != nil {
+				result.Errors++
+				result.ErrorDetails = append(result.ErrorDetails, fmt.Sprintf("%s: %v", path, err))
+				return nil
+			}
+
+			for i := range messages {
+				if err := s.index.IndexSessionMessage(sess.ID, &messages[i]); err != nil {
+					result.Errors++
+					result.ErrorDetails = append(result.ErrorDetails, fmt.Sprintf("索引会话消息 %s#%d: %v", sess.ID, messages[i].Sequence, err))
+				}
+			}
+			return nil
+		})
+	}
+}
+
 // CleanOrphanedIndexes 清理孤立索引
 func (s *IndexSyncer) CleanOrphanedIndexes() (int, error) {
 	// 获取所有文件
@@ -416,7 +515,7 @@ func (s *IndexSyncer) IndexOrphanedFiles() (int, error) {
 	return indexed, nil
 }
 
-// WatchFileChange 监听文件变更（用于增量同步）
+// WatchFileChange 按修改时间扫描文件变更（用于增量同步，实时监听见 FileWatcher）
 // 返回需要同步的文件列表
 func (s *IndexSyncer) WatchFileChange(since time.Time) ([]string, error) {
 	files, err := s.storage.GetAllMemoryPaths()
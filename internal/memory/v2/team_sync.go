@@ -0,0 +1,470 @@
+// Package v2 提供团队记忆同步：通过 git 远端在多台机器间共享项目知识与决策
+package v2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 推送被拒绝（远端已有新提交）时的最大重试次数
+const maxTeamSyncAttempts = 3
+
+// TeamSyncResult 团队同步结果
+type TeamSyncResult struct {
+	Exported      int  `json:"exported"`       // 推送到远端的新增或更新记忆数
+	Imported      int  `json:"imported"`       // 从远端拉取的新增或更新记忆数
+	ArchivedLocal int  `json:"archived_local"` // 远端已删除、本地归档的记忆数
+	DeletedRemote int  `json:"deleted_remote"` // 本地已删除或归档、从远端移除的记忆数
+	Conflicts     int  `json:"conflicts"`      // 两端均有修改、按更新时间解决的记忆数
+	Pushed        bool `json:"pushed"`
+
+	importedPaths []string // 本地新写入的文件，需要重建索引
+	removedPaths  []string // 被远端新路径替换的本地旧文件
+	archivedIDs   []string // 本地归档的记忆，需要删除索引与向量
+}
+
+// TeamSyncStatus 团队同步状态
+type TeamSyncStatus struct {
+	Remote     string           `json:"remote"`
+	Branch     string           `json:"branch"`
+	Categories []MemoryCategory `json:"categories"`
+	LastSync   time.Time        `json:"last_sync"`
+	Shared     int              `json:"shared"`    // 上次同步后远端的记忆数
+	Dir        string           `json:"dir"`       // 同步工作目录
+	Plaintext  bool             `json:"plaintext"` // 本地已加密，但同步克隆与远端为明文
+}
+
+// teamSyncState 上次同步后远端的记忆（ID → 内容哈希），用于区分新增与删除
+type teamSyncState struct {
+	Synced   map[string]string `json:"synced"`
+	LastSync time.Time         `json:"last_sync"`
+}
+
+// teamFile 参与同步的一个记忆文件
+type teamFile struct {
+	rel  string // 相对记忆根目录的路径
+	path string
+	data []byte
+	mem  *Memory
+	hash string // 正文内容哈希
+}
+
+// TeamSync 团队记忆同步器
+// 远端仓库的布局与项目记忆目录相同，但只包含共享分类的项目长期记忆；
+// 核心记忆、会话与短期记忆从不参与同步。同步在独立的本地克隆中进行，
+// 以记忆 ID 对齐两端文件：只存在一端的按上次同步状态判断是新增还是删除，
+// 两端都存在且不同的，保留 UpdatedAt 较新的一份（相同时比较内容哈希，保证各机器结果一致）。
+// 成员各自的加密密钥不同，远端与同步克隆中的文件始终为明文，导入本地时按本地配置加密
+type TeamSync struct {
+	storage   *StorageManager
+	fileStore *MarkdownFileStore
+	config    TeamSyncConfig
+	git       string
+
+	dir string // 同步工作目录：repo/ 为远端克隆，state.json 为同步状态
+	mu  sync.Mutex
+}
+
+// NewTeamSync 创建当前项目的团队同步器（需要本地 git 与 team_sync.remote 配置）
+func NewTeamSync(storage *StorageManager, fileStore *MarkdownFileStore, config TeamSyncConfig) (*TeamSync, error) {
+	if config.Remote == "" {
+		return nil, fmt.Errorf("未配置团队同步远端，请在项目配置中设置 team_sync.remote")
+	}
+	projectRoot := storage.GetProjectRoot()
+	if projectRoot == "" {
+		return nil, fmt.Errorf("未设置项目，无法同步团队记忆")
+	}
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return nil, fmt.Errorf("未找到 git，无法同步团队记忆: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(projectRoot))
+	name := filepath.Base(storage.GetCurrentProject()) + "-" + hex.EncodeToString(sum[:4])
+	dir := filepath.Join(teamSyncRoot(storage), name)
+
+	// 同步克隆与远端无法按成员各自的密钥加密，启用静态加密时需显式确认
+	if storage.config.Encryption.Enabled && !config.AllowPlaintext {
+		return nil, fmt.Errorf("已启用静态加密，但团队同步会在 %s 与远端保存明文副本；"+
+			"如确认共享，请在项目配置中设置 team_sync.allow_plaintext: true", dir)
+	}
+
+	return &TeamSync{
+		storage:   storage,
+		fileStore: fileStore,
+		config:    config,
+		git:       git,
+		dir:       dir,
+	}, nil
+}
+
+// teamSyncRoot 返回各项目同步工作目录的上级目录（~/.aimate/sync）
+func teamSyncRoot(storage *StorageManager) string {
+	return filepath.Join(filepath.Dir(storage.GetGlobalRoot()), "sync")
+}
+
+// Status 返回同步配置与上次同步状态
+func (t *TeamSync) Status() *TeamSyncStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.loadState()
+	return &TeamSyncStatus{
+		Remote:     t.config.Remote,
+		Branch:     t.config.Branch,
+		Categories: t.config.Categories,
+		LastSync:   state.LastSync,
+		Shared:     len(state.Synced),
+		Dir:        t.dir,
+		Plaintext:  t.storage.config.Encryption.Enabled,
+	}
+}
+
+// Sync 拉取远端、合并两端记忆并推送，推送被拒绝时重新拉取后重试
+func (t *TeamSync) Sync() (*TeamSyncResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.ensureClone(); err != nil {
+		return nil, err
+	}
+	state := t.loadState()
+
+	// 重试时远端克隆会被重置，但之前尝试中导入与归档的本地文件已经生效，
+	// 这些变更要带到最终结果中，调用方才能为其重建索引
+	var carried *TeamSyncResult
+	var lastErr error
+	for attempt := 0; attempt < maxTeamSyncAttempts; attempt++ {
+		if err := t.fetch(); err != nil {
+			return carried, err
+		}
+
+		result, err := t.merge(state)
+		result.carryLocalChanges(carried)
+		if err != nil {
+			return result, err
+		}
+
+		pushed, err := t.push(result)
+		if err != nil {
+			if isPushRejected(err) {
+				lastErr = err
+				carried = result
+				continue
+			}
+			return result, err
+		}
+		result.Pushed = pushed
+
+		remote, err := t.scan(t.repoDir())
+		if err != nil {
+			return result, err
+		}
+		state.Synced = make(map[string]string, len(remote))
+		for id, file := range remote {
+			state.Synced[id] = file.hash
+		}
+		state.LastSync = time.Now()
+		if err := t.saveState(state); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+
+	return carried, fmt.Errorf("推送团队记忆失败（远端持续更新）: %w", lastErr)
+}
+
+// carryLocalChanges 并入之前尝试中已写入本地的变更
+func (r *TeamSyncResult) carryLocalChanges(prev *TeamSyncResult) {
+	if prev == nil {
+		return
+	}
+	r.Imported += prev.Imported
+	r.ArchivedLocal += prev.ArchivedLocal
+	r.importedPaths = append(append([]string(nil), prev.importedPaths...), r.importedPaths...)
+	r.removedPaths = append(append([]string(nil), prev.removedPaths...), r.removedPaths...)
+	r.archivedIDs = append(append([]string(nil), prev.archivedIDs...), r.archivedIDs...)
+}
+
+// merge 按记忆 ID 合并本地与远端克隆中的共享记忆
+func (t *TeamSync) merge(state *teamSyncState) (*TeamSyncResult, error) {
+	result := &TeamSyncResult{}
+
+	local, err := t.scan(t.storage.GetProjectRoot())
+	if err != nil {
+		return result, err
+	}
+	remote, err := t.scan(t.repoDir())
+	if err != nil {
+		return result, err
+	}
+
+	ids := make(map[string]bool, len(local)+len(remote))
+	for id := range local {
+		ids[id] = true
+	}
+	for id := range remote {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		l, inLocal := local[id]
+		r, inRemote := remote[id]
+		base, wasSynced := state.Synced[id]
+
+		switch {
+		case inLocal && !inRemote:
+			if wasSynced {
+				// 远端已删除：本地归档
+				if err := t.fileStore.ArchiveMemory(l.mem); err != nil {
+					return result, fmt.Errorf("归档 %s 失败: %w", l.rel, err)
+				}
+				result.archivedIDs = append(result.archivedIDs, l.mem.ID)
+				result.ArchivedLocal++
+				continue
+			}
+			if err := t.exportFile(l, nil); err != nil {
+				return result, err
+			}
+			result.Exported++
+
+		case !inLocal && inRemote:
+			if wasSynced {
+				// 本地已删除或归档：从远端移除
+				if err := os.Remove(filepath.Join(t.repoDir(), r.rel)); err != nil {
+					return result, fmt.Errorf("移除远端记忆 %s 失败: %w", r.rel, err)
+				}
+				result.DeletedRemote++
+				continue
+			}
+			if err := t.importFile(r, nil, result); err != nil {
+				return result, err
+			}
+			result.Imported++
+
+		default:
+			if bytes.Equal(l.data, r.data) && l.rel == r.rel {
+				continue
+			}
+			if l.hash != r.hash && (!wasSynced || (base != l.hash && base != r.hash)) {
+				result.Conflicts++
+			}
+			if newerTeamFile(l, r) {
+				if err := t.exportFile(l, r); err != nil {
+					return result, err
+				}
+				result.Exported++
+			} else {
+				if err := t.importFile(r, l, result); err != nil {
+					return result, err
+				}
+				result.Imported++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// exportFile 将本地文件写入远端克隆，replaced 为远端同一记忆的旧文件
+func (t *TeamSync) exportFile(file, replaced *teamFile) error {
+	dst := filepath.Join(t.repoDir(), file.rel)
+	if err := EnsureDir(dst); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dst, file.data, 0644); err != nil {
+		return fmt.Errorf("写入远端记忆 %s 失败: %w", file.rel, err)
+	}
+	if replaced != nil && replaced.rel != file.rel {
+		_ = os.Remove(filepath.Join(t.repoDir(), replaced.rel))
+	}
+	return nil
+}
+
+// importFile 将远端文件写入本地项目记忆目录，replaced 为本地同一记忆的旧文件
+func (t *TeamSync) importFile(file, replaced *teamFile, result *TeamSyncResult) error {
+	dst := filepath.Join(t.storage.GetProjectRoot(), file.rel)
+	if err := EnsureDir(dst); err != nil {
+		return err
+	}
+	return t.fileStore.withLock(dst, func() error {
+		if err := t.fileStore.writeFile(dst, file.data); err != nil {
+			return fmt.Errorf("写入本地记忆 %s 失败: %w", file.rel, err)
+		}
+		paths := []string{dst}
+		if replaced != nil && replaced.path != dst {
+			_ = os.Remove(replaced.path)
+			paths = append(paths, replaced.path)
+			result.removedPaths = append(result.removedPaths, replaced.path)
+		}
+		t.fileStore.record("sync "+t.fileStore.describeMemory(file.mem), paths...)
+		result.importedPaths = append(result.importedPaths, dst)
+		return nil
+	})
+}
+
+// scan 读取根目录下共享分类目录中的项目长期记忆（ID → 文件）
+func (t *TeamSync) scan(root string) (map[string]*teamFile, error) {
+	files := make(map[string]*teamFile)
+	for _, category := range t.config.Categories {
+		rel, err := filepath.Rel(t.storage.GetProjectRoot(), t.storage.getLongTermCategoryPath(category, ScopeProject))
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(root, rel)
+		if !FileExists(dir) {
+			continue
+		}
+
+		paths, err := t.storage.ListMemoryFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			data, err := t.fileStore.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			mem, err := t.fileStore.parser.ParseMemory(data)
+			if err != nil || mem.ID == "" {
+				continue
+			}
+			// 只共享活跃的长期记忆，其他类型即使出现在共享目录中也忽略
+			if mem.Type != MemoryTypeLongTerm || mem.Category != category || mem.Status != StatusActive {
+				continue
+			}
+			mem.FilePath = path
+			fileRel, _ := filepath.Rel(root, path)
+			files[mem.ID] = &teamFile{
+				rel:  fileRel,
+				path: path,
+				data: data,
+				mem:  mem,
+				hash: CalculateContentHash([]byte(mem.Content)),
+			}
+		}
+	}
+	return files, nil
+}
+
+// newerTeamFile 判断本地文件是否应覆盖远端文件
+func newerTeamFile(local, remote *teamFile) bool {
+	if !local.mem.UpdatedAt.Equal(remote.mem.UpdatedAt) {
+		return local.mem.UpdatedAt.After(remote.mem.UpdatedAt)
+	}
+	if local.hash != remote.hash {
+		return local.hash > remote.hash
+	}
+	return bytes.Compare(local.data, remote.data) > 0
+}
+
+// ensureClone 克隆远端（远端为空仓库时同样可以克隆），并保持远端地址与配置一致
+func (t *TeamSync) ensureClone() error {
+	repo := t.repoDir()
+	if !isGitRepo(repo) {
+		if err := os.MkdirAll(t.dir, 0755); err != nil {
+			return fmt.Errorf("创建同步目录失败: %w", err)
+		}
+		if _, err := runGit(t.git, t.dir, "clone", "-q", t.config.Remote, "repo"); err != nil {
+			return fmt.Errorf("克隆团队记忆仓库失败: %w", err)
+		}
+	} else if _, err := runGit(t.git, repo, "remote", "set-url", "origin", t.config.Remote); err != nil {
+		return fmt.Errorf("更新远端地址失败: %w", err)
+	}
+	ensureGitIdentity(t.git, repo)
+	return nil
+}
+
+// fetch 拉取远端并将克隆重置为远端分支（远端分支不存在时从空分支开始）
+func (t *TeamSync) fetch() error {
+	repo := t.repoDir()
+	if _, err := runGit(t.git, repo, "fetch", "-q", "origin"); err != nil {
+		return fmt.Errorf("拉取团队记忆失败: %w", err)
+	}
+
+	remoteRef := "refs/remotes/origin/" + t.config.Branch
+	if _, err := runGit(t.git, repo, "rev-parse", "--verify", "-q", remoteRef); err != nil {
+		_, err := runGit(t.git, repo, "symbolic-ref", "HEAD", "refs/heads/"+t.config.Branch)
+		return err
+	}
+	if _, err := runGit(t.git, repo, "checkout", "-q", "-f", "-B", t.config.Branch, remoteRef); err != nil {
+		return fmt.Errorf("切换同步分支失败: %w", err)
+	}
+	if _, err := runGit(t.git, repo, "clean", "-q", "-fd"); err != nil {
+		return fmt.Errorf("清理同步目录失败: %w", err)
+	}
+	return nil
+}
+
+// push 提交远端克隆中的变更并推送，没有变更时不推送
+func (t *TeamSync) push(result *TeamSyncResult) (bool, error) {
+	repo := t.repoDir()
+	if _, err := runGit(t.git, repo, "add", "-A"); err != nil {
+		return false, fmt.Errorf("暂存团队记忆失败: %w", err)
+	}
+	if _, err := runGit(t.git, repo, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+
+	host, _ := os.Hostname()
+	message := fmt.Sprintf("sync from %s: %d exported, %d deleted", host, result.Exported, result.DeletedRemote)
+	if _, err := runGit(t.git, repo, "commit", "-q", "--no-verify", "--no-gpg-sign", "-m", message); err != nil {
+		return false, fmt.Errorf("提交团队记忆失败: %w", err)
+	}
+	if _, err := runGit(t.git, repo, "push", "-q", "origin", "HEAD:refs/heads/"+t.config.Branch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isPushRejected 判断推送是否因远端已有新提交而被拒绝
+func isPushRejected(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "rejected") || strings.Contains(msg, "fetch first") ||
+		strings.Contains(msg, "non-fast-forward")
+}
+
+// repoDir 远端克隆目录
+func (t *TeamSync) repoDir() string {
+	return filepath.Join(t.dir, "repo")
+}
+
+// loadState 读取同步状态，不存在或损坏时视为从未同步
+func (t *TeamSync) loadState() *teamSyncState {
+	state := &teamSyncState{Synced: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(t.dir, "state.json"))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil || state.Synced == nil {
+		return &teamSyncState{Synced: make(map[string]string)}
+	}
+	return state
+}
+
+// saveState 保存同步状态
+func (t *TeamSync) saveState(state *teamSyncState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(t.dir, "state.json"), data, 0644); err != nil {
+		return fmt.Errorf("保存同步状态失败: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@
 package v2
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -50,6 +51,27 @@ const (
 	CategoryDecision  MemoryCategory = "decision"  // 决策记录
 )
 
+// 各记忆类型允许的分类
+var memoryTypeCategories = map[MemoryType][]MemoryCategory{
+	MemoryTypeCore:      {CategoryPreference, CategoryRule, CategoryPersona},
+	MemoryTypeShortTerm: {CategoryTask, CategoryNote, CategoryContext},
+	MemoryTypeLongTerm:  {CategoryProject, CategoryKnowledge, CategoryDecision},
+}
+
+// validateMemoryCategory 校验记忆类型与分类是否匹配（会话记忆不可直接创建）
+func validateMemoryCategory(memType MemoryType, category MemoryCategory) error {
+	categories, ok := memoryTypeCategories[memType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidMemoryType, memType)
+	}
+	for _, c := range categories {
+		if c == category {
+			return nil
+		}
+	}
+	return fmt.Errorf("记忆类型 %s 不支持分类 %s", memType, category)
+}
+
 // MemoryStatus 记忆状态
 type MemoryStatus string
 
@@ -86,6 +108,9 @@ type Memory struct {
 	// 关联的其他记忆 ID
 	Related []string `yaml:"related,omitempty" json:"related,omitempty"`
 
+	// 关联类型（记忆 ID → 类型），未列出的关联为普通关联
+	RelationTypes map[string]RelationType `yaml:"relation_types,omitempty" json:"relation_types,omitempty"`
+
 	// 来源信息（如：会话 ID、文件路径等）
 	Source string `yaml:"source,omitempty" json:"source,omitempty"`
 
@@ -95,6 +120,9 @@ type Memory struct {
 	// 状态
 	Status MemoryStatus `yaml:"status" json:"status"`
 
+	// 是否固定（固定的记忆不会过期、归档或被合并）
+	Pinned bool `yaml:"pinned,omitempty" json:"pinned,omitempty"`
+
 	// 重要程度（1-5，5 最重要）
 	Importance int `yaml:"importance" json:"importance"`
 
@@ -136,6 +164,12 @@ type Session struct {
 	// 消息计数
 	MessageCount int `yaml:"message_count" json:"message_count"`
 
+	// 父会话 ID（仅分支会话）
+	ParentID string `yaml:"parent_id,omitempty" json:"parent_id,omitempty"`
+
+	// 分支点：复制父会话消息的最大序号（仅分支会话）
+	ForkSequence int `yaml:"fork_sequence,omitempty" json:"fork_sequence,omitempty"`
+
 	// 时间戳
 	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
 	UpdatedAt time.Time `yaml:"updated_at" json:"updated_at"`
@@ -171,23 +205,25 @@ type SessionMessage struct {
 // MemoryFrontmatter Markdown 文件的 frontmatter 元数据
 // 用于 YAML frontmatter 的序列化/反序列化
 type MemoryFrontmatter struct {
-	ID          string         `yaml:"id"`
-	Type        MemoryType     `yaml:"type"`
-	Scope       MemoryScope    `yaml:"scope"`
-	Category    MemoryCategory `yaml:"category"`
-	Title       string         `yaml:"title"`
-	Tags        []string       `yaml:"tags,omitempty"`
-	Related     []string       `yaml:"related,omitempty"`
-	Source      string         `yaml:"source,omitempty"`
-	ProjectPath string         `yaml:"project_path,omitempty"`
-	Status      MemoryStatus   `yaml:"status"`
-	Importance  int            `yaml:"importance"`
-	AccessCount int            `yaml:"access_count"`
-	ContentHash string         `yaml:"content_hash"`
-	ExpiresAt   *time.Time     `yaml:"expires_at,omitempty"`
-	CreatedAt   time.Time      `yaml:"created_at"`
-	UpdatedAt   time.Time      `yaml:"updated_at"`
-	AccessedAt  time.Time      `yaml:"accessed_at"`
+	ID          string                  `yaml:"id"`
+	Type        MemoryType              `yaml:"type"`
+	Scope       MemoryScope             `yaml:"scope"`
+	Category    MemoryCategory          `yaml:"category"`
+	Title       string                  `yaml:"title"`
+	Tags        []string                `yaml:"tags,omitempty"`
+	Related     []string                `yaml:"related,omitempty"`
+	Relations   map[string]RelationType `yaml:"relation_types,omitempty"`
+	Source      string                  `yaml:"source,omitempty"`
+	ProjectPath string                  `yaml:"project_path,omitempty"`
+	Status      MemoryStatus            `yaml:"status"`
+	Pinned      bool                    `yaml:"pinned,omitempty"`
+	Importance  int                     `yaml:"importance"`
+	AccessCount int                     `yaml:"access_count"`
+	ContentHash string                  `yaml:"content_hash"`
+	ExpiresAt   *time.Time              `yaml:"expires_at,omitempty"`
+	CreatedAt   time.Time               `yaml:"created_at"`
+	UpdatedAt   time.Time               `yaml:"updated_at"`
+	AccessedAt  time.Time               `yaml:"accessed_at"`
 }
 
 // SessionFrontmatter 会话文件的 frontmatter 元数据
@@ -198,6 +234,8 @@ type SessionFrontmatter struct {
 	Status       MemoryStatus `yaml:"status"`
 	TokenCount   int          `yaml:"token_count"`
 	MessageCount int          `yaml:"message_count"`
+	ParentID     string       `yaml:"parent_id,omitempty"`
+	ForkSequence int          `yaml:"fork_sequence,omitempty"`
 	CreatedAt    time.Time    `yaml:"created_at"`
 	UpdatedAt    time.Time    `yaml:"updated_at"`
 }
@@ -208,6 +246,9 @@ type MemorySearchResult struct {
 	Score      float64 `json:"score"`      // 相关性分数
 	MatchType  string  `json:"match_type"` // 匹配类型：vector/keyword/time
 	Highlights string  `json:"highlights"` // 高亮片段
+
+	// 得分说明（融合、时间权重、重排序与多样化各阶段的分数）
+	Explanation *ScoreExplanation `json:"explanation,omitempty"`
 }
 
 // MemoryStats 记忆统计信息
@@ -289,9 +330,11 @@ func (m *Memory) ToFrontmatter() *MemoryFrontmatter {
 		Title:       m.Title,
 		Tags:        m.Tags,
 		Related:     m.Related,
+		Relations:   m.RelationTypes,
 		Source:      m.Source,
 		ProjectPath: m.ProjectPath,
 		Status:      m.Status,
+		Pinned:      m.Pinned,
 		Importance:  m.Importance,
 		AccessCount: m.AccessCount,
 		ContentHash: m.ContentHash,
@@ -311,9 +354,11 @@ func (m *Memory) FromFrontmatter(fm *MemoryFrontmatter) {
 	m.Title = fm.Title
 	m.Tags = fm.Tags
 	m.Related = fm.Related
+	m.RelationTypes = fm.Relations
 	m.Source = fm.Source
 	m.ProjectPath = fm.ProjectPath
 	m.Status = fm.Status
+	m.Pinned = fm.Pinned
 	m.Importance = fm.Importance
 	m.AccessCount = fm.AccessCount
 	m.ContentHash = fm.ContentHash
@@ -332,6 +377,8 @@ func (s *Session) ToFrontmatter() *SessionFrontmatter {
 		Status:       s.Status,
 		TokenCount:   s.TokenCount,
 		MessageCount: s.MessageCount,
+		ParentID:     s.ParentID,
+		ForkSequence: s.ForkSequence,
 		CreatedAt:    s.CreatedAt,
 		UpdatedAt:    s.UpdatedAt,
 	}
@@ -345,13 +392,15 @@ func (s *Session) FromFrontmatter(fm *SessionFrontmatter) {
 	s.Status = fm.Status
 	s.TokenCount = fm.TokenCount
 	s.MessageCount = fm.MessageCount
+	s.ParentID = fm.ParentID
+	s.ForkSequence = fm.ForkSequence
 	s.CreatedAt = fm.CreatedAt
 	s.UpdatedAt = fm.UpdatedAt
 }
 
 // IsExpired 检查记忆是否已过期
 func (m *Memory) IsExpired() bool {
-	if m.ExpiresAt == nil {
+	if m.Pinned || m.ExpiresAt == nil {
 		return false
 	}
 	return time.Now().After(*m.ExpiresAt)
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -46,22 +47,77 @@ type VectorSearchResult struct {
 
 // VectorStats 向量统计
 type VectorStats struct {
-	TotalVectors int `json:"total_vectors"`
-	Dimension    int `json:"dimension"`
+	TotalVectors   int    `json:"total_vectors"`
+	Dimension      int    `json:"dimension"`
+	Model          string `json:"model"`
+	IndexedVectors int    `json:"indexed_vectors"`
+	IndexReady     bool   `json:"index_ready"`
+	NeedsReembed   bool   `json:"needs_reembed"`
 }
 
+// VectorSpace 向量空间：生成向量的模型与维度，不同空间的向量不可相互比较
+type VectorSpace struct {
+	Model     string `json:"model"`
+	Dimension int    `json:"dimension"`
+}
+
+// 向量数少于该值时直接精确搜索，ANN 索引的收益不明显
+const defaultANNThreshold = 1000
+
+// 向量表名
+const (
+	vectorTable  = "memory_vectors"
+	reembedTable = "memory_vectors_reembed" // 重建期间写入新空间向量的影子表
+)
+
 // SQLiteVectorStore 基于 SQLite 的向量存储实现
-// 使用 BLOB 存储向量，并在查询时计算余弦相似度
-// 这是一个简化实现，适用于小规模数据（< 10000 条）
-// 对于大规模数据，建议使用 sqlite-vec 扩展或外部向量数据库
+// 使用 BLOB 存储向量，并维护一个持久化在 vectors.db 旁（.hnsw 文件）的 HNSW 索引
+// 向量数较少或索引未就绪时退化为逐条计算余弦相似度的精确搜索
+//
+// 库中记录了向量所属的模型与维度。配置的嵌入模型变化后，旧向量原样保留，
+// 新写入的向量进入影子表，直到 reembed 完成后整体替换
 type SQLiteVectorStore struct {
-	db        *sql.DB
-	dbPath    string
-	dimension int
+	db     *sql.DB
+	dbPath string
+
+	// 向量空间：target 为当前配置，current 为主表向量所属空间
+	target      VectorSpace
+	current     VectorSpace
+	reembedding bool
+	spaceMu     sync.RWMutex
+
+	// ANN 索引
+	ann          *HNSWIndex
+	annPath      string
+	annThreshold int
+	annReady     bool
+	annBuilding  bool
+	annDirty     bool
+	annPending   []annOp
+	annStop      chan struct{}
+	annDone      chan struct{}
+	annMu        sync.Mutex
+}
+
+// annOp 需要同步到索引的写操作（vector 为 nil 表示删除）
+type annOp struct {
+	id     string
+	vector []float32
+	gen    int64 // 写入后的数据库版本号，0 表示未知
+}
+
+// applyTo 将写操作应用到索引，零向量无法参与余弦计算，按删除处理
+func (op annOp) applyTo(ann *HNSWIndex) {
+	if op.vector == nil || calculateNorm(op.vector) == 0 {
+		ann.Delete(op.id)
+		return
+	}
+	ann.Insert(op.id, op.vector)
 }
 
 // NewSQLiteVectorStore 创建 SQLite 向量存储
-func NewSQLiteVectorStore(dbPath string, dimension int) (*SQLiteVectorStore, error) {
+// model 与 dimension 为当前配置的嵌入模型，用于标记新写入的向量并检测模型变化
+func NewSQLiteVectorStore(dbPath string, model string, dimension int) (*SQLiteVectorStore, error) {
 	// 确保目录存在
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -75,9 +131,11 @@ func NewSQLiteVectorStore(dbPath string, dimension int) (*SQLiteVectorStore, err
 	}
 
 	store := &SQLiteVectorStore{
-		db:        db,
-		dbPath:    dbPath,
-		dimension: dimension,
+		db:           db,
+		dbPath:       dbPath,
+		target:       VectorSpace{Model: model, Dimension: dimension},
+		annPath:      dbPath + ".hnsw",
+		annThreshold: defaultANNThreshold,
 	}
 
 	// 初始化表结构
@@ -86,6 +144,15 @@ func NewSQLiteVectorStore(dbPath string, dimension int) (*SQLiteVectorStore, err
 		return nil, err
 	}
 
+	// 识别已有向量所属空间
+	if err := store.initSpace(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// 加载或重建 ANN 索引
+	store.openANN()
+
 	return store, nil
 }
 
@@ -93,17 +160,17 @@ func NewSQLiteVectorStore(dbPath string, dimension int) (*SQLiteVectorStore, err
 func (s *SQLiteVectorStore) initTables() error {
 	queries := []string{
 		// 向量表
-		`CREATE TABLE IF NOT EXISTS memory_vectors (
-			id TEXT PRIMARY KEY,
-			vector BLOB NOT NULL,
-			dimension INTEGER NOT NULL,
-			norm REAL NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
-		)`,
+		vectorTableSQL(vectorTable),
 
 		// 索引
 		`CREATE INDEX IF NOT EXISTS idx_vectors_created_at ON memory_vectors(created_at)`,
+
+		// 元数据表（写入版本号、向量空间）
+		`CREATE TABLE IF NOT EXISTS vector_meta (
+			key TEXT PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`,
+		`INSERT OR IGNORE INTO vector_meta (key, value) VALUES ('generation', 0)`,
 	}
 
 	for _, query := range queries {
@@ -112,15 +179,61 @@ func (s *SQLiteVectorStore) initTables() error {
 		}
 	}
 
+	// 旧版本的向量表没有 model 列
+	if err := s.ensureModelColumn(); err != nil {
+		return fmt.Errorf("初始化向量表失败: %w", err)
+	}
+
 	return nil
 }
 
-// StoreVector 存储向量
+// vectorTableSQL 返回向量表建表语句（主表与影子表结构一致）
+func vectorTableSQL(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		id TEXT PRIMARY KEY,
+		vector BLOB NOT NULL,
+		dimension INTEGER NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		norm REAL NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`
+}
+
+// upsertVectorSQL 返回写入向量的语句，已存在时保留创建时间
+func upsertVectorSQL(table string) string {
+	return `INSERT INTO ` + table + ` (id, vector, dimension, model, norm, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			vector = excluded.vector,
+			dimension = excluded.dimension,
+			model = excluded.model,
+			norm = excluded.norm,
+			updated_at = excluded.updated_at`
+}
+
+// writeTablesLocked 返回写操作的目标表（调用方持有 spaceMu）
+// 空间一致时写主表；重建进行中或空间不一致时写影子表
+func (s *SQLiteVectorStore) writeTablesLocked() []string {
+	var tables []string
+	if s.current == s.target {
+		tables = append(tables, vectorTable)
+	}
+	if s.reembedding || s.current != s.target {
+		tables = append(tables, reembedTable)
+	}
+	return tables
+}
+
+// StoreVector 存储向量（向量应由当前配置的嵌入模型生成）
 func (s *SQLiteVectorStore) StoreVector(id string, vector []float32) error {
-	if len(vector) != s.dimension {
-		return fmt.Errorf("向量维度不匹配: 期望 %d, 实际 %d", s.dimension, len(vector))
+	if len(vector) != s.target.Dimension {
+		return fmt.Errorf("向量维度不匹配: 期望 %d, 实际 %d", s.target.Dimension, len(vector))
 	}
 
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+
 	// 计算 L2 范数
 	norm := calculateNorm(vector)
 
@@ -129,22 +242,30 @@ func (s *SQLiteVectorStore) StoreVector(id string, vector []float32) error {
 
 	now := time.Now()
 
-	_, err := s.db.Exec(
-		`INSERT OR REPLACE INTO memory_vectors (id, vector, dimension, norm, created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		id, blob, len(vector), norm, now, now,
-	)
-	if err != nil {
-		return fmt.Errorf("存储向量失败: %w", err)
+	for _, table := range s.writeTablesLocked() {
+		_, err := s.db.Exec(upsertVectorSQL(table), id, blob, len(vector), s.target.Model, norm, now, now)
+		if err != nil {
+			return fmt.Errorf("存储向量失败: %w", err)
+		}
+		if table == vectorTable {
+			s.annApply(annOp{id: id, vector: vector})
+		}
 	}
 
 	return nil
 }
 
-// GetVector 获取向量
+// GetVector 获取当前配置空间下的向量
 func (s *SQLiteVectorStore) GetVector(id string) ([]float32, error) {
+	s.spaceMu.RLock()
+	table := vectorTable
+	if s.current != s.target {
+		table = reembedTable
+	}
+	s.spaceMu.RUnlock()
+
 	var blob []byte
-	err := s.db.QueryRow("SELECT vector FROM memory_vectors WHERE id = ?", id).Scan(&blob)
+	err := s.db.QueryRow("SELECT vector FROM "+table+" WHERE id = ?", id).Scan(&blob)
 	if err == sql.ErrNoRows {
 		return nil, ErrVectorNotFound
 	}
@@ -155,57 +276,118 @@ func (s *SQLiteVectorStore) GetVector(id string) ([]float32, error) {
 	return blobToVector(blob), nil
 }
 
-// DeleteVector 删除向量
+// DeleteVector 删除向量（主表与影子表中的都会删除）
 func (s *SQLiteVectorStore) DeleteVector(id string) error {
-	result, err := s.db.Exec("DELETE FROM memory_vectors WHERE id = ?", id)
-	if err != nil {
-		return fmt.Errorf("删除向量失败: %w", err)
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+
+	tables := []string{vectorTable}
+	if s.reembedding || s.current != s.target {
+		tables = append(tables, reembedTable)
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("获取删除行数失败: %w", err)
+	var deleted int64
+	for _, table := range tables {
+		result, err := s.db.Exec("DELETE FROM "+table+" WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("删除向量失败: %w", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("获取删除行数失败: %w", err)
+		}
+		if rows > 0 && table == vectorTable {
+			s.annApply(annOp{id: id})
+		}
+		deleted += rows
 	}
-	if rows == 0 {
+
+	if deleted == 0 {
 		return ErrVectorNotFound
 	}
-
 	return nil
 }
 
 // UpdateVector 更新向量
 func (s *SQLiteVectorStore) UpdateVector(id string, vector []float32) error {
-	if len(vector) != s.dimension {
-		return fmt.Errorf("向量维度不匹配: 期望 %d, 实际 %d", s.dimension, len(vector))
+	if len(vector) != s.target.Dimension {
+		return fmt.Errorf("向量维度不匹配: 期望 %d, 实际 %d", s.target.Dimension, len(vector))
 	}
 
-	norm := calculateNorm(vector)
-	blob := vectorToBlob(vector)
-
-	result, err := s.db.Exec(
-		`UPDATE memory_vectors SET vector = ?, norm = ?, updated_at = ? WHERE id = ?`,
-		blob, norm, time.Now(), id,
-	)
+	exists, err := s.vectorExists(id)
 	if err != nil {
 		return fmt.Errorf("更新向量失败: %w", err)
 	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("获取更新行数失败: %w", err)
-	}
-	if rows == 0 {
+	if !exists {
 		return ErrVectorNotFound
 	}
 
-	return nil
+	return s.StoreVector(id, vector)
+}
+
+// vectorExists 检查主表或影子表中是否存在向量
+func (s *SQLiteVectorStore) vectorExists(id string) (bool, error) {
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+
+	tables := []string{vectorTable}
+	if s.reembedding || s.current != s.target {
+		tables = append(tables, reembedTable)
+	}
+
+	for _, table := range tables {
+		var one int
+		err := s.db.QueryRow("SELECT 1 FROM "+table+" WHERE id = ?", id).Scan(&one)
+		if err == nil {
+			return true, nil
+		}
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+	}
+	return false, nil
 }
 
 // SearchSimilar 相似度搜索
-// 使用余弦相似度进行排序
+// 索引就绪且数据量足够时使用 HNSW 近似搜索，否则精确搜索
+// 库中向量与当前配置不属于同一空间时返回 ErrVectorSpace
 func (s *SQLiteVectorStore) SearchSimilar(queryVector []float32, topK int, minSimilarity float64) ([]*VectorSearchResult, error) {
-	if len(queryVector) != s.dimension {
-		return nil, fmt.Errorf("查询向量维度不匹配: 期望 %d, 实际 %d", s.dimension, len(queryVector))
+	if s.NeedsReembed() {
+		return nil, ErrVectorSpace
+	}
+
+	if len(queryVector) != s.target.Dimension {
+		return nil, fmt.Errorf("查询向量维度不匹配: 期望 %d, 实际 %d", s.target.Dimension, len(queryVector))
+	}
+
+	if calculateNorm(queryVector) == 0 {
+		return nil, fmt.Errorf("查询向量范数为 0")
+	}
+
+	if ann := s.readyANN(); ann != nil {
+		candidates := ann.Search(queryVector, topK)
+		results := make([]*VectorSearchResult, 0, len(candidates))
+		for _, r := range candidates {
+			if r.Score >= minSimilarity {
+				results = append(results, r)
+			}
+		}
+		return results, nil
+	}
+
+	return s.SearchExact(queryVector, topK, minSimilarity)
+}
+
+// SearchExact 精确相似度搜索
+// 逐条计算余弦相似度，作为 ANN 索引的兜底及召回率基准
+func (s *SQLiteVectorStore) SearchExact(queryVector []float32, topK int, minSimilarity float64) ([]*VectorSearchResult, error) {
+	if s.NeedsReembed() {
+		return nil, ErrVectorSpace
+	}
+
+	if len(queryVector) != s.target.Dimension {
+		return nil, fmt.Errorf("查询向量维度不匹配: 期望 %d, 实际 %d", s.target.Dimension, len(queryVector))
 	}
 
 	queryNorm := calculateNorm(queryVector)
@@ -213,7 +395,6 @@ func (s *SQLiteVectorStore) SearchSimilar(queryVector []float32, topK int, minSi
 		return nil, fmt.Errorf("查询向量范数为 0")
 	}
 
-	// 获取所有向量（小规模数据适用）
 	rows, err := s.db.Query("SELECT id, vector, norm FROM memory_vectors")
 	if err != nil {
 		return nil, fmt.Errorf("查询向量失败: %w", err)
@@ -265,16 +446,38 @@ func (s *SQLiteVectorStore) SearchSimilar(queryVector []float32, topK int, minSi
 
 // BatchStoreVectors 批量存储向量
 func (s *SQLiteVectorStore) BatchStoreVectors(items map[string][]float32) error {
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+
+	for _, table := range s.writeTablesLocked() {
+		if err := s.batchUpsert(table, items); err != nil {
+			return err
+		}
+
+		if table != vectorTable {
+			continue
+		}
+		ops := make([]annOp, 0, len(items))
+		for id, vector := range items {
+			if len(vector) == s.target.Dimension {
+				ops = append(ops, annOp{id: id, vector: vector})
+			}
+		}
+		s.annApply(ops...)
+	}
+
+	return nil
+}
+
+// batchUpsert 在事务中批量写入指定表，维度不符的向量被跳过
+func (s *SQLiteVectorStore) batchUpsert(table string, items map[string][]float32) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("开始事务失败: %w", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(
-		`INSERT OR REPLACE INTO memory_vectors (id, vector, dimension, norm, created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-	)
+	stmt, err := tx.Prepare(upsertVectorSQL(table))
 	if err != nil {
 		return fmt.Errorf("准备语句失败: %w", err)
 	}
@@ -283,14 +486,14 @@ func (s *SQLiteVectorStore) BatchStoreVectors(items map[string][]float32) error
 	now := time.Now()
 
 	for id, vector := range items {
-		if len(vector) != s.dimension {
+		if len(vector) != s.target.Dimension {
 			continue
 		}
 
 		norm := calculateNorm(vector)
 		blob := vectorToBlob(vector)
 
-		if _, err := stmt.Exec(id, blob, len(vector), norm, now, now); err != nil {
+		if _, err := stmt.Exec(id, blob, len(vector), s.target.Model, norm, now, now); err != nil {
 			return fmt.Errorf("批量存储向量失败: %w", err)
 		}
 	}
@@ -319,20 +522,257 @@ func (s *SQLiteVectorStore) GetVectorStats() (*VectorStats, error) {
 		return nil, err
 	}
 
-	return &VectorStats{
+	current := s.Space()
+	stats := &VectorStats{
 		TotalVectors: count,
-		Dimension:    s.dimension,
-	}, nil
+		Dimension:    current.Dimension,
+		Model:        current.Model,
+		NeedsReembed: current != s.target,
+	}
+
+	s.annMu.Lock()
+	if s.ann != nil {
+		stats.IndexedVectors = s.ann.Len()
+		stats.IndexReady = s.annReady
+	}
+	s.annMu.Unlock()
+
+	return stats, nil
 }
 
-// Close 关闭数据库连接
+// Close 保存 ANN 索引并关闭数据库连接
 func (s *SQLiteVectorStore) Close() error {
+	s.closeANN()
 	if s.db != nil {
 		return s.db.Close()
 	}
 	return nil
 }
 
+// ========== ANN 索引 ==========
+
+// SetANNThreshold 设置启用 ANN 搜索的最小向量数（<= 0 表示始终使用 ANN）
+func (s *SQLiteVectorStore) SetANNThreshold(n int) {
+	s.annMu.Lock()
+	s.annThreshold = n
+	s.annMu.Unlock()
+}
+
+// WaitANNReady 等待后台索引构建完成
+func (s *SQLiteVectorStore) WaitANNReady() {
+	s.annMu.Lock()
+	done := s.annDone
+	s.annMu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// readyANN 返回可用于搜索的索引，不可用时返回 nil
+func (s *SQLiteVectorStore) readyANN() *HNSWIndex {
+	gen, err := s.generation()
+	dimension := s.Space().Dimension
+
+	s.annMu.Lock()
+	defer s.annMu.Unlock()
+
+	if !s.annReady || s.ann.Len() < s.annThreshold {
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	if s.ann.Generation() != gen {
+		// 其他进程写入过数据库，索引已落后：后台重建，本次精确搜索
+		s.startRebuildLocked(dimension)
+		return nil
+	}
+	return s.ann
+}
+
+// openANN 加载持久化索引，文件缺失或过期时后台重建
+func (s *SQLiteVectorStore) openANN() {
+	gen, err := s.generation()
+	if err != nil {
+		return
+	}
+
+	dimension := s.Space().Dimension
+	if ann, err := LoadHNSWIndex(s.annPath, dimension, DefaultHNSWConfig()); err == nil && ann.Generation() == gen {
+		s.ann = ann
+		s.annReady = true
+		return
+	}
+
+	s.annMu.Lock()
+	s.startRebuildLocked(dimension)
+	s.annMu.Unlock()
+}
+
+// startRebuildLocked 启动后台重建（调用方持有 annMu）
+// 构建期间的写操作记入 annPending，构建完成后重放
+func (s *SQLiteVectorStore) startRebuildLocked(dimension int) {
+	s.ann = NewHNSWIndex(dimension, DefaultHNSWConfig())
+	s.annReady = false
+	s.annBuilding = true
+	s.annPending = nil
+	s.annStop = make(chan struct{})
+	s.annDone = make(chan struct{})
+
+	go s.rebuildANN(s.ann, s.annStop, s.annDone)
+}
+
+// rebuildANN 从数据库全量构建索引
+// 索引版本号取扫描前的数据库版本号，扫描期间其他进程的写入会在下次搜索时被发现
+func (s *SQLiteVectorStore) rebuildANN(ann *HNSWIndex, stop, done chan struct{}) {
+	defer close(done)
+
+	finish := func(ok bool) {
+		s.annMu.Lock()
+		defer s.annMu.Unlock()
+
+		s.annBuilding = false
+		if !ok {
+			s.annPending = nil
+			return
+		}
+		for _, op := range s.annPending {
+			op.applyTo(ann)
+			advanceGeneration(ann, op.gen)
+		}
+		s.annPending = nil
+		s.annReady = true
+		s.annDirty = true
+	}
+
+	gen, err := s.generation()
+	if err != nil {
+		finish(false)
+		return
+	}
+	ann.SetGeneration(gen)
+
+	rows, err := s.db.Query("SELECT id, vector FROM memory_vectors")
+	if err != nil {
+		finish(false)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		select {
+		case <-stop:
+			finish(false)
+			return
+		default:
+		}
+
+		var id string
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			continue
+		}
+		vector := blobToVector(blob)
+		if calculateNorm(vector) == 0 {
+			continue
+		}
+		ann.Insert(id, vector)
+	}
+
+	finish(rows.Err() == nil)
+}
+
+// annApply 将写操作同步到索引并推进版本号
+func (s *SQLiteVectorStore) annApply(ops ...annOp) {
+	gen, err := s.bumpGeneration()
+	if err != nil {
+		gen = 0
+	}
+
+	s.annMu.Lock()
+	defer s.annMu.Unlock()
+
+	if s.ann == nil {
+		return
+	}
+	if s.annBuilding {
+		for _, op := range ops {
+			op.gen = gen
+			s.annPending = append(s.annPending, op)
+		}
+		return
+	}
+
+	for _, op := range ops {
+		op.applyTo(s.ann)
+	}
+	advanceGeneration(s.ann, gen)
+	s.annDirty = true
+}
+
+// advanceGeneration 记录索引已应用到的版本号
+// 只有 gen 紧接索引当前版本号时才推进；中间夹有其他进程的写入时保持不变，
+// 使持久化的版本号不会超过索引实际包含的内容
+func advanceGeneration(ann *HNSWIndex, gen int64) {
+	if gen > 0 && gen == ann.Generation()+1 {
+		ann.SetGeneration(gen)
+	}
+}
+
+// stopANNBuild 停止正在进行的后台构建并等待其退出
+func (s *SQLiteVectorStore) stopANNBuild() {
+	s.annMu.Lock()
+	stop, done := s.annStop, s.annDone
+	if s.annBuilding && stop != nil {
+		close(stop)
+		s.annStop = nil
+	}
+	s.annMu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// resetANN 丢弃当前索引并按新维度后台重建
+func (s *SQLiteVectorStore) resetANN(dimension int) {
+	s.stopANNBuild()
+
+	s.annMu.Lock()
+	s.startRebuildLocked(dimension)
+	s.annMu.Unlock()
+}
+
+// closeANN 停止后台构建并持久化索引
+func (s *SQLiteVectorStore) closeANN() {
+	s.stopANNBuild()
+
+	s.annMu.Lock()
+	defer s.annMu.Unlock()
+
+	if s.ann != nil && s.annReady && s.annDirty {
+		if err := s.ann.Save(s.annPath); err == nil {
+			s.annDirty = false
+		}
+	}
+}
+
+// generation 读取向量库写入版本号
+func (s *SQLiteVectorStore) generation() (int64, error) {
+	var gen int64
+	err := s.db.QueryRow("SELECT value FROM vector_meta WHERE key = 'generation'").Scan(&gen)
+	return gen, err
+}
+
+// bumpGeneration 推进写入版本号
+func (s *SQLiteVectorStore) bumpGeneration() (int64, error) {
+	var gen int64
+	err := s.db.QueryRow(
+		"UPDATE vector_meta SET value = value + 1 WHERE key = 'generation' RETURNING value",
+	).Scan(&gen)
+	return gen, err
+}
+
 // ========== 工具函数 ==========
 
 // vectorToBlob 将 float32 切片转换为 BLOB
@@ -0,0 +1,586 @@
+// Package v2 提供 HNSW 近似最近邻索引
+package v2
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+)
+
+// HNSW 默认参数
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+
+	// 已删除节点占比超过该值时重建索引
+	hnswRebuildDeletedRatio = 0.25
+
+	// 节点数少于该值时不触发重建
+	hnswRebuildMinNodes = 100
+
+	// 索引文件格式版本
+	hnswSnapshotVersion = 1
+)
+
+// HNSWConfig HNSW 索引参数
+type HNSWConfig struct {
+	// 每层最大邻居数（第 0 层为 2M）
+	M int
+	// 构建时候选集大小
+	EfConstruction int
+	// 搜索时候选集大小
+	EfSearch int
+	// 随机种子（固定种子使构建结果可复现）
+	Seed int64
+}
+
+// DefaultHNSWConfig 默认 HNSW 参数
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{
+		M:              defaultHNSWM,
+		EfConstruction: defaultHNSWEfConstruction,
+		EfSearch:       defaultHNSWEfSearch,
+		Seed:           42,
+	}
+}
+
+// hnswNode 索引节点
+type hnswNode struct {
+	id        string
+	vector    []float32 // 归一化向量
+	neighbors [][]int   // 每层邻居（节点槽位）
+	deleted   bool
+}
+
+// HNSWIndex 分层可导航小世界图索引（余弦相似度）
+// 节点按槽位存储，删除和更新采用墓碑标记，墓碑过多时自动重建
+type HNSWIndex struct {
+	config    HNSWConfig
+	dimension int
+	levelMult float64
+	rng       *rand.Rand
+
+	nodes      []*hnswNode
+	slots      map[string]int // id -> 有效节点槽位
+	entryPoint int
+	maxLevel   int
+	deleted    int
+
+	// 与向量库同步的版本号，用于判断持久化文件是否过期
+	generation int64
+
+	mu sync.RWMutex
+}
+
+// NewHNSWIndex 创建 HNSW 索引
+func NewHNSWIndex(dimension int, config HNSWConfig) *HNSWIndex {
+	if config.M <= 1 {
+		config.M = defaultHNSWM
+	}
+	if config.EfConstruction <= 0 {
+		config.EfConstruction = defaultHNSWEfConstruction
+	}
+	if config.EfSearch <= 0 {
+		config.EfSearch = defaultHNSWEfSearch
+	}
+
+	return &HNSWIndex{
+		config:     config,
+		dimension:  dimension,
+		levelMult:  1 / math.Log(float64(config.M)),
+		rng:        rand.New(rand.NewSource(config.Seed)),
+		slots:      make(map[string]int),
+		entryPoint: -1,
+		maxLevel:   -1,
+	}
+}
+
+// Len 返回有效（未删除）节点数
+func (h *HNSWIndex) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.slots)
+}
+
+// Generation 返回索引版本号
+func (h *HNSWIndex) Generation() int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.generation
+}
+
+// SetGeneration 设置索引版本号
+func (h *HNSWIndex) SetGeneration(gen int64) {
+	h.mu.Lock()
+	h.generation = gen
+	h.mu.Unlock()
+}
+
+// Insert 插入或更新向量
+func (h *HNSWIndex) Insert(id string, vector []float32) error {
+	if len(vector) != h.dimension {
+		return fmt.Errorf("向量维度不匹配: 期望 %d, 实际 %d", h.dimension, len(vector))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 更新：旧节点留作墓碑维持图的连通性，新向量占用新槽位
+	h.deleteLocked(id)
+	h.insertLocked(id, NormalizeVector(vector))
+	h.maybeRebuildLocked()
+	return nil
+}
+
+// Delete 删除向量
+func (h *HNSWIndex) Delete(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.deleteLocked(id) {
+		h.maybeRebuildLocked()
+	}
+}
+
+// Search 搜索与查询向量最相似的 k 个向量，结果按相似度降序
+func (h *HNSWIndex) Search(query []float32, k int) []*VectorSearchResult {
+	if len(query) != h.dimension || k <= 0 {
+		return nil
+	}
+	q := NormalizeVector(query)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.entryPoint < 0 {
+		return nil
+	}
+
+	ep := h.entryPoint
+	epDist := h.distance(q, h.nodes[ep].vector)
+	for level := h.maxLevel; level > 0; level-- {
+		ep, epDist = h.greedyLocked(q, ep, epDist, level)
+	}
+
+	ef := h.config.EfSearch
+	if ef < k {
+		ef = k
+	}
+	// 墓碑节点参与导航但不计入结果，按比例放大候选集
+	if h.deleted > 0 {
+		ef += ef * h.deleted / len(h.nodes)
+	}
+
+	candidates := h.searchLayerLocked(q, ep, epDist, ef, 0)
+
+	results := make([]*VectorSearchResult, 0, k)
+	for _, c := range candidates {
+		node := h.nodes[c.slot]
+		if node.deleted {
+			continue
+		}
+		results = append(results, &VectorSearchResult{
+			ID:       node.id,
+			Score:    1 - c.dist,
+			Distance: c.dist,
+		})
+		if len(results) == k {
+			break
+		}
+	}
+
+	return results
+}
+
+// deleteLocked 将节点标记为墓碑（调用方持有写锁）
+func (h *HNSWIndex) deleteLocked(id string) bool {
+	slot, ok := h.slots[id]
+	if !ok {
+		return false
+	}
+	delete(h.slots, id)
+	h.nodes[slot].deleted = true
+	h.deleted++
+	return true
+}
+
+// insertLocked 插入新节点（调用方持有写锁）
+func (h *HNSWIndex) insertLocked(id string, vector []float32) {
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+	slot := len(h.nodes)
+	node := &hnswNode{
+		id:        id,
+		vector:    vector,
+		neighbors: make([][]int, level+1),
+	}
+	h.nodes = append(h.nodes, node)
+	h.slots[id] = slot
+
+	if h.entryPoint < 0 {
+		h.entryPoint = slot
+		h.maxLevel = level
+		return
+	}
+
+	ep := h.entryPoint
+	epDist := h.distance(vector, h.nodes[ep].vector)
+	for l := h.maxLevel; l > level; l-- {
+		ep, epDist = h.greedyLocked(vector, ep, epDist, l)
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayerLocked(vector, ep, epDist, h.config.EfConstruction, l)
+		neighbors := h.selectNeighbors(candidates, h.maxNeighbors(l))
+
+		for _, n := range neighbors {
+			node.neighbors[l] = append(node.neighbors[l], n.slot)
+			h.linkLocked(n.slot, slot, l)
+		}
+
+		if len(candidates) > 0 {
+			ep, epDist = candidates[0].slot, candidates[0].dist
+		}
+	}
+
+	if level > h.maxLevel {
+		h.entryPoint = slot
+		h.maxLevel = level
+	}
+}
+
+// linkLocked 为已有节点添加反向连接，超出上限时重新挑选邻居
+func (h *HNSWIndex) linkLocked(from, to int, level int) {
+	node := h.nodes[from]
+	if level >= len(node.neighbors) {
+		return
+	}
+	node.neighbors[level] = append(node.neighbors[level], to)
+
+	limit := h.maxNeighbors(level)
+	if len(node.neighbors[level]) <= limit {
+		return
+	}
+
+	candidates := make([]hnswCandidate, 0, len(node.neighbors[level]))
+	for _, n := range node.neighbors[level] {
+		candidates = append(candidates, hnswCandidate{slot: n, dist: h.distance(node.vector, h.nodes[n].vector)})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+
+	kept := h.selectNeighbors(candidates, limit)
+	node.neighbors[level] = node.neighbors[level][:0]
+	for _, c := range kept {
+		node.neighbors[level] = append(node.neighbors[level], c.slot)
+	}
+}
+
+// maybeRebuildLocked 墓碑过多时用有效节点重建索引
+func (h *HNSWIndex) maybeRebuildLocked() {
+	if len(h.nodes) < hnswRebuildMinNodes || float64(h.deleted)/float64(len(h.nodes)) < hnswRebuildDeletedRatio {
+		return
+	}
+
+	live := make([]*hnswNode, 0, len(h.slots))
+	for _, n := range h.nodes {
+		if !n.deleted {
+			live = append(live, n)
+		}
+	}
+
+	h.nodes = make([]*hnswNode, 0, len(live))
+	h.slots = make(map[string]int, len(live))
+	h.entryPoint = -1
+	h.maxLevel = -1
+	h.deleted = 0
+	for _, n := range live {
+		h.insertLocked(n.id, n.vector)
+	}
+}
+
+// greedyLocked 在指定层贪心搜索最近节点
+func (h *HNSWIndex) greedyLocked(q []float32, ep int, epDist float64, level int) (int, float64) {
+	for changed := true; changed; {
+		changed = false
+		node := h.nodes[ep]
+		if level >= len(node.neighbors) {
+			break
+		}
+		for _, n := range node.neighbors[level] {
+			d := h.distance(q, h.nodes[n].vector)
+			if d < epDist {
+				ep, epDist = n, d
+				changed = true
+			}
+		}
+	}
+	return ep, epDist
+}
+
+// searchLayerLocked 在指定层进行 ef 宽度的最佳优先搜索，结果按距离升序
+func (h *HNSWIndex) searchLayerLocked(q []float32, ep int, epDist float64, ef, level int) []hnswCandidate {
+	visited := map[int]bool{ep: true}
+	candidates := &hnswMinHeap{{slot: ep, dist: epDist}}
+	results := &hnswMaxHeap{{slot: ep, dist: epDist}}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if c.dist > (*results)[0].dist && results.Len() >= ef {
+			break
+		}
+
+		node := h.nodes[c.slot]
+		if level >= len(node.neighbors) {
+			continue
+		}
+		for _, n := range node.neighbors[level] {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+
+			d := h.distance(q, h.nodes[n].vector)
+			if results.Len() < ef || d < (*results)[0].dist {
+				heap.Push(candidates, hnswCandidate{slot: n, dist: d})
+				heap.Push(results, hnswCandidate{slot: n, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]hnswCandidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(hnswCandidate)
+	}
+	return sorted
+}
+
+// selectNeighbors 启发式选择邻居：优先保留彼此方向分散的近邻，候选需按距离升序
+func (h *HNSWIndex) selectNeighbors(candidates []hnswCandidate, m int) []hnswCandidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]hnswCandidate, 0, m)
+	var skipped []hnswCandidate
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		good := true
+		for _, s := range selected {
+			if h.distance(h.nodes[c.slot].vector, h.nodes[s.slot].vector) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	// 不足 m 个时用被跳过的近邻补齐
+	for _, c := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+// maxNeighbors 返回指定层的最大邻居数
+func (h *HNSWIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return h.config.M * 2
+	}
+	return h.config.M
+}
+
+// distance 计算余弦距离（向量已归一化）
+func (h *HNSWIndex) distance(a, b []float32) float64 {
+	return 1 - calculateDotProduct(a, b)
+}
+
+// ========== 持久化 ==========
+
+// hnswSnapshot 索引持久化格式
+type hnswSnapshot struct {
+	Version        int
+	Generation     int64
+	Dimension      int
+	M              int
+	EfConstruction int
+	EntryPoint     int
+	MaxLevel       int
+	Nodes          []hnswNodeSnapshot
+}
+
+// hnswNodeSnapshot 节点持久化格式
+type hnswNodeSnapshot struct {
+	ID        string
+	Vector    []float32
+	Neighbors [][]int
+	Deleted   bool
+}
+
+// Save 将索引保存到文件（先写临时文件再重命名）
+func (h *HNSWIndex) Save(path string) error {
+	h.mu.RLock()
+	snap := hnswSnapshot{
+		Version:        hnswSnapshotVersion,
+		Generation:     h.generation,
+		Dimension:      h.dimension,
+		M:              h.config.M,
+		EfConstruction: h.config.EfConstruction,
+		EntryPoint:     h.entryPoint,
+		MaxLevel:       h.maxLevel,
+		Nodes:          make([]hnswNodeSnapshot, len(h.nodes)),
+	}
+	for i, n := range h.nodes {
+		snap.Nodes[i] = hnswNodeSnapshot{
+			ID:        n.id,
+			Vector:    n.vector,
+			Neighbors: n.neighbors,
+			Deleted:   n.deleted,
+		}
+	}
+	h.mu.RUnlock()
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建索引文件失败: %w", err)
+	}
+
+	if err := gob.NewEncoder(f).Encode(&snap); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入索引文件失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入索引文件失败: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("保存索引文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// LoadHNSWIndex 从文件加载索引
+func LoadHNSWIndex(path string, dimension int, config HNSWConfig) (*HNSWIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snap hnswSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("解析索引文件失败: %w", err)
+	}
+
+	if snap.Version != hnswSnapshotVersion {
+		return nil, fmt.Errorf("索引文件版本不支持: %d", snap.Version)
+	}
+	if snap.Dimension != dimension {
+		return nil, fmt.Errorf("索引维度不匹配: 期望 %d, 实际 %d", dimension, snap.Dimension)
+	}
+
+	config.M = snap.M
+	config.EfConstruction = snap.EfConstruction
+	h := NewHNSWIndex(dimension, config)
+	h.generation = snap.Generation
+	h.entryPoint = snap.EntryPoint
+	h.maxLevel = snap.MaxLevel
+	h.nodes = make([]*hnswNode, len(snap.Nodes))
+
+	for i, ns := range snap.Nodes {
+		if len(ns.Vector) != dimension || len(ns.Neighbors) == 0 {
+			return nil, fmt.Errorf("索引文件损坏: 节点 %s 数据无效", ns.ID)
+		}
+		h.nodes[i] = &hnswNode{
+			id:        ns.ID,
+			vector:    ns.Vector,
+			neighbors: ns.Neighbors,
+			deleted:   ns.Deleted,
+		}
+		if ns.Deleted {
+			h.deleted++
+		} else {
+			h.slots[ns.ID] = i
+		}
+	}
+
+	// 校验引用完整性
+	if len(h.nodes) == 0 {
+		if h.entryPoint != -1 {
+			return nil, fmt.Errorf("索引文件损坏: 入口节点不存在")
+		}
+		return h, nil
+	}
+	if h.entryPoint < 0 || h.entryPoint >= len(h.nodes) || len(h.nodes[h.entryPoint].neighbors) != h.maxLevel+1 {
+		return nil, fmt.Errorf("索引文件损坏: 入口节点无效")
+	}
+	for _, n := range h.nodes {
+		for _, layer := range n.neighbors {
+			for _, nb := range layer {
+				if nb < 0 || nb >= len(h.nodes) {
+					return nil, fmt.Errorf("索引文件损坏: 节点 %s 的邻居越界", n.id)
+				}
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// ========== 优先队列 ==========
+
+// hnswCandidate 搜索候选
+type hnswCandidate struct {
+	slot int
+	dist float64
+}
+
+// hnswMinHeap 按距离升序的小顶堆
+type hnswMinHeap []hnswCandidate
+
+func (h hnswMinHeap) Len() int           { return len(h) }
+func (h hnswMinHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h hnswMinHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hnswMinHeap) Push(x any)        { *h = append(*h, x.(hnswCandidate)) }
+func (h *hnswMinHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// hnswMaxHeap 按距离降序的大顶堆
+type hnswMaxHeap []hnswCandidate
+
+func (h hnswMaxHeap) Len() int           { return len(h) }
+func (h hnswMaxHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h hnswMaxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hnswMaxHeap) Push(x any)        { *h = append(*h, x.(hnswCandidate)) }
+func (h *hnswMaxHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
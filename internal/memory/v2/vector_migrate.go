@@ -0,0 +1,236 @@
+// Package v2 提供向量空间识别与嵌入模型迁移
+package v2
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqlExecer 可执行 SQL 的对象（*sql.DB 或 *sql.Tx）
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Space 返回主表向量所属空间
+func (s *SQLiteVectorStore) Space() VectorSpace {
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+	return s.current
+}
+
+// TargetSpace 返回当前配置的向量空间
+func (s *SQLiteVectorStore) TargetSpace() VectorSpace {
+	return s.target
+}
+
+// NeedsReembed 库中向量与当前配置的模型或维度不一致时返回 true
+func (s *SQLiteVectorStore) NeedsReembed() bool {
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+	return s.current != s.target
+}
+
+// ensureModelColumn 为旧版本向量表补充 model 列
+func (s *SQLiteVectorStore) ensureModelColumn() error {
+	rows, err := s.db.Query("PRAGMA table_info(memory_vectors)")
+	if err != nil {
+		return err
+	}
+
+	hasModel := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == "model" {
+			hasModel = true
+		}
+	}
+	rows.Close()
+
+	if hasModel {
+		return nil
+	}
+	_, err = s.db.Exec("ALTER TABLE memory_vectors ADD COLUMN model TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// initSpace 识别主表向量所属空间
+// 旧版本数据库未记录空间时以已有向量为准；主表为空时直接采用当前配置
+func (s *SQLiteVectorStore) initSpace() error {
+	current, ok, err := s.loadSpace()
+	if err != nil {
+		return fmt.Errorf("读取向量空间失败: %w", err)
+	}
+
+	if !ok {
+		current = s.target
+		var dimension int
+		var model string
+		err := s.db.QueryRow("SELECT dimension, model FROM memory_vectors LIMIT 1").Scan(&dimension, &model)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return fmt.Errorf("读取向量空间失败: %w", err)
+		case model == "" && dimension == s.target.Dimension:
+			// 未标记模型且维度一致，视为由当前模型生成
+			if _, err := s.db.Exec("UPDATE memory_vectors SET model = ? WHERE model = ''", s.target.Model); err != nil {
+				return fmt.Errorf("标记向量模型失败: %w", err)
+			}
+		default:
+			current = VectorSpace{Model: model, Dimension: dimension}
+		}
+	}
+
+	if current != s.target {
+		count, err := s.GetVectorCount()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			current = s.target
+		}
+	}
+
+	if err := saveSpace(s.db, current); err != nil {
+		return err
+	}
+	s.current = current
+
+	// 空间不一致时新向量写入影子表
+	if current != s.target {
+		if _, err := s.db.Exec(vectorTableSQL(reembedTable)); err != nil {
+			return fmt.Errorf("创建重建向量表失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadSpace 读取记录的向量空间
+func (s *SQLiteVectorStore) loadSpace() (VectorSpace, bool, error) {
+	var space VectorSpace
+	err := s.db.QueryRow("SELECT value FROM vector_meta WHERE key = 'model'").Scan(&space.Model)
+	if err == sql.ErrNoRows {
+		return space, false, nil
+	}
+	if err != nil {
+		return space, false, err
+	}
+
+	err = s.db.QueryRow("SELECT value FROM vector_meta WHERE key = 'dimension'").Scan(&space.Dimension)
+	if err == sql.ErrNoRows {
+		return space, false, nil
+	}
+	if err != nil {
+		return space, false, err
+	}
+
+	return space, true, nil
+}
+
+// saveSpace 记录向量空间
+func saveSpace(db sqlExecer, space VectorSpace) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO vector_meta (key, value) VALUES ('model', ?), ('dimension', ?)",
+		space.Model, space.Dimension,
+	)
+	if err != nil {
+		return fmt.Errorf("记录向量空间失败: %w", err)
+	}
+	return nil
+}
+
+// ========== 重建 ==========
+
+// BeginReembed 开始重建：清空影子表，此后写入的向量同时进入影子表
+// 上次中断的重建可能留下其他空间或已删除记忆的向量，因此影子表总是重新创建
+// 重建完成前主表保持不变，搜索照常使用旧向量
+func (s *SQLiteVectorStore) BeginReembed() error {
+	s.spaceMu.Lock()
+	defer s.spaceMu.Unlock()
+
+	if s.reembedding {
+		return fmt.Errorf("向量重建正在进行中")
+	}
+	if _, err := s.db.Exec("DROP TABLE IF EXISTS " + reembedTable); err != nil {
+		return fmt.Errorf("清空重建向量表失败: %w", err)
+	}
+	if _, err := s.db.Exec(vectorTableSQL(reembedTable)); err != nil {
+		return fmt.Errorf("创建重建向量表失败: %w", err)
+	}
+	s.reembedding = true
+	return nil
+}
+
+// StoreReembedded 写入一批重建后的向量
+func (s *SQLiteVectorStore) StoreReembedded(items map[string][]float32) error {
+	s.spaceMu.RLock()
+	defer s.spaceMu.RUnlock()
+
+	if !s.reembedding {
+		return fmt.Errorf("向量重建未开始")
+	}
+	return s.batchUpsert(reembedTable, items)
+}
+
+// CommitReembed 用影子表原子替换主表，并按新空间重建 ANN 索引
+func (s *SQLiteVectorStore) CommitReembed() error {
+	s.spaceMu.Lock()
+
+	if !s.reembedding {
+		s.spaceMu.Unlock()
+		return fmt.Errorf("向量重建未开始")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.spaceMu.Unlock()
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		"DROP TABLE memory_vectors",
+		"ALTER TABLE " + reembedTable + " RENAME TO memory_vectors",
+		`CREATE INDEX IF NOT EXISTS idx_vectors_created_at ON memory_vectors(created_at)`,
+		"UPDATE vector_meta SET value = value + 1 WHERE key = 'generation'",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			s.spaceMu.Unlock()
+			return fmt.Errorf("替换向量表失败: %w", err)
+		}
+	}
+	if err := saveSpace(tx, s.target); err != nil {
+		s.spaceMu.Unlock()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.spaceMu.Unlock()
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	s.current = s.target
+	s.reembedding = false
+	s.spaceMu.Unlock()
+
+	s.resetANN(s.target.Dimension)
+	return nil
+}
+
+// AbortReembed 放弃重建，主表保持不变
+// 空间不一致时影子表中仍保存着新写入的向量，予以保留
+func (s *SQLiteVectorStore) AbortReembed() {
+	s.spaceMu.Lock()
+	defer s.spaceMu.Unlock()
+
+	s.reembedding = false
+	if s.current == s.target {
+		s.db.Exec("DROP TABLE IF EXISTS " + reembedTable)
+	}
+}
@@ -0,0 +1,258 @@
+// Package v2 提供记忆文件监听：外部编辑记忆文件后自动同步索引与向量
+package v2
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/hession/aimate/internal/logger"
+)
+
+// 默认防抖时间：编辑器保存时常在短时间内产生多次写入、重命名事件
+const defaultWatchDebounce = 500 * time.Millisecond
+
+// FileWatcher 记忆文件监听器
+// 监听全局与项目的记忆目录，文件变化在防抖窗口结束后调用 SyncSingle 同步索引，并重新生成向量
+type FileWatcher struct {
+	storage   *StorageManager
+	fileStore *MarkdownFileStore
+	syncer    *IndexSyncer
+	embedding *EmbeddingManager
+	debounce  time.Duration
+
+	watcher *fsnotify.Watcher
+	pending map[string]bool
+	timer   *time.Timer
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+
+	// 每个文件同步完成后的回调（可选）
+	onSync func(path string, err error)
+}
+
+// NewFileWatcher 创建记忆文件监听器（embedding 为 nil 时只同步索引）
+func NewFileWatcher(
+	storage *StorageManager,
+	fileStore *MarkdownFileStore,
+	syncer *IndexSyncer,
+	embedding *EmbeddingManager,
+	debounce time.Duration,
+) *FileWatcher {
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+	return &FileWatcher{
+		storage:   storage,
+		fileStore: fileStore,
+		syncer:    syncer,
+		embedding: embedding,
+		debounce:  debounce,
+		pending:   make(map[string]bool),
+	}
+}
+
+// Start 开始监听
+func (w *FileWatcher) Start() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watcher != nil {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return NewMemoryError("FileWatcher.Start", err)
+	}
+	w.watcher = watcher
+	w.done = make(chan struct{})
+
+	for _, root := range w.storage.GetMemoryRoots() {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			continue
+		}
+		w.addTree(root)
+	}
+
+	w.wg.Add(1)
+	go w.loop(watcher, w.done)
+	return nil
+}
+
+// Stop 停止监听，丢弃尚未处理的变更（下次维护时由 SyncAll 补齐）
+func (w *FileWatcher) Stop() {
+	w.mu.Lock()
+	if w.watcher == nil {
+		w.mu.Unlock()
+		return
+	}
+	close(w.done)
+	_ = w.watcher.Close()
+	w.watcher = nil
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+}
+
+// Restart 重新监听（项目切换后调用）
+func (w *FileWatcher) Restart() error {
+	w.Stop()
+	return w.Start()
+}
+
+// loop 事件循环
+func (w *FileWatcher) loop(watcher *fsnotify.Watcher, done chan struct{}) {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("[memory-watcher] 监听错误: %v", err)
+		}
+	}
+}
+
+// handleEvent 处理单个文件系统事件
+func (w *FileWatcher) handleEvent(event fsnotify.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watcher == nil {
+		return
+	}
+
+	// 新建或移入的目录：加入监听并同步其中已有的文件
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			for _, path := range w.addTree(event.Name) {
+				w.pending[path] = true
+			}
+			w.schedule()
+			return
+		}
+	}
+
+	if !isMemoryFile(event.Name) || event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	// 重命名与删除都只记录路径，由 SyncSingle 根据文件是否存在决定更新或删除索引
+	w.pending[event.Name] = true
+	w.schedule()
+}
+
+// schedule 重置防抖计时器
+func (w *FileWatcher) schedule() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, w.flush)
+}
+
+// flush 同步防抖窗口内变化的文件
+func (w *FileWatcher) flush() {
+	w.mu.Lock()
+	if w.watcher == nil {
+		w.mu.Unlock()
+		return
+	}
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	w.pending = make(map[string]bool)
+	w.timer = nil
+	w.wg.Add(1)
+	w.mu.Unlock()
+	defer w.wg.Done()
+
+	// 先处理已删除的旧路径，再处理新路径，避免移动文件时新索引被误删
+	var removed, changed []string
+	for _, path := range paths {
+		if FileExists(path) {
+			changed = append(changed, path)
+		} else {
+			removed = append(removed, path)
+		}
+	}
+
+	for _, path := range append(removed, changed...) {
+		err := w.syncFile(path)
+		if err != nil {
+			logger.Warn("[memory-watcher] 同步 %s 失败: %v", path, err)
+		}
+		if w.onSync != nil {
+			w.onSync(path, err)
+		}
+	}
+}
+
+// syncFile 同步单个文件的索引与向量
+func (w *FileWatcher) syncFile(path string) error {
+	if err := w.syncer.SyncSingle(path); err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if (w.embedding == nil && w.syncer.vector == nil) || !FileExists(path) {
+		return nil
+	}
+
+	mem, err := w.fileStore.ReadMemory(path)
+	if err != nil {
+		return err
+	}
+	syncMemoryVector(context.Background(), w.embedding, w.syncer.vector, mem)
+	return nil
+}
+
+// addTree 递归监听目录，返回其中已有的记忆文件
+func (w *FileWatcher) addTree(root string) []string {
+	var files []string
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if err := w.watcher.Add(path); err != nil {
+				logger.Warn("[memory-watcher] 无法监听 %s: %v", path, err)
+			}
+			return nil
+		}
+		if isMemoryFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// isMemoryFile 判断是否为记忆文件（忽略编辑器的隐藏临时文件）
+func isMemoryFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, ".md") && !strings.HasPrefix(name, ".")
+}
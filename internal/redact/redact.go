@@ -0,0 +1,382 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// placeholderPrefix starts every placeholder so already redacted text is left alone
+const placeholderPrefix = "[REDACTED_"
+
+// Pattern is a user-defined redaction rule.
+// If the regex has a group named "secret", only that group is replaced.
+type Pattern struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+}
+
+// Options selects which rules a Redactor applies.
+// API keys, tokens, private keys and literal values assigned to secret keys are always redacted.
+type Options struct {
+	Emails bool      // Redact email addresses
+	Phones bool      // Redact phone numbers
+	Custom []Pattern // Extra rules, applied before the built-in ones
+}
+
+// rule is a compiled redaction rule
+type rule struct {
+	kind    string
+	re      *regexp.Regexp
+	group   int  // index of the "secret" group, 0 replaces the whole match
+	quote   int  // index of the "quote" group, 0 if the rule has none
+	literal bool // only replace quoted or token-like values, never code
+}
+
+// Built-in rules, most specific first
+var (
+	privateKeyRule = newRule("PRIVATE_KEY",
+		`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+	apiKeyRule = newRule("API_KEY",
+		`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|glpat-[A-Za-z0-9_-]{20,}|xox[abprs]-[A-Za-z0-9-]{10,})`)
+	jwtRule = newRule("TOKEN",
+		`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)
+	bearerRule = newRule("TOKEN",
+		`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/=-]{16,})`)
+	assignmentRule = newLiteralRule("SECRET",
+		`(?i)(?:api[_-]?key|access[_-]?key|secret(?:[_-]?key)?|token|password|passwd|pwd)["']?\s*(?::=|[:=])\s*(?P<quote>["']?)(?P<secret>[^\s"',;\\]{6,})`)
+	emailRule = newRule("EMAIL",
+		`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+	phoneRule = newRule("PHONE",
+		`(?:\+\d{1,3}[ -]?)?(?:\(\d{2,4}\)[ -]?|\b\d{3}[ .-])\d{3,4}[ .-]\d{4}\b|\b1[3-9]\d{9}\b`)
+)
+
+// Redactor replaces secrets and personal data with placeholders and counts what it replaced.
+// Placeholders carry the kind and a number assigned in order of first appearance, e.g.
+// [REDACTED_EMAIL_1], so within one Redactor the same value always maps to the same
+// placeholder and different values stay distinguishable. The number reveals nothing
+// about the value, unlike a hash that could be checked against guesses.
+// A nil *Redactor returns text unchanged.
+type Redactor struct {
+	rules  []*rule
+	mu     sync.Mutex
+	counts map[string]int
+	ids    map[[sha256.Size]byte]int // hash of kind and value → placeholder number
+	next   map[string]int            // last number assigned per kind
+}
+
+// New compiles a Redactor for the given options
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{
+		counts: make(map[string]int),
+		ids:    make(map[[sha256.Size]byte]int),
+		next:   make(map[string]int),
+	}
+
+	for _, p := range opts.Custom {
+		kind := kindName(p.Name)
+		if kind == "" {
+			return nil, fmt.Errorf("redaction pattern %q has no name", p.Regex)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", p.Name, err)
+		}
+		r.rules = append(r.rules, &rule{kind: kind, re: re, group: secretGroup(re)})
+	}
+
+	r.rules = append(r.rules, privateKeyRule, apiKeyRule, jwtRule, bearerRule, assignmentRule)
+	if opts.Emails {
+		r.rules = append(r.rules, emailRule)
+	}
+	if opts.Phones {
+		r.rules = append(r.rules, phoneRule)
+	}
+	return r, nil
+}
+
+// Default returns a Redactor with all built-in rules enabled
+func Default() *Redactor {
+	r, _ := New(Options{Emails: true, Phones: true})
+	return r
+}
+
+// Redact returns text with every match replaced by a placeholder
+func (r *Redactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	redacted, counts := r.redact(text)
+	r.record(counts)
+	return redacted
+}
+
+// redact applies every rule and returns the replacements per kind without recording them
+func (r *Redactor) redact(text string) (string, map[string]int) {
+	counts := make(map[string]int)
+	for _, rl := range r.rules {
+		var n int
+		text, n = r.apply(rl, text)
+		if n > 0 {
+			counts[rl.kind] += n
+		}
+	}
+	return text, counts
+}
+
+// record adds replacements to the running counts
+func (r *Redactor) record(counts map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for kind, n := range counts {
+		r.counts[kind] += n
+	}
+}
+
+// RedactJSON redacts every string in a JSON document and re-encodes it, so a
+// replacement can never break the structure. Strings that are themselves JSON,
+// such as tool-call arguments, are redacted as decoded text and stay valid JSON.
+// Text that is not JSON is redacted as plain text.
+func (r *Redactor) RedactJSON(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	value, ok := decodeJSON(text)
+	if !ok {
+		return r.Redact(text)
+	}
+	if encoded, ok := encodeJSON(r.redactValue(value)); ok {
+		return encoded
+	}
+	return r.Redact(text)
+}
+
+// redactValue redacts the strings of a decoded JSON value
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = r.redactValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+		return v
+	case string:
+		return r.redactString(v)
+	default:
+		return value
+	}
+}
+
+// redactString redacts a JSON string value. Embedded JSON is redacted as text
+// first, which keeps key context such as "password": "..."; if that breaks the
+// embedded document, its strings are redacted one by one instead.
+func (r *Redactor) redactString(text string) string {
+	redacted, counts := r.redact(text)
+	if redacted != text && !json.Valid([]byte(redacted)) {
+		if value, ok := decodeJSON(text); ok {
+			if encoded, ok := encodeJSON(r.redactValue(value)); ok {
+				return encoded
+			}
+		}
+	}
+	r.record(counts)
+	return redacted
+}
+
+// decodeJSON decodes a JSON object or array, keeping numbers exact
+func decodeJSON(text string) (interface{}, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return nil, false
+	}
+	return value, true
+}
+
+// encodeJSON encodes a value without HTML escaping or a trailing newline
+func encodeJSON(value interface{}) (string, bool) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// Counts returns the number of redactions per kind since the Redactor was created
+func (r *Redactor) Counts() map[string]int {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.counts))
+	for kind, n := range r.counts {
+		counts[kind] = n
+	}
+	return counts
+}
+
+// Total returns the total number of redactions
+func (r *Redactor) Total() int {
+	total := 0
+	for _, n := range r.Counts() {
+		total += n
+	}
+	return total
+}
+
+// Summary formats the counts as "KIND n" pairs sorted by kind
+func (r *Redactor) Summary() string {
+	counts := r.Counts()
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%s %d", kind, counts[kind])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// apply replaces all matches of a rule and returns how many it replaced
+func (r *Redactor) apply(rl *rule, text string) (string, int) {
+	matches := rl.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	var b strings.Builder
+	last := 0
+	replaced := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if rl.group > 0 {
+			if m[2*rl.group] < 0 {
+				continue
+			}
+			start, end = m[2*rl.group], m[2*rl.group+1]
+		}
+		value := text[start:end]
+		if strings.HasPrefix(value, placeholderPrefix) || start < last {
+			continue
+		}
+		if rl.literal && !(rl.quote > 0 && m[2*rl.quote] < m[2*rl.quote+1]) && !tokenLike(value) {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(r.placeholder(rl.kind, value))
+		last = end
+		replaced++
+	}
+	if replaced == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), replaced
+}
+
+// placeholder returns the replacement for a value, numbering values of each kind
+// in order of first appearance. Only a hash of the value is kept in memory.
+func (r *Redactor) placeholder(kind, value string) string {
+	key := sha256.Sum256([]byte(kind + "\x00" + value))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.ids[key]
+	if !ok {
+		r.next[kind]++
+		id = r.next[kind]
+		r.ids[key] = id
+	}
+	return placeholderPrefix + kind + "_" + strconv.Itoa(id) + "]"
+}
+
+// newRule compiles a built-in rule
+func newRule(kind, expr string) *rule {
+	re := regexp.MustCompile(expr)
+	return &rule{kind: kind, re: re, group: secretGroup(re)}
+}
+
+// newLiteralRule compiles a built-in rule whose unquoted values must look like a token.
+// Assignments in code such as token = get_token(user) or secret = cfg.Secret are kept.
+func newLiteralRule(kind, expr string) *rule {
+	rl := newRule(kind, expr)
+	rl.quote = rl.re.SubexpIndex("quote")
+	rl.literal = true
+	return rl
+}
+
+// tokenLike reports whether an unquoted value is a literal secret rather than
+// an identifier, a field access, a variable, a pointer or a function call
+func tokenLike(value string) bool {
+	if strings.ContainsAny(value, "()[]{}<>") || strings.ContainsAny(value[:1], "$%&*") {
+		return false
+	}
+
+	var letter, digit, symbol bool
+	for _, c := range value {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			letter = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c != '_' && c != '.' && c != '-':
+			symbol = true
+		}
+	}
+	if symbol {
+		return true
+	}
+	if !letter || !digit {
+		return false
+	}
+	// A dotted path of identifiers, e.g. cfg.Token2, is a field access
+	for _, part := range strings.Split(value, ".") {
+		if part == "" || (part[0] >= '0' && part[0] <= '9') || strings.Contains(part, "-") {
+			return true
+		}
+	}
+	return !strings.Contains(value, ".")
+}
+
+// secretGroup returns the index of the group named "secret", or 0
+func secretGroup(re *regexp.Regexp) int {
+	if i := re.SubexpIndex("secret"); i > 0 {
+		return i
+	}
+	return 0
+}
+
+// kindName normalizes a custom pattern name to an upper-case placeholder kind
+func kindName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(strings.TrimSpace(name)) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
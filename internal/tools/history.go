@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	v2 "github.com/hession/aimate/internal/memory/v2"
+)
+
+const defaultHistoryLimit = 10
+
+// HistorySearcher searches past session messages
+type HistorySearcher interface {
+	SearchHistory(query string, limit int) ([]*v2.SessionMessageHit, error)
+}
+
+// SearchHistoryTool searches messages from past conversations
+type SearchHistoryTool struct {
+	searcher HistorySearcher
+}
+
+// NewSearchHistoryTool creates a history search tool
+func NewSearchHistoryTool(searcher HistorySearcher) *SearchHistoryTool {
+	return &SearchHistoryTool{searcher: searcher}
+}
+
+func (t *SearchHistoryTool) Name() string {
+	return "search_history"
+}
+
+func (t *SearchHistoryTool) Description() string {
+	return "Full-text search over messages from past conversation sessions. Returns session ID, message number, time and a matching snippet."
+}
+
+func (t *SearchHistoryTool) Parameters() []ParameterDef {
+	return []ParameterDef{
+		{
+			Name:        "query",
+			Type:        "string",
+			Description: "Words to search for",
+			Required:    true,
+		},
+		{
+			Name:        "limit",
+			Type:        "number",
+			Description: "Maximum number of results (default 10)",
+			Required:    false,
+		},
+	}
+}
+
+func (t *SearchHistoryTool) Execute(args map[string]any) (string, error) {
+	query, ok := args["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("missing required parameter: query")
+	}
+
+	limit := defaultHistoryLimit
+	if val, ok := args["limit"].(float64); ok && val > 0 {
+		limit = int(val)
+	}
+
+	hits, err := t.searcher.SearchHistory(query, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to search history: %w", err)
+	}
+
+	if len(hits) == 0 {
+		return fmt.Sprintf("No past messages found for %q", query), nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Found %d messages:\n", len(hits)))
+	for _, hit := range hits {
+		builder.WriteString(fmt.Sprintf("- session %s #%d (%s, %s): %s\n",
+			hit.SessionID, hit.Sequence, hit.Role,
+			hit.Timestamp.Format("2006-01-02 15:04"), hit.Snippet))
+	}
+
+	return builder.String(), nil
+}
@@ -0,0 +1,314 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/hession/aimate/internal/memory/v2"
+)
+
+const (
+	defaultMemorySearchLimit = 5
+	memorySnippetLength      = 200
+)
+
+// MemoryStore reads and writes memories on behalf of the model
+type MemoryStore interface {
+	SaveMemory(ctx context.Context, memType v2.MemoryType, category v2.MemoryCategory, scope v2.MemoryScope, title, content string, tags []string) (*v2.Memory, error)
+	SearchMemoriesDetailed(ctx context.Context, query string, topK int) ([]*v2.MemorySearchResult, error)
+	GetMemory(id string) (*v2.Memory, error)
+	UpdateMemory(ctx context.Context, id, content string, tags []string) (*v2.Memory, error)
+	ForgetMemory(id string) (*v2.Memory, error)
+}
+
+// NewMemoryTools creates the memory_save, memory_search, memory_update and memory_forget tools
+func NewMemoryTools(store MemoryStore, confirmFunc func(command string) bool) []Tool {
+	return []Tool{
+		&MemorySaveTool{store: store, confirmFunc: confirmFunc},
+		&MemorySearchTool{store: store},
+		&MemoryUpdateTool{store: store, confirmFunc: confirmFunc},
+		&MemoryForgetTool{store: store, confirmFunc: confirmFunc},
+	}
+}
+
+// MemorySaveTool stores a new memory.
+// Core memories shape every later conversation, so saving one needs confirmation.
+type MemorySaveTool struct {
+	store       MemoryStore
+	confirmFunc func(command string) bool
+}
+
+func (t *MemorySaveTool) Name() string {
+	return "memory_save"
+}
+
+func (t *MemorySaveTool) Description() string {
+	return "Save information worth remembering across conversations. " +
+		"Types and categories: core (preference, rule, persona) for lasting user preferences and rules; " +
+		"short_term (task, note, context) for information relevant for a few days; " +
+		"long_term (project, knowledge, decision) for durable facts and decisions. " +
+		"Search first to avoid duplicates, and use memory_update to correct an existing memory."
+}
+
+func (t *MemorySaveTool) Parameters() []ParameterDef {
+	return []ParameterDef{
+		{
+			Name:        "type",
+			Type:        "string",
+			Description: "Memory type: core, short_term or long_term",
+			Required:    true,
+		},
+		{
+			Name:        "category",
+			Type:        "string",
+			Description: "Category matching the type, e.g. preference, task or decision",
+			Required:    true,
+		},
+		{
+			Name:        "title",
+			Type:        "string",
+			Description: "Short title",
+			Required:    true,
+		},
+		{
+			Name:        "content",
+			Type:        "string",
+			Description: "The information to remember, written so it makes sense without the conversation",
+			Required:    true,
+		},
+		{
+			Name:        "scope",
+			Type:        "string",
+			Description: "global (all projects) or project (current project only); defaults to the current project when inside one",
+			Required:    false,
+		},
+		{
+			Name:        "tags",
+			Type:        "string",
+			Description: "Comma-separated tags",
+			Required:    false,
+		},
+	}
+}
+
+func (t *MemorySaveTool) Execute(args map[string]any) (string, error) {
+	memType, _ := args["type"].(string)
+	category, _ := args["category"].(string)
+	title, _ := args["title"].(string)
+	content, _ := args["content"].(string)
+	if memType == "" || category == "" || strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("missing required parameter: type, category, title and content are required")
+	}
+	scope, _ := args["scope"].(string)
+	tagList, _ := args["tags"].(string)
+
+	if v2.MemoryType(memType) == v2.MemoryTypeCore && t.confirmFunc != nil &&
+		!t.confirmFunc(fmt.Sprintf("save core memory %q: %s", strings.TrimSpace(title), memorySnippet(content))) {
+		return "", fmt.Errorf("user cancelled core memory save")
+	}
+
+	mem, err := t.store.SaveMemory(context.Background(),
+		v2.MemoryType(memType), v2.MemoryCategory(category), v2.MemoryScope(scope),
+		strings.TrimSpace(title), strings.TrimSpace(content), splitTags(tagList))
+	if err != nil {
+		return "", fmt.Errorf("failed to save memory: %w", err)
+	}
+
+	return fmt.Sprintf("Saved memory %s (%s/%s): %s", mem.ID, mem.Type, mem.Category, mem.Title), nil
+}
+
+// MemorySearchTool searches stored memories
+type MemorySearchTool struct {
+	store MemoryStore
+}
+
+func (t *MemorySearchTool) Name() string {
+	return "memory_search"
+}
+
+func (t *MemorySearchTool) Description() string {
+	return "Search remembered information by meaning and keywords. Returns memory IDs that can be cited or passed to memory_update and memory_forget."
+}
+
+func (t *MemorySearchTool) Parameters() []ParameterDef {
+	return []ParameterDef{
+		{
+			Name:        "query",
+			Type:        "string",
+			Description: "What to look for",
+			Required:    true,
+		},
+		{
+			Name:        "limit",
+			Type:        "number",
+			Description: "Maximum number of results (default 5)",
+			Required:    false,
+		},
+	}
+}
+
+func (t *MemorySearchTool) Execute(args map[string]any) (string, error) {
+	query, ok := args["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("missing required parameter: query")
+	}
+
+	limit := defaultMemorySearchLimit
+	if val, ok := args["limit"].(float64); ok && val > 0 {
+		limit = int(val)
+	}
+
+	results, err := t.store.SearchMemoriesDetailed(context.Background(), query, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to search memories: %w", err)
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("No memories found for %q", query), nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Found %d memories:\n", len(results)))
+	for _, result := range results {
+		mem := result.Memory
+		builder.WriteString(fmt.Sprintf("- [%s] %s (%s/%s, score %.2f, updated %s): %s\n",
+			mem.ID, mem.Title, mem.Type, mem.Category, result.Score,
+			mem.UpdatedAt.Format("2006-01-02"), memorySnippet(mem.Content)))
+	}
+
+	return builder.String(), nil
+}
+
+// MemoryUpdateTool replaces the content of an existing memory
+type MemoryUpdateTool struct {
+	store       MemoryStore
+	confirmFunc func(command string) bool
+}
+
+func (t *MemoryUpdateTool) Name() string {
+	return "memory_update"
+}
+
+func (t *MemoryUpdateTool) Description() string {
+	return "Replace the content of an existing memory when it is outdated or wrong. Requires user confirmation."
+}
+
+func (t *MemoryUpdateTool) Parameters() []ParameterDef {
+	return []ParameterDef{
+		{
+			Name:        "id",
+			Type:        "string",
+			Description: "Memory ID from memory_search or the remembered context",
+			Required:    true,
+		},
+		{
+			Name:        "content",
+			Type:        "string",
+			Description: "The complete new content",
+			Required:    true,
+		},
+		{
+			Name:        "tags",
+			Type:        "string",
+			Description: "Comma-separated tags replacing the existing ones (omit to keep them)",
+			Required:    false,
+		},
+	}
+}
+
+func (t *MemoryUpdateTool) Execute(args map[string]any) (string, error) {
+	id, _ := args["id"].(string)
+	content, _ := args["content"].(string)
+	if id == "" || strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("missing required parameter: id and content are required")
+	}
+
+	mem, err := t.store.GetMemory(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to find memory: %w", err)
+	}
+
+	if t.confirmFunc != nil && !t.confirmFunc(fmt.Sprintf("update memory %q: %s", mem.Title, memorySnippet(content))) {
+		return "", fmt.Errorf("user cancelled memory update")
+	}
+
+	var tags []string
+	if tagList, ok := args["tags"].(string); ok {
+		tags = splitTags(tagList)
+	}
+
+	updated, err := t.store.UpdateMemory(context.Background(), id, strings.TrimSpace(content), tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to update memory: %w", err)
+	}
+
+	return fmt.Sprintf("Updated memory %s: %s", updated.ID, updated.Title), nil
+}
+
+// MemoryForgetTool deletes a memory
+type MemoryForgetTool struct {
+	store       MemoryStore
+	confirmFunc func(command string) bool
+}
+
+func (t *MemoryForgetTool) Name() string {
+	return "memory_forget"
+}
+
+func (t *MemoryForgetTool) Description() string {
+	return "Delete a memory that is wrong or that the user asked to forget. Requires user confirmation."
+}
+
+func (t *MemoryForgetTool) Parameters() []ParameterDef {
+	return []ParameterDef{
+		{
+			Name:        "id",
+			Type:        "string",
+			Description: "Memory ID from memory_search or the remembered context",
+			Required:    true,
+		},
+	}
+}
+
+func (t *MemoryForgetTool) Execute(args map[string]any) (string, error) {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return "", fmt.Errorf("missing required parameter: id")
+	}
+
+	mem, err := t.store.GetMemory(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to find memory: %w", err)
+	}
+
+	if t.confirmFunc != nil && !t.confirmFunc(fmt.Sprintf("forget memory %q: %s", mem.Title, memorySnippet(mem.Content))) {
+		return "", fmt.Errorf("user cancelled memory deletion")
+	}
+
+	if _, err := t.store.ForgetMemory(id); err != nil {
+		return "", fmt.Errorf("failed to forget memory: %w", err)
+	}
+
+	return fmt.Sprintf("Forgot memory %s: %s", mem.ID, mem.Title), nil
+}
+
+// splitTags parses a comma-separated tag list
+func splitTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// memorySnippet shortens memory content to a single line
+func memorySnippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if runes := []rune(content); len(runes) > memorySnippetLength {
+		return string(runes[:memorySnippetLength]) + "..."
+	}
+	return content
+}
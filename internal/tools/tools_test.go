@@ -1,10 +1,14 @@
 package tools
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	v2 "github.com/hession/aimate/internal/memory/v2"
 )
 
 func TestRegistry(t *testing.T) {
@@ -234,3 +238,163 @@ func TestGetSchemas(t *testing.T) {
 		}
 	}
 }
+
+type fakeHistorySearcher struct {
+	query string
+	limit int
+}
+
+func (f *fakeHistorySearcher) SearchHistory(query string, limit int) ([]*v2.SessionMessageHit, error) {
+	f.query = query
+	f.limit = limit
+	if query == "none" {
+		return nil, nil
+	}
+	return []*v2.SessionMessageHit{
+		{SessionID: "abc12345", Sequence: 3, Role: "user", Snippet: "use [sqlite] here", Timestamp: time.Now()},
+	}, nil
+}
+
+func TestSearchHistoryTool(t *testing.T) {
+	searcher := &fakeHistorySearcher{}
+	tool := NewSearchHistoryTool(searcher)
+
+	if tool.Name() != "search_history" {
+		t.Errorf("Tool name mismatch: expected search_history, got %s", tool.Name())
+	}
+
+	if _, err := tool.Execute(map[string]any{}); err == nil {
+		t.Error("Missing query should return error")
+	}
+
+	result, err := tool.Execute(map[string]any{"query": "sqlite", "limit": float64(3)})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if searcher.limit != 3 {
+		t.Errorf("Limit should be 3, got %d", searcher.limit)
+	}
+	if !strings.Contains(result, "abc12345 #3") || !strings.Contains(result, "[sqlite]") {
+		t.Errorf("Result should contain session and snippet, got: %s", result)
+	}
+
+	result, err = tool.Execute(map[string]any{"query": "none"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !strings.Contains(result, "No past messages") {
+		t.Errorf("Empty result message mismatch: %s", result)
+	}
+}
+
+type fakeMemoryStore struct {
+	memories map[string]*v2.Memory
+	saved    *v2.Memory
+}
+
+func (f *fakeMemoryStore) SaveMemory(ctx context.Context, memType v2.MemoryType, category v2.MemoryCategory, scope v2.MemoryScope, title, content string, tags []string) (*v2.Memory, error) {
+	f.saved = &v2.Memory{ID: "new-id", Type: memType, Category: category, Scope: scope, Title: title, Content: content, Tags: tags}
+	return f.saved, nil
+}
+
+func (f *fakeMemoryStore) SearchMemoriesDetailed(ctx context.Context, query string, topK int) ([]*v2.MemorySearchResult, error) {
+	var results []*v2.MemorySearchResult
+	for _, mem := range f.memories {
+		if strings.Contains(mem.Content, query) {
+			results = append(results, &v2.MemorySearchResult{Memory: mem, Score: 0.9})
+		}
+	}
+	return results, nil
+}
+
+func (f *fakeMemoryStore) GetMemory(id string) (*v2.Memory, error) {
+	mem, ok := f.memories[id]
+	if !ok {
+		return nil, v2.ErrMemoryNotFound
+	}
+	return mem, nil
+}
+
+func (f *fakeMemoryStore) UpdateMemory(ctx context.Context, id, content string, tags []string) (*v2.Memory, error) {
+	mem := f.memories[id]
+	mem.Content = content
+	if tags != nil {
+		mem.Tags = tags
+	}
+	return mem, nil
+}
+
+func (f *fakeMemoryStore) ForgetMemory(id string) (*v2.Memory, error) {
+	mem := f.memories[id]
+	delete(f.memories, id)
+	return mem, nil
+}
+
+func TestMemoryTools(t *testing.T) {
+	store := &fakeMemoryStore{memories: map[string]*v2.Memory{
+		"mem-1": {ID: "mem-1", Type: v2.MemoryTypeLongTerm, Category: v2.CategoryProject, Title: "Database", Content: "The project uses SQLite", UpdatedAt: time.Now()},
+	}}
+	confirmed := false
+	registry := NewRegistry()
+	for _, tool := range NewMemoryTools(store, func(string) bool { return confirmed }) {
+		if err := registry.Register(tool); err != nil {
+			t.Fatalf("Failed to register %s: %v", tool.Name(), err)
+		}
+	}
+
+	result, err := registry.Execute("memory_save", map[string]any{
+		"type": "long_term", "category": "decision", "title": "ORM", "content": "Use plain SQL", "tags": "db, sql",
+	})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if !strings.Contains(result, "new-id") || len(store.saved.Tags) != 2 || store.saved.Tags[1] != "sql" {
+		t.Errorf("Unexpected save result: %s %+v", result, store.saved)
+	}
+	if _, err := registry.Execute("memory_save", map[string]any{"type": "core"}); err == nil {
+		t.Error("Missing parameters should return error")
+	}
+	coreArgs := map[string]any{"type": "core", "category": "rule", "title": "Tests", "content": "Always run go test"}
+	if _, err := registry.Execute("memory_save", coreArgs); err == nil || store.saved.Title == "Tests" {
+		t.Error("Saving a core memory without confirmation should fail")
+	}
+
+	result, err = registry.Execute("memory_search", map[string]any{"query": "SQLite"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !strings.Contains(result, "[mem-1] Database") {
+		t.Errorf("Search result should cite memory ID, got: %s", result)
+	}
+
+	// Destructive operations require confirmation
+	if _, err := registry.Execute("memory_update", map[string]any{"id": "mem-1", "content": "The project uses Postgres"}); err == nil {
+		t.Error("Update without confirmation should fail")
+	}
+	if _, err := registry.Execute("memory_forget", map[string]any{"id": "mem-1"}); err == nil {
+		t.Error("Forget without confirmation should fail")
+	}
+	if store.memories["mem-1"].Content != "The project uses SQLite" {
+		t.Error("Memory should be unchanged after cancelled update")
+	}
+
+	confirmed = true
+	if _, err := registry.Execute("memory_save", coreArgs); err != nil || store.saved.Title != "Tests" {
+		t.Errorf("Confirmed core memory should be saved: %v", err)
+	}
+	if _, err := registry.Execute("memory_update", map[string]any{"id": "mem-1", "content": "The project uses Postgres"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if store.memories["mem-1"].Content != "The project uses Postgres" {
+		t.Errorf("Content not updated: %s", store.memories["mem-1"].Content)
+	}
+	if _, err := registry.Execute("memory_forget", map[string]any{"id": "mem-1"}); err != nil {
+		t.Fatalf("Forget failed: %v", err)
+	}
+	if _, ok := store.memories["mem-1"]; ok {
+		t.Error("Memory should be deleted")
+	}
+	if _, err := registry.Execute("memory_forget", map[string]any{"id": "missing"}); err == nil {
+		t.Error("Forgetting an unknown memory should fail")
+	}
+}